@@ -2,10 +2,41 @@ package main
 
 import (
 	"REST_project/config"
+	"REST_project/internal/blob"
+	"REST_project/internal/digest"
+	"REST_project/internal/export"
+	"REST_project/internal/handlers/account-handlers"
+	"REST_project/internal/handlers/attachment-handlers"
+	"REST_project/internal/handlers/audit-handlers"
+	"REST_project/internal/handlers/auth"
+	"REST_project/internal/handlers/calendar-handlers"
 	"REST_project/internal/handlers/create-handlers"
+	"REST_project/internal/handlers/export-handlers"
+	"REST_project/internal/handlers/feed-handlers"
+	"REST_project/internal/handlers/import-handlers"
+	"REST_project/internal/handlers/live-handlers"
 	"REST_project/internal/handlers/logger"
+	"REST_project/internal/handlers/member-handlers"
+	"REST_project/internal/handlers/participant-handlers"
+	"REST_project/internal/handlers/moderation-handlers"
+	"REST_project/internal/handlers/notification-handlers"
+	"REST_project/internal/handlers/qa-handlers"
+	"REST_project/internal/handlers/search-handlers"
+	"REST_project/internal/handlers/sso-handlers"
 	"REST_project/internal/handlers/register-handlers"
+	"REST_project/internal/handlers/webhook-handlers"
+	"REST_project/internal/live"
+	"REST_project/internal/mailer"
+	"REST_project/internal/metrics"
+	model "REST_project/internal/models"
+	"REST_project/internal/moderation"
+	"REST_project/internal/outbox"
+	"REST_project/internal/policy"
+	"REST_project/internal/ratelimit"
+	"REST_project/internal/sso"
 	"REST_project/internal/storage"
+	"REST_project/internal/webhook"
+	"REST_project/internal/webpush"
 	"context"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -14,6 +45,7 @@ import (
 	"os"
 	"github.com/rs/cors"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -43,6 +75,9 @@ func main() {
 		slog.String("version", "0.0.1"),
 	)
 	cfg := config.MustLoad()
+	if cfg.DBConf.MaxIdleConns != 0 {
+		log.Warn("database.maxIdleConns (DB_MAX_IDLE_CONNS) is deprecated: it now sets the minimum pool size, use minIdleConns (DB_MIN_IDLE_CONNS)")
+	}
 	db, err := storage.New(cfg.DBConf)
 	if err != nil {
 		log.Error("failed to init storage", slog.Attr{
@@ -51,6 +86,7 @@ func main() {
 		})
 		os.Exit(1)
 	}
+	defer db.Close()
 	if err = storage.RunMigrations(db.DB); err != nil {
 		log.Error("failed to make migrations", slog.Attr{
 			Key:   "error",
@@ -58,6 +94,86 @@ func main() {
 		})
 	}
 
+	blobStore, err := blob.New(cfg.UploadConf)
+	if err != nil {
+		log.Error("failed to init blob store", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	mail, err := mailer.New(cfg.MailConf, log)
+	if err != nil {
+		log.Error("failed to init mailer", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	moderator := moderation.New(db, cfg.ModConf)
+
+	exporter := export.New(log, db, blobStore, cfg.ExportConf)
+	if err = exporter.Recover(context.Background()); err != nil {
+		log.Error("failed to recover exports", slog.String("error", err.Error()))
+	}
+	pol := policy.New(db)
+
+	// шина доменных событий, рассылка вебхуков, писем и push-уведомлений работают до остановки сервера
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	bus := outbox.New(log, db, cfg.OutboxConf)
+	bus.Subscribe("webhooks", db.EnqueueWebhooks, model.WebhookEventTypes...)
+	bus.Subscribe("notifications", db.InitNotificationPreferences, model.ParticipantRegistered)
+	bus.Subscribe("push", db.EnqueuePushes, model.PostCreated)
+	signer := digest.NewSigner(log, cfg.DigestConf.Secret)
+	pushKeys, err := webpush.NewKeys(log, cfg.PushConf.VAPIDPrivateKey)
+	if err != nil {
+		log.Error("failed to init push keys", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	background.Add(4)
+	go func() {
+		defer background.Done()
+		if err := bus.Run(bgCtx); err != nil {
+			log.Error("failed to run outbox", slog.String("error", err.Error()))
+		}
+	}()
+	go func() {
+		defer background.Done()
+		webhook.New(log, db, cfg.HookConf).Run(bgCtx)
+	}()
+	go func() {
+		defer background.Done()
+		digest.New(log, db, mail, signer, cfg.DigestConf).Run(bgCtx)
+	}()
+	go func() {
+		defer background.Done()
+		webpush.New(log, db, pushKeys, cfg.PushConf).Run(bgCtx)
+	}()
+
+	// счетчики ограничителя запросов: в памяти сервера или общие в базе
+	var rateStore ratelimit.Store
+	switch cfg.RateConf.Store {
+	case "memory", "":
+		rateStore = ratelimit.NewMemory()
+	case "postgres":
+		rateStore = db
+	default:
+		log.Error("unknown rate limit store", slog.String("store", cfg.RateConf.Store))
+		os.Exit(1)
+	}
+	limiter := ratelimit.New(log, rateStore, cfg.RateConf)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		limiter.Run(bgCtx)
+	}()
+
+	// живые обновления: каждый сервер слушает уведомления базы и рассылает их своим клиентам
+	hub := live.New(log, db, cfg.LiveConf)
+	liveCtx, stopLive := context.WithCancel(context.Background())
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		hub.Run(liveCtx)
+	}()
+
 	corsMiddleware := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
@@ -70,26 +186,147 @@ func main() {
 	router.Use(middleware.Logger)
 	router.Use(logger.New(log))
 	router.Use(middleware.Recoverer)
+	// отменяет контекст запроса, а с ним и запросы к базе, по истечении таймаута сервера.
+	// Потоки живых обновлений открыты, пока клиент не уйдет, и таймаута не получают,
+	// а загрузкам файлов импорта и вложений и скачиванию выгрузок срок задают сами обработчики
+	router.Use(middleware.Maybe(middleware.Timeout(cfg.ServConf.Timeout), func(r *http.Request) bool {
+		return !live_handlers.IsStream(r) && !import_handlers.IsImport(r) && !attachment_handlers.IsUpload(r) &&
+			!export_handlers.IsDownload(r)
+	}))
 	router.Use(middleware.URLFormat)
 	router.Use(corsMiddleware.Handler)
+	router.Use(auth.New(log, db))
+
+	// Метрики процесса и пула соединений с базой
+	router.Handle("/metrics", metrics.Handler(metrics.New(db, cfg.DBConf.DBName)))
 
 	// Маршруты регистрации
 	router.Route("/register", func(r chi.Router) {
+		r.Use(limiter.Limit("register", cfg.RateConf.Register))
 		r.Post("/enterprise", register_handlers.RegisterEnterprise(log, db))
 		r.Get("/enterprise", register_handlers.GetEnterprises(log, db))
-		r.Post("/event", register_handlers.RegisterEvent(log, db))
+		r.Post("/event", register_handlers.RegisterEvent(log, db, pol))
 		r.Get("/event", register_handlers.GetEvents(log, db)) 
-		r.Post("/user", register_handlers.RegisterUser(log, db))
+		r.Post("/user", register_handlers.RegisterUser(log, db, cfg.LoginConf))
 		r.Get("/user", register_handlers.GetUsers(log, db))
+		r.Post("/account", account_handlers.RegisterAccount(log, db))
+	})
+
+	// Вход организаторов через OIDC
+	if cfg.OIDCConf.Enabled {
+		ssoClient := sso.New(cfg.OIDCConf)
+		router.Route("/auth/oidc", func(r chi.Router) {
+			r.Get("/login", sso_handlers.Login(log, db, ssoClient, cfg.OIDCConf))
+			r.Get("/callback", sso_handlers.Callback(log, db, ssoClient, cfg.OIDCConf))
+		})
+	}
+	router.Post("/auth/logout", sso_handlers.Logout(log, db))
+
+	// Вход участников по ссылке из письма
+	router.Route("/participants", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(limiter.Limit("login", cfg.RateConf.Login))
+			r.Post("/login", participant_handlers.RequestLoginLink(log, db, mail, cfg.LoginConf))
+			r.Post("/login/verify", participant_handlers.VerifyLoginLink(log, db, cfg.LoginConf))
+		})
+		r.Post("/logout", participant_handlers.Logout(log, db))
+		r.Get("/me", participant_handlers.Me(log))
+		r.Get("/me/notifications", notification_handlers.GetPreferences(log, db))
+		r.Put("/me/notifications", notification_handlers.SetPreferences(log, db))
+		r.Get("/me/push-subscriptions", notification_handlers.GetPushSubscriptions(log, db))
+		r.Post("/me/push-subscriptions", notification_handlers.CreatePushSubscription(log, db, cfg.PushConf))
+		r.Delete("/me/push-subscriptions/{subscriptionID}", notification_handlers.DeletePushSubscription(log, db))
+	})
+
+	// Отписка от писем по ссылке из письма, без входа
+	router.Get("/notifications/unsubscribe", notification_handlers.UnsubscribePage(log, signer))
+	router.Post("/notifications/unsubscribe", notification_handlers.Unsubscribe(log, db, signer))
+	// Открытый ключ VAPID для подписки браузера на push-уведомления
+	router.Get("/notifications/push-key", notification_handlers.PushKey(pushKeys))
+
+	// Маршруты текущего аккаунта
+	router.Route("/account", func(r chi.Router) {
+		r.Get("/", account_handlers.GetAccount(log, db))
+		r.Post("/keys", account_handlers.CreateKey(log, db))
+		r.Delete("/keys/{keyID}", account_handlers.RevokeKey(log, db))
 	})
 
 
 	// Маршруты для работы с постами и комментариями
 	router.Route("/api", func(r chi.Router) {
-		r.Post("/posts", create_handlers.CreatePost(log, db))
+		r.Use(limiter.Limit("api", cfg.RateConf.API))
+		r.Post("/posts", create_handlers.CreatePost(log, db, pol))
 		r.Get("/posts", create_handlers.GetPosts(log, db)) 
-		r.Post("/comments", create_handlers.CreateComment(log, db))
+		r.With(limiter.Limit("comments", cfg.RateConf.Comments)).Post("/comments", create_handlers.CreateComment(log, db, moderator))
 		r.Get("/comments", create_handlers.GetComments(log, db)) 
+		r.Post("/posts/{id}/votes", create_handlers.Vote(log, db))
+		r.Get("/posts/{id}/poll", create_handlers.GetPoll(log, db))
+		r.Post("/posts/{id}/attachments", attachment_handlers.UploadAttachment(log, db, blobStore, cfg.UploadConf, pol))
+		r.Get("/posts/{id}/attachments", attachment_handlers.GetAttachments(log, db))
+		r.Get("/attachments/{id}", attachment_handlers.DownloadAttachment(log, db, blobStore))
+		r.Get("/attachments/{id}/variants/{width}", attachment_handlers.DownloadAttachmentVariant(log, db, blobStore))
+	})
+
+	// Маршруты внутри конкретного мероприятия
+	router.Route("/events/{id}", func(r chi.Router) {
+		// действия участников
+		r.Group(func(r chi.Router) {
+			r.Use(limiter.Limit("events", cfg.RateConf.Events))
+			r.Post("/questions", qa_handlers.CreateQuestion(log, db))
+			r.Post("/questions/{questionID}/votes", qa_handlers.UpvoteQuestion(log, db))
+			r.Delete("/questions/{questionID}/votes", qa_handlers.RemoveQuestionVote(log, db))
+			r.Post("/comments/{commentID}/reports", moderation_handlers.ReportComment(log, db))
+		})
+		r.Get("/questions", qa_handlers.GetQuestions(log, db))
+		r.Get("/questions/moderation", qa_handlers.GetModerationQuestions(log, db, pol))
+		r.Put("/questions/{questionID}/status", qa_handlers.SetQuestionStatus(log, db, pol))
+		r.Get("/search", search_handlers.Search(log, db))
+		r.Get("/moderation/queue", moderation_handlers.GetQueue(log, db, pol))
+		r.Post("/comments/{commentID}/approve", moderation_handlers.ApproveComment(log, db, pol))
+		r.Post("/comments/{commentID}/reject", moderation_handlers.RejectComment(log, db, pol))
+		r.Put("/premoderation", moderation_handlers.SetPremoderation(log, db, pol))
+		r.Get("/reports", moderation_handlers.GetReports(log, db, pol))
+		r.Put("/reports/{reportID}", moderation_handlers.ResolveReport(log, db, pol))
+		r.Post("/sanctions", moderation_handlers.CreateSanction(log, db, pol))
+		r.Get("/sanctions", moderation_handlers.GetSanctions(log, db, pol))
+		r.Delete("/sanctions/{sanctionID}", moderation_handlers.RevokeSanction(log, db, pol))
+		r.Get("/moderation/log", moderation_handlers.GetLog(log, db, pol))
+		r.Post("/participants/{participantID}/session", participant_handlers.OpenSession(log, db, pol, cfg.LoginConf))
+		r.Post("/participants/import", import_handlers.ImportParticipants(log, db, pol, cfg.ImportConf))
+		r.Get("/export", export_handlers.ExportEvent(log, exporter, pol))
+		r.Post("/exports", export_handlers.StartExport(log, exporter, pol))
+		r.Get("/exports", export_handlers.GetExports(log, db, pol))
+		r.Get("/exports/{jobID}", export_handlers.GetExport(log, db, pol))
+		r.Get("/exports/{jobID}/download", export_handlers.DownloadExport(log, db, blobStore, pol, cfg.ExportConf))
+		r.Put("/schedule", register_handlers.SetEventSchedule(log, db, pol))
+		// /events/{id}/calendar.ics, расширение снимает middleware.URLFormat
+		r.Get("/calendar", calendar_handlers.EventCalendar(log, db, cfg.CalConf))
+		// /events/{id}/feed.atom и /events/{id}/feed.rss
+		r.Get("/feed", feed_handlers.EventFeed(log, db, cfg.FeedConf))
+		r.Get("/live", live_handlers.EventStream(log, db, hub, cfg.LiveConf))
+	})
+
+	// Маршруты внутри конкретного предприятия
+	router.Route("/enterprises/{id}", func(r chi.Router) {
+		r.Get("/moderation/rules", moderation_handlers.GetRules(log, db, pol))
+		r.Post("/moderation/rules", moderation_handlers.CreateRule(log, db, pol))
+		r.Delete("/moderation/rules/{ruleID}", moderation_handlers.DeleteRule(log, db, pol))
+		r.Get("/members", member_handlers.GetMembers(log, db, pol))
+		r.Post("/members", member_handlers.AddMember(log, db, pol))
+		r.Put("/members/{accountID}", member_handlers.SetMemberRole(log, db, pol))
+		r.Delete("/members/{accountID}", member_handlers.RemoveMember(log, db, pol))
+		r.Get("/sso/groups", member_handlers.GetGroupMappings(log, db, pol))
+		r.Post("/sso/groups", member_handlers.CreateGroupMapping(log, db, pol))
+		r.Delete("/sso/groups/{mappingID}", member_handlers.DeleteGroupMapping(log, db, pol))
+		r.Get("/audit", audit_handlers.GetLog(log, db, pol))
+		// /enterprises/{id}/calendar.ics - лента для подписки в календаре
+		r.Get("/calendar", calendar_handlers.EnterpriseCalendar(log, db, cfg.CalConf))
+		r.Post("/webhooks", webhook_handlers.CreateWebhook(log, db, pol))
+		r.Get("/webhooks", webhook_handlers.GetWebhooks(log, db, pol))
+		r.Put("/webhooks/{webhookID}", webhook_handlers.UpdateWebhook(log, db, pol))
+		r.Delete("/webhooks/{webhookID}", webhook_handlers.DeleteWebhook(log, db, pol))
+		r.Get("/webhooks/{webhookID}/deliveries", webhook_handlers.GetDeliveries(log, db, pol))
+		r.Post("/webhooks/{webhookID}/deliveries/{deliveryID}/retry", webhook_handlers.RetryDelivery(log, db, pol))
 	})
 
 	// Health check endpoint
@@ -111,6 +348,9 @@ func main() {
 		IdleTimeout:  cfg.ServConf.Timeout * 3,
 	}
 
+	// открытые потоки не дают Shutdown дождаться простоя соединений, поэтому hub закрывает их сразу
+	srv.RegisterOnShutdown(stopLive)
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil {
 			log.Error("failed to start server")
@@ -133,6 +373,22 @@ func main() {
 		})
 		return
 	}
+	// начатые выгрузки дописываются, пока не истечет таймаут остановки
+	if err := exporter.Wait(ctx); err != nil {
+		log.Error("exports did not finish before shutdown", slog.String("error", err.Error()))
+	}
+	// начатые отправки вебхуков, писем и уведомлений дописываются, новые события и доставки не забираются
+	stopBackground()
+	backgroundDone := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(backgroundDone)
+	}()
+	select {
+	case <-backgroundDone:
+	case <-ctx.Done():
+		log.Error("background workers did not finish before shutdown")
+	}
 	log.Info("gracefully stopped")
 }
 
@@ -8,8 +8,23 @@ import (
 )
 
 type Config struct {
-	ServConf ServerCfg   `yaml:"server"`
-	DBConf   DatabaseCfg `yaml:"database"`
+	ServConf   ServerCfg     `yaml:"server"`
+	DBConf     DatabaseCfg   `yaml:"database"`
+	UploadConf UploadCfg     `yaml:"uploads"`
+	ModConf    ModerationCfg `yaml:"moderation"`
+	OIDCConf   OIDCCfg       `yaml:"oidc"`
+	MailConf   MailCfg       `yaml:"mail"`
+	LoginConf  LoginCfg      `yaml:"participantLogin"`
+	ImportConf ImportCfg     `yaml:"import"`
+	ExportConf ExportCfg     `yaml:"export"`
+	CalConf    CalendarCfg   `yaml:"calendar"`
+	FeedConf   FeedCfg       `yaml:"feed"`
+	HookConf   WebhookCfg    `yaml:"webhooks"`
+	OutboxConf OutboxCfg     `yaml:"outbox"`
+	LiveConf   LiveCfg       `yaml:"live"`
+	DigestConf DigestCfg     `yaml:"digest"`
+	PushConf   PushCfg       `yaml:"push"`
+	RateConf   RateLimitCfg  `yaml:"rateLimit"`
 }
 
 type ServerCfg struct {
@@ -24,6 +39,212 @@ type DatabaseCfg struct {
 	Password string `yaml:"password" env:"DB_PASSWORD" env-default:"1234"`
 	DBName   string `yaml:"dbname" env:"DB_NAME" env-default:"postgres"`
 	Host     string `yaml:"host" env:"DB_HOST" env-default:"localhost"`
+	// Isolation - уровень изоляции транзакций WithTx: read committed, repeatable read или serializable
+	Isolation string `yaml:"isolation" env:"DB_ISOLATION" env-default:"read committed"`
+	// TxRetries - сколько раз WithTx повторяет транзакцию после ошибки сериализации или взаимной блокировки
+	TxRetries int `yaml:"txRetries" env:"DB_TX_RETRIES" env-default:"3"`
+	// QueryTimeout - предельное время одного обращения к хранилищу, 0 - без ограничения
+	QueryTimeout time.Duration `yaml:"queryTimeout" env:"DB_QUERY_TIMEOUT" env-default:"5s"`
+	// Настройки пула соединений pgx, 0 - значение pgx по умолчанию.
+	// MinIdleConns - сколько простаивающих соединений пул держит открытыми заранее
+	MaxOpenConns    int           `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS" env-default:"25"`
+	MinIdleConns    int           `yaml:"minIdleConns" env:"DB_MIN_IDLE_CONNS" env-default:"2"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME" env-default:"30m"`
+	ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime" env:"DB_CONN_MAX_IDLE_TIME" env-default:"5m"`
+	// MaxIdleConns устарел: у пула pgx нет верхней границы простаивающих соединений. Пока он задан,
+	// пул держит открытыми не меньше стольких соединений (MinConns pgx), вместо него - MinIdleConns
+	MaxIdleConns int `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS"`
+	// StmtCacheSize - сколько разных запросов каждое соединение держит подготовленными, 0 - не готовить
+	StmtCacheSize int `yaml:"stmtCacheSize" env:"DB_STMT_CACHE_SIZE" env-default:"256"`
+}
+
+type UploadCfg struct {
+	Backend         string   `yaml:"backend" env:"UPLOAD_BACKEND" env-default:"fs"`
+	Dir             string   `yaml:"dir" env:"UPLOAD_DIR" env-default:"uploads"`
+	Bucket          string   `yaml:"bucket" env:"UPLOAD_BUCKET" env-default:"attachments"`
+	MaxSize         int64    `yaml:"maxSize" env:"UPLOAD_MAX_SIZE" env-default:"10485760"`
+	AllowedTypes    []string `yaml:"allowedTypes" env:"UPLOAD_ALLOWED_TYPES" env-default:"application/pdf,image/jpeg,image/png,image/gif,image/webp"`
+	ThumbnailWidths []int    `yaml:"thumbnailWidths" env:"UPLOAD_THUMBNAIL_WIDTHS" env-default:"160,480,1080"`
+	// Timeout - срок загрузки вложения вместо общего таймаута сервера
+	Timeout time.Duration `yaml:"timeout" env:"UPLOAD_TIMEOUT" env-default:"5m"`
+}
+
+type ModerationCfg struct {
+	MaxLinks        int           `yaml:"maxLinks" env:"MODERATION_MAX_LINKS" env-default:"2"`
+	FloodLimit      int           `yaml:"floodLimit" env:"MODERATION_FLOOD_LIMIT" env-default:"5"`
+	FloodWindow     time.Duration `yaml:"floodWindow" env:"MODERATION_FLOOD_WINDOW" env-default:"1m"`
+	DuplicateWindow time.Duration `yaml:"duplicateWindow" env:"MODERATION_DUPLICATE_WINDOW" env-default:"10m"`
+}
+
+// OIDCCfg - вход организаторов через корпоративный провайдер OpenID Connect.
+// DiscoveryURL - адрес издателя, к нему добавляется /.well-known/openid-configuration
+type OIDCCfg struct {
+	Enabled      bool          `yaml:"enabled" env:"OIDC_ENABLED" env-default:"false"`
+	DiscoveryURL string        `yaml:"discoveryURL" env:"OIDC_DISCOVERY_URL"`
+	ClientID     string        `yaml:"clientID" env:"OIDC_CLIENT_ID"`
+	ClientSecret string        `yaml:"clientSecret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL  string        `yaml:"redirectURL" env:"OIDC_REDIRECT_URL" env-default:"http://localhost:50051/auth/oidc/callback"`
+	Scopes       []string      `yaml:"scopes" env:"OIDC_SCOPES" env-default:"openid,profile,email"`
+	GroupsClaim  string        `yaml:"groupsClaim" env:"OIDC_GROUPS_CLAIM" env-default:"groups"`
+	StateTTL     time.Duration `yaml:"stateTTL" env:"OIDC_STATE_TTL" env-default:"10m"`
+	SessionTTL   time.Duration `yaml:"sessionTTL" env:"OIDC_SESSION_TTL" env-default:"24h"`
+}
+
+// MailCfg - отправка писем. Backend: smtp, file (письма .eml в Dir) или log (письма в лог)
+type MailCfg struct {
+	Backend      string `yaml:"backend" env:"MAIL_BACKEND" env-default:"log"`
+	From         string `yaml:"from" env:"MAIL_FROM" env-default:"events@localhost"`
+	SMTPHost     string `yaml:"smtpHost" env:"MAIL_SMTP_HOST" env-default:"localhost"`
+	SMTPPort     string `yaml:"smtpPort" env:"MAIL_SMTP_PORT" env-default:"587"`
+	SMTPUser     string `yaml:"smtpUser" env:"MAIL_SMTP_USER"`
+	SMTPPassword string `yaml:"smtpPassword" env:"MAIL_SMTP_PASSWORD"`
+	Dir          string `yaml:"dir" env:"MAIL_DIR" env-default:"mail"`
+}
+
+// LoginCfg - вход участников по ссылке из письма. К LinkURL добавляется ?token=
+type LoginCfg struct {
+	LinkURL    string        `yaml:"linkURL" env:"LOGIN_LINK_URL" env-default:"http://localhost:3000/login"`
+	TokenTTL   time.Duration `yaml:"tokenTTL" env:"LOGIN_TOKEN_TTL" env-default:"15m"`
+	SessionTTL time.Duration `yaml:"sessionTTL" env:"LOGIN_SESSION_TTL" env-default:"720h"`
+}
+
+// ImportCfg - массовый импорт участников. MaxSize - предел размера файла в байтах,
+// MaxErrors - сколько ошибок строк попадает в отчет, остальные только считаются.
+// Timeout - срок запроса импорта вместо общего таймаута сервера: файл до MaxSize за него не успеть
+type ImportCfg struct {
+	MaxSize   int64         `yaml:"maxSize" env:"IMPORT_MAX_SIZE" env-default:"52428800"`
+	MaxErrors int           `yaml:"maxErrors" env:"IMPORT_MAX_ERRORS" env-default:"1000"`
+	Timeout   time.Duration `yaml:"timeout" env:"IMPORT_TIMEOUT" env-default:"10m"`
+}
+
+// ExportCfg - фоновые выгрузки событий. Workers - сколько выгрузок идет одновременно,
+// Timeout - предел времени одной выгрузки, DownloadTimeout - срок скачивания готового архива
+// вместо общего таймаута сервера
+type ExportCfg struct {
+	Workers         int           `yaml:"workers" env:"EXPORT_WORKERS" env-default:"2"`
+	Timeout         time.Duration `yaml:"timeout" env:"EXPORT_TIMEOUT" env-default:"30m"`
+	DownloadTimeout time.Duration `yaml:"downloadTimeout" env:"EXPORT_DOWNLOAD_TIMEOUT" env-default:"30m"`
+}
+
+// CalendarCfg - ленты iCalendar. Domain - правая часть UID событий, после запуска ее менять нельзя,
+// Refresh - как часто подписанные календари перезапрашивают ленту
+type CalendarCfg struct {
+	Domain  string        `yaml:"domain" env:"CALENDAR_DOMAIN" env-default:"events.localhost"`
+	Refresh time.Duration `yaml:"refresh" env:"CALENDAR_REFRESH" env-default:"1h"`
+}
+
+// FeedCfg - ленты Atom и RSS. BaseURL - внешний адрес API для ссылок в лентах,
+// SiteURL - адрес сайта, на котором открывается событие, Limit - сколько последних постов попадает в ленту
+type FeedCfg struct {
+	BaseURL string `yaml:"baseURL" env:"FEED_BASE_URL" env-default:"http://localhost:50051"`
+	SiteURL string `yaml:"siteURL" env:"FEED_SITE_URL" env-default:"http://localhost:3000"`
+	Limit   int    `yaml:"limit" env:"FEED_LIMIT" env-default:"50"`
+}
+
+// WebhookCfg - рассылка вебхуков. Рассылка раз в PollInterval забирает до BatchSize доставок
+// и отправляет их в Workers потоков. Неудачная доставка повторяется через BackoffBase, 2*BackoffBase...
+// но не реже BackoffMax, после MaxAttempts попыток она считается мертвой. AllowPrivate разрешает
+// адреса в локальной сети, по умолчанию они запрещены, чтобы вебхук не стучался во внутренние сервисы.
+// Доставки старше Retention удаляются
+type WebhookCfg struct {
+	Workers      int           `yaml:"workers" env:"WEBHOOK_WORKERS" env-default:"4"`
+	BatchSize    int           `yaml:"batchSize" env:"WEBHOOK_BATCH_SIZE" env-default:"20"`
+	PollInterval time.Duration `yaml:"pollInterval" env:"WEBHOOK_POLL_INTERVAL" env-default:"2s"`
+	Timeout      time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT" env-default:"10s"`
+	MaxAttempts  int           `yaml:"maxAttempts" env:"WEBHOOK_MAX_ATTEMPTS" env-default:"10"`
+	BackoffBase  time.Duration `yaml:"backoffBase" env:"WEBHOOK_BACKOFF_BASE" env-default:"30s"`
+	BackoffMax   time.Duration `yaml:"backoffMax" env:"WEBHOOK_BACKOFF_MAX" env-default:"6h"`
+	AllowPrivate bool          `yaml:"allowPrivate" env:"WEBHOOK_ALLOW_PRIVATE" env-default:"false"`
+	Retention    time.Duration `yaml:"retention" env:"WEBHOOK_RETENTION" env-default:"720h"`
+}
+
+// OutboxCfg - рассылка доменных событий подписчикам. Каждый подписчик раз в PollInterval забирает
+// до BatchSize событий и держит их за собой Lease, на обработку одного события дается HandlerTimeout.
+// После неудачи подписчик ждет BackoffBase, 2*BackoffBase... но не дольше BackoffMax. Событие,
+// которое подписчик не обработал за MaxAttempts попыток, уходит в domain_event_dead_letters.
+// События старше Retention, которые прошли все подписчики, удаляются
+type OutboxCfg struct {
+	PollInterval   time.Duration `yaml:"pollInterval" env:"OUTBOX_POLL_INTERVAL" env-default:"1s"`
+	BatchSize      int           `yaml:"batchSize" env:"OUTBOX_BATCH_SIZE" env-default:"100"`
+	Lease          time.Duration `yaml:"lease" env:"OUTBOX_LEASE" env-default:"1m"`
+	HandlerTimeout time.Duration `yaml:"handlerTimeout" env:"OUTBOX_HANDLER_TIMEOUT" env-default:"30s"`
+	MaxAttempts    int           `yaml:"maxAttempts" env:"OUTBOX_MAX_ATTEMPTS" env-default:"10"`
+	BackoffBase    time.Duration `yaml:"backoffBase" env:"OUTBOX_BACKOFF_BASE" env-default:"1s"`
+	BackoffMax     time.Duration `yaml:"backoffMax" env:"OUTBOX_BACKOFF_MAX" env-default:"10m"`
+	Retention      time.Duration `yaml:"retention" env:"OUTBOX_RETENTION" env-default:"168h"`
+}
+
+// LiveCfg - живые обновления событий. Каждый сервер слушает уведомления Postgres и рассылает
+// их своим клиентам: Buffer - сколько сообщений ждет медленный клиент, прежде чем его отключат,
+// Heartbeat - как часто поток шлет комментарий, чтобы прокси не закрыли соединение.
+// После обрыва соединения с базой сервер переподключается через ReconnectMin, 2*ReconnectMin...
+// но не реже ReconnectMax и досылает до CatchUpLimit событий, пропущенных за время обрыва
+type LiveCfg struct {
+	Heartbeat    time.Duration `yaml:"heartbeat" env:"LIVE_HEARTBEAT" env-default:"25s"`
+	Buffer       int           `yaml:"buffer" env:"LIVE_BUFFER" env-default:"64"`
+	ReconnectMin time.Duration `yaml:"reconnectMin" env:"LIVE_RECONNECT_MIN" env-default:"1s"`
+	ReconnectMax time.Duration `yaml:"reconnectMax" env:"LIVE_RECONNECT_MAX" env-default:"30s"`
+	CatchUpLimit int           `yaml:"catchUpLimit" env:"LIVE_CATCH_UP_LIMIT" env-default:"1000"`
+}
+
+// DigestCfg - письма участникам о новых постах. Раз в Interval рассылка забирает до BatchSize
+// участников, которым пора писать, и держит их за собой Lease. В письмо попадает до MaxPosts постов.
+// BaseURL - адрес API для ссылки отписки, SiteURL - адрес сайта для ссылки на событие.
+// Secret подписывает ссылки отписки: без него ключ создается при запуске и старые ссылки перестают работать
+type DigestCfg struct {
+	Interval  time.Duration `yaml:"interval" env:"DIGEST_INTERVAL" env-default:"1m"`
+	BatchSize int           `yaml:"batchSize" env:"DIGEST_BATCH_SIZE" env-default:"50"`
+	Lease     time.Duration `yaml:"lease" env:"DIGEST_LEASE" env-default:"10m"`
+	MaxPosts  int           `yaml:"maxPosts" env:"DIGEST_MAX_POSTS" env-default:"20"`
+	BaseURL   string        `yaml:"baseURL" env:"DIGEST_BASE_URL" env-default:"http://localhost:50051"`
+	SiteURL   string        `yaml:"siteURL" env:"DIGEST_SITE_URL" env-default:"http://localhost:3000"`
+	Secret    string        `yaml:"secret" env:"DIGEST_SECRET"`
+}
+
+// PushCfg - уведомления Web Push. Раз в PollInterval рассылка забирает до BatchSize отправок
+// и отправляет их в Workers потоков. Неудачная отправка повторяется через BackoffBase, 2*BackoffBase...
+// но не реже BackoffMax, не больше MaxAttempts попыток. TTL - сколько push-сервис хранит уведомление
+// для выключенного устройства, отправки старше TTL удаляются. VAPIDPrivateKey - закрытый ключ P-256
+// в base64url, без него ключ создается при запуске и подписки браузеров перестают работать после
+// перезапуска. Subject - контакт для push-сервиса, mailto: или https:. AllowPrivate разрешает
+// адреса http и в локальной сети, например для локальной заглушки push-сервиса
+type PushCfg struct {
+	VAPIDPrivateKey string        `yaml:"vapidPrivateKey" env:"PUSH_VAPID_PRIVATE_KEY"`
+	Subject         string        `yaml:"subject" env:"PUSH_SUBJECT" env-default:"mailto:events@localhost"`
+	Workers         int           `yaml:"workers" env:"PUSH_WORKERS" env-default:"8"`
+	BatchSize       int           `yaml:"batchSize" env:"PUSH_BATCH_SIZE" env-default:"100"`
+	PollInterval    time.Duration `yaml:"pollInterval" env:"PUSH_POLL_INTERVAL" env-default:"2s"`
+	Timeout         time.Duration `yaml:"timeout" env:"PUSH_TIMEOUT" env-default:"10s"`
+	MaxAttempts     int           `yaml:"maxAttempts" env:"PUSH_MAX_ATTEMPTS" env-default:"5"`
+	BackoffBase     time.Duration `yaml:"backoffBase" env:"PUSH_BACKOFF_BASE" env-default:"10s"`
+	BackoffMax      time.Duration `yaml:"backoffMax" env:"PUSH_BACKOFF_MAX" env-default:"10m"`
+	TTL             time.Duration `yaml:"ttl" env:"PUSH_TTL" env-default:"24h"`
+	AllowPrivate    bool          `yaml:"allowPrivate" env:"PUSH_ALLOW_PRIVATE" env-default:"false"`
+}
+
+// RateLimitCfg - ограничение частоты запросов. Store: memory (счетчики в памяти сервера) или
+// postgres (общие для всех серверов). Лимиты заданы для групп маршрутов /register и /api, для входа
+// участников и их действий в событиях и отдельно для отправки комментариев.
+// Корзины, которые успели наполниться, удаляются раз в PurgeInterval
+type RateLimitCfg struct {
+	Enabled       bool          `yaml:"enabled" env:"RATE_LIMIT_ENABLED" env-default:"true"`
+	Store         string        `yaml:"store" env:"RATE_LIMIT_STORE" env-default:"memory"`
+	PurgeInterval time.Duration `yaml:"purgeInterval" env:"RATE_LIMIT_PURGE_INTERVAL" env-default:"5m"`
+	Register      RateCfg       `yaml:"register" env-prefix:"RATE_LIMIT_REGISTER_"`
+	API           RateCfg       `yaml:"api" env-prefix:"RATE_LIMIT_API_"`
+	Comments      RateCfg       `yaml:"comments" env-prefix:"RATE_LIMIT_COMMENTS_"`
+	// Login - запросы ссылки для входа: каждый отправляет письмо
+	Login RateCfg `yaml:"login" env-prefix:"RATE_LIMIT_LOGIN_"`
+	// Events - действия участников в событии: вопросы, голоса за вопросы, жалобы
+	Events RateCfg `yaml:"events" env-prefix:"RATE_LIMIT_EVENTS_"`
+}
+
+// RateCfg - корзина токенов: Requests запросов за Period, подряд не больше Burst.
+// Burst 0 - равен Requests, Requests 0 - без ограничения
+type RateCfg struct {
+	Requests int           `yaml:"requests" env:"REQUESTS" env-default:"60"`
+	Period   time.Duration `yaml:"period" env:"PERIOD" env-default:"1m"`
+	Burst    int           `yaml:"burst" env:"BURST"`
 }
 
 func MustLoad() *Config {
@@ -0,0 +1,49 @@
+// Package audit переносит через context сведения об авторе запроса,
+// чтобы storage записывал их в журналы в той же транзакции, что и само изменение
+package audit
+
+import (
+	model "REST_project/internal/models"
+	"context"
+	"strconv"
+)
+
+const (
+	// ActorSystem подписывает изменения, сделанные не из HTTP-запроса
+	ActorSystem = "system"
+	// ActorAnonymous подписывает запросы без авторизации
+	ActorAnonymous = "anonymous"
+)
+
+type ctxKey struct{}
+
+// WithMeta кладет сведения об авторе запроса в контекст
+func WithMeta(ctx context.Context, meta model.ActionMeta) context.Context {
+	return context.WithValue(ctx, ctxKey{}, meta)
+}
+
+// WithActor подменяет автора, сохраняя request id и адрес
+func WithActor(ctx context.Context, actor string) context.Context {
+	meta := MetaFrom(ctx)
+	meta.Actor = actor
+	return WithMeta(ctx, meta)
+}
+
+// MetaFrom достает сведения об авторе запроса. Без них действие считается системным
+func MetaFrom(ctx context.Context) model.ActionMeta {
+	meta, ok := ctx.Value(ctxKey{}).(model.ActionMeta)
+	if !ok || meta.Actor == "" {
+		meta.Actor = ActorSystem
+	}
+	return meta
+}
+
+// AccountActor подписывает действие сотрудника
+func AccountActor(accountID int) string {
+	return "account:" + strconv.Itoa(accountID)
+}
+
+// ParticipantActor подписывает действие участника события
+func ParticipantActor(participantID int) string {
+	return "participant:" + strconv.Itoa(participantID)
+}
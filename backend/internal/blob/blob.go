@@ -0,0 +1,53 @@
+package blob
+
+import (
+	cfg "REST_project/config"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store хранит содержимое вложений по ключу
+type Store interface {
+	// Put сохраняет содержимое r под ключом key. size может быть -1, если размер заранее неизвестен
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Object - открытый для чтения объект. Поддерживает Seek, поэтому его можно
+// отдавать через http.ServeContent с поддержкой Range-запросов
+type Object interface {
+	io.ReadSeekCloser
+	Size() int64
+	ModTime() time.Time
+}
+
+// NewKey генерирует уникальный ключ вида prefix/<random>
+func NewKey(prefix string) (string, error) {
+	const op = "blob.NewKey"
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return prefix + "/" + hex.EncodeToString(b), nil
+}
+
+// New создает хранилище, выбранное в конфигурации
+func New(c cfg.UploadCfg) (Store, error) {
+	const op = "blob.New"
+	switch c.Backend {
+	case "", "fs":
+		return NewFS(c.Dir)
+	case "memory":
+		return NewS3(NewMemoryObjects(), c.Bucket), nil
+	default:
+		return nil, fmt.Errorf("%s: unknown backend %q", op, c.Backend)
+	}
+}
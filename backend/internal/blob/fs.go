@@ -0,0 +1,105 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FSStore хранит объекты в локальной директории
+type FSStore struct {
+	root string
+}
+
+func NewFS(root string) (*FSStore, error) {
+	const op = "blob.NewFS"
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &FSStore{root: root}, nil
+}
+
+func (s *FSStore) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if clean == "." || filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.root, clean), nil
+}
+
+func (s *FSStore) Put(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	const op = "blob.FSStore.Put"
+	p, err := s.path(key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// пишем во временный файл, чтобы читатели никогда не увидели объект частично
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *FSStore) Open(_ context.Context, key string) (Object, error) {
+	const op = "blob.FSStore.Open"
+	p, err := s.path(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &fsObject{File: f, info: info}, nil
+}
+
+func (s *FSStore) Delete(_ context.Context, key string) error {
+	const op = "blob.FSStore.Delete"
+	p, err := s.path(key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+type fsObject struct {
+	*os.File
+	info fs.FileInfo
+}
+
+func (o *fsObject) Size() int64        { return o.info.Size() }
+func (o *fsObject) ModTime() time.Time { return o.info.ModTime() }
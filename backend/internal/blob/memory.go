@@ -0,0 +1,81 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// MemoryObjects - локальная замена S3-совместимого хранилища, держит объекты в памяти.
+// Подходит для разработки и для проверки S3Store без внешних сервисов
+type MemoryObjects struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+func NewMemoryObjects() *MemoryObjects {
+	return &MemoryObjects{objects: make(map[string]memoryObject)}
+}
+
+func (m *MemoryObjects) PutObject(_ context.Context, bucket, key string, body io.Reader, _ int64, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[bucket+"/"+key] = memoryObject{
+		data: data,
+		info: ObjectInfo{
+			Size:         int64(len(data)),
+			ContentType:  contentType,
+			LastModified: time.Now(),
+		},
+	}
+	return nil
+}
+
+func (m *MemoryObjects) GetObject(_ context.Context, bucket, key string, offset, length int64) (io.ReadCloser, error) {
+	m.mu.RLock()
+	obj, ok := m.objects[bucket+"/"+key]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	size := int64(len(obj.data))
+	if offset > size {
+		offset = size
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+	return io.NopCloser(bytes.NewReader(obj.data[offset:end])), nil
+}
+
+func (m *MemoryObjects) HeadObject(_ context.Context, bucket, key string) (ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[bucket+"/"+key]
+	if !ok {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return obj.info, nil
+}
+
+func (m *MemoryObjects) DeleteObject(_ context.Context, bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[bucket+"/"+key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.objects, bucket+"/"+key)
+	return nil
+}
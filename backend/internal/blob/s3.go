@@ -0,0 +1,121 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ObjectAPI - подмножество S3 API, которого достаточно для хранения вложений.
+// Его реализует как клиент настоящего S3-совместимого хранилища, так и MemoryObjects
+type ObjectAPI interface {
+	PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error
+	// GetObject читает объект начиная с offset. length < 0 означает "до конца объекта"
+	GetObject(ctx context.Context, bucket, key string, offset, length int64) (io.ReadCloser, error)
+	HeadObject(ctx context.Context, bucket, key string) (ObjectInfo, error)
+	DeleteObject(ctx context.Context, bucket, key string) error
+}
+
+type ObjectInfo struct {
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// S3Store хранит объекты в бакете S3-совместимого хранилища
+type S3Store struct {
+	api    ObjectAPI
+	bucket string
+}
+
+func NewS3(api ObjectAPI, bucket string) *S3Store {
+	return &S3Store{api: api, bucket: bucket}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	const op = "blob.S3Store.Put"
+	if err := s.api.PutObject(ctx, s.bucket, key, r, size, contentType); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *S3Store) Open(ctx context.Context, key string) (Object, error) {
+	const op = "blob.S3Store.Open"
+	info, err := s.api.HeadObject(ctx, s.bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &s3Object{ctx: ctx, store: s, key: key, info: info}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	const op = "blob.S3Store.Delete"
+	if err := s.api.DeleteObject(ctx, s.bucket, key); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// s3Object читает объект ranged-запросами: после Seek следующий Read
+// запрашивает объект с новой позиции, поэтому Range-запросы клиента
+// не приводят к скачиванию объекта целиком
+type s3Object struct {
+	ctx    context.Context
+	store  *S3Store
+	key    string
+	info   ObjectInfo
+	offset int64
+	body   io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.info.Size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		body, err := o.store.api.GetObject(o.ctx, o.store.bucket, o.key, o.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.offset + offset
+	case io.SeekEnd:
+		abs = o.info.Size + offset
+	default:
+		return 0, errors.New("blob: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("blob: negative position")
+	}
+	if abs != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = abs
+	return abs, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body != nil {
+		return o.body.Close()
+	}
+	return nil
+}
+
+func (o *s3Object) Size() int64        { return o.info.Size }
+func (o *s3Object) ModTime() time.Time { return o.info.LastModified }
@@ -0,0 +1,273 @@
+package calendar
+
+import (
+	model "REST_project/internal/models"
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	// база часовых поясов встраивается в бинарник, чтобы LoadLocation работал и без tzdata в системе
+	_ "time/tzdata"
+	"unicode/utf8"
+)
+
+const (
+	prodID = "-//REST_project//Events//EN"
+	// maxLine - предел длины строки в октетах, длинные строки переносятся (RFC 5545, 3.1)
+	maxLine = 75
+
+	dateTime    = "20060102T150405"
+	dateTimeUTC = "20060102T150405Z"
+)
+
+// Calendar пишет события в формате iCalendar (RFC 5545)
+type Calendar struct {
+	Name string
+	// Domain - правая часть UID событий. UID не должен меняться, иначе календари задвоят события
+	Domain string
+	// Refresh - как часто подписанный календарь перезапрашивает ленту, 0 - не указывать
+	Refresh time.Duration
+}
+
+// LoadLocation возвращает часовой пояс IANA. Пустое имя означает UTC,
+// Local не принимается: он зависит от сервера
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// Write пишет календарь с событиями. События без времени начала пропускаются
+func (c Calendar) Write(w io.Writer, events []model.Event) error {
+	lw := &lineWriter{w: bufio.NewWriter(w)}
+	lw.prop("BEGIN", "VCALENDAR")
+	lw.prop("VERSION", "2.0")
+	lw.prop("PRODID", prodID)
+	lw.prop("CALSCALE", "GREGORIAN")
+	lw.prop("METHOD", "PUBLISH")
+	if c.Name != "" {
+		lw.prop("NAME", escape(c.Name))
+		lw.prop("X-WR-CALNAME", escape(c.Name))
+	}
+	if c.Refresh > 0 {
+		lw.prop("REFRESH-INTERVAL;VALUE=DURATION", duration(c.Refresh))
+		lw.prop("X-PUBLISHED-TTL", duration(c.Refresh))
+	}
+
+	zones := zoneRanges(events)
+	for _, z := range zones {
+		writeTimezone(lw, z)
+	}
+	for _, e := range events {
+		if e.StartsAt == nil {
+			continue
+		}
+		c.writeEvent(lw, e, location(e))
+	}
+
+	lw.prop("END", "VCALENDAR")
+	return lw.flush()
+}
+
+func (c Calendar) writeEvent(lw *lineWriter, e model.Event, loc *time.Location) {
+	lw.prop("BEGIN", "VEVENT")
+	lw.prop("UID", fmt.Sprintf("event-%d@%s", e.ID, c.Domain))
+	// у опубликованного календаря DTSTAMP - время последнего изменения события,
+	// так лента не меняется между запросами, пока не меняются события
+	lw.prop("DTSTAMP", e.UpdatedAt.UTC().Format(dateTimeUTC))
+	lw.prop("CREATED", e.CreatedAt.UTC().Format(dateTimeUTC))
+	lw.prop("LAST-MODIFIED", e.UpdatedAt.UTC().Format(dateTimeUTC))
+	lw.prop("SEQUENCE", fmt.Sprint(e.Sequence))
+	lw.prop(timeProp("DTSTART", *e.StartsAt, loc))
+	if e.EndsAt != nil {
+		lw.prop(timeProp("DTEND", *e.EndsAt, loc))
+	}
+	lw.prop("SUMMARY", escape(e.Name))
+
+	description := e.Description
+	if e.JoinURL != "" {
+		if description != "" {
+			description += "\n\n"
+		}
+		description += "Join: " + e.JoinURL
+	}
+	if description != "" {
+		lw.prop("DESCRIPTION", escape(description))
+	}
+	if e.Location != "" {
+		lw.prop("LOCATION", escape(e.Location))
+	}
+	if e.JoinURL != "" {
+		lw.prop("URL", e.JoinURL)
+		lw.prop("CONFERENCE;VALUE=URI;FEATURE=VIDEO,AUDIO", e.JoinURL)
+	}
+	lw.prop("STATUS", "CONFIRMED")
+	lw.prop("END", "VEVENT")
+}
+
+// timeProp записывает время в часовом поясе события, для UTC - с суффиксом Z
+func timeProp(name string, t time.Time, loc *time.Location) (string, string) {
+	if loc == time.UTC {
+		return name, t.UTC().Format(dateTimeUTC)
+	}
+	return name + ";TZID=" + loc.String(), t.In(loc).Format(dateTime)
+}
+
+// zoneRange - часовой пояс и промежуток времени его событий, для которого нужны правила перехода
+type zoneRange struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+func zoneRanges(events []model.Event) []zoneRange {
+	var zones []zoneRange
+	index := map[string]int{}
+	for _, e := range events {
+		loc := location(e)
+		if e.StartsAt == nil || loc == time.UTC {
+			continue
+		}
+		from, to := *e.StartsAt, *e.StartsAt
+		if e.EndsAt != nil {
+			to = *e.EndsAt
+		}
+		i, ok := index[loc.String()]
+		if !ok {
+			index[loc.String()] = len(zones)
+			zones = append(zones, zoneRange{loc: loc, from: from, to: to})
+			continue
+		}
+		if from.Before(zones[i].from) {
+			zones[i].from = from
+		}
+		if to.After(zones[i].to) {
+			zones[i].to = to
+		}
+	}
+	return zones
+}
+
+// writeTimezone пишет VTIMEZONE с переходами между поясным и летним временем,
+// которые действуют в промежутке z. Переходы берутся из базы часовых поясов Go
+func writeTimezone(lw *lineWriter, z zoneRange) {
+	lw.prop("BEGIN", "VTIMEZONE")
+	lw.prop("TZID", z.loc.String())
+
+	t := z.from.In(z.loc)
+	for {
+		name, offset := t.Zone()
+		start, end := t.ZoneBounds()
+
+		// DTSTART перехода записывается в местном времени до перехода
+		offsetFrom := offset
+		dtstart := "19700101T000000"
+		if !start.IsZero() {
+			_, offsetFrom = start.Add(-time.Second).Zone()
+			dtstart = start.In(time.FixedZone("", offsetFrom)).Format(dateTime)
+		}
+
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		lw.prop("BEGIN", kind)
+		lw.prop("DTSTART", dtstart)
+		lw.prop("TZOFFSETFROM", utcOffset(offsetFrom))
+		lw.prop("TZOFFSETTO", utcOffset(offset))
+		lw.prop("TZNAME", escape(name))
+		lw.prop("END", kind)
+
+		if end.IsZero() || end.After(z.to) {
+			break
+		}
+		t = end.In(z.loc)
+	}
+
+	lw.prop("END", "VTIMEZONE")
+}
+
+// location возвращает часовой пояс события. Неизвестный пояс заменяется на UTC,
+// чтобы одно событие не ломало всю ленту
+func location(e model.Event) *time.Location {
+	loc, err := LoadLocation(e.Timezone)
+	if err != nil || loc.String() == "UTC" {
+		return time.UTC
+	}
+	return loc
+}
+
+func utcOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+	if seconds%60 != 0 {
+		s += fmt.Sprintf("%02d", seconds%60)
+	}
+	return s
+}
+
+// duration записывает промежуток в формате DURATION (RFC 5545, 3.3.6) с точностью до минуты
+func duration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	s := "PT"
+	if h := minutes / 60; h > 0 {
+		s += fmt.Sprintf("%dH", h)
+	}
+	if m := minutes % 60; m > 0 {
+		s += fmt.Sprintf("%dM", m)
+	}
+	return s
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escape экранирует значение типа TEXT (RFC 5545, 3.3.11)
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// lineWriter пишет строки содержимого с CRLF и переносом длинных строк.
+// Первая ошибка записи запоминается и возвращается из flush
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (l *lineWriter) prop(name, value string) {
+	if l.err != nil {
+		return
+	}
+	line := name + ":" + value
+	limit := maxLine
+	for len(line) > limit {
+		// перенос не должен разрывать многобайтовый символ UTF-8
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		_, l.err = l.w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// пробел в начале продолжения тоже занимает октет
+		limit = maxLine - 1
+	}
+	if l.err == nil {
+		_, l.err = l.w.WriteString(line + "\r\n")
+	}
+}
+
+func (l *lineWriter) flush() error {
+	if l.err != nil {
+		return l.err
+	}
+	return l.w.Flush()
+}
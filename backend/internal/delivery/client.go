@@ -0,0 +1,83 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress - запрос к внутреннему адресу, его не пропустил Guard
+var ErrForbiddenAddress = errors.New("address is not allowed")
+
+// NewClient возвращает HTTP-клиент для адресов, которые присылают пользователи. Без allowPrivate
+// он не подключается к внутренним адресам, conns - сколько соединений держать с одним хостом
+func NewClient(timeout time.Duration, conns int, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// адрес проверяется после разрешения имени, поэтому DNS не подменит его на внутренний
+		dialer.Control = Guard
+	}
+	return &http.Client{
+		Timeout: timeout,
+		// прокси из окружения обошел бы проверку адреса
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: conns,
+		},
+		// редирект считается ответом: переход по нему мог бы увести запрос во внутреннюю сеть
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Drain дочитывает и закрывает тело ответа, которое не нужно: дочитанное соединение возвращается в пул
+func Drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// Backoff - пауза перед попыткой n+1: base * 2^(n-1), не больше limit, со случайным разбросом
+// до половины, чтобы повторы разных запросов не шли одной волной
+func Backoff(base, limit time.Duration, n int) time.Duration {
+	delay := base
+	for i := 1; i < n && delay < limit; i++ {
+		delay *= 2
+	}
+	if limit > 0 && delay > limit {
+		delay = limit
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// Guard - Control для net.Dialer, не дает подключиться к локальным, внутренним и служебным адресам
+func Guard(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !Public(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// sharedAddress - 100.64.0.0/10, адреса операторского NAT (RFC 6598)
+var sharedAddress = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Public сообщает, что ip - публичный адрес, на который можно отправлять запросы
+func Public(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || sharedAddress.Contains(ip))
+}
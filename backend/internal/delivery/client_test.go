@@ -0,0 +1,57 @@
+package delivery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGuard(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.0.0.1:443", false},
+		{"172.16.5.4:443", false},
+		{"192.168.1.1:443", false},
+		{"169.254.169.254:80", false},
+		{"100.64.0.1:443", false},
+		{"0.0.0.0:80", false},
+		{"[fe80::1]:80", false},
+		{"[fc00::1]:80", false},
+	}
+	for _, tt := range tests {
+		err := Guard("tcp", tt.address, nil)
+		if (err == nil) != tt.allowed {
+			t.Errorf("Guard(%s) = %v, allowed %v", tt.address, err, tt.allowed)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, limit := 10*time.Second, time.Minute
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{10, time.Minute},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			got := Backoff(base, limit, tt.n)
+			if got < tt.want/2 || got > tt.want {
+				t.Fatalf("Backoff(%d) = %v, want between %v and %v", tt.n, got, tt.want/2, tt.want)
+			}
+		}
+	}
+	if got := Backoff(0, limit, 3); got != 0 {
+		t.Errorf("Backoff with zero base = %v, want 0", got)
+	}
+}
@@ -0,0 +1,95 @@
+package delivery
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Config - как Queue забирает очередь: раз в PollInterval пачками до BatchSize,
+// отправляя пачку в Workers потоков. PurgeInterval - как часто чистить очередь, 0 - не чистить
+type Config struct {
+	Workers       int
+	BatchSize     int
+	PollInterval  time.Duration
+	PurgeInterval time.Duration
+}
+
+// Queue рассылает исходящие запросы из очереди в базе: вебхуки, push-уведомления.
+// Что забрать, как отправить и что удалить, решает владелец очереди
+type Queue[T any] struct {
+	log     *slog.Logger
+	c       Config
+	claim   func(ctx context.Context, limit int) ([]T, error)
+	deliver func(ctx context.Context, item T)
+	purge   func(ctx context.Context)
+}
+
+// NewQueue создает очередь. claim забирает до limit элементов и откладывает их, чтобы их не взял
+// следующий проход; deliver отправляет один элемент и сам записывает итог; purge может быть nil
+func NewQueue[T any](
+	log *slog.Logger,
+	c Config,
+	claim func(ctx context.Context, limit int) ([]T, error),
+	deliver func(ctx context.Context, item T),
+	purge func(ctx context.Context),
+) *Queue[T] {
+	if c.Workers < 1 {
+		c.Workers = 1
+	}
+	if c.BatchSize < 1 {
+		c.BatchSize = 1
+	}
+	return &Queue[T]{log: log, c: c, claim: claim, deliver: deliver, purge: purge}
+}
+
+// Run рассылает очередь, пока не отменен ctx. Начатые отправки дописываются и после отмены,
+// Run возвращается, когда они закончатся
+func (q *Queue[T]) Run(ctx context.Context) {
+	ticker := time.NewTicker(q.c.PollInterval)
+	defer ticker.Stop()
+
+	var purged time.Time
+	for {
+		if q.purge != nil && q.c.PurgeInterval > 0 && time.Since(purged) >= q.c.PurgeInterval {
+			q.purge(ctx)
+			purged = time.Now()
+		}
+		// полная пачка значит, что в очереди остались элементы: следующая забирается сразу
+		for q.Dispatch(ctx) && ctx.Err() == nil {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch забирает одну пачку и отправляет ее в Workers потоков. Возвращает true, если пачка полная
+func (q *Queue[T]) Dispatch(ctx context.Context) bool {
+	items, err := q.claim(ctx, q.c.BatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			q.log.Error("failed to claim deliveries", slog.String("error", err.Error()))
+		}
+		return false
+	}
+
+	// отмена ctx не обрывает уже забранные элементы, иначе они ждали бы, пока истечет их отсрочка
+	sendCtx := context.WithoutCancel(ctx)
+	slots := make(chan struct{}, q.c.Workers)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			q.deliver(sendCtx, item)
+		}()
+	}
+	wg.Wait()
+	return len(items) == q.c.BatchSize
+}
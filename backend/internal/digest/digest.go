@@ -0,0 +1,184 @@
+package digest
+
+import (
+	"REST_project/config"
+	"REST_project/internal/mailer"
+	model "REST_project/internal/models"
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+type Store interface {
+	ClaimDigests(ctx context.Context, limit int, lease time.Duration, maxPosts int) ([]model.Digest, error)
+	MarkDigestSent(ctx context.Context, participantID, lastPostID int) error
+}
+
+// excerptLen - сколько символов поста попадает в письмо, остальное читается на сайте
+const excerptLen = 500
+
+//go:embed templates
+var templates embed.FS
+
+var funcs = map[string]any{"excerpt": excerpt}
+
+var (
+	htmlTmpl = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(funcs).ParseFS(templates, "templates/digest.html"))
+	textTmpl = texttemplate.Must(texttemplate.New("digest.txt").Funcs(funcs).ParseFS(templates, "templates/digest.txt"))
+)
+
+// Scheduler рассылает участникам письма о новых постах их событий: сразу, раз в час или раз в сутки,
+// как выбрал участник. Новые посты за это время собираются в одно письмо
+type Scheduler struct {
+	log    *slog.Logger
+	store  Store
+	mail   mailer.Mailer
+	signer *Signer
+	c      config.DigestCfg
+}
+
+func New(log *slog.Logger, store Store, mail mailer.Mailer, signer *Signer, c config.DigestCfg) *Scheduler {
+	if c.BatchSize < 1 {
+		c.BatchSize = 1
+	}
+	if c.MaxPosts < 1 {
+		c.MaxPosts = 1
+	}
+	return &Scheduler{
+		log:    log.With(slog.String("component", "digest")),
+		store:  store,
+		mail:   mail,
+		signer: signer,
+		c:      c,
+	}
+}
+
+// Run рассылает письма, пока не отменен ctx. Начатые отправки дописываются и после отмены
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.c.Interval)
+	defer ticker.Stop()
+	for {
+		// полная пачка значит, что письма ждут еще участники: следующая забирается сразу
+		for s.dispatch(ctx) && ctx.Err() == nil {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch забирает пачку писем и отправляет их по очереди. Возвращает true, если пачка полная
+func (s *Scheduler) dispatch(ctx context.Context) bool {
+	digests, err := s.store.ClaimDigests(ctx, s.c.BatchSize, s.c.Lease, s.c.MaxPosts)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.Error("failed to claim digests", slog.String("error", err.Error()))
+		}
+		return false
+	}
+
+	// отмена ctx не обрывает уже забранные письма, иначе они ждали бы конца lease
+	sendCtx := context.WithoutCancel(ctx)
+	for _, d := range digests {
+		s.send(sendCtx, d)
+	}
+	return len(digests) == s.c.BatchSize
+}
+
+// send отправляет одно письмо. Если отправка не удалась, письмо повторится после lease
+// и соберет посты, появившиеся за это время
+func (s *Scheduler) send(ctx context.Context, d model.Digest) {
+	log := s.log.With(slog.Int("participant_id", d.ParticipantID), slog.Int("event_id", d.EventID))
+
+	msg, err := s.message(d)
+	if err != nil {
+		log.Error("failed to render digest", slog.String("error", err.Error()))
+		return
+	}
+	if err = s.mail.Send(ctx, msg); err != nil {
+		log.Error("failed to send digest", slog.String("error", err.Error()))
+		return
+	}
+	if err = s.store.MarkDigestSent(ctx, d.ParticipantID, d.LastPostID); err != nil {
+		// письмо уйдет еще раз после lease: повтор лучше, чем потерянные посты
+		log.Error("failed to mark digest sent", slog.String("error", err.Error()))
+		return
+	}
+	log.Debug("digest sent", slog.Int("posts", len(d.Posts)+d.More))
+}
+
+type view struct {
+	model.Digest
+	Subject        string
+	Cadence        string
+	EventURL       string
+	UnsubscribeURL string
+}
+
+// message собирает письмо со ссылкой отписки. Заголовки List-Unsubscribe дают почтовому
+// клиенту отписать участника одной кнопкой по RFC 8058
+func (s *Scheduler) message(d model.Digest) (mailer.Message, error) {
+	unsubscribe := strings.TrimRight(s.c.BaseURL, "/") + "/notifications/unsubscribe?token=" + url.QueryEscape(s.signer.Token(d.ParticipantID))
+	v := view{
+		Digest:         d,
+		Subject:        subject(d),
+		Cadence:        cadence(d.Mode),
+		EventURL:       strings.TrimRight(s.c.SiteURL, "/") + "/events/" + strconv.Itoa(d.EventID),
+		UnsubscribeURL: unsubscribe,
+	}
+
+	var text, html bytes.Buffer
+	if err := textTmpl.Execute(&text, v); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := htmlTmpl.Execute(&html, v); err != nil {
+		return mailer.Message{}, err
+	}
+	return mailer.Message{
+		To:      d.Email,
+		Subject: v.Subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribe + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+func subject(d model.Digest) string {
+	n := len(d.Posts) + d.More
+	if n == 1 {
+		return "New post in " + d.EventName
+	}
+	return fmt.Sprintf("%d new posts in %s", n, d.EventName)
+}
+
+func cadence(mode string) string {
+	switch mode {
+	case model.NotifyHourly:
+		return "hourly digest"
+	case model.NotifyDaily:
+		return "daily digest"
+	default:
+		return "every new post"
+	}
+}
+
+func excerpt(s string) string {
+	r := []rune(strings.TrimSpace(s))
+	if len(r) <= excerptLen {
+		return string(r)
+	}
+	return strings.TrimSpace(string(r[:excerptLen])) + "…"
+}
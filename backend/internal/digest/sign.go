@@ -0,0 +1,59 @@
+package digest
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// Signer подписывает ссылки отписки. Ссылка отписывает только своего участника
+// и не истекает: письмо может пролежать в ящике сколько угодно
+type Signer struct {
+	key []byte
+}
+
+// NewSigner создает Signer с ключом secret. Без ключа создается случайный,
+// и ссылки из уже отправленных писем перестают работать после перезапуска
+func NewSigner(log *slog.Logger, secret string) *Signer {
+	if secret != "" {
+		return &Signer{key: []byte(secret)}
+	}
+	log.Warn("digest secret is not set, unsubscribe links will break on restart")
+	key := make([]byte, 32)
+	// crypto/rand.Read не возвращает ошибку и при сбое завершает программу
+	rand.Read(key)
+	return &Signer{key: key}
+}
+
+// Token возвращает токен отписки участника: <id>.<base64url HMAC-SHA256>
+func (s *Signer) Token(participantID int) string {
+	id := strconv.Itoa(participantID)
+	return id + "." + base64.RawURLEncoding.EncodeToString(s.mac(id))
+}
+
+// Verify проверяет токен отписки и возвращает номер участника
+func (s *Signer) Verify(token string) (int, bool) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, false
+	}
+	participantID, err := strconv.Atoi(id)
+	if err != nil || participantID <= 0 {
+		return 0, false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.mac(id)) {
+		return 0, false
+	}
+	return participantID, true
+}
+
+func (s *Signer) mac(id string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte("unsubscribe:" + id))
+	return mac.Sum(nil)
+}
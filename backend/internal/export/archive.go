@@ -0,0 +1,279 @@
+package export
+
+import (
+	"REST_project/internal/blob"
+	model "REST_project/internal/models"
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"iter"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatVersion меняется, когда меняется состав или формат файлов архива
+const formatVersion = 1
+
+type rows[T any] = iter.Seq2[T, error]
+
+// manifest описывает содержимое архива, пишется последним файлом manifest.json
+type manifest struct {
+	FormatVersion int            `json:"format_version"`
+	EventID       int            `json:"event_id"`
+	EventName     string         `json:"event_name"`
+	ExportedAt    time.Time      `json:"exported_at"`
+	Files         []manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	Name   string `json:"name"`
+	Entity string `json:"entity"`
+	Format string `json:"format"`
+	// Rows - число записей в CSV и JSON, для файлов вложений не заполняется
+	Rows   int    `json:"rows,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type archive struct {
+	zw       *zip.Writer
+	manifest manifest
+}
+
+func newArchive(zw *zip.Writer, event model.Event) *archive {
+	return &archive{
+		zw: zw,
+		manifest: manifest{
+			FormatVersion: formatVersion,
+			EventID:       event.ID,
+			EventName:     event.Name,
+			ExportedAt:    time.Now().UTC(),
+			Files:         []manifestFile{},
+		},
+	}
+}
+
+// file - файл архива, который считает свой размер и контрольную сумму
+type file struct {
+	w    io.Writer
+	h    hash.Hash
+	size int64
+	info manifestFile
+}
+
+func (f *file) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	f.h.Write(b[:n])
+	f.size += int64(n)
+	return n, err
+}
+
+// create начинает файл архива. Уже сжатые файлы вложений сохраняются без сжатия
+func (a *archive) create(name, entity, format string, method uint16) (*file, error) {
+	w, err := a.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: a.manifest.ExportedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &file{w: w, h: sha256.New(), info: manifestFile{Name: name, Entity: entity, Format: format}}, nil
+}
+
+// done заносит законченный файл в манифест
+func (a *archive) done(f *file, rows int) {
+	f.info.Rows = rows
+	f.info.Size = f.size
+	f.info.SHA256 = hex.EncodeToString(f.h.Sum(nil))
+	a.manifest.Files = append(a.manifest.Files, f.info)
+}
+
+func (a *archive) writeEvent(event model.Event) error {
+	f, err := a.create("event.json", "event", "json", zip.Deflate)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(event); err != nil {
+		return err
+	}
+	a.done(f, 1)
+
+	f, err = a.create("event.csv", "event", "csv", zip.Deflate)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	cw.Write([]string{"id", "enterprise_id", "name", "description", "capacity", "created_at",
+		"starts_at", "ends_at", "timezone", "location", "join_url"})
+	cw.Write([]string{itoa(event.ID), itoa(event.EnterpriseID), event.Name, event.Description, itoa(event.Capacity), timestamp(event.CreatedAt),
+		optTimestamp(event.StartsAt), optTimestamp(event.EndsAt), event.Timezone, event.Location, event.JoinURL})
+	cw.Flush()
+	if err = cw.Error(); err != nil {
+		return err
+	}
+	a.done(f, 1)
+	return nil
+}
+
+// table описывает выгрузку сущности. rows вызывается дважды - для CSV и для JSON,
+// так строки не приходится держать в памяти
+type table[T any] struct {
+	entity string
+	header []string
+	record func(v T) []string
+	rows   func() rows[T]
+}
+
+func writeTable[T any](a *archive, t table[T]) error {
+	f, err := a.create(t.entity+".csv", t.entity, "csv", zip.Deflate)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	if err = cw.Write(t.header); err != nil {
+		return err
+	}
+	n := 0
+	for v, err := range t.rows() {
+		if err != nil {
+			return err
+		}
+		if err = cw.Write(t.record(v)); err != nil {
+			return err
+		}
+		n++
+	}
+	cw.Flush()
+	if err = cw.Error(); err != nil {
+		return err
+	}
+	a.done(f, n)
+
+	// JSON - массив, который пишется по одному элементу
+	f, err = a.create(t.entity+".json", t.entity, "json", zip.Deflate)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(f, "["); err != nil {
+		return err
+	}
+	n = 0
+	for v, err := range t.rows() {
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		sep := ",\n  "
+		if n == 0 {
+			sep = "\n  "
+		}
+		if _, err = io.WriteString(f, sep); err != nil {
+			return err
+		}
+		if _, err = f.Write(b); err != nil {
+			return err
+		}
+		n++
+	}
+	if _, err = io.WriteString(f, "\n]\n"); err != nil {
+		return err
+	}
+	a.done(f, n)
+	return nil
+}
+
+// writeBlob копирует файл вложения из хранилища в архив
+func (a *archive) writeBlob(ctx context.Context, store blob.Store, name, key string) error {
+	obj, err := store.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	f, err := a.create(name, "attachment_file", "binary", zip.Store)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, obj); err != nil {
+		return err
+	}
+	a.done(f, 0)
+	return nil
+}
+
+// close дописывает манифест и закрывает архив
+func (a *archive) close() error {
+	w, err := a.zw.CreateHeader(&zip.FileHeader{
+		Name:     "manifest.json",
+		Method:   zip.Deflate,
+		Modified: a.manifest.ExportedAt,
+	})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(a.manifest); err != nil {
+		return err
+	}
+	return a.zw.Close()
+}
+
+// attachmentRow - вложение вместе с путем его файла в архиве
+type attachmentRow struct {
+	model.Attachment
+	Path string `json:"path"`
+}
+
+func withPaths(attachments rows[model.Attachment]) rows[attachmentRow] {
+	return func(yield func(attachmentRow, error) bool) {
+		for v, err := range attachments {
+			row := attachmentRow{Attachment: v}
+			if err == nil {
+				row.Path = fmt.Sprintf("attachments/%d/%s", v.ID, safeName(v.FileName))
+			}
+			if !yield(row, err) {
+				return
+			}
+		}
+	}
+}
+
+// safeName оставляет от имени файла только последнюю часть пути, чтобы файл не вышел из своей папки архива
+func safeName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "file"
+	}
+	return name
+}
+
+func itoa(n int) string {
+	return strconv.Itoa(n)
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// optTimestamp - timestamp для необязательного времени, пустая строка, если оно не задано
+func optTimestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return timestamp(*t)
+}
@@ -0,0 +1,306 @@
+package export
+
+import (
+	"REST_project/config"
+	"REST_project/internal/blob"
+	model "REST_project/internal/models"
+	"REST_project/internal/storage"
+	"archive/zip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type Store interface {
+	CreateExportJob(ctx context.Context, eventID int) (model.ExportJob, error)
+	StartExportJob(ctx context.Context, jobID int) error
+	SetExportProgress(ctx context.Context, jobID, progress int, stage string) error
+	FinishExportJob(ctx context.Context, jobID int, key string, size int64, errMsg string) error
+	FailInterruptedExportJobs(ctx context.Context) (int, error)
+	WithTxIsolation(ctx context.Context, level sql.IsolationLevel, fn func(tx storage.Repo) error) error
+}
+
+// Exporter собирает ZIP-архивы событий: сразу в ответ для небольших событий
+// или фоновым заданием, за ходом которого клиент следит по статусу
+type Exporter struct {
+	log     *slog.Logger
+	store   Store
+	blobs   blob.Store
+	timeout time.Duration
+	// slots ограничивает число одновременных фоновых выгрузок
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func New(log *slog.Logger, store Store, blobs blob.Store, c config.ExportCfg) *Exporter {
+	workers := c.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	return &Exporter{
+		log:     log,
+		store:   store,
+		blobs:   blobs,
+		timeout: c.Timeout,
+		slots:   make(chan struct{}, workers),
+	}
+}
+
+// Recover завершает с ошибкой выгрузки, которые прервала прошлая остановка сервера
+func (e *Exporter) Recover(ctx context.Context) error {
+	const op = "export.Recover"
+	n, err := e.store.FailInterruptedExportJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n > 0 {
+		e.log.Warn("interrupted exports marked as failed", slog.Int("count", n))
+	}
+	return nil
+}
+
+// Start ставит выгрузку в очередь и запускает ее в фоне. От ctx берутся только
+// автор и request id, отмена запроса выгрузку не прерывает
+func (e *Exporter) Start(ctx context.Context, eventID int) (model.ExportJob, error) {
+	const op = "export.Start"
+	job, err := e.store.CreateExportJob(ctx, eventID)
+	if err != nil {
+		return model.ExportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	e.wg.Add(1)
+	go e.run(context.WithoutCancel(ctx), job)
+	return job, nil
+}
+
+// Wait ждет окончания начатых выгрузок или отмены ctx
+func (e *Exporter) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Write пишет архив события в w, не создавая задания
+func (e *Exporter) Write(ctx context.Context, w io.Writer, eventID int) error {
+	const op = "export.Write"
+	if err := e.write(ctx, w, eventID, nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (e *Exporter) run(ctx context.Context, job model.ExportJob) {
+	defer e.wg.Done()
+	log := e.log.With(slog.Int("export_id", job.ID), slog.Int("event_id", job.EventID))
+
+	e.slots <- struct{}{}
+	defer func() { <-e.slots }()
+
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	key, size, err := e.build(ctx, job)
+	errMsg := ""
+	if err != nil {
+		log.Error("export failed", slog.String("error", err.Error()))
+		errMsg = "export failed"
+		if ctx.Err() != nil {
+			errMsg = "export timed out"
+		}
+	} else {
+		log.Info("export finished", slog.Int64("size", size))
+	}
+
+	// срок ctx мог истечь, а итог записать нужно
+	if err = e.store.FinishExportJob(context.WithoutCancel(ctx), job.ID, key, size, errMsg); err != nil {
+		log.Error("failed to finish export", slog.String("error", err.Error()))
+	}
+}
+
+// build пишет архив прямо в хранилище файлов через канал, не собирая его в памяти
+func (e *Exporter) build(ctx context.Context, job model.ExportJob) (string, int64, error) {
+	if err := e.store.StartExportJob(ctx, job.ID); err != nil {
+		return "", 0, err
+	}
+
+	key, err := blob.NewKey(fmt.Sprintf("exports/%d", job.EventID))
+	if err != nil {
+		return "", 0, err
+	}
+
+	pr, pw := io.Pipe()
+	stored := make(chan error, 1)
+	go func() {
+		err := e.blobs.Put(ctx, key, pr, -1, "application/zip")
+		// если хранилище перестало читать, запись архива должна прерваться
+		pr.CloseWithError(err)
+		stored <- err
+	}()
+
+	out := &countingWriter{w: pw}
+	p := &progress{ctx: ctx, log: e.log, store: e.store, jobID: job.ID}
+	err = e.write(ctx, out, job.EventID, p)
+	pw.CloseWithError(err)
+	if putErr := <-stored; err == nil {
+		err = putErr
+	}
+	if err != nil {
+		if delErr := e.blobs.Delete(context.WithoutCancel(ctx), key); delErr != nil {
+			e.log.Error("failed to delete partial export", slog.String("key", key), slog.String("error", delErr.Error()))
+		}
+		return "", 0, err
+	}
+	return key, out.n, nil
+}
+
+// write пишет архив в одной транзакции REPEATABLE READ, чтобы все файлы описывали одно состояние события
+func (e *Exporter) write(ctx context.Context, w io.Writer, eventID int, p *progress) error {
+	return e.store.WithTxIsolation(ctx, sql.LevelRepeatableRead, func(tx storage.Repo) error {
+		event, err := tx.GetEvent(ctx, eventID)
+		if err != nil {
+			return err
+		}
+		attachments, err := tx.CountAttachments(ctx, eventID)
+		if err != nil {
+			return err
+		}
+		// события, участники, посты, комментарии, вложения, файлы вложений и манифест
+		p.begin(5 + attachments + 1)
+
+		a := newArchive(zip.NewWriter(w), event)
+		if err = a.writeEvent(event); err != nil {
+			return err
+		}
+		p.step("event")
+
+		err = writeTable(a, table[model.Participant]{
+			entity: "participants",
+			header: []string{"id", "event_id", "name", "email"},
+			record: func(v model.Participant) []string {
+				return []string{itoa(v.ID), itoa(v.EventID), v.Name, v.Email}
+			},
+			rows: func() rows[model.Participant] { return tx.ExportParticipants(ctx, eventID) },
+		})
+		if err != nil {
+			return err
+		}
+		p.step("participants")
+
+		err = writeTable(a, table[model.Post]{
+			entity: "posts",
+			header: []string{"id", "event_id", "type", "content", "created_at"},
+			record: func(v model.Post) []string {
+				return []string{itoa(v.ID), itoa(v.EventID), v.Type, v.Content, timestamp(v.CreatedAt)}
+			},
+			rows: func() rows[model.Post] { return tx.ExportPosts(ctx, eventID) },
+		})
+		if err != nil {
+			return err
+		}
+		p.step("posts")
+
+		err = writeTable(a, table[model.Comment]{
+			entity: "comments",
+			header: []string{"id", "post_id", "participant_id", "content", "status", "moderation_reason", "created_at"},
+			record: func(v model.Comment) []string {
+				return []string{itoa(v.ID), itoa(v.PostID), itoa(v.ParticipantID), v.Content, v.Status, v.ModerationReason, timestamp(v.CreatedAt)}
+			},
+			rows: func() rows[model.Comment] { return tx.ExportComments(ctx, eventID) },
+		})
+		if err != nil {
+			return err
+		}
+		p.step("comments")
+
+		err = writeTable(a, table[attachmentRow]{
+			entity: "attachments",
+			header: []string{"id", "post_id", "file_name", "content_type", "size", "width", "height", "created_at", "path"},
+			record: func(v attachmentRow) []string {
+				return []string{itoa(v.ID), itoa(v.PostID), v.FileName, v.ContentType, fmt.Sprint(v.Size),
+					itoa(v.Width), itoa(v.Height), timestamp(v.CreatedAt), v.Path}
+			},
+			rows: func() rows[attachmentRow] { return withPaths(tx.ExportAttachments(ctx, eventID)) },
+		})
+		if err != nil {
+			return err
+		}
+		p.step("attachments")
+
+		for v, err := range withPaths(tx.ExportAttachments(ctx, eventID)) {
+			if err != nil {
+				return err
+			}
+			if err = a.writeBlob(ctx, e.blobs, v.Path, v.StorageKey); err != nil {
+				return fmt.Errorf("attachment %d: %w", v.ID, err)
+			}
+			p.step("files")
+		}
+
+		if err = a.close(); err != nil {
+			return err
+		}
+		p.step("manifest")
+		return nil
+	})
+}
+
+// progress сохраняет процент готовности фоновой выгрузки. nil - выгрузка без задания
+type progress struct {
+	ctx   context.Context
+	log   *slog.Logger
+	store Store
+	jobID int
+	total int
+	done  int
+	last  int
+}
+
+func (p *progress) begin(total int) {
+	if p == nil {
+		return
+	}
+	p.total, p.done, p.last = total, 0, -1
+}
+
+// step отмечает этап и пишет прогресс, только когда меняется процент
+func (p *progress) step(stage string) {
+	if p == nil {
+		return
+	}
+	p.done++
+	// 100 выставляет только завершение задания, когда архив уже сохранен
+	pct := min(p.done*100/p.total, 99)
+	if pct == p.last {
+		return
+	}
+	p.last = pct
+	if err := p.store.SetExportProgress(p.ctx, p.jobID, pct, stage); err != nil {
+		p.log.Error("failed to save export progress", slog.Int("export_id", p.jobID), slog.String("error", err.Error()))
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
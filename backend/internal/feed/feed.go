@@ -0,0 +1,284 @@
+package feed
+
+import (
+	"REST_project/config"
+	model "REST_project/internal/models"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Форматы ленты
+const (
+	FormatAtom = "atom"
+	FormatRSS  = "rss"
+)
+
+// maxTitle - предел длины заголовка записи, заголовок берется из первой строки поста
+const maxTitle = 80
+
+// Feed - лента постов события, общая для Atom и RSS
+type Feed struct {
+	// ID - постоянный идентификатор ленты (tag URI, RFC 4151)
+	ID       string
+	Title    string
+	Subtitle string
+	// Link - страница события на сайте, Self - адрес самой ленты
+	Link    string
+	Self    string
+	Updated time.Time
+	Entries []Entry
+}
+
+type Entry struct {
+	ID         string
+	Title      string
+	Content    string
+	Published  time.Time
+	Updated    time.Time
+	Enclosures []Enclosure
+}
+
+type Enclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+// FromEvent собирает ленту из постов события, посты идут новыми первыми. Updated ленты -
+// время последнего поста или изменения события, если оно позже
+func FromEvent(event model.Event, posts []model.Post, format string, c config.FeedCfg) Feed {
+	base := strings.TrimSuffix(c.BaseURL, "/")
+	tag := tagPrefix(base, event)
+	f := Feed{
+		ID:       tag,
+		Title:    event.Name,
+		Subtitle: event.Description,
+		Link:     fmt.Sprintf("%s/events/%d", strings.TrimSuffix(c.SiteURL, "/"), event.ID),
+		Self:     fmt.Sprintf("%s/events/%d/feed.%s", base, event.ID, format),
+		Updated:  event.UpdatedAt,
+		Entries:  make([]Entry, 0, len(posts)),
+	}
+	for _, p := range posts {
+		if p.CreatedAt.After(f.Updated) {
+			f.Updated = p.CreatedAt
+		}
+		e := Entry{
+			ID:        fmt.Sprintf("%s/post/%d", tag, p.ID),
+			Title:     title(p),
+			Content:   p.Content,
+			Published: p.CreatedAt,
+			// посты не редактируются, поэтому запись не меняется после публикации
+			Updated: p.CreatedAt,
+		}
+		for _, a := range p.Attachments {
+			e.Enclosures = append(e.Enclosures, Enclosure{URL: base + a.URL, Type: a.ContentType, Length: a.Size})
+		}
+		f.Entries = append(f.Entries, e)
+	}
+	return f
+}
+
+// tagPrefix строит tag URI события. Дата - день создания события, так идентификатор не меняется
+func tagPrefix(base string, event model.Event) string {
+	host := "localhost"
+	if u, err := url.Parse(base); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	return fmt.Sprintf("tag:%s,%s:event/%d", host, event.CreatedAt.UTC().Format(time.DateOnly), event.ID)
+}
+
+// title берет первую непустую строку поста и обрезает ее до maxTitle символов
+func title(p model.Post) string {
+	for _, line := range strings.Split(p.Content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if utf8.RuneCountInString(line) > maxTitle {
+			line = string([]rune(line)[:maxTitle-1]) + "…"
+		}
+		return line
+	}
+	if p.Type == model.PostTypePoll {
+		return fmt.Sprintf("Poll #%d", p.ID)
+	}
+	return fmt.Sprintf("Post #%d", p.ID)
+}
+
+// ContentType возвращает тип содержимого ленты формата format
+func ContentType(format string) string {
+	if format == FormatRSS {
+		return "application/rss+xml; charset=utf-8"
+	}
+	return "application/atom+xml; charset=utf-8"
+}
+
+// Write пишет ленту в формате format: Atom (RFC 4287) или RSS 2.0
+func Write(w io.Writer, f Feed, format string) error {
+	var doc any
+	switch format {
+	case FormatAtom:
+		doc = atom(f)
+	case FormatRSS:
+		doc = rss(f)
+	default:
+		return fmt.Errorf("unknown feed format %q", format)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    atomText    `xml:"title"`
+	Subtitle *atomText   `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   atomAuthor  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     atomText   `xml:"title"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Content   atomText   `xml:"content"`
+	Links     []atomLink `xml:"link"`
+}
+
+func atom(f Feed) atomFeed {
+	doc := atomFeed{
+		ID:      f.ID,
+		Title:   atomText{Type: "text", Body: f.Title},
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		// у постов нет автора, публикует их организатор события
+		Author: atomAuthor{Name: f.Title},
+		Links: []atomLink{
+			{Rel: "self", Href: f.Self, Type: "application/atom+xml"},
+			{Rel: "alternate", Href: f.Link, Type: "text/html"},
+		},
+		Entries: make([]atomEntry, 0, len(f.Entries)),
+	}
+	if f.Subtitle != "" {
+		doc.Subtitle = &atomText{Type: "text", Body: f.Subtitle}
+	}
+	for _, e := range f.Entries {
+		entry := atomEntry{
+			ID:        e.ID,
+			Title:     atomText{Type: "text", Body: e.Title},
+			Published: e.Published.UTC().Format(time.RFC3339),
+			Updated:   e.Updated.UTC().Format(time.RFC3339),
+			Content:   atomText{Type: "text", Body: e.Content},
+		}
+		for _, a := range e.Enclosures {
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Href: a.URL, Type: a.Type, Length: a.Length})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return doc
+}
+
+type rssDoc struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          rssSelf   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssSelf - atom:link rel="self", которую валидаторы RSS ожидают в канале
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string         `xml:"title"`
+	Description string         `xml:"description"`
+	PubDate     string         `xml:"pubDate"`
+	GUID        rssGUID        `xml:"guid"`
+	Enclosures  []rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+func rss(f Feed) rssDoc {
+	description := f.Subtitle
+	if description == "" {
+		description = f.Title
+	}
+	doc := rssDoc{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   description,
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+			Self:          rssSelf{Href: f.Self, Rel: "self", Type: "application/rss+xml"},
+			Items:         make([]rssItem, 0, len(f.Entries)),
+		},
+	}
+	for _, e := range f.Entries {
+		item := rssItem{
+			Title:       e.Title,
+			Description: e.Content,
+			PubDate:     e.Published.UTC().Format(time.RFC1123Z),
+			GUID:        rssGUID{Value: e.ID},
+		}
+		for _, a := range e.Enclosures {
+			item.Enclosures = append(item.Enclosures, rssEnclosure{URL: a.URL, Length: a.Length, Type: a.Type})
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+	return doc
+}
@@ -0,0 +1,259 @@
+package account_handlers
+
+import (
+	"REST_project/internal/handlers/auth"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+const maxNameLen = 255
+
+type Server interface {
+	CreateAccount(ctx context.Context, name, email, keyHash string) (int, error)
+	CreateAPIKey(ctx context.Context, accountID int, keyHash string) (int, error)
+	GetAPIKeys(ctx context.Context, accountID int) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, accountID, keyID int) error
+	GetMemberships(ctx context.Context, accountID int) ([]model.Member, error)
+}
+
+type RequestAccountRegister struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// ResponseKey - ключ возвращается только при выпуске, в базе хранится его хеш
+type ResponseKey struct {
+	AccountID int    `json:"account_id,omitempty"`
+	KeyID     int    `json:"key_id,omitempty"`
+	APIKey    string `json:"api_key"`
+}
+
+// ResponseAccount - текущий аккаунт с его ключами и ролями в предприятиях
+type ResponseAccount struct {
+	model.Account
+	Keys        []model.APIKey `json:"keys"`
+	Memberships []model.Member `json:"memberships"`
+}
+
+func respOk(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, model.Response{
+		Status: "OK",
+	})
+}
+
+// RegisterAccount создает аккаунт сотрудника и выдает ему первый API-ключ
+func RegisterAccount(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.account-handlers.RegisterAccount"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req RequestAccountRegister
+		err := render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "empty request",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to decode request body", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid request format",
+			})
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		req.Email = strings.TrimSpace(req.Email)
+		if req.Name == "" || len(req.Name) > maxNameLen || !validEmail(req.Email) {
+			log.Error("invalid request data")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid data provided",
+			})
+			return
+		}
+
+		log.Info("registering account", slog.String("email", req.Email))
+
+		key, hash, err := auth.NewKey()
+		if err != nil {
+			log.Error("failed to generate api key", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to register account",
+			})
+			return
+		}
+
+		id, err := s.CreateAccount(r.Context(), req.Name, req.Email, hash)
+		if err != nil {
+			log.Error("failed to register account", slog.String("error", err.Error()))
+			msg := "failed to register account"
+			if errors.Is(err, storage.ErrEmailTaken) {
+				msg = "email is already registered"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   ResponseKey{AccountID: id, APIKey: key},
+		})
+	}
+}
+
+func GetAccount(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.account-handlers.GetAccount"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		account, ok := policy.AccountFrom(r.Context())
+		if !ok {
+			auth.Allowed(w, r, log, policy.ErrUnauthenticated)
+			return
+		}
+
+		keys, err := s.GetAPIKeys(r.Context(), account.ID)
+		if err != nil {
+			log.Error("failed to get api keys", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get account",
+			})
+			return
+		}
+		memberships, err := s.GetMemberships(r.Context(), account.ID)
+		if err != nil {
+			log.Error("failed to get memberships", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get account",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   ResponseAccount{Account: account, Keys: keys, Memberships: memberships},
+		})
+	}
+}
+
+// CreateKey выпускает дополнительный API-ключ, например для отдельного сервиса
+func CreateKey(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.account-handlers.CreateKey"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		account, ok := policy.AccountFrom(r.Context())
+		if !ok {
+			auth.Allowed(w, r, log, policy.ErrUnauthenticated)
+			return
+		}
+
+		key, hash, err := auth.NewKey()
+		if err != nil {
+			log.Error("failed to generate api key", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to create api key",
+			})
+			return
+		}
+
+		id, err := s.CreateAPIKey(r.Context(), account.ID, hash)
+		if err != nil {
+			log.Error("failed to create api key", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to create api key",
+			})
+			return
+		}
+
+		log.Info("api key created", slog.Int("account_id", account.ID), slog.Int("key_id", id))
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   ResponseKey{KeyID: id, APIKey: key},
+		})
+	}
+}
+
+func RevokeKey(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.account-handlers.RevokeKey"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		account, ok := policy.AccountFrom(r.Context())
+		if !ok {
+			auth.Allowed(w, r, log, policy.ErrUnauthenticated)
+			return
+		}
+
+		keyID, err := strconv.Atoi(chi.URLParam(r, "keyID"))
+		if err != nil || keyID <= 0 {
+			log.Error("invalid key id", slog.String("id", chi.URLParam(r, "keyID")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid key id",
+			})
+			return
+		}
+
+		err = s.RevokeAPIKey(r.Context(), account.ID, keyID)
+		if err != nil {
+			log.Error("failed to revoke api key", slog.String("error", err.Error()))
+			msg := "failed to revoke api key"
+			if errors.Is(err, storage.ErrKeyNotFound) {
+				msg = "api key not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		log.Info("api key revoked", slog.Int("account_id", account.ID), slog.Int("key_id", keyID))
+		respOk(w, r)
+	}
+}
+
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && len(email) <= maxNameLen
+}
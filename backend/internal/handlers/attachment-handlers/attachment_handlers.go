@@ -0,0 +1,444 @@
+package attachment_handlers
+
+import (
+	"REST_project/config"
+	"REST_project/internal/blob"
+	"REST_project/internal/handlers/auth"
+	"REST_project/internal/handlers/deadline"
+	"REST_project/internal/imaging"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// sniffLen - столько байт смотрит http.DetectContentType
+const sniffLen = 512
+
+// multipartOverhead - запас на заголовки multipart сверх размера самого файла
+const multipartOverhead = 1 << 20
+
+var uploadPath = regexp.MustCompile(`^/api/posts/[^/]+/attachments$`)
+
+type Server interface {
+	CreateAttachment(ctx context.Context, a model.Attachment) (int, error)
+	GetAttachment(ctx context.Context, id int) (model.Attachment, error)
+	GetAttachmentVariant(ctx context.Context, attachmentID, width int) (model.AttachmentVariant, error)
+	GetPostAttachments(ctx context.Context, postID int) ([]model.Attachment, error)
+}
+
+var (
+	errFileTooLarge = errors.New("file is too large")
+	errInvalidImage = errors.New("invalid image")
+)
+
+type Policy interface {
+	AuthorizePost(ctx context.Context, postID int, perm policy.Permission) error
+}
+
+// IsUpload сообщает, что запрос загружает вложение. Общий таймаут запросов ему мал,
+// срок задает сам UploadAttachment
+func IsUpload(r *http.Request) bool {
+	return r.Method == http.MethodPost && uploadPath.MatchString(r.URL.Path)
+}
+
+// UploadAttachment прикрепляет файл к посту, доступно организаторам предприятия
+func UploadAttachment(log *slog.Logger, s Server, store blob.Store, c config.UploadCfg, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.attachment-handlers.UploadAttachment"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		r, cancel := deadline.Extend(w, r, c.Timeout)
+		defer cancel()
+
+		postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || postID <= 0 {
+			log.Error("invalid post id", slog.String("id", chi.URLParam(r, "id")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid post id",
+			})
+			return
+		}
+
+		if !auth.Allowed(w, r, log, p.AuthorizePost(r.Context(), postID, policy.ManageEvents)) {
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, c.MaxSize+multipartOverhead)
+		mr, err := r.MultipartReader()
+		if err != nil {
+			log.Error("failed to read multipart body", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid request format",
+			})
+			return
+		}
+
+		// ищем часть с файлом, остальные поля формы пропускаем
+		var part io.Reader
+		var fileName string
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Error("failed to read multipart part", slog.String("error", err.Error()))
+				render.JSON(w, r, model.Response{
+					Status: "Error",
+					Error:  "invalid request format",
+				})
+				return
+			}
+			if p.FormName() == "file" && p.FileName() != "" {
+				part, fileName = p, filepath.Base(p.FileName())
+				break
+			}
+		}
+		if part == nil {
+			log.Error("file part is missing")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "file is required",
+			})
+			return
+		}
+
+		// тип определяем по содержимому, заголовку клиента не доверяем
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(part, head)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			log.Error("failed to read file", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to read file",
+			})
+			return
+		}
+		head = head[:n]
+		contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+		if !slices.Contains(c.AllowedTypes, contentType) {
+			log.Error("file type is not allowed", slog.String("content_type", contentType))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  fmt.Sprintf("file type %s is not allowed", contentType),
+			})
+			return
+		}
+
+		a := model.Attachment{
+			PostID:      postID,
+			FileName:    fileName,
+			ContentType: contentType,
+		}
+		body := &limitedCounter{r: io.MultiReader(bytes.NewReader(head), part), limit: c.MaxSize}
+		if imaging.IsImage(contentType) {
+			err = storeImage(r.Context(), store, &a, body, c.ThumbnailWidths)
+		} else {
+			err = storeFile(r.Context(), store, &a, body)
+		}
+		if err != nil {
+			deleteBlobs(r.Context(), store, a)
+
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.Is(err, errFileTooLarge) || errors.As(err, &maxBytesErr):
+				log.Error("file is too large", slog.Int64("max_size", c.MaxSize))
+				render.JSON(w, r, model.Response{
+					Status: "Error",
+					Error:  fmt.Sprintf("file exceeds %d bytes", c.MaxSize),
+				})
+			case errors.Is(err, errInvalidImage):
+				log.Error("failed to process image", slog.String("error", err.Error()))
+				render.JSON(w, r, model.Response{
+					Status: "Error",
+					Error:  "invalid image",
+				})
+			default:
+				log.Error("failed to save file", slog.String("error", err.Error()))
+				render.JSON(w, r, model.Response{
+					Status: "Error",
+					Error:  "failed to save file",
+				})
+			}
+			return
+		}
+
+		log.Info("file stored", slog.String("key", a.StorageKey), slog.Int64("size", a.Size), slog.Int("variants", len(a.Variants)))
+
+		a.ID, err = s.CreateAttachment(r.Context(), a)
+		if err != nil {
+			log.Error("failed to create attachment", slog.String("error", err.Error()))
+			deleteBlobs(r.Context(), store, a)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to create attachment",
+			})
+			return
+		}
+		a.URL = model.AttachmentURL(a.ID)
+		for i := range a.Variants {
+			a.Variants[i].URL = model.AttachmentVariantURL(a.ID, a.Variants[i].Width)
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   a,
+		})
+	}
+}
+
+func GetAttachments(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.attachment-handlers.GetAttachments"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || postID <= 0 {
+			log.Error("invalid post id", slog.String("id", chi.URLParam(r, "id")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid post id",
+			})
+			return
+		}
+
+		attachments, err := s.GetPostAttachments(r.Context(), postID)
+		if err != nil {
+			log.Error("failed to get attachments", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get attachments",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   attachments,
+		})
+	}
+}
+
+// DownloadAttachment отдает файл вложения. http.ServeContent сам обрабатывает
+// Range, If-Modified-Since и If-Range
+func DownloadAttachment(log *slog.Logger, s Server, store blob.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.attachment-handlers.DownloadAttachment"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || id <= 0 {
+			log.Error("invalid attachment id", slog.String("id", chi.URLParam(r, "id")))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid attachment id",
+			})
+			return
+		}
+
+		a, err := s.GetAttachment(r.Context(), id)
+		if errors.Is(err, storage.ErrAttachmentNotFound) {
+			log.Info("attachment not found", slog.Int("id", id))
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "attachment not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to get attachment", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get attachment",
+			})
+			return
+		}
+
+		serveBlob(w, r, log, store, a.StorageKey, a.ContentType, a.FileName)
+	}
+}
+
+// DownloadAttachmentVariant отдает уменьшенную копию изображения заданной ширины
+func DownloadAttachmentVariant(log *slog.Logger, s Server, store blob.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.attachment-handlers.DownloadAttachmentVariant"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || id <= 0 {
+			log.Error("invalid attachment id", slog.String("id", chi.URLParam(r, "id")))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid attachment id",
+			})
+			return
+		}
+		width, err := strconv.Atoi(chi.URLParam(r, "width"))
+		if err != nil || width <= 0 {
+			log.Error("invalid width", slog.String("width", chi.URLParam(r, "width")))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid width",
+			})
+			return
+		}
+
+		v, err := s.GetAttachmentVariant(r.Context(), id, width)
+		if errors.Is(err, storage.ErrAttachmentNotFound) {
+			log.Info("attachment variant not found", slog.Int("id", id), slog.Int("width", width))
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "attachment not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to get attachment variant", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get attachment",
+			})
+			return
+		}
+
+		serveBlob(w, r, log, store, v.StorageKey, v.ContentType, "")
+	}
+}
+
+func serveBlob(w http.ResponseWriter, r *http.Request, log *slog.Logger, store blob.Store, key, contentType, fileName string) {
+	obj, err := store.Open(r.Context(), key)
+	if err != nil {
+		log.Error("failed to open file", slog.String("error", err.Error()))
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "failed to open file",
+		})
+		return
+	}
+	defer obj.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if fileName != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": fileName}))
+	}
+	http.ServeContent(w, r, fileName, obj.ModTime(), obj)
+}
+
+// storeFile сохраняет файл в хранилище как есть, не загружая его целиком в память
+func storeFile(ctx context.Context, store blob.Store, a *model.Attachment, body *limitedCounter) error {
+	key, err := blob.NewKey(fmt.Sprintf("posts/%d", a.PostID))
+	if err != nil {
+		return err
+	}
+	a.StorageKey = key
+	if err = store.Put(ctx, key, body, -1, a.ContentType); err != nil {
+		return err
+	}
+	a.Size = body.n
+	return nil
+}
+
+// storeImage удаляет из изображения метаданные, строит уменьшенные копии
+// и сохраняет в хранилище и оригинал, и копии
+func storeImage(ctx context.Context, store blob.Store, a *model.Attachment, body *limitedCounter, widths []int) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	img, err := imaging.Process(data, a.ContentType, widths)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidImage, err)
+	}
+
+	key, err := blob.NewKey(fmt.Sprintf("posts/%d", a.PostID))
+	if err != nil {
+		return err
+	}
+	a.StorageKey = key
+	a.Size = int64(len(img.Data))
+	a.Width, a.Height = img.Width, img.Height
+	if err = store.Put(ctx, key, bytes.NewReader(img.Data), a.Size, a.ContentType); err != nil {
+		return err
+	}
+
+	for _, v := range img.Variants {
+		variant := model.AttachmentVariant{
+			Width:       v.Width,
+			Height:      v.Height,
+			ContentType: v.ContentType,
+			Size:        int64(len(v.Data)),
+			StorageKey:  fmt.Sprintf("%s-w%d", key, v.Width),
+		}
+		a.Variants = append(a.Variants, variant)
+		if err = store.Put(ctx, variant.StorageKey, bytes.NewReader(v.Data), variant.Size, variant.ContentType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteBlobs удаляет из хранилища файлы вложения, которое не удалось сохранить
+func deleteBlobs(ctx context.Context, store blob.Store, a model.Attachment) {
+	if a.StorageKey != "" {
+		store.Delete(ctx, a.StorageKey)
+	}
+	for _, v := range a.Variants {
+		store.Delete(ctx, v.StorageKey)
+	}
+}
+
+// limitedCounter считает прочитанные байты и возвращает errFileTooLarge,
+// как только их становится больше limit
+type limitedCounter struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (l *limitedCounter) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.limit {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
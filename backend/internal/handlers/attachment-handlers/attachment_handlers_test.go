@@ -0,0 +1,25 @@
+package attachment_handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsUpload(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodPost, "/api/posts/7/attachments", true},
+		{http.MethodGet, "/api/posts/7/attachments", false},
+		{http.MethodPost, "/api/posts/7/comments", false},
+		{http.MethodGet, "/api/attachments/3", false},
+	}
+	for _, tt := range tests {
+		if got := IsUpload(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Errorf("IsUpload(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
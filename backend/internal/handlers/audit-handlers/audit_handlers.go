@@ -0,0 +1,104 @@
+package audit_handlers
+
+import (
+	"REST_project/internal/handlers/auth"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+)
+
+type Server interface {
+	GetAuditLog(ctx context.Context, enterpriseID int, f model.AuditFilter) ([]model.AuditEntry, error)
+}
+
+type Policy interface {
+	Authorize(ctx context.Context, enterpriseID int, perm policy.Permission) error
+}
+
+// GetLog возвращает журнал аудита предприятия от новых записей к старым.
+// Фильтры: ?entity=, ?entity_id=, ?action=, ?actor=, постранично через ?limit= и ?offset=
+func GetLog(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.audit-handlers.GetLog"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || enterpriseID <= 0 {
+			log.Error("invalid enterprise id", slog.String("id", chi.URLParam(r, "id")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid enterprise id",
+			})
+			return
+		}
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ViewAudit)) {
+			return
+		}
+
+		q := r.URL.Query()
+		f := model.AuditFilter{
+			Entity: q.Get("entity"),
+			Action: q.Get("action"),
+			Actor:  q.Get("actor"),
+			Limit:  defaultLimit,
+		}
+		var ok bool
+		if f.EntityID, ok = queryInt(w, r, log, "entity_id", 0, 1, 0); !ok {
+			return
+		}
+		if f.Limit, ok = queryInt(w, r, log, "limit", defaultLimit, 1, maxLimit); !ok {
+			return
+		}
+		if f.Offset, ok = queryInt(w, r, log, "offset", 0, 0, 0); !ok {
+			return
+		}
+
+		entries, err := s.GetAuditLog(r.Context(), enterpriseID, f)
+		if err != nil {
+			log.Error("failed to get audit log", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get audit log",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   entries,
+		})
+	}
+}
+
+// queryInt читает целый параметр запроса не меньше min и, если max > 0, не больше max
+func queryInt(w http.ResponseWriter, r *http.Request, log *slog.Logger, name string, def, min, max int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || (max > 0 && n > max) {
+		log.Error("invalid "+name, slog.String(name, v))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid " + name,
+		})
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"REST_project/internal/audit"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// Префиксы помогают отличить API-ключ от токена сессии и узнать их в логах и сканерах секретов
+const (
+	keyPrefix                = "evk_"
+	sessionPrefix            = "evs_"
+	participantSessionPrefix = "evp_"
+)
+
+type KeyStore interface {
+	AccountByKey(ctx context.Context, keyHash string) (model.Account, error)
+	AccountBySession(ctx context.Context, tokenHash string) (model.Account, error)
+	ParticipantBySession(ctx context.Context, tokenHash string) (model.Participant, error)
+}
+
+// New возвращает middleware, которое по заголовку Authorization: Bearer <токен> кладет в контекст
+// аккаунт (API-ключ или сессия OIDC) или участника (сессия после входа по ссылке).
+// Запросы без заголовка проходят анонимно. Автор запроса, request id и адрес
+// сохраняются в контексте для журналов аудита
+func New(log *slog.Logger, s KeyStore) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/auth"),
+		)
+
+		log.Info("auth middleware enabled")
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r.WithContext(audit.WithMeta(r.Context(), actionMeta(r, audit.ActorAnonymous))))
+				return
+			}
+
+			token, ok := BearerToken(r)
+			if !ok {
+				unauthorized(w, r, "invalid authorization header")
+				return
+			}
+
+			if IsParticipantToken(token) {
+				participant, err := s.ParticipantBySession(r.Context(), HashKey(token))
+				if err != nil {
+					if !errors.Is(err, storage.ErrParticipantNotFound) {
+						log.Error("failed to resolve participant session",
+							slog.String("error", err.Error()),
+							slog.String("request_id", middleware.GetReqID(r.Context())),
+						)
+					}
+					unauthorized(w, r, "invalid or expired credentials")
+					return
+				}
+				ctx := policy.WithParticipant(r.Context(), participant)
+				ctx = audit.WithMeta(ctx, actionMeta(r, audit.ParticipantActor(participant.ID)))
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			var account model.Account
+			var err error
+			if IsSessionToken(token) {
+				account, err = s.AccountBySession(r.Context(), HashKey(token))
+			} else {
+				account, err = s.AccountByKey(r.Context(), HashKey(token))
+			}
+			if err != nil {
+				if !errors.Is(err, storage.ErrAccountNotFound) {
+					log.Error("failed to resolve bearer token",
+						slog.String("error", err.Error()),
+						slog.String("request_id", middleware.GetReqID(r.Context())),
+					)
+				}
+				unauthorized(w, r, "invalid or expired credentials")
+				return
+			}
+
+			ctx := policy.WithAccount(r.Context(), account)
+			ctx = audit.WithMeta(ctx, actionMeta(r, audit.AccountActor(account.ID)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// NewKey выпускает новый API-ключ и возвращает его вместе с хешем для хранения
+func NewKey() (string, string, error) {
+	return newToken(keyPrefix)
+}
+
+// NewSessionToken выпускает токен сессии и возвращает его вместе с хешем для хранения
+func NewSessionToken() (string, string, error) {
+	return newToken(sessionPrefix)
+}
+
+// NewParticipantToken выпускает токен сессии участника и возвращает его вместе с хешем
+func NewParticipantToken() (string, string, error) {
+	return newToken(participantSessionPrefix)
+}
+
+// NewLoginToken выпускает одноразовый токен для ссылки из письма
+func NewLoginToken() (string, string, error) {
+	return newToken("")
+}
+
+func IsSessionToken(token string) bool {
+	return strings.HasPrefix(token, sessionPrefix)
+}
+
+func IsParticipantToken(token string) bool {
+	return strings.HasPrefix(token, participantSessionPrefix)
+}
+
+// BearerToken достает токен из заголовка Authorization
+func BearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+func newToken(prefix string) (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := prefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashKey(token), nil
+}
+
+// HashKey возвращает sha256 ключа или токена, в базе хранится только он
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Allowed разбирает результат проверки политики и при отказе отвечает клиенту сам
+func Allowed(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) bool {
+	if err == nil {
+		return true
+	}
+
+	log.Error("access denied", slog.String("error", err.Error()))
+	status, msg := http.StatusInternalServerError, "failed to check permissions"
+	switch {
+	case errors.Is(err, policy.ErrUnauthenticated):
+		status, msg = http.StatusUnauthorized, "authentication required"
+	case errors.Is(err, policy.ErrForbidden):
+		status, msg = http.StatusForbidden, "forbidden"
+	case errors.Is(err, storage.ErrEventNotFound):
+		status, msg = http.StatusNotFound, "event not found"
+	case errors.Is(err, storage.ErrPostNotFound):
+		status, msg = http.StatusNotFound, "post not found"
+	}
+	render.Status(r, status)
+	render.JSON(w, r, model.Response{
+		Status: "Error",
+		Error:  msg,
+	})
+	return false
+}
+
+// actionMeta собирает данные для журналов: кто, в каком запросе и с какого адреса
+func actionMeta(r *http.Request, actor string) model.ActionMeta {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return model.ActionMeta{
+		Actor:     actor,
+		RequestID: middleware.GetReqID(r.Context()),
+		IP:        ip,
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	render.Status(r, http.StatusUnauthorized)
+	render.JSON(w, r, model.Response{
+		Status: "Error",
+		Error:  msg,
+	})
+}
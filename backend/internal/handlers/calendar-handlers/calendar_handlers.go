@@ -0,0 +1,160 @@
+package calendar_handlers
+
+import (
+	"REST_project/config"
+	"REST_project/internal/calendar"
+	model "REST_project/internal/models"
+	"REST_project/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// Ленты доступны без входа, как и список событий: календари подписываются по ссылке
+// и не умеют передавать ключи или cookie
+
+type Server interface {
+	GetEvent(ctx context.Context, eventID int) (model.Event, error)
+	GetEnterprise(ctx context.Context, enterpriseID int) (model.Enterprise, error)
+	GetEnterpriseEvents(ctx context.Context, enterpriseID int) ([]model.Event, error)
+}
+
+// EventCalendar отдает событие в формате iCalendar: /events/{id}/calendar.ics
+func EventCalendar(log *slog.Logger, s Server, c config.CalendarCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.calendar-handlers.EventCalendar"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		id, ok := icsParam(w, r, log)
+		if !ok {
+			return
+		}
+
+		event, err := s.GetEvent(r.Context(), id)
+		if errors.Is(err, storage.ErrEventNotFound) {
+			notFound(w, r, log, "event not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get event", slog.String("error", err.Error()))
+			failed(w, r)
+			return
+		}
+		if event.StartsAt == nil {
+			notFound(w, r, log, "event is not scheduled")
+			return
+		}
+
+		cal := calendar.Calendar{Name: event.Name, Domain: c.Domain}
+		serve(w, r, log, cal, []model.Event{event}, fmt.Sprintf("event-%d.ics", id))
+	}
+}
+
+// EnterpriseCalendar отдает ленту событий предприятия для подписки: /enterprises/{id}/calendar.ics.
+// Лента собирается при каждом запросе, поэтому изменения событий видны при следующем обновлении календаря
+func EnterpriseCalendar(log *slog.Logger, s Server, c config.CalendarCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.calendar-handlers.EnterpriseCalendar"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		id, ok := icsParam(w, r, log)
+		if !ok {
+			return
+		}
+
+		enterprise, err := s.GetEnterprise(r.Context(), id)
+		if errors.Is(err, storage.ErrEnterpriseNotFound) {
+			notFound(w, r, log, "enterprise not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get enterprise", slog.String("error", err.Error()))
+			failed(w, r)
+			return
+		}
+		events, err := s.GetEnterpriseEvents(r.Context(), id)
+		if err != nil {
+			log.Error("failed to get events", slog.String("error", err.Error()))
+			failed(w, r)
+			return
+		}
+
+		cal := calendar.Calendar{Name: enterprise.Name, Domain: c.Domain, Refresh: c.Refresh}
+		serve(w, r, log, cal, events, fmt.Sprintf("enterprise-%d.ics", id))
+	}
+}
+
+// icsParam разбирает id из пути. Расширение .ics снимает middleware.URLFormat,
+// другие расширения для календаря не поддерживаются
+func icsParam(w http.ResponseWriter, r *http.Request, log *slog.Logger) (int, bool) {
+	if format, _ := r.Context().Value(middleware.URLFormatCtxKey).(string); format != "ics" {
+		notFound(w, r, log, "calendar is available as .ics")
+		return 0, false
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		log.Error("invalid id", slog.String("id", chi.URLParam(r, "id")))
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid id",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// serve отдает календарь через http.ServeContent: по времени последнего изменения событий
+// он отвечает 304 на If-Modified-Since, и календари не скачивают неизменную ленту заново
+func serve(w http.ResponseWriter, r *http.Request, log *slog.Logger, cal calendar.Calendar, events []model.Event, fileName string) {
+	var buf bytes.Buffer
+	if err := cal.Write(&buf, events); err != nil {
+		log.Error("failed to write calendar", slog.String("error", err.Error()))
+		failed(w, r)
+		return
+	}
+
+	var modified time.Time
+	for _, e := range events {
+		if e.UpdatedAt.After(modified) {
+			modified = e.UpdatedAt
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", fileName))
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, fileName, modified, bytes.NewReader(buf.Bytes()))
+}
+
+func notFound(w http.ResponseWriter, r *http.Request, log *slog.Logger, msg string) {
+	log.Info(msg)
+	render.Status(r, http.StatusNotFound)
+	render.JSON(w, r, model.Response{
+		Status: "Error",
+		Error:  msg,
+	})
+}
+
+func failed(w http.ResponseWriter, r *http.Request) {
+	render.Status(r, http.StatusInternalServerError)
+	render.JSON(w, r, model.Response{
+		Status: "Error",
+		Error:  "failed to build calendar",
+	})
+}
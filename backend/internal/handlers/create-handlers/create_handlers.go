@@ -1,22 +1,37 @@
 package create_handlers
 
 import (
+	"REST_project/internal/handlers/auth"
 	model "REST_project/internal/models"
+	"REST_project/internal/moderation"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"context"
 	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Server interface {
-	CreatePost(content string, event_id int) (int, error)
-	CreateComment(postID int, participantID int, content string) (int, error)
-	GetPosts() ([]model.Post, error)
-	GetComments() ([]model.Comment, error)
+	CreatePost(ctx context.Context, content string, event_id int, notify bool) (int, error)
+	CreatePoll(ctx context.Context, content string, eventID int, poll model.Poll, notify bool) (int, error)
+	CreateComment(ctx context.Context, postID int, participantID int, content, status, reason string) (int, error)
+	Vote(ctx context.Context, postID, participantID int, optionIDs []int) error
+	GetPosts(ctx context.Context) ([]model.Post, error)
+	GetPoll(ctx context.Context, postID int) (*model.Poll, error)
+	GetComments(ctx context.Context) ([]model.Comment, error)
 }
 
+const maxPollOptions = 20
+
 // ... существующие структуры RequestPostCreate и RequestCommentCreate ...
 
 func GetPosts(log *slog.Logger, s Server) http.HandlerFunc {
@@ -29,7 +44,7 @@ func GetPosts(log *slog.Logger, s Server) http.HandlerFunc {
 
 		log.Info("getting posts")
 
-		posts, err := s.GetPosts()
+		posts, err := s.GetPosts(r.Context())
 		if err != nil {
 			log.Error("failed to get posts", slog.String("error", err.Error()))
 			render.JSON(w, r, model.Response{
@@ -56,7 +71,7 @@ func GetComments(log *slog.Logger, s Server) http.HandlerFunc {
 
 		log.Info("getting comments")
 
-		comments, err := s.GetComments()
+		comments, err := s.GetComments(r.Context())
 		if err != nil {
 			log.Error("failed to get comments", slog.String("error", err.Error()))
 			render.JSON(w, r, model.Response{
@@ -75,8 +90,19 @@ func GetComments(log *slog.Logger, s Server) http.HandlerFunc {
 
 
 type RequestPostCreate struct {
-	Content string `json:"content"`
-	EventID int    `json:"event_id"`
+	Content string             `json:"content"`
+	EventID int                `json:"event_id"`
+	Type    string             `json:"type,omitempty"`
+	Poll    *RequestPollCreate `json:"poll,omitempty"`
+	// Notify - срочное объявление: участники, подписанные на push, получат уведомление
+	Notify bool `json:"notify,omitempty"`
+}
+
+type RequestPollCreate struct {
+	Options     []string   `json:"options"`
+	MultiChoice bool       `json:"multi_choice"`
+	Anonymous   bool       `json:"anonymous"`
+	ClosesAt    *time.Time `json:"closes_at,omitempty"`
 }
 
 func respOk(w http.ResponseWriter, r *http.Request) {
@@ -85,7 +111,8 @@ func respOk(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func CreatePost(log *slog.Logger, s Server) http.HandlerFunc {
+// CreatePost публикует пост в событии, доступно организаторам предприятия
+func CreatePost(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "internal.handlers.register-handlers.CreatePost"
 		log = log.With(
@@ -121,9 +148,43 @@ func CreatePost(log *slog.Logger, s Server) http.HandlerFunc {
 			return
 		}
 
+		if req.Type == "" {
+			req.Type = model.PostTypeText
+		}
+		var poll model.Poll
+		switch req.Type {
+		case model.PostTypeText:
+		case model.PostTypePoll:
+			var msg string
+			poll, msg = validatePoll(req.Poll)
+			if msg != "" {
+				log.Error("invalid poll", slog.String("reason", msg))
+				render.JSON(w, r, model.Response{
+					Status: "Error",
+					Error:  msg,
+				})
+				return
+			}
+		default:
+			log.Error("unknown post type", slog.String("type", req.Type))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "unknown post type",
+			})
+			return
+		}
+
+		if !auth.Allowed(w, r, log, p.AuthorizeEvent(r.Context(), req.EventID, policy.ManageEvents)) {
+			return
+		}
+
 		log.Info("creating post", slog.Any("request", req))
 
-		_, err = s.CreatePost(req.Content, req.EventID)
+		if req.Type == model.PostTypePoll {
+			_, err = s.CreatePoll(r.Context(), req.Content, req.EventID, poll, req.Notify)
+		} else {
+			_, err = s.CreatePost(r.Context(), req.Content, req.EventID, req.Notify)
+		}
 		if err != nil {
 			log.Error("failed to create post", slog.String("error", err.Error()))
 			render.JSON(w, r, model.Response{
@@ -137,13 +198,59 @@ func CreatePost(log *slog.Logger, s Server) http.HandlerFunc {
 	}
 }
 
+// validatePoll проверяет параметры опроса и возвращает текст ошибки для клиента
+func validatePoll(req *RequestPollCreate) (model.Poll, string) {
+	if req == nil {
+		return model.Poll{}, "poll is required"
+	}
+	if len(req.Options) < 2 || len(req.Options) > maxPollOptions {
+		return model.Poll{}, fmt.Sprintf("poll must have from 2 to %d options", maxPollOptions)
+	}
+	if req.ClosesAt != nil && !req.ClosesAt.After(time.Now()) {
+		return model.Poll{}, "closes_at must be in the future"
+	}
+
+	poll := model.Poll{
+		MultiChoice: req.MultiChoice,
+		Anonymous:   req.Anonymous,
+		ClosesAt:    req.ClosesAt,
+	}
+	seen := make(map[string]bool, len(req.Options))
+	for _, o := range req.Options {
+		o = strings.TrimSpace(o)
+		if o == "" || seen[o] {
+			return model.Poll{}, "poll options must be non-empty and unique"
+		}
+		seen[o] = true
+		poll.Options = append(poll.Options, model.PollOption{Content: o})
+	}
+	return poll, ""
+}
+
+// RequestCommentCreate - автор комментария берется из сессии участника,
+// participant_id оставлен для старых клиентов и должен совпадать с ней
 type RequestCommentCreate struct {
 	PostID        int    `json:"post_id"`
 	ParticipantID int    `json:"participant_id"`
 	Content       string `json:"content"`
 }
 
-func CreateComment(log *slog.Logger, s Server) http.HandlerFunc {
+// ResponseCommentCreate сообщает клиенту, опубликован комментарий или ждет модерации
+type ResponseCommentCreate struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type Policy interface {
+	AuthorizeEvent(ctx context.Context, eventID int, perm policy.Permission) error
+}
+
+type Moderator interface {
+	Check(ctx context.Context, postID, participantID int, content string) (moderation.Verdict, error)
+}
+
+func CreateComment(log *slog.Logger, s Server, m Moderator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "internal.handlers.register-handlers.CreateComment"
 		log = log.With(
@@ -170,7 +277,13 @@ func CreateComment(log *slog.Logger, s Server) http.HandlerFunc {
 			return
 		}
 
-		if req.Content == "" || req.PostID <= 0 || req.ParticipantID <= 0 {
+		participant, err := policy.ActingParticipant(r.Context(), req.ParticipantID)
+		if !auth.Allowed(w, r, log, err) {
+			return
+		}
+		req.ParticipantID = participant.ID
+
+		if req.Content == "" || req.PostID <= 0 {
 			log.Error("invalid request data")
 			render.JSON(w, r, model.Response{
 				Status: "Error",
@@ -181,15 +294,197 @@ func CreateComment(log *slog.Logger, s Server) http.HandlerFunc {
 
 		log.Info("creating comment", slog.Any("request", req))
 
-		_, err = s.CreateComment(req.PostID, req.ParticipantID, req.Content)
+		verdict, err := m.Check(r.Context(), req.PostID, req.ParticipantID, req.Content)
+		if err != nil {
+			log.Error("failed to moderate comment", slog.String("error", err.Error()))
+			msg := "failed to create comment"
+			if errors.Is(err, storage.ErrPostNotFound) {
+				msg = "post not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+		if verdict.Status != model.CommentApproved {
+			log.Info("comment held by moderation", slog.String("status", verdict.Status), slog.String("reason", verdict.Reason))
+		}
+
+		id, err := s.CreateComment(r.Context(), req.PostID, req.ParticipantID, req.Content, verdict.Status, verdict.Reason)
 		if err != nil {
 			log.Error("failed to create comment", slog.String("error", err.Error()))
+			msg := "failed to create comment"
+			switch {
+			case errors.Is(err, storage.ErrParticipantBanned):
+				msg = "participant is banned from this event"
+			case errors.Is(err, storage.ErrParticipantMuted):
+				msg = "participant is muted in this event"
+			case errors.Is(err, storage.ErrParticipantNotFound):
+				msg = "participant is not registered for this event"
+			}
 			render.JSON(w, r, model.Response{
 				Status: "Error",
-				Error:  "failed to create comment",
+				Error:  msg,
 			})
 			return
 		}
-		respOk(w, r)
+
+		data := ResponseCommentCreate{ID: id, Status: verdict.Status}
+		if verdict.Status == model.CommentRejected {
+			data.Reason = verdict.Reason
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Data:   data,
+				Error:  "comment rejected by moderation",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   data,
+		})
+	}
+}
+
+// RequestVote - голосует участник сессии, participant_id оставлен
+// для старых клиентов и должен совпадать с ней
+type RequestVote struct {
+	ParticipantID int   `json:"participant_id"`
+	OptionIDs     []int `json:"option_ids"`
+}
+
+func Vote(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.create-handlers.Vote"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || postID <= 0 {
+			log.Error("invalid post id", slog.String("id", chi.URLParam(r, "id")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid post id",
+			})
+			return
+		}
+
+		var req RequestVote
+		err = render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "empty request",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to decode request body", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid request format",
+			})
+			return
+		}
+
+		participant, err := policy.ActingParticipant(r.Context(), req.ParticipantID)
+		if !auth.Allowed(w, r, log, err) {
+			return
+		}
+		req.ParticipantID = participant.ID
+
+		if len(req.OptionIDs) == 0 {
+			log.Error("invalid request data")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid data provided",
+			})
+			return
+		}
+
+		log.Info("voting", slog.Int("post_id", postID), slog.Any("request", req))
+
+		err = s.Vote(r.Context(), postID, req.ParticipantID, req.OptionIDs)
+		if err != nil {
+			log.Error("failed to vote", slog.String("error", err.Error()))
+			msg := "failed to vote"
+			switch {
+			case errors.Is(err, storage.ErrPollNotFound):
+				msg = "poll not found"
+			case errors.Is(err, storage.ErrPollClosed):
+				msg = "poll is closed"
+			case errors.Is(err, storage.ErrAlreadyVoted):
+				msg = "already voted"
+			case errors.Is(err, storage.ErrInvalidVote):
+				msg = "invalid options"
+			case errors.Is(err, storage.ErrParticipantNotFound):
+				msg = "participant is not registered for this event"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		poll, err := s.GetPoll(r.Context(), postID)
+		if err != nil {
+			log.Error("failed to get poll", slog.String("error", err.Error()))
+			respOk(w, r)
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   poll,
+		})
+	}
+}
+
+func GetPoll(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.create-handlers.GetPoll"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		postID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || postID <= 0 {
+			log.Error("invalid post id", slog.String("id", chi.URLParam(r, "id")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid post id",
+			})
+			return
+		}
+
+		poll, err := s.GetPoll(r.Context(), postID)
+		if errors.Is(err, storage.ErrPollNotFound) {
+			log.Info("poll not found", slog.Int("post_id", postID))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "poll not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to get poll", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get poll",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   poll,
+		})
 	}
 }
@@ -0,0 +1,23 @@
+// Package deadline продлевает сроки запросам, которым не хватает общего таймаута сервера:
+// загрузкам и выгрузкам больших файлов. Такие запросы исключаются из middleware.Timeout
+// в main, а срок им задает сам обработчик
+package deadline
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Extend продлевает чтение тела, запись ответа и контекст запроса на d от текущего момента.
+// Вызывающий должен вызвать cancel, когда закончит с запросом
+func Extend(w http.ResponseWriter, r *http.Request, d time.Duration) (*http.Request, context.CancelFunc) {
+	until := time.Now().Add(d)
+	// ошибка значит, что соединение не дает продлить срок (http.ErrNotSupported),
+	// тогда действуют ReadTimeout и WriteTimeout сервера
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(until)
+	_ = rc.SetWriteDeadline(until)
+	ctx, cancel := context.WithDeadline(r.Context(), until)
+	return r.WithContext(ctx), cancel
+}
@@ -0,0 +1,310 @@
+package export_handlers
+
+import (
+	"REST_project/config"
+	"REST_project/internal/blob"
+	"REST_project/internal/handlers/auth"
+	"REST_project/internal/handlers/deadline"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+var downloadPath = regexp.MustCompile(`^/events/[^/]+/exports/[^/]+/download$`)
+
+type Server interface {
+	GetExportJob(ctx context.Context, eventID, jobID int) (model.ExportJob, error)
+	GetExportJobs(ctx context.Context, eventID int) ([]model.ExportJob, error)
+}
+
+type Exporter interface {
+	Start(ctx context.Context, eventID int) (model.ExportJob, error)
+	Write(ctx context.Context, w io.Writer, eventID int) error
+}
+
+type Policy interface {
+	AuthorizeEvent(ctx context.Context, eventID int, perm policy.Permission) error
+}
+
+// StartExport ставит выгрузку события в очередь и сразу отвечает 202 с заданием.
+// Ход выгрузки отдает GetExport, готовый архив - DownloadExport
+func StartExport(log *slog.Logger, e Exporter, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.export-handlers.StartExport"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := eventParam(w, r, log, p)
+		if !ok {
+			return
+		}
+
+		job, err := e.Start(r.Context(), eventID)
+		if errors.Is(err, storage.ErrEventNotFound) {
+			log.Info("event not found", slog.Int("event_id", eventID))
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "event not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to start export", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to start export",
+			})
+			return
+		}
+
+		log.Info("export started", slog.Int("event_id", eventID), slog.Int("export_id", job.ID))
+		render.Status(r, http.StatusAccepted)
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   job,
+		})
+	}
+}
+
+// GetExports возвращает выгрузки события от новых к старым
+func GetExports(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.export-handlers.GetExports"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := eventParam(w, r, log, p)
+		if !ok {
+			return
+		}
+
+		jobs, err := s.GetExportJobs(r.Context(), eventID)
+		if err != nil {
+			log.Error("failed to get exports", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get exports",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   jobs,
+		})
+	}
+}
+
+// GetExport возвращает статус и процент готовности выгрузки. У готовой выгрузки заполнен url архива
+func GetExport(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.export-handlers.GetExport"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		job, ok := exportParam(w, r, log, s, p)
+		if !ok {
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   job,
+		})
+	}
+}
+
+// DownloadExport отдает архив готовой выгрузки. http.ServeContent сам обрабатывает Range-запросы
+func DownloadExport(log *slog.Logger, s Server, store blob.Store, p Policy, c config.ExportCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.export-handlers.DownloadExport"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		// архив может быть большим, а объект хранилища читается лениво с контекстом запроса,
+		// поэтому общий таймаут сервера к скачиванию не применяется (см. IsDownload)
+		r, cancel := deadline.Extend(w, r, c.DownloadTimeout)
+		defer cancel()
+
+		job, ok := exportParam(w, r, log, s, p)
+		if !ok {
+			return
+		}
+		if job.Status != model.ExportDone {
+			log.Info("export is not ready", slog.Int("export_id", job.ID), slog.String("status", job.Status))
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  fmt.Sprintf("export is %s", job.Status),
+				Data:   job,
+			})
+			return
+		}
+
+		obj, err := store.Open(r.Context(), job.StorageKey)
+		if err != nil {
+			log.Error("failed to open export", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to read export",
+			})
+			return
+		}
+		defer obj.Close()
+
+		fileName := archiveName(job.EventID)
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+		http.ServeContent(w, r, fileName, obj.ModTime(), obj)
+	}
+}
+
+// IsDownload сообщает, что запрос скачивает готовую выгрузку. Общий таймаут запросов ему мал,
+// срок задает сам DownloadExport
+func IsDownload(r *http.Request) bool {
+	return r.Method == http.MethodGet && downloadPath.MatchString(r.URL.Path)
+}
+
+// ExportEvent сразу отдает архив события в ответ, без задания. Подходит для небольших событий:
+// запрос ограничен таймаутом сервера, большие события выгружаются через StartExport
+func ExportEvent(log *slog.Logger, e Exporter, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.export-handlers.ExportEvent"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := eventParam(w, r, log, p)
+		if !ok {
+			return
+		}
+
+		// заголовки пишутся при первой записи архива, до нее еще можно ответить ошибкой
+		out := &lazyWriter{w: w, header: func() {
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archiveName(eventID)}))
+		}}
+		err := e.Write(r.Context(), out, eventID)
+		if err != nil && !out.started {
+			log.Error("failed to export event", slog.String("error", err.Error()))
+			msg, status := "failed to export event", http.StatusInternalServerError
+			if errors.Is(err, storage.ErrEventNotFound) {
+				msg, status = "event not found", http.StatusNotFound
+			}
+			render.Status(r, status)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+		if err != nil {
+			// архив уже частично отправлен, клиент получит оборванный ZIP
+			log.Error("export interrupted", slog.String("error", err.Error()))
+			return
+		}
+		log.Info("event exported", slog.Int("event_id", eventID))
+	}
+}
+
+// eventParam разбирает id события и проверяет право управлять им
+func eventParam(w http.ResponseWriter, r *http.Request, log *slog.Logger, p Policy) (int, bool) {
+	eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || eventID <= 0 {
+		log.Error("invalid event id", slog.String("id", chi.URLParam(r, "id")))
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid event id",
+		})
+		return 0, false
+	}
+	if !auth.Allowed(w, r, log, p.AuthorizeEvent(r.Context(), eventID, policy.ManageEvents)) {
+		return 0, false
+	}
+	return eventID, true
+}
+
+// exportParam находит выгрузку события по id из пути
+func exportParam(w http.ResponseWriter, r *http.Request, log *slog.Logger, s Server, p Policy) (model.ExportJob, bool) {
+	eventID, ok := eventParam(w, r, log, p)
+	if !ok {
+		return model.ExportJob{}, false
+	}
+	jobID, err := strconv.Atoi(chi.URLParam(r, "jobID"))
+	if err != nil || jobID <= 0 {
+		log.Error("invalid export id", slog.String("id", chi.URLParam(r, "jobID")))
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid export id",
+		})
+		return model.ExportJob{}, false
+	}
+
+	job, err := s.GetExportJob(r.Context(), eventID, jobID)
+	if errors.Is(err, storage.ErrExportNotFound) {
+		log.Info("export not found", slog.Int("export_id", jobID))
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "export not found",
+		})
+		return model.ExportJob{}, false
+	}
+	if err != nil {
+		log.Error("failed to get export", slog.String("error", err.Error()))
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "failed to get export",
+		})
+		return model.ExportJob{}, false
+	}
+	return job, true
+}
+
+func archiveName(eventID int) string {
+	return fmt.Sprintf("event-%d-export.zip", eventID)
+}
+
+// lazyWriter выставляет заголовки ответа перед первой записью
+type lazyWriter struct {
+	w       io.Writer
+	header  func()
+	started bool
+}
+
+func (l *lazyWriter) Write(b []byte) (int, error) {
+	if !l.started {
+		l.started = true
+		l.header()
+	}
+	return l.w.Write(b)
+}
@@ -0,0 +1,25 @@
+package export_handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsDownload(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodGet, "/events/7/exports/3/download", true},
+		{http.MethodPost, "/events/7/exports/3/download", false},
+		{http.MethodGet, "/events/7/exports/3", false},
+		{http.MethodGet, "/events/7/export", false},
+	}
+	for _, tt := range tests {
+		if got := IsDownload(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Errorf("IsDownload(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
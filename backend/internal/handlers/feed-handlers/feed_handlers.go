@@ -0,0 +1,108 @@
+package feed_handlers
+
+import (
+	"REST_project/config"
+	"REST_project/internal/feed"
+	model "REST_project/internal/models"
+	"REST_project/internal/storage"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Server interface {
+	GetEvent(ctx context.Context, eventID int) (model.Event, error)
+	GetEventPosts(ctx context.Context, eventID, limit int) ([]model.Post, error)
+}
+
+// EventFeed отдает последние посты события лентой /events/{id}/feed.atom или /events/{id}/feed.rss.
+// Лента доступна без входа, как и посты. На If-None-Match и If-Modified-Since
+// отвечает 304, если лента не изменилась
+func EventFeed(log *slog.Logger, s Server, c config.FeedCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.feed-handlers.EventFeed"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		// расширение снимает middleware.URLFormat
+		format, _ := r.Context().Value(middleware.URLFormatCtxKey).(string)
+		if format != feed.FormatAtom && format != feed.FormatRSS {
+			log.Info("unknown feed format", slog.String("format", format))
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "feed is available as .atom or .rss",
+			})
+			return
+		}
+
+		eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || eventID <= 0 {
+			log.Error("invalid event id", slog.String("id", chi.URLParam(r, "id")))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid event id",
+			})
+			return
+		}
+
+		event, err := s.GetEvent(r.Context(), eventID)
+		if errors.Is(err, storage.ErrEventNotFound) {
+			log.Info("event not found", slog.Int("event_id", eventID))
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "event not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to get event", slog.String("error", err.Error()))
+			failed(w, r)
+			return
+		}
+		posts, err := s.GetEventPosts(r.Context(), eventID, c.Limit)
+		if err != nil {
+			log.Error("failed to get posts", slog.String("error", err.Error()))
+			failed(w, r)
+			return
+		}
+
+		f := feed.FromEvent(event, posts, format, c)
+		var buf bytes.Buffer
+		if err = feed.Write(&buf, f, format); err != nil {
+			log.Error("failed to write feed", slog.String("error", err.Error()))
+			failed(w, r)
+			return
+		}
+
+		// лента не содержит текущего времени, поэтому одинаковое содержимое дает одинаковый ETag
+		sum := sha256.Sum256(buf.Bytes())
+		w.Header().Set("ETag", fmt.Sprintf("%q", hex.EncodeToString(sum[:16])))
+		w.Header().Set("Content-Type", feed.ContentType(format))
+		w.Header().Set("Cache-Control", "no-cache")
+		// ServeContent сам сверяет If-None-Match с ETag и If-Modified-Since с временем ленты
+		http.ServeContent(w, r, "", f.Updated, bytes.NewReader(buf.Bytes()))
+	}
+}
+
+func failed(w http.ResponseWriter, r *http.Request) {
+	render.Status(r, http.StatusInternalServerError)
+	render.JSON(w, r, model.Response{
+		Status: "Error",
+		Error:  "failed to build feed",
+	})
+}
@@ -0,0 +1,230 @@
+package import_handlers
+
+import (
+	"REST_project/config"
+	"REST_project/internal/handlers/auth"
+	"REST_project/internal/handlers/deadline"
+	"REST_project/internal/importer"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// Режимы импорта
+const (
+	modeDryRun = "dry-run"
+	modeCommit = "commit"
+)
+
+var importPath = regexp.MustCompile(`^/events/[^/]+/participants/import$`)
+
+type Server interface {
+	ParticipantIndex(ctx context.Context, eventID int) (model.ParticipantIndex, error)
+	ImportParticipants(ctx context.Context, eventID int, participants iter.Seq2[model.Participant, error]) (int, error)
+}
+
+type Policy interface {
+	AuthorizeEvent(ctx context.Context, eventID int, perm policy.Permission) error
+}
+
+// IsImport сообщает, что запрос загружает файл импорта. Общий таймаут запросов ему мал,
+// срок задает сам ImportParticipants
+func IsImport(r *http.Request) bool {
+	return r.Method == http.MethodPost && importPath.MatchString(r.URL.Path)
+}
+
+// ImportParticipants регистрирует участников события из файла CSV (столбцы name и email)
+// или JSON Lines (объекты {"name", "email"}) в теле запроса. Формат берется из ?format=
+// или Content-Type. По умолчанию работает как ?mode=dry-run: проверяет файл и ничего не пишет;
+// ?mode=commit регистрирует прошедшие проверку строки. Файл читается потоком, строки с ошибками
+// и дубликаты пропускаются и попадают в отчет
+func ImportParticipants(log *slog.Logger, s Server, p Policy, c config.ImportCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.import-handlers.ImportParticipants"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		r, cancel := deadline.Extend(w, r, c.Timeout)
+		defer cancel()
+
+		eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || eventID <= 0 {
+			log.Error("invalid event id", slog.String("id", chi.URLParam(r, "id")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid event id",
+			})
+			return
+		}
+		if !auth.Allowed(w, r, log, p.AuthorizeEvent(r.Context(), eventID, policy.ManageEvents)) {
+			return
+		}
+
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = modeDryRun
+		}
+		if mode != modeDryRun && mode != modeCommit {
+			log.Error("invalid mode", slog.String("mode", mode))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "mode must be dry-run or commit",
+			})
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = importer.FormatFromContentType(r.Header.Get("Content-Type"))
+		}
+
+		index, err := s.ParticipantIndex(r.Context(), eventID)
+		if err != nil {
+			log.Error("failed to load participants", slog.String("error", err.Error()))
+			msg := "failed to import participants"
+			if errors.Is(err, storage.ErrEventNotFound) {
+				msg = "event not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, c.MaxSize)
+		reader, err := importer.NewReader(r.Body, format)
+		if err != nil {
+			log.Error("failed to open import file", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  readErrorMessage(err, c),
+			})
+			return
+		}
+
+		report := model.ImportReport{DryRun: mode == modeDryRun, Errors: []model.ImportRowError{}}
+		addError := func(line int, err error) {
+			report.Failed++
+			if len(report.Errors) >= c.MaxErrors {
+				report.ErrorsTruncated = true
+				return
+			}
+			report.Errors = append(report.Errors, model.ImportRowError{Row: line, Error: err.Error()})
+		}
+
+		// readErr - ошибка чтения самого файла, после нее импорт отменяется
+		var readErr error
+		validator := importer.NewValidator(index)
+		rows := func(yield func(model.Participant, error) bool) {
+			for {
+				line, participant, err := reader.Read()
+				if errors.Is(err, io.EOF) {
+					return
+				}
+				var rowErr *importer.RowError
+				if errors.As(err, &rowErr) {
+					report.Rows++
+					addError(rowErr.Line, rowErr.Err)
+					continue
+				}
+				if err != nil {
+					readErr = err
+					yield(model.Participant{}, err)
+					return
+				}
+
+				report.Rows++
+				if err := validator.Check(&participant); err != nil {
+					addError(line, err)
+					continue
+				}
+				report.Valid++
+				if !yield(participant, nil) {
+					return
+				}
+			}
+		}
+
+		if report.DryRun {
+			for _, err := range rows {
+				if err != nil {
+					break
+				}
+			}
+		} else {
+			report.Imported, err = s.ImportParticipants(r.Context(), eventID, rows)
+		}
+
+		if readErr != nil {
+			log.Error("failed to read import file", slog.String("error", readErr.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  readErrorMessage(readErr, c),
+				Data:   report,
+			})
+			return
+		}
+		if err == nil && report.DryRun && index.Capacity > 0 && index.Registered+report.Valid > index.Capacity {
+			err = storage.ErrEventFull
+		}
+		if err != nil {
+			log.Error("failed to import participants", slog.String("error", err.Error()))
+			msg := "failed to import participants"
+			switch {
+			case errors.Is(err, storage.ErrEventNotFound):
+				msg = "event not found"
+			case errors.Is(err, storage.ErrEventFull):
+				msg = fmt.Sprintf("event is full: %d of %d places are taken", index.Registered, index.Capacity)
+			case errors.Is(err, storage.ErrEmailTaken):
+				msg = "participants were registered while importing, retry the import"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+				Data:   report,
+			})
+			return
+		}
+
+		log.Info("participants imported",
+			slog.Int("event_id", eventID),
+			slog.Bool("dry_run", report.DryRun),
+			slog.Int("rows", report.Rows),
+			slog.Int("imported", report.Imported),
+		)
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   report,
+		})
+	}
+}
+
+// readErrorMessage переводит ошибку чтения файла в сообщение для клиента
+func readErrorMessage(err error, c config.ImportCfg) string {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return fmt.Sprintf("file exceeds %d bytes", c.MaxSize)
+	case errors.Is(err, importer.ErrUnknownFormat):
+		return "format must be csv or jsonl"
+	case errors.Is(err, importer.ErrMissingName):
+		return importer.ErrMissingName.Error()
+	}
+	return "failed to read file"
+}
@@ -0,0 +1,25 @@
+package import_handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsImport(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodPost, "/events/7/participants/import", true},
+		{http.MethodGet, "/events/7/participants/import", false},
+		{http.MethodPost, "/events/7/participants/3/session", false},
+		{http.MethodPost, "/events/7/participants/import/extra", false},
+	}
+	for _, tt := range tests {
+		if got := IsImport(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Errorf("IsImport(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package live_handlers
+
+import (
+	"REST_project/config"
+	"REST_project/internal/live"
+	model "REST_project/internal/models"
+	"REST_project/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// writeTimeout - сколько ждать записи в поток. Клиент, который не читает дольше, отключается
+const writeTimeout = 10 * time.Second
+
+// retryMS - через сколько EventSource переподключится после обрыва
+const retryMS = 3000
+
+var streamPath = regexp.MustCompile(`^/events/[^/]+/live$`)
+
+type Server interface {
+	GetEvent(ctx context.Context, eventID int) (model.Event, error)
+}
+
+type Hub interface {
+	Subscribe(eventID int) *live.Subscription
+	Unsubscribe(sub *live.Subscription)
+}
+
+// IsStream сообщает, что запрос открывает поток событий. Потоку не подходит общий таймаут
+// запросов: он открыт, пока клиент не уйдет
+func IsStream(r *http.Request) bool {
+	return streamPath.MatchString(r.URL.Path)
+}
+
+// EventStream отдает обновления события потоком Server-Sent Events: /events/{id}/live.
+// Поток доступен без входа, как и посты. Сообщение - доменное событие: id - его номер,
+// event - тип, data - JSON сущности
+func EventStream(log *slog.Logger, s Server, h Hub, c config.LiveCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.live-handlers.EventStream"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || eventID <= 0 {
+			log.Error("invalid event id", slog.String("id", chi.URLParam(r, "id")))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid event id",
+			})
+			return
+		}
+
+		_, err = s.GetEvent(r.Context(), eventID)
+		if errors.Is(err, storage.ErrEventNotFound) {
+			log.Info("event not found", slog.Int("event_id", eventID))
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "event not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to get event", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to open stream",
+			})
+			return
+		}
+
+		sub := h.Subscribe(eventID)
+		defer h.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// nginx иначе копит поток в буфере
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		rc := http.NewResponseController(w)
+		send := func(format string, args ...any) bool {
+			// срок записи сервера рассчитан на обычные запросы, для потока он ставится на каждую запись
+			if err := rc.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return false
+			}
+			if _, err := fmt.Fprintf(w, format, args...); err != nil {
+				return false
+			}
+			return rc.Flush() == nil
+		}
+
+		if !send("retry: %d\n\n", retryMS) {
+			return
+		}
+		log.Debug("live stream opened", slog.Int("event_id", eventID))
+
+		heartbeat := time.NewTicker(max(c.Heartbeat, time.Second))
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case msg, ok := <-sub.C:
+				if !ok {
+					// hub отключил медленного клиента или сервер останавливается: EventSource переподключится
+					return
+				}
+				if !send("id: %d\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, msg.Data) {
+					return
+				}
+			case <-heartbeat.C:
+				if !send(": ping\n\n") {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package member_handlers
+
+import (
+	"REST_project/internal/handlers/auth"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Server interface {
+	GetMembers(ctx context.Context, enterpriseID int) ([]model.Member, error)
+	MemberRole(ctx context.Context, enterpriseID, accountID int) (string, error)
+	AddMember(ctx context.Context, enterpriseID int, email, role string) (int, error)
+	SetMemberRole(ctx context.Context, enterpriseID, accountID int, role string) error
+	RemoveMember(ctx context.Context, enterpriseID, accountID int) error
+	GetGroupMappings(ctx context.Context, enterpriseID int) ([]model.GroupMapping, error)
+	GetGroupMapping(ctx context.Context, enterpriseID, mappingID int) (model.GroupMapping, error)
+	CreateGroupMapping(ctx context.Context, enterpriseID int, group, role string) (int, error)
+	DeleteGroupMapping(ctx context.Context, enterpriseID, mappingID int) error
+}
+
+type Policy interface {
+	Authorize(ctx context.Context, enterpriseID int, perm policy.Permission) error
+	AuthorizeRoles(ctx context.Context, enterpriseID int, roles ...string) error
+}
+
+type RequestMemberAdd struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type RequestMemberRole struct {
+	Role string `json:"role"`
+}
+
+type RequestGroupMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+func respOk(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, model.Response{
+		Status: "OK",
+	})
+}
+
+// GetMembers возвращает сотрудников предприятия, доступно любому его сотруднику
+func GetMembers(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.member-handlers.GetMembers"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ViewEnterprise)) {
+			return
+		}
+
+		members, err := s.GetMembers(r.Context(), enterpriseID)
+		if err != nil {
+			log.Error("failed to get members", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get members",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   members,
+		})
+	}
+}
+
+// AddMember добавляет в предприятие аккаунт по email. Назначить можно только роль ниже своей,
+// владелец может назначать любые
+func AddMember(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.member-handlers.AddMember"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+
+		var req RequestMemberAdd
+		if !decode(w, r, log, &req) {
+			return
+		}
+		req.Email = strings.TrimSpace(req.Email)
+		if req.Email == "" || !policy.ValidRole(req.Role) {
+			log.Error("invalid request data", slog.Any("request", req))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "email and a valid role are required",
+			})
+			return
+		}
+
+		if !auth.Allowed(w, r, log, p.AuthorizeRoles(r.Context(), enterpriseID, req.Role)) {
+			return
+		}
+
+		log.Info("adding member", slog.Int("enterprise_id", enterpriseID), slog.Any("request", req))
+
+		accountID, err := s.AddMember(r.Context(), enterpriseID, req.Email, req.Role)
+		if err != nil {
+			log.Error("failed to add member", slog.String("error", err.Error()))
+			msg := "failed to add member"
+			switch {
+			case errors.Is(err, storage.ErrAccountNotFound):
+				msg = "account not found"
+			case errors.Is(err, storage.ErrAlreadyMember):
+				msg = "account is already a member"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   map[string]int{"account_id": accountID},
+		})
+	}
+}
+
+// SetMemberRole меняет роль сотрудника. Нужно право управлять и текущей, и новой ролью
+func SetMemberRole(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.member-handlers.SetMemberRole"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		accountID, ok := urlID(w, r, log, "accountID", "account")
+		if !ok {
+			return
+		}
+
+		var req RequestMemberRole
+		if !decode(w, r, log, &req) {
+			return
+		}
+		if !policy.ValidRole(req.Role) {
+			log.Error("invalid role", slog.String("role", req.Role))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid role",
+			})
+			return
+		}
+
+		current, ok := memberRole(w, r, log, s, p, enterpriseID, accountID)
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.AuthorizeRoles(r.Context(), enterpriseID, current, req.Role)) {
+			return
+		}
+
+		log.Info("changing member role", slog.Int("account_id", accountID), slog.String("from", current), slog.String("to", req.Role))
+
+		err := s.SetMemberRole(r.Context(), enterpriseID, accountID, req.Role)
+		if err != nil {
+			log.Error("failed to change member role", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  memberError(err, "failed to change member role"),
+			})
+			return
+		}
+		respOk(w, r)
+	}
+}
+
+func RemoveMember(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.member-handlers.RemoveMember"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		accountID, ok := urlID(w, r, log, "accountID", "account")
+		if !ok {
+			return
+		}
+
+		current, ok := memberRole(w, r, log, s, p, enterpriseID, accountID)
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.AuthorizeRoles(r.Context(), enterpriseID, current)) {
+			return
+		}
+
+		log.Info("removing member", slog.Int("account_id", accountID), slog.String("role", current))
+
+		err := s.RemoveMember(r.Context(), enterpriseID, accountID)
+		if err != nil {
+			log.Error("failed to remove member", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  memberError(err, "failed to remove member"),
+			})
+			return
+		}
+		respOk(w, r)
+	}
+}
+
+// GetGroupMappings возвращает сопоставления групп провайдера OIDC ролям предприятия
+func GetGroupMappings(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.member-handlers.GetGroupMappings"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ManageMembers)) {
+			return
+		}
+
+		mappings, err := s.GetGroupMappings(r.Context(), enterpriseID)
+		if err != nil {
+			log.Error("failed to get group mappings", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get group mappings",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   mappings,
+		})
+	}
+}
+
+// CreateGroupMapping выдает участникам группы провайдера роль при следующем входе.
+// Сопоставить можно только роль, которую сотрудник мог бы назначить сам
+func CreateGroupMapping(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.member-handlers.CreateGroupMapping"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+
+		var req RequestGroupMapping
+		if !decode(w, r, log, &req) {
+			return
+		}
+		req.Group = strings.TrimSpace(req.Group)
+		if req.Group == "" || len(req.Group) > 255 || !policy.ValidRole(req.Role) {
+			log.Error("invalid request data", slog.Any("request", req))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "group and a valid role are required",
+			})
+			return
+		}
+
+		if !auth.Allowed(w, r, log, p.AuthorizeRoles(r.Context(), enterpriseID, req.Role)) {
+			return
+		}
+
+		log.Info("creating group mapping", slog.Int("enterprise_id", enterpriseID), slog.Any("request", req))
+
+		id, err := s.CreateGroupMapping(r.Context(), enterpriseID, req.Group, req.Role)
+		if err != nil {
+			log.Error("failed to create group mapping", slog.String("error", err.Error()))
+			msg := "failed to create group mapping"
+			if errors.Is(err, storage.ErrMappingExists) {
+				msg = "group is already mapped"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   map[string]int{"id": id},
+		})
+	}
+}
+
+// DeleteGroupMapping удаляет сопоставление. Выданные по нему роли снимаются при следующем входе
+func DeleteGroupMapping(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.member-handlers.DeleteGroupMapping"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		mappingID, ok := urlID(w, r, log, "mappingID", "mapping")
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ManageMembers)) {
+			return
+		}
+
+		mapping, err := s.GetGroupMapping(r.Context(), enterpriseID, mappingID)
+		if err == nil {
+			if !auth.Allowed(w, r, log, p.AuthorizeRoles(r.Context(), enterpriseID, mapping.Role)) {
+				return
+			}
+			err = s.DeleteGroupMapping(r.Context(), enterpriseID, mappingID)
+		}
+		if err != nil {
+			log.Error("failed to delete group mapping", slog.String("error", err.Error()))
+			msg := "failed to delete group mapping"
+			if errors.Is(err, storage.ErrMappingNotFound) {
+				msg = "group mapping not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+		respOk(w, r)
+	}
+}
+
+// memberRole возвращает текущую роль сотрудника. Сначала проверяет, что
+// запрашивающий вообще может видеть сотрудников, чтобы не раскрывать состав чужого предприятия
+func memberRole(w http.ResponseWriter, r *http.Request, log *slog.Logger, s Server, p Policy, enterpriseID, accountID int) (string, bool) {
+	if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ManageMembers)) {
+		return "", false
+	}
+
+	role, err := s.MemberRole(r.Context(), enterpriseID, accountID)
+	if err != nil {
+		log.Error("failed to get member role", slog.String("error", err.Error()))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "failed to get member",
+		})
+		return "", false
+	}
+	if role == "" {
+		log.Error("member not found", slog.Int("account_id", accountID))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "member not found",
+		})
+		return "", false
+	}
+	return role, true
+}
+
+func memberError(err error, fallback string) string {
+	switch {
+	case errors.Is(err, storage.ErrMemberNotFound):
+		return "member not found"
+	case errors.Is(err, storage.ErrLastOwner):
+		return "enterprise must keep at least one owner"
+	}
+	return fallback
+}
+
+// urlID достает из пути положительный id, при ошибке отвечает клиенту сам
+func urlID(w http.ResponseWriter, r *http.Request, log *slog.Logger, param, entity string) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, param))
+	if err != nil || id <= 0 {
+		log.Error("invalid "+entity+" id", slog.String("id", chi.URLParam(r, param)))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid " + entity + " id",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, log *slog.Logger, v any) bool {
+	err := render.DecodeJSON(r.Body, v)
+	if errors.Is(err, io.EOF) {
+		log.Error("request body is empty")
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "empty request",
+		})
+		return false
+	}
+	if err != nil {
+		log.Error("failed to decode request body", slog.String("error", err.Error()))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid request format",
+		})
+		return false
+	}
+	return true
+}
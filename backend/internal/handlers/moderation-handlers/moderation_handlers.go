@@ -0,0 +1,760 @@
+package moderation_handlers
+
+import (
+	"REST_project/internal/handlers/auth"
+	model "REST_project/internal/models"
+	"REST_project/internal/moderation"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+const (
+	maxPatternLen = 255
+	maxReasonLen  = 1000
+
+	defaultLogLimit = 100
+	maxLogLimit     = 500
+)
+
+type Server interface {
+	GetPendingComments(ctx context.Context, eventID int) ([]model.Comment, error)
+	ModerateComment(ctx context.Context, eventID, commentID int, status, reason string) error
+	SetPremoderation(ctx context.Context, eventID int, enabled bool) error
+	CreateModerationRule(ctx context.Context, enterpriseID int, pattern string, isRegex bool) (int, error)
+	GetModerationRules(ctx context.Context, enterpriseID int) ([]model.ModerationRule, error)
+	DeleteModerationRule(ctx context.Context, enterpriseID, ruleID int) error
+	CreateReport(ctx context.Context, eventID, commentID, reporterID int, reason string) (int, error)
+	GetReports(ctx context.Context, eventID int, status string) ([]model.CommentReport, error)
+	ResolveReport(ctx context.Context, eventID, reportID int, status string) error
+	CreateSanction(ctx context.Context, sanction model.Sanction) (int, error)
+	GetSanctions(ctx context.Context, eventID int, activeOnly bool) ([]model.Sanction, error)
+	RevokeSanction(ctx context.Context, eventID, sanctionID int) error
+	GetModerationLog(ctx context.Context, eventID, limit, offset int) ([]model.ModerationLogEntry, error)
+}
+
+type RequestReject struct {
+	Reason string `json:"reason"`
+}
+
+type RequestPremoderation struct {
+	Enabled bool `json:"enabled"`
+}
+
+type RequestRuleCreate struct {
+	Pattern string `json:"pattern"`
+	IsRegex bool   `json:"is_regex"`
+}
+
+// RequestReport - жалобу подает участник сессии, participant_id оставлен
+// для старых клиентов и должен совпадать с ней
+type RequestReport struct {
+	ParticipantID int    `json:"participant_id"`
+	Reason        string `json:"reason"`
+}
+
+type RequestReportResolve struct {
+	Status string `json:"status"`
+}
+
+// RequestSanction - Duration в формате time.ParseDuration ("30m", "24h"), пустая строка - бессрочно
+type RequestSanction struct {
+	ParticipantID int    `json:"participant_id"`
+	Kind          string `json:"kind"`
+	Reason        string `json:"reason"`
+	Duration      string `json:"duration"`
+}
+
+type Policy interface {
+	Authorize(ctx context.Context, enterpriseID int, perm policy.Permission) error
+	AuthorizeEvent(ctx context.Context, eventID int, perm policy.Permission) error
+}
+
+func respOk(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, model.Response{
+		Status: "OK",
+	})
+}
+
+// GetQueue возвращает комментарии события, ожидающие модерации
+func GetQueue(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.GetQueue"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := authorizeEvent(w, r, log, p, policy.ModerateEvents)
+		if !ok {
+			return
+		}
+
+		comments, err := s.GetPendingComments(r.Context(), eventID)
+		if err != nil {
+			log.Error("failed to get moderation queue", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get moderation queue",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   comments,
+		})
+	}
+}
+
+func ApproveComment(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.ApproveComment"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := authorizeEvent(w, r, log, p, policy.ModerateEvents)
+		if !ok {
+			return
+		}
+		commentID, ok := urlID(w, r, log, "commentID", "comment")
+		if !ok {
+			return
+		}
+
+		log.Info("approving comment", slog.Int("comment_id", commentID))
+		moderate(w, r, log, s, eventID, commentID, model.CommentApproved, "")
+	}
+}
+
+// RejectComment отклоняет комментарий. Причина обязательна и сохраняется вместе с комментарием
+func RejectComment(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.RejectComment"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := authorizeEvent(w, r, log, p, policy.ModerateEvents)
+		if !ok {
+			return
+		}
+		commentID, ok := urlID(w, r, log, "commentID", "comment")
+		if !ok {
+			return
+		}
+
+		var req RequestReject
+		if !decode(w, r, log, &req) {
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" {
+			log.Error("reason is empty")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "reason is required",
+			})
+			return
+		}
+
+		log.Info("rejecting comment", slog.Int("comment_id", commentID), slog.String("reason", req.Reason))
+		moderate(w, r, log, s, eventID, commentID, model.CommentRejected, req.Reason)
+	}
+}
+
+func moderate(w http.ResponseWriter, r *http.Request, log *slog.Logger, s Server, eventID, commentID int, status, reason string) {
+	err := s.ModerateComment(r.Context(), eventID, commentID, status, reason)
+	if err != nil {
+		log.Error("failed to moderate comment", slog.String("error", err.Error()))
+		msg := "failed to moderate comment"
+		if errors.Is(err, storage.ErrCommentNotFound) {
+			msg = "comment not found"
+		}
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  msg,
+		})
+		return
+	}
+	respOk(w, r)
+}
+
+func SetPremoderation(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.SetPremoderation"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := authorizeEvent(w, r, log, p, policy.ManageEvents)
+		if !ok {
+			return
+		}
+
+		var req RequestPremoderation
+		if !decode(w, r, log, &req) {
+			return
+		}
+
+		log.Info("setting premoderation", slog.Int("event_id", eventID), slog.Bool("enabled", req.Enabled))
+
+		err := s.SetPremoderation(r.Context(), eventID, req.Enabled)
+		if err != nil {
+			log.Error("failed to set premoderation", slog.String("error", err.Error()))
+			msg := "failed to set premoderation"
+			if errors.Is(err, storage.ErrEventNotFound) {
+				msg = "event not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+		respOk(w, r)
+	}
+}
+
+func GetRules(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.GetRules"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := authorizeEnterprise(w, r, log, p, policy.ViewEnterprise)
+		if !ok {
+			return
+		}
+
+		rules, err := s.GetModerationRules(r.Context(), enterpriseID)
+		if err != nil {
+			log.Error("failed to get moderation rules", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get moderation rules",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   rules,
+		})
+	}
+}
+
+// CreateRule добавляет в блок-лист предприятия слово, фразу или регулярное выражение
+func CreateRule(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.CreateRule"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := authorizeEnterprise(w, r, log, p, policy.ManageRules)
+		if !ok {
+			return
+		}
+
+		var req RequestRuleCreate
+		if !decode(w, r, log, &req) {
+			return
+		}
+		req.Pattern = strings.TrimSpace(req.Pattern)
+		if req.Pattern == "" || len(req.Pattern) > maxPatternLen {
+			log.Error("invalid pattern")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid pattern",
+			})
+			return
+		}
+		if req.IsRegex {
+			if _, err := moderation.CompileRule(req.Pattern); err != nil {
+				log.Error("invalid regex", slog.String("error", err.Error()))
+				render.JSON(w, r, model.Response{
+					Status: "Error",
+					Error:  "invalid regular expression",
+				})
+				return
+			}
+		}
+
+		log.Info("creating moderation rule", slog.Int("enterprise_id", enterpriseID), slog.Any("request", req))
+
+		id, err := s.CreateModerationRule(r.Context(), enterpriseID, req.Pattern, req.IsRegex)
+		if err != nil {
+			log.Error("failed to create moderation rule", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to create moderation rule",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   map[string]int{"id": id},
+		})
+	}
+}
+
+func DeleteRule(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.DeleteRule"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := authorizeEnterprise(w, r, log, p, policy.ManageRules)
+		if !ok {
+			return
+		}
+		ruleID, ok := urlID(w, r, log, "ruleID", "rule")
+		if !ok {
+			return
+		}
+
+		err := s.DeleteModerationRule(r.Context(), enterpriseID, ruleID)
+		if err != nil {
+			log.Error("failed to delete moderation rule", slog.String("error", err.Error()))
+			msg := "failed to delete moderation rule"
+			if errors.Is(err, storage.ErrRuleNotFound) {
+				msg = "moderation rule not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+		respOk(w, r)
+	}
+}
+
+// ReportComment принимает жалобу участника события на комментарий
+func ReportComment(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.ReportComment"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := urlID(w, r, log, "id", "event")
+		if !ok {
+			return
+		}
+		commentID, ok := urlID(w, r, log, "commentID", "comment")
+		if !ok {
+			return
+		}
+
+		var req RequestReport
+		if !decode(w, r, log, &req) {
+			return
+		}
+		participant, err := policy.ActingParticipant(r.Context(), req.ParticipantID)
+		if !auth.Allowed(w, r, log, err) {
+			return
+		}
+
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" || len(req.Reason) > maxReasonLen {
+			log.Error("invalid report", slog.Any("request", req))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "reason is required",
+			})
+			return
+		}
+
+		log.Info("reporting comment", slog.Int("comment_id", commentID), slog.Int("participant_id", participant.ID))
+
+		id, err := s.CreateReport(r.Context(), eventID, commentID, participant.ID, req.Reason)
+		if err != nil {
+			log.Error("failed to create report", slog.String("error", err.Error()))
+			msg := "failed to create report"
+			switch {
+			case errors.Is(err, storage.ErrCommentNotFound):
+				msg = "comment not found"
+			case errors.Is(err, storage.ErrParticipantNotFound):
+				msg = "participant is not registered for this event"
+			case errors.Is(err, storage.ErrAlreadyReported):
+				msg = "comment already reported"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   map[string]int{"id": id},
+		})
+	}
+}
+
+// GetReports возвращает жалобы события, ?status= фильтрует по статусу
+func GetReports(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.GetReports"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := authorizeEvent(w, r, log, p, policy.ModerateEvents)
+		if !ok {
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", model.ReportOpen, model.ReportResolved, model.ReportDismissed:
+		default:
+			log.Error("invalid status", slog.String("status", status))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid status",
+			})
+			return
+		}
+
+		reports, err := s.GetReports(r.Context(), eventID, status)
+		if err != nil {
+			log.Error("failed to get reports", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get reports",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   reports,
+		})
+	}
+}
+
+func ResolveReport(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.ResolveReport"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := authorizeEvent(w, r, log, p, policy.ModerateEvents)
+		if !ok {
+			return
+		}
+		reportID, ok := urlID(w, r, log, "reportID", "report")
+		if !ok {
+			return
+		}
+
+		var req RequestReportResolve
+		if !decode(w, r, log, &req) {
+			return
+		}
+		if req.Status != model.ReportResolved && req.Status != model.ReportDismissed {
+			log.Error("invalid status", slog.String("status", req.Status))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "status must be resolved or dismissed",
+			})
+			return
+		}
+
+		log.Info("resolving report", slog.Int("report_id", reportID), slog.String("status", req.Status))
+
+		err := s.ResolveReport(r.Context(), eventID, reportID, req.Status)
+		if err != nil {
+			log.Error("failed to resolve report", slog.String("error", err.Error()))
+			msg := "failed to resolve report"
+			if errors.Is(err, storage.ErrReportNotFound) {
+				msg = "report not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+		respOk(w, r)
+	}
+}
+
+// CreateSanction заглушает (mute) или банит (ban) участника события, на срок или бессрочно
+func CreateSanction(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.CreateSanction"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := authorizeEvent(w, r, log, p, policy.ModerateEvents)
+		if !ok {
+			return
+		}
+
+		var req RequestSanction
+		if !decode(w, r, log, &req) {
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.ParticipantID <= 0 || (req.Kind != model.SanctionMute && req.Kind != model.SanctionBan) || len(req.Reason) > maxReasonLen {
+			log.Error("invalid sanction", slog.Any("request", req))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "participant_id and kind (mute or ban) are required",
+			})
+			return
+		}
+
+		sanction := model.Sanction{
+			EventID:       eventID,
+			ParticipantID: req.ParticipantID,
+			Kind:          req.Kind,
+			Reason:        req.Reason,
+		}
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil || d <= 0 {
+				log.Error("invalid duration", slog.String("duration", req.Duration))
+				render.JSON(w, r, model.Response{
+					Status: "Error",
+					Error:  "invalid duration",
+				})
+				return
+			}
+			expiresAt := time.Now().Add(d)
+			sanction.ExpiresAt = &expiresAt
+		}
+
+		log.Info("creating sanction", slog.Int("event_id", eventID), slog.Any("request", req))
+
+		id, err := s.CreateSanction(r.Context(), sanction)
+		if err != nil {
+			log.Error("failed to create sanction", slog.String("error", err.Error()))
+			msg := "failed to create sanction"
+			if errors.Is(err, storage.ErrParticipantNotFound) {
+				msg = "participant is not registered for this event"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   map[string]int{"id": id},
+		})
+	}
+}
+
+// GetSanctions возвращает санкции события, ?active=true - только действующие
+func GetSanctions(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.GetSanctions"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := authorizeEvent(w, r, log, p, policy.ModerateEvents)
+		if !ok {
+			return
+		}
+
+		activeOnly, _ := strconv.ParseBool(r.URL.Query().Get("active"))
+
+		sanctions, err := s.GetSanctions(r.Context(), eventID, activeOnly)
+		if err != nil {
+			log.Error("failed to get sanctions", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get sanctions",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   sanctions,
+		})
+	}
+}
+
+func RevokeSanction(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.RevokeSanction"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := authorizeEvent(w, r, log, p, policy.ModerateEvents)
+		if !ok {
+			return
+		}
+		sanctionID, ok := urlID(w, r, log, "sanctionID", "sanction")
+		if !ok {
+			return
+		}
+
+		log.Info("revoking sanction", slog.Int("sanction_id", sanctionID))
+
+		err := s.RevokeSanction(r.Context(), eventID, sanctionID)
+		if err != nil {
+			log.Error("failed to revoke sanction", slog.String("error", err.Error()))
+			msg := "failed to revoke sanction"
+			if errors.Is(err, storage.ErrSanctionNotFound) {
+				msg = "sanction not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+		respOk(w, r)
+	}
+}
+
+// GetLog возвращает журнал модерации события, постранично через ?limit= и ?offset=
+func GetLog(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.moderation-handlers.GetLog"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := authorizeEvent(w, r, log, p, policy.ModerateEvents)
+		if !ok {
+			return
+		}
+
+		limit, offset := defaultLogLimit, 0
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > maxLogLimit {
+				log.Error("invalid limit", slog.String("limit", v))
+				render.JSON(w, r, model.Response{
+					Status: "Error",
+					Error:  "invalid limit",
+				})
+				return
+			}
+			limit = n
+		}
+		if v := r.URL.Query().Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				log.Error("invalid offset", slog.String("offset", v))
+				render.JSON(w, r, model.Response{
+					Status: "Error",
+					Error:  "invalid offset",
+				})
+				return
+			}
+			offset = n
+		}
+
+		entries, err := s.GetModerationLog(r.Context(), eventID, limit, offset)
+		if err != nil {
+			log.Error("failed to get moderation log", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get moderation log",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   entries,
+		})
+	}
+}
+
+// authorizeEvent достает id события из пути и проверяет разрешение в нем
+func authorizeEvent(w http.ResponseWriter, r *http.Request, log *slog.Logger, p Policy, perm policy.Permission) (int, bool) {
+	eventID, ok := urlID(w, r, log, "id", "event")
+	if !ok {
+		return 0, false
+	}
+	return eventID, auth.Allowed(w, r, log, p.AuthorizeEvent(r.Context(), eventID, perm))
+}
+
+// authorizeEnterprise достает id предприятия из пути и проверяет разрешение в нем
+func authorizeEnterprise(w http.ResponseWriter, r *http.Request, log *slog.Logger, p Policy, perm policy.Permission) (int, bool) {
+	enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+	if !ok {
+		return 0, false
+	}
+	return enterpriseID, auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, perm))
+}
+
+// urlID достает из пути положительный id, при ошибке отвечает клиенту сам
+func urlID(w http.ResponseWriter, r *http.Request, log *slog.Logger, param, entity string) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, param))
+	if err != nil || id <= 0 {
+		log.Error("invalid "+entity+" id", slog.String("id", chi.URLParam(r, param)))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid " + entity + " id",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, log *slog.Logger, v any) bool {
+	err := render.DecodeJSON(r.Body, v)
+	if errors.Is(err, io.EOF) {
+		log.Error("request body is empty")
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "empty request",
+		})
+		return false
+	}
+	if err != nil {
+		log.Error("failed to decode request body", slog.String("error", err.Error()))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid request format",
+		})
+		return false
+	}
+	return true
+}
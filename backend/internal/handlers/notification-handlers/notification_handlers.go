@@ -0,0 +1,423 @@
+package notification_handlers
+
+import (
+	"REST_project/config"
+	"REST_project/internal/handlers/auth"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"REST_project/internal/webpush"
+	"context"
+	"errors"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Server interface {
+	GetNotificationMode(ctx context.Context, participantID int) (string, error)
+	SetNotificationMode(ctx context.Context, participantID int, mode string) error
+	SavePushSubscription(ctx context.Context, sub model.PushSubscription) (model.PushSubscription, error)
+	GetPushSubscriptions(ctx context.Context, participantID int) ([]model.PushSubscription, error)
+	DeletePushSubscription(ctx context.Context, participantID, subscriptionID int) error
+}
+
+// Verifier проверяет подпись ссылки отписки
+type Verifier interface {
+	Verify(token string) (int, bool)
+}
+
+// PushKeys - ключи VAPID сервера
+type PushKeys interface {
+	PublicKey() string
+}
+
+// page - страница отписки. GET показывает кнопку, а отписывает только POST:
+// почтовые сканеры открывают ссылки из писем и не должны отписывать участника
+var page = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Email notifications</title></head>
+<body style="font-family: sans-serif;">
+{{if .Done}}<p>You are unsubscribed and will not get emails about new posts.</p>
+{{else if .Invalid}}<p>This unsubscribe link is invalid.</p>
+{{else}}<form method="post"><p>Stop getting emails about new posts of this event?</p>
+<button type="submit">Unsubscribe</button></form>
+{{end}}</body>
+</html>
+`))
+
+type RequestPreferences struct {
+	Mode string `json:"mode"`
+}
+
+// RequestPushSubscription - PushSubscription.toJSON() браузера. ExpirationTime - миллисекунды Unix
+type RequestPushSubscription struct {
+	Endpoint       string `json:"endpoint"`
+	ExpirationTime *int64 `json:"expirationTime"`
+	Keys           struct {
+		P256DH string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+type ResponsePushKey struct {
+	PublicKey string `json:"public_key"`
+}
+
+// GetPreferences возвращает настройки писем текущего участника
+func GetPreferences(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.notification-handlers.GetPreferences"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		participant, ok := policy.ParticipantFrom(r.Context())
+		if !ok {
+			auth.Allowed(w, r, log, policy.ErrUnauthenticated)
+			return
+		}
+
+		mode, err := s.GetNotificationMode(r.Context(), participant.ID)
+		if err != nil {
+			log.Error("failed to get notification mode", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get notification preferences",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   model.NotificationPreferences{Mode: mode},
+		})
+	}
+}
+
+// SetPreferences меняет режим писем текущего участника: immediate, hourly, daily или off
+func SetPreferences(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.notification-handlers.SetPreferences"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		participant, ok := policy.ParticipantFrom(r.Context())
+		if !ok {
+			auth.Allowed(w, r, log, policy.ErrUnauthenticated)
+			return
+		}
+
+		var req RequestPreferences
+		err := render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "empty request",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to decode request body", slog.String("error", err.Error()))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid request format",
+			})
+			return
+		}
+		switch req.Mode {
+		case model.NotifyImmediate, model.NotifyHourly, model.NotifyDaily, model.NotifyOff:
+		default:
+			log.Info("invalid notification mode", slog.String("mode", req.Mode))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "mode must be immediate, hourly, daily or off",
+			})
+			return
+		}
+
+		err = s.SetNotificationMode(r.Context(), participant.ID, req.Mode)
+		if errors.Is(err, storage.ErrParticipantNotFound) {
+			log.Info("participant not found", slog.Int("participant_id", participant.ID))
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "participant not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to set notification mode", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to update notification preferences",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   model.NotificationPreferences{Mode: req.Mode},
+		})
+	}
+}
+
+// UnsubscribePage показывает страницу отписки по ссылке из письма: /notifications/unsubscribe?token=
+func UnsubscribePage(log *slog.Logger, v Verifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.notification-handlers.UnsubscribePage"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		status := http.StatusOK
+		_, ok := v.Verify(r.URL.Query().Get("token"))
+		if !ok {
+			log.Info("invalid unsubscribe token")
+			status = http.StatusBadRequest
+		}
+		renderPage(w, log, status, !ok, false)
+	}
+}
+
+// Unsubscribe отключает письма участнику из подписанной ссылки. Сюда же почтовый клиент
+// отправляет отписку в одно нажатие по RFC 8058, поэтому вход не нужен
+func Unsubscribe(log *slog.Logger, s Server, v Verifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.notification-handlers.Unsubscribe"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		participantID, ok := v.Verify(r.URL.Query().Get("token"))
+		if !ok {
+			log.Info("invalid unsubscribe token")
+			renderPage(w, log, http.StatusBadRequest, true, false)
+			return
+		}
+
+		err := s.SetNotificationMode(r.Context(), participantID, model.NotifyOff)
+		if errors.Is(err, storage.ErrParticipantNotFound) {
+			// участника уже нет, писем ему тоже не будет
+			log.Info("participant not found", slog.Int("participant_id", participantID))
+			err = nil
+		}
+		if err != nil {
+			log.Error("failed to unsubscribe", slog.String("error", err.Error()))
+			http.Error(w, "failed to unsubscribe, try again later", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("participant unsubscribed", slog.Int("participant_id", participantID))
+		renderPage(w, log, http.StatusOK, false, true)
+	}
+}
+
+// PushKey отдает открытый ключ VAPID, с которым браузер подписывается на уведомления
+func PushKey(k PushKeys) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   ResponsePushKey{PublicKey: k.PublicKey()},
+		})
+	}
+}
+
+// CreatePushSubscription сохраняет подписку браузера текущего участника на push-уведомления
+func CreatePushSubscription(log *slog.Logger, s Server, c config.PushCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.notification-handlers.CreatePushSubscription"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		participant, ok := policy.ParticipantFrom(r.Context())
+		if !ok {
+			auth.Allowed(w, r, log, policy.ErrUnauthenticated)
+			return
+		}
+
+		var req RequestPushSubscription
+		err := render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "empty request",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to decode request body", slog.String("error", err.Error()))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid request format",
+			})
+			return
+		}
+		if err = webpush.CheckSubscription(req.Endpoint, req.Keys.P256DH, req.Keys.Auth, c.AllowPrivate); err != nil {
+			log.Info("invalid push subscription", slog.String("error", err.Error()))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  err.Error(),
+			})
+			return
+		}
+
+		sub := model.PushSubscription{
+			ParticipantID: participant.ID,
+			Endpoint:      req.Endpoint,
+			P256DH:        req.Keys.P256DH,
+			Auth:          req.Keys.Auth,
+		}
+		if req.ExpirationTime != nil {
+			expiresAt := time.UnixMilli(*req.ExpirationTime)
+			sub.ExpiresAt = &expiresAt
+		}
+
+		sub, err = s.SavePushSubscription(r.Context(), sub)
+		if errors.Is(err, storage.ErrParticipantNotFound) {
+			log.Info("participant not found", slog.Int("participant_id", participant.ID))
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "participant not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to save push subscription", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to save push subscription",
+			})
+			return
+		}
+
+		log.Info("push subscription saved", slog.Int("subscription_id", sub.ID))
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   sub,
+		})
+	}
+}
+
+// GetPushSubscriptions возвращает подписки браузеров текущего участника
+func GetPushSubscriptions(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.notification-handlers.GetPushSubscriptions"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		participant, ok := policy.ParticipantFrom(r.Context())
+		if !ok {
+			auth.Allowed(w, r, log, policy.ErrUnauthenticated)
+			return
+		}
+
+		subs, err := s.GetPushSubscriptions(r.Context(), participant.ID)
+		if err != nil {
+			log.Error("failed to get push subscriptions", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get push subscriptions",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   subs,
+		})
+	}
+}
+
+// DeletePushSubscription отписывает браузер текущего участника от уведомлений
+func DeletePushSubscription(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.notification-handlers.DeletePushSubscription"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		participant, ok := policy.ParticipantFrom(r.Context())
+		if !ok {
+			auth.Allowed(w, r, log, policy.ErrUnauthenticated)
+			return
+		}
+
+		subscriptionID, err := strconv.Atoi(chi.URLParam(r, "subscriptionID"))
+		if err != nil || subscriptionID <= 0 {
+			log.Error("invalid subscription id", slog.String("id", chi.URLParam(r, "subscriptionID")))
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid subscription id",
+			})
+			return
+		}
+
+		err = s.DeletePushSubscription(r.Context(), participant.ID, subscriptionID)
+		if errors.Is(err, storage.ErrEndpointNotFound) {
+			log.Info("push subscription not found", slog.Int("subscription_id", subscriptionID))
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "push subscription not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to delete push subscription", slog.String("error", err.Error()))
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to delete push subscription",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+		})
+	}
+}
+
+func renderPage(w http.ResponseWriter, log *slog.Logger, status int, invalid, done bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// токен в адресе не должен уходить на другие сайты
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	if err := page.Execute(w, struct{ Invalid, Done bool }{invalid, done}); err != nil {
+		log.Error("failed to render unsubscribe page", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,337 @@
+package participant_handlers
+
+import (
+	"REST_project/config"
+	"REST_project/internal/handlers/auth"
+	"REST_project/internal/mailer"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Server interface {
+	ParticipantByEmail(ctx context.Context, eventID int, email string) (model.Participant, error)
+	CreateLoginToken(ctx context.Context, participantID int, tokenHash string, expiresAt time.Time) error
+	LoginParticipant(ctx context.Context, tokenHash, sessionHash string, expiresAt time.Time) (model.Participant, error)
+	RevokeParticipantSession(ctx context.Context, tokenHash string) error
+	OpenParticipantSession(ctx context.Context, eventID, participantID int, sessionHash string, expiresAt time.Time) (model.Participant, error)
+}
+
+type Policy interface {
+	AuthorizeEvent(ctx context.Context, eventID int, perm policy.Permission) error
+}
+
+type RequestLinkSend struct {
+	EventID int    `json:"event_id"`
+	Email   string `json:"email"`
+}
+
+type RequestLoginVerify struct {
+	Token string `json:"token"`
+}
+
+type ResponseLogin struct {
+	model.Session
+	Participant model.Participant `json:"participant"`
+}
+
+func respOk(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, model.Response{
+		Status: "OK",
+	})
+}
+
+// RequestLoginLink отправляет участнику события письмо со ссылкой для входа.
+// Ответ не зависит от того, найден ли email, чтобы по нему нельзя было проверять участников
+func RequestLoginLink(log *slog.Logger, s Server, m mailer.Mailer, c config.LoginCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.participant-handlers.RequestLoginLink"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req RequestLinkSend
+		if !decode(w, r, log, &req) {
+			return
+		}
+		req.Email = strings.TrimSpace(req.Email)
+		if req.EventID <= 0 || req.Email == "" {
+			log.Error("invalid request data")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "event_id and email are required",
+			})
+			return
+		}
+
+		participant, err := s.ParticipantByEmail(r.Context(), req.EventID, req.Email)
+		if errors.Is(err, storage.ErrParticipantNotFound) {
+			log.Info("login link requested for unknown email", slog.Int("event_id", req.EventID))
+			respOk(w, r)
+			return
+		}
+		if err != nil {
+			log.Error("failed to find participant", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to send login link",
+			})
+			return
+		}
+
+		token, hash, err := auth.NewLoginToken()
+		if err == nil {
+			err = s.CreateLoginToken(r.Context(), participant.ID, hash, time.Now().Add(c.TokenTTL))
+		}
+		if err == nil {
+			err = m.Send(r.Context(), loginMessage(participant, token, c))
+		}
+		if err != nil {
+			log.Error("failed to send login link", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to send login link",
+			})
+			return
+		}
+
+		log.Info("login link sent", slog.Int("participant_id", participant.ID))
+		respOk(w, r)
+	}
+}
+
+// VerifyLoginLink погашает токен из ссылки и открывает сессию участника.
+// Это POST, а не GET по ссылке, чтобы почтовые сканеры, открывающие ссылки, не тратили токен
+func VerifyLoginLink(log *slog.Logger, s Server, c config.LoginCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.participant-handlers.VerifyLoginLink"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req RequestLoginVerify
+		if !decode(w, r, log, &req) {
+			return
+		}
+		if req.Token == "" {
+			log.Error("token is empty")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "token is required",
+			})
+			return
+		}
+
+		token, hash, err := auth.NewParticipantToken()
+		if err != nil {
+			log.Error("failed to generate session token", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to login",
+			})
+			return
+		}
+
+		expiresAt := time.Now().Add(c.SessionTTL)
+		participant, err := s.LoginParticipant(r.Context(), auth.HashKey(req.Token), hash, expiresAt)
+		if err != nil {
+			log.Error("failed to login participant", slog.String("error", err.Error()))
+			msg := "failed to login"
+			if errors.Is(err, storage.ErrTokenInvalid) {
+				render.Status(r, http.StatusUnauthorized)
+				msg = "login link is invalid, expired or already used"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		log.Info("participant logged in", slog.Int("participant_id", participant.ID))
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data: ResponseLogin{
+				Session:     model.Session{Token: token, ExpiresAt: expiresAt},
+				Participant: participant,
+			},
+		})
+	}
+}
+
+// OpenSession открывает сессию участнику события от имени организатора. Так входят
+// участники без email: ссылку для входа им не отправить, а токен организатор передает сам
+func OpenSession(log *slog.Logger, s Server, p Policy, c config.LoginCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.participant-handlers.OpenSession"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || eventID <= 0 {
+			log.Error("invalid event id", slog.String("id", chi.URLParam(r, "id")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid event id",
+			})
+			return
+		}
+		participantID, err := strconv.Atoi(chi.URLParam(r, "participantID"))
+		if err != nil || participantID <= 0 {
+			log.Error("invalid participant id", slog.String("id", chi.URLParam(r, "participantID")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid participant id",
+			})
+			return
+		}
+		if !auth.Allowed(w, r, log, p.AuthorizeEvent(r.Context(), eventID, policy.ManageEvents)) {
+			return
+		}
+
+		token, hash, err := auth.NewParticipantToken()
+		if err != nil {
+			log.Error("failed to generate session token", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to open session",
+			})
+			return
+		}
+
+		expiresAt := time.Now().Add(c.SessionTTL)
+		participant, err := s.OpenParticipantSession(r.Context(), eventID, participantID, hash, expiresAt)
+		if err != nil {
+			log.Error("failed to open session", slog.String("error", err.Error()))
+			msg := "failed to open session"
+			if errors.Is(err, storage.ErrParticipantNotFound) {
+				render.Status(r, http.StatusNotFound)
+				msg = "participant not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		log.Info("participant session opened", slog.Int("participant_id", participant.ID))
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data: ResponseLogin{
+				Session:     model.Session{Token: token, ExpiresAt: expiresAt},
+				Participant: participant,
+			},
+		})
+	}
+}
+
+// Me возвращает участника текущей сессии
+func Me(log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.participant-handlers.Me"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		participant, ok := policy.ParticipantFrom(r.Context())
+		if !ok {
+			auth.Allowed(w, r, log, policy.ErrUnauthenticated)
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   participant,
+		})
+	}
+}
+
+func Logout(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.participant-handlers.Logout"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		token, ok := auth.BearerToken(r)
+		if !ok || !auth.IsParticipantToken(token) {
+			log.Error("request has no participant session token")
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "participant session token required",
+			})
+			return
+		}
+
+		if err := s.RevokeParticipantSession(r.Context(), auth.HashKey(token)); err != nil {
+			log.Error("failed to revoke session", slog.String("error", err.Error()))
+			msg := "failed to logout"
+			if errors.Is(err, storage.ErrSessionNotFound) {
+				msg = "session not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+		respOk(w, r)
+	}
+}
+
+func loginMessage(p model.Participant, token string, c config.LoginCfg) mailer.Message {
+	link := c.LinkURL + "?token=" + url.QueryEscape(token)
+	minutes := int(c.TokenTTL.Minutes())
+	return mailer.Message{
+		To:      p.Email,
+		Subject: "Your login link",
+		Text: fmt.Sprintf("Hello, %s!\n\nFollow this link to log in to the event:\n%s\n\n"+
+			"The link works once and expires in %d minutes. If you did not request it, ignore this email.\n",
+			p.Name, link, minutes),
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, log *slog.Logger, v any) bool {
+	err := render.DecodeJSON(r.Body, v)
+	if errors.Is(err, io.EOF) {
+		log.Error("request body is empty")
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "empty request",
+		})
+		return false
+	}
+	if err != nil {
+		log.Error("failed to decode request body", slog.String("error", err.Error()))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid request format",
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,364 @@
+package qa_handlers
+
+import (
+	"REST_project/internal/handlers/auth"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Server interface {
+	CreateQuestion(ctx context.Context, eventID, participantID int, content string, anonymous bool) (int, error)
+	UpvoteQuestion(ctx context.Context, eventID, questionID, participantID int) error
+	RemoveQuestionVote(ctx context.Context, eventID, questionID, participantID int) error
+	SetQuestionStatus(ctx context.Context, eventID, questionID int, status string) error
+	GetQuestions(ctx context.Context, eventID int, sort, status string, includeHidden bool) ([]model.Question, error)
+}
+
+type Policy interface {
+	AuthorizeEvent(ctx context.Context, eventID int, perm policy.Permission) error
+}
+
+// RequestQuestionCreate - автор вопроса берется из сессии участника,
+// participant_id оставлен для старых клиентов и должен совпадать с ней
+type RequestQuestionCreate struct {
+	ParticipantID int    `json:"participant_id"`
+	Content       string `json:"content"`
+	Anonymous     bool   `json:"anonymous"`
+}
+
+// RequestQuestionVote - голосует участник сессии, тело необязательно.
+// participant_id оставлен для старых клиентов и должен совпадать с сессией
+type RequestQuestionVote struct {
+	ParticipantID int `json:"participant_id"`
+}
+
+type RequestQuestionStatus struct {
+	Status string `json:"status"`
+}
+
+func respOk(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, model.Response{
+		Status: "OK",
+	})
+}
+
+func CreateQuestion(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.qa-handlers.CreateQuestion"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := urlID(w, r, log, "id", "event")
+		if !ok {
+			return
+		}
+
+		var req RequestQuestionCreate
+		if !decode(w, r, log, &req) {
+			return
+		}
+
+		participant, err := policy.ActingParticipant(r.Context(), req.ParticipantID)
+		if !auth.Allowed(w, r, log, err) {
+			return
+		}
+		req.ParticipantID = participant.ID
+
+		if req.Content == "" {
+			log.Error("invalid request data")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid data provided",
+			})
+			return
+		}
+
+		log.Info("creating question", slog.Int("event_id", eventID), slog.Any("request", req))
+
+		id, err := s.CreateQuestion(r.Context(), eventID, req.ParticipantID, req.Content, req.Anonymous)
+		if err != nil {
+			log.Error("failed to create question", slog.String("error", err.Error()))
+			msg := "failed to create question"
+			if errors.Is(err, storage.ErrParticipantNotFound) {
+				msg = "participant is not registered for this event"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   map[string]int{"id": id},
+		})
+	}
+}
+
+// GetQuestions возвращает вопросы для участников: без скрытых вопросов
+// и без автора у анонимных
+func GetQuestions(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.qa-handlers.GetQuestions"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := urlID(w, r, log, "id", "event")
+		if !ok {
+			return
+		}
+
+		log.Info("getting questions", slog.Int("event_id", eventID))
+
+		questions, err := s.GetQuestions(r.Context(), eventID, r.URL.Query().Get("sort"), "", false)
+		if err != nil {
+			log.Error("failed to get questions", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get questions",
+			})
+			return
+		}
+
+		for i := range questions {
+			if questions[i].Anonymous {
+				questions[i].ParticipantID = 0
+				questions[i].ParticipantName = ""
+			}
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   questions,
+		})
+	}
+}
+
+// GetModerationQuestions возвращает модератору все вопросы, включая скрытые,
+// вместе с авторами. Поддерживает фильтр ?status=
+func GetModerationQuestions(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.qa-handlers.GetModerationQuestions"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := urlID(w, r, log, "id", "event")
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.AuthorizeEvent(r.Context(), eventID, policy.ModerateEvents)) {
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		if status != "" && !validStatus(status) {
+			log.Error("invalid status", slog.String("status", status))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid status",
+			})
+			return
+		}
+
+		log.Info("getting questions for moderation", slog.Int("event_id", eventID))
+
+		questions, err := s.GetQuestions(r.Context(), eventID, r.URL.Query().Get("sort"), status, true)
+		if err != nil {
+			log.Error("failed to get questions", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to get questions",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   questions,
+		})
+	}
+}
+
+func UpvoteQuestion(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.qa-handlers.UpvoteQuestion"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		vote(w, r, log, s.UpvoteQuestion)
+	}
+}
+
+func RemoveQuestionVote(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.qa-handlers.RemoveQuestionVote"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		vote(w, r, log, s.RemoveQuestionVote)
+	}
+}
+
+func vote(w http.ResponseWriter, r *http.Request, log *slog.Logger, fn func(ctx context.Context, eventID, questionID, participantID int) error) {
+	eventID, ok := urlID(w, r, log, "id", "event")
+	if !ok {
+		return
+	}
+	questionID, ok := urlID(w, r, log, "questionID", "question")
+	if !ok {
+		return
+	}
+
+	var req RequestQuestionVote
+	if err := render.DecodeJSON(r.Body, &req); err != nil && !errors.Is(err, io.EOF) {
+		log.Error("failed to decode request body", slog.String("error", err.Error()))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid request format",
+		})
+		return
+	}
+	participant, err := policy.ActingParticipant(r.Context(), req.ParticipantID)
+	if !auth.Allowed(w, r, log, err) {
+		return
+	}
+
+	err = fn(r.Context(), eventID, questionID, participant.ID)
+	if err != nil {
+		log.Error("failed to vote", slog.String("error", err.Error()))
+		msg := "failed to vote"
+		switch {
+		case errors.Is(err, storage.ErrQuestionNotFound):
+			msg = "question not found"
+		case errors.Is(err, storage.ErrParticipantNotFound):
+			msg = "participant is not registered for this event"
+		case errors.Is(err, storage.ErrAlreadyVoted):
+			msg = "already voted"
+		}
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  msg,
+		})
+		return
+	}
+
+	respOk(w, r)
+}
+
+// SetQuestionStatus позволяет модератору отметить вопрос отвеченным,
+// скрыть его или вернуть в открытые
+func SetQuestionStatus(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.qa-handlers.SetQuestionStatus"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, ok := urlID(w, r, log, "id", "event")
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.AuthorizeEvent(r.Context(), eventID, policy.ModerateEvents)) {
+			return
+		}
+		questionID, ok := urlID(w, r, log, "questionID", "question")
+		if !ok {
+			return
+		}
+
+		var req RequestQuestionStatus
+		if !decode(w, r, log, &req) {
+			return
+		}
+		if !validStatus(req.Status) {
+			log.Error("invalid status", slog.String("status", req.Status))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid status",
+			})
+			return
+		}
+
+		log.Info("setting question status", slog.Int("question_id", questionID), slog.String("status", req.Status))
+
+		err := s.SetQuestionStatus(r.Context(), eventID, questionID, req.Status)
+		if err != nil {
+			log.Error("failed to set question status", slog.String("error", err.Error()))
+			msg := "failed to set question status"
+			if errors.Is(err, storage.ErrQuestionNotFound) {
+				msg = "question not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		respOk(w, r)
+	}
+}
+
+func validStatus(status string) bool {
+	switch status {
+	case model.QuestionOpen, model.QuestionAnswered, model.QuestionHidden:
+		return true
+	}
+	return false
+}
+
+// urlID достает из пути положительный id, при ошибке отвечает клиенту сам
+func urlID(w http.ResponseWriter, r *http.Request, log *slog.Logger, param, entity string) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, param))
+	if err != nil || id <= 0 {
+		log.Error("invalid "+entity+" id", slog.String("id", chi.URLParam(r, param)))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid " + entity + " id",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, log *slog.Logger, v any) bool {
+	err := render.DecodeJSON(r.Body, v)
+	if errors.Is(err, io.EOF) {
+		log.Error("request body is empty")
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "empty request",
+		})
+		return false
+	}
+	if err != nil {
+		log.Error("failed to decode request body", slog.String("error", err.Error()))
+		render.JSON(w, r, model.Response{
+			Status: "Error",
+			Error:  "invalid request format",
+		})
+		return false
+	}
+	return true
+}
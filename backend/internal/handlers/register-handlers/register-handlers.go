@@ -1,15 +1,31 @@
 package register_handlers
 
 import (
+	"REST_project/config"
+	"REST_project/internal/calendar"
+	"REST_project/internal/handlers/auth"
 	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"context"
 	"errors"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// maxLocationLen - предел длины места проведения события
+const maxLocationLen = 500
+
 type RequestEntRegister struct {
     Name string `json:"name"` 
 }
@@ -18,20 +34,39 @@ type RequestEventRegister struct {
     Name         string `json:"name"`
     Description  string `json:"description"`
     EnterpriseID int    `json:"enterprise_id"`
+    // Capacity - предел числа участников, 0 - без ограничения
+    Capacity     int    `json:"capacity"`
+    // время и место проведения необязательны, без времени начала событие не попадает в календарь
+    model.EventSchedule
 }
 
 type RequestUserRegister struct {
     EventID int    `json:"event_id"`
     Name    string `json:"name"`
+    // Email необязателен, без него участник не сможет войти по ссылке с другого устройства
+    Email   string `json:"email"`
+}
+
+// ResponseUserRegister - зарегистрированный участник и его сессия: участнику без email
+// другого способа войти нет
+type ResponseUserRegister struct {
+    model.Session
+    Participant model.Participant `json:"participant"`
 }
 
 type Server interface {
-    EnterpriseRegister(name string) (int, error)
-    EventRegister(name string, description string, enterpriseID int) (int, error)
-    ParticipantRegister(eventID int, name string) (int, error) 
-    GetEnterprises() ([]model.Enterprise, error)
-    GetEvents() ([]model.Event, error)
-    GetParticipants() ([]model.Participant, error) 
+    EnterpriseRegister(ctx context.Context, name string, ownerID int) (int, error)
+    EventRegister(ctx context.Context, name string, description string, enterpriseID, capacity int, schedule model.EventSchedule) (int, error)
+    SetEventSchedule(ctx context.Context, eventID int, schedule model.EventSchedule) error
+    RegisterParticipant(ctx context.Context, eventID int, name, email, sessionHash string, expiresAt time.Time) (model.Participant, error)
+    GetEnterprises(ctx context.Context) ([]model.Enterprise, error)
+    GetEvents(ctx context.Context) ([]model.Event, error)
+    GetParticipants(ctx context.Context) ([]model.Participant, error) 
+}
+
+type Policy interface {
+	Authorize(ctx context.Context, enterpriseID int, perm policy.Permission) error
+	AuthorizeEvent(ctx context.Context, eventID int, perm policy.Permission) error
 }
 
 func respOk(w http.ResponseWriter, r *http.Request) {
@@ -47,6 +82,12 @@ func RegisterEnterprise(log *slog.Logger, s Server) http.HandlerFunc {
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
+		account, ok := policy.AccountFrom(r.Context())
+		if !ok {
+			auth.Allowed(w, r, log, policy.ErrUnauthenticated)
+			return
+		}
+
 		var req RequestEntRegister
 		err := render.DecodeJSON(r.Body, &req)
 		if errors.Is(err, io.EOF) {
@@ -69,7 +110,7 @@ func RegisterEnterprise(log *slog.Logger, s Server) http.HandlerFunc {
 			return
 		}
 		log.Info("request body decoded", slog.Any("request", req))
-		_, err = s.EnterpriseRegister(req.Name)
+		_, err = s.EnterpriseRegister(r.Context(), req.Name, account.ID)
 		if err != nil {
 			log.Error("failed to write enterprise name to database")
 			render.JSON(w, r, model.Response{
@@ -83,7 +124,8 @@ func RegisterEnterprise(log *slog.Logger, s Server) http.HandlerFunc {
 }
 
 
-func RegisterEvent(log *slog.Logger, s Server) http.HandlerFunc {
+// RegisterEvent создает событие предприятия, доступно организаторам и выше
+func RegisterEvent(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "internal.handlers.register-handlers.RegisterEvent"
 		log = log.With(
@@ -110,7 +152,7 @@ func RegisterEvent(log *slog.Logger, s Server) http.HandlerFunc {
 			return
 		}
 
-		if req.Name == "" || req.Description == "" || req.EnterpriseID <= 0 {
+		if req.Name == "" || req.Description == "" || req.EnterpriseID <= 0 || req.Capacity < 0 {
 			log.Error("invalid request data")
 			render.JSON(w, r, model.Response{
 				Status: "Error",
@@ -119,9 +161,22 @@ func RegisterEvent(log *slog.Logger, s Server) http.HandlerFunc {
 			return
 		}
 
+		if err = validSchedule(&req.EventSchedule); err != nil {
+			log.Error("invalid schedule", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  err.Error(),
+			})
+			return
+		}
+
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), req.EnterpriseID, policy.ManageEvents)) {
+			return
+		}
+
 		log.Info("registering event", slog.Any("request", req))
 
-		_, err = s.EventRegister(req.Name, req.Description, req.EnterpriseID)
+		_, err = s.EventRegister(r.Context(), req.Name, req.Description, req.EnterpriseID, req.Capacity, req.EventSchedule)
 		if err != nil {
 			log.Error("failed to register event", slog.String("error", err.Error()))
 			render.JSON(w, r, model.Response{
@@ -135,8 +190,76 @@ func RegisterEvent(log *slog.Logger, s Server) http.HandlerFunc {
 	}
 }
 
+// SetEventSchedule заменяет время и место проведения события. Подписанные календари
+// получат изменение при следующем обновлении ленты
+func SetEventSchedule(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.register-handlers.SetEventSchedule"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || eventID <= 0 {
+			log.Error("invalid event id", slog.String("id", chi.URLParam(r, "id")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid event id",
+			})
+			return
+		}
+
+		var req model.EventSchedule
+		err = render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "empty request",
+			})
+			return
+		}
+		if err != nil {
+			log.Error("failed to decode request body", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid request format",
+			})
+			return
+		}
+		if err = validSchedule(&req); err != nil {
+			log.Error("invalid schedule", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  err.Error(),
+			})
+			return
+		}
+
+		if !auth.Allowed(w, r, log, p.AuthorizeEvent(r.Context(), eventID, policy.ManageEvents)) {
+			return
+		}
+
+		if err = s.SetEventSchedule(r.Context(), eventID, req); err != nil {
+			log.Error("failed to set schedule", slog.String("error", err.Error()))
+			msg := "failed to set schedule"
+			if errors.Is(err, storage.ErrEventNotFound) {
+				msg = "event not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		log.Info("event schedule updated", slog.Int("event_id", eventID))
+		respOk(w, r)
+	}
+}
 
-func RegisterUser(log *slog.Logger, s Server) http.HandlerFunc {
+func RegisterUser(log *slog.Logger, s Server, c config.LoginCfg) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "internal.handlers.register-handlers.RegisterUser"
 		log = log.With(
@@ -163,7 +286,8 @@ func RegisterUser(log *slog.Logger, s Server) http.HandlerFunc {
 			return
 		}
 
-		if req.Name == "" || req.EventID <= 0 {
+		req.Email = strings.TrimSpace(req.Email)
+		if req.Name == "" || req.EventID <= 0 || (req.Email != "" && !validEmail(req.Email)) {
 			log.Error("invalid request data")
 			render.JSON(w, r, model.Response{
 				Status: "Error",
@@ -172,11 +296,11 @@ func RegisterUser(log *slog.Logger, s Server) http.HandlerFunc {
 			return
 		}
 
-		log.Info("registering user", slog.Any("request", req))
+		log.Info("registering user", slog.Int("event_id", req.EventID), slog.String("name", req.Name))
 
-		_, err = s.ParticipantRegister(req.EventID, req.Name)
+		token, hash, err := auth.NewParticipantToken()
 		if err != nil {
-			log.Error("failed to register user", slog.String("error", err.Error()))
+			log.Error("failed to generate session token", slog.String("error", err.Error()))
 			render.JSON(w, r, model.Response{
 				Status: "Error",
 				Error:  "failed to register user",
@@ -184,7 +308,37 @@ func RegisterUser(log *slog.Logger, s Server) http.HandlerFunc {
 			return
 		}
 
-		respOk(w, r)
+		expiresAt := time.Now().Add(c.SessionTTL)
+		participant, err := s.RegisterParticipant(r.Context(), req.EventID, req.Name, req.Email, hash, expiresAt)
+		if err != nil {
+			log.Error("failed to register user", slog.String("error", err.Error()))
+			msg := "failed to register user"
+			switch {
+			case errors.Is(err, storage.ErrEventNotFound):
+				msg = "event not found"
+			case errors.Is(err, storage.ErrEventFull):
+				msg = "event is full"
+			case errors.Is(err, storage.ErrParticipantBanned):
+				msg = "participant is banned from this event"
+			case errors.Is(err, storage.ErrEmailTaken):
+				msg = "email is already registered for this event"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		log.Info("user registered", slog.Int("participant_id", participant.ID))
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data: ResponseUserRegister{
+				Session:     model.Session{Token: token, ExpiresAt: expiresAt},
+				Participant: participant,
+			},
+		})
 	}
 }
 
@@ -198,7 +352,7 @@ func GetEnterprises(log *slog.Logger, s Server) http.HandlerFunc {
 
 		log.Info("getting enterprises")
 
-		enterprises, err := s.GetEnterprises()
+		enterprises, err := s.GetEnterprises(r.Context())
 		if err != nil {
 			log.Error("failed to get enterprises", slog.String("error", err.Error()))
 			render.JSON(w, r, model.Response{
@@ -225,7 +379,7 @@ func GetEvents(log *slog.Logger, s Server) http.HandlerFunc {
 
 		log.Info("getting events")
 
-		events, err := s.GetEvents()
+		events, err := s.GetEvents(r.Context())
 		if err != nil {
 			log.Error("failed to get events", slog.String("error", err.Error()))
 			render.JSON(w, r, model.Response{
@@ -252,7 +406,7 @@ func GetUsers(log *slog.Logger, s Server) http.HandlerFunc {
 
 		log.Info("getting users")
 
-		users, err := s.GetParticipants()
+		users, err := s.GetParticipants(r.Context())
 		if err != nil {
 			log.Error("failed to get users", slog.String("error", err.Error()))
 			render.JSON(w, r, model.Response{
@@ -268,3 +422,32 @@ func GetUsers(log *slog.Logger, s Server) http.HandlerFunc {
 		})
 	}
 }
+
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && len(email) <= 255
+}
+
+// validSchedule проверяет расписание события и подставляет UTC вместо пустого часового пояса
+func validSchedule(s *model.EventSchedule) error {
+	if s.EndsAt != nil && (s.StartsAt == nil || s.EndsAt.Before(*s.StartsAt)) {
+		return errors.New("ends_at must not be before starts_at")
+	}
+	if s.Timezone == "" {
+		s.Timezone = "UTC"
+	}
+	if _, err := calendar.LoadLocation(s.Timezone); err != nil {
+		return errors.New("unknown timezone")
+	}
+	s.Location = strings.TrimSpace(s.Location)
+	if utf8.RuneCountInString(s.Location) > maxLocationLen {
+		return errors.New("location is too long")
+	}
+	if s.JoinURL != "" {
+		u, err := url.Parse(s.JoinURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.New("join_url must be an http or https url")
+		}
+	}
+	return nil
+}
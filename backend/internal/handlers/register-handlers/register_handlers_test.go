@@ -0,0 +1,97 @@
+package register_handlers
+
+import (
+	"REST_project/config"
+	"REST_project/internal/handlers/auth"
+	model "REST_project/internal/models"
+	"REST_project/internal/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer запоминает, с какими данными зарегистрирован участник
+type fakeServer struct {
+	Server
+	err         error
+	email       string
+	sessionHash string
+}
+
+func (f *fakeServer) RegisterParticipant(_ context.Context, eventID int, name, email, sessionHash string, _ time.Time) (model.Participant, error) {
+	if f.err != nil {
+		return model.Participant{}, f.err
+	}
+	f.email, f.sessionHash = email, sessionHash
+	return model.Participant{ID: 1, EventID: eventID, Name: name, Email: email}, nil
+}
+
+type registerResponse struct {
+	Status string               `json:"status"`
+	Error  string               `json:"error"`
+	Data   ResponseUserRegister `json:"data"`
+}
+
+func TestRegisterUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		err       error
+		wantError string
+		wantEmail string
+	}{
+		{name: "without email", body: `{"event_id":1,"name":"Ann"}`},
+		{name: "with email", body: `{"event_id":1,"name":"Ann","email":" ann@example.com "}`, wantEmail: "ann@example.com"},
+		{name: "invalid email", body: `{"event_id":1,"name":"Ann","email":"ann"}`, wantError: "invalid data provided"},
+		{name: "no name", body: `{"event_id":1}`, wantError: "invalid data provided"},
+		{name: "banned", body: `{"event_id":1,"name":"Ann"}`,
+			err: fmt.Errorf("op: %w", storage.ErrParticipantBanned), wantError: "participant is banned from this event"},
+		{name: "event full", body: `{"event_id":1,"name":"Ann"}`,
+			err: fmt.Errorf("op: %w", storage.ErrEventFull), wantError: "event is full"},
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeServer{err: tt.err}
+			h := RegisterUser(log, s, config.LoginCfg{SessionTTL: time.Hour})
+
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(http.MethodPost, "/register/user", strings.NewReader(tt.body)))
+
+			var resp registerResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantError != "" {
+				if resp.Status != "Error" || resp.Error != tt.wantError {
+					t.Fatalf("response = %s %q, want Error %q", resp.Status, resp.Error, tt.wantError)
+				}
+				return
+			}
+
+			if resp.Status != "OK" {
+				t.Fatalf("response = %s %q, want OK", resp.Status, resp.Error)
+			}
+			if !auth.IsParticipantToken(resp.Data.Token) {
+				t.Errorf("session token %q is not a participant token", resp.Data.Token)
+			}
+			if s.sessionHash != auth.HashKey(resp.Data.Token) {
+				t.Error("stored session hash does not match the returned token")
+			}
+			if !resp.Data.ExpiresAt.After(time.Now()) {
+				t.Errorf("session expires at %v, want in the future", resp.Data.ExpiresAt)
+			}
+			if s.email != tt.wantEmail || resp.Data.Participant.ID != 1 {
+				t.Errorf("registered %+v with email %q, want id 1 with email %q", resp.Data.Participant, s.email, tt.wantEmail)
+			}
+		})
+	}
+}
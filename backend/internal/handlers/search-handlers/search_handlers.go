@@ -0,0 +1,135 @@
+package search_handlers
+
+import (
+	model "REST_project/internal/models"
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+	maxQueryLen  = 256
+)
+
+type Server interface {
+	Search(ctx context.Context, eventID int, p model.SearchParams) ([]model.SearchResult, error)
+}
+
+// Search ищет по постам и комментариям события.
+// Параметры: q - запрос, type - post или comment, from и to - границы по дате
+// (RFC 3339 или YYYY-MM-DD), limit и offset - пагинация
+func Search(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.search-handlers.Search"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		eventID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil || eventID <= 0 {
+			log.Error("invalid event id", slog.String("id", chi.URLParam(r, "id")))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "invalid event id",
+			})
+			return
+		}
+
+		p, msg := parseParams(r)
+		if msg != "" {
+			log.Error("invalid search params", slog.String("reason", msg))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		log.Info("searching", slog.Int("event_id", eventID), slog.String("query", p.Query))
+
+		results, err := s.Search(r.Context(), eventID, p)
+		if err != nil {
+			log.Error("failed to search", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to search",
+			})
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   results,
+		})
+	}
+}
+
+// parseParams разбирает параметры запроса и возвращает текст ошибки для клиента
+func parseParams(r *http.Request) (model.SearchParams, string) {
+	q := r.URL.Query()
+	p := model.SearchParams{
+		Query: strings.TrimSpace(q.Get("q")),
+		Type:  q.Get("type"),
+		Limit: defaultLimit,
+	}
+
+	if p.Query == "" {
+		return p, "query is required"
+	}
+	if len(p.Query) > maxQueryLen {
+		return p, "query is too long"
+	}
+	switch p.Type {
+	case "", model.SearchTypePost, model.SearchTypeComment:
+	default:
+		return p, "type must be post or comment"
+	}
+
+	var err error
+	if p.From, err = parseDate(q.Get("from")); err != nil {
+		return p, "invalid from date"
+	}
+	if p.To, err = parseDate(q.Get("to")); err != nil {
+		return p, "invalid to date"
+	}
+
+	if v := q.Get("limit"); v != "" {
+		p.Limit, err = strconv.Atoi(v)
+		if err != nil || p.Limit <= 0 {
+			return p, "invalid limit"
+		}
+		p.Limit = min(p.Limit, maxLimit)
+	}
+	if v := q.Get("offset"); v != "" {
+		p.Offset, err = strconv.Atoi(v)
+		if err != nil || p.Offset < 0 {
+			return p, "invalid offset"
+		}
+	}
+	return p, ""
+}
+
+// parseDate принимает RFC 3339 или дату без времени (полночь по UTC)
+func parseDate(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
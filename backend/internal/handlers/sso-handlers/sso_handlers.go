@@ -0,0 +1,255 @@
+package sso_handlers
+
+import (
+	"REST_project/config"
+	"REST_project/internal/handlers/auth"
+	model "REST_project/internal/models"
+	"REST_project/internal/sso"
+	"REST_project/internal/storage"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Server interface {
+	CreateOIDCState(ctx context.Context, st model.OIDCState) error
+	ConsumeOIDCState(ctx context.Context, state string) (model.OIDCState, error)
+	LoginOIDC(ctx context.Context, identity model.OIDCIdentity) (int, error)
+	CreateSession(ctx context.Context, accountID int, tokenHash string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, tokenHash string) error
+}
+
+type Provider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	Exchange(ctx context.Context, code, verifier, nonce string) (model.OIDCIdentity, error)
+}
+
+// stateCookie привязывает state к браузеру, начавшему вход: без него злоумышленник
+// может подсунуть жертве ссылку на callback со своим code и войти ей под своим аккаунтом
+const stateCookie = "oidc_state"
+
+func respOk(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, model.Response{
+		Status: "OK",
+	})
+}
+
+// Login начинает вход через провайдера OIDC: сохраняет state, nonce и PKCE verifier
+// и перенаправляет пользователя на страницу входа провайдера
+func Login(log *slog.Logger, s Server, p Provider, c config.OIDCCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.sso-handlers.Login"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		url, state, err := startLogin(r.Context(), s, p, c.StateTTL)
+		if err != nil {
+			log.Error("failed to start oidc login", slog.String("error", err.Error()))
+			render.Status(r, http.StatusBadGateway)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to start login",
+			})
+			return
+		}
+
+		setStateCookie(w, c, state, int(c.StateTTL.Seconds()))
+		http.Redirect(w, r, url, http.StatusFound)
+	}
+}
+
+func startLogin(ctx context.Context, s Server, p Provider, ttl time.Duration) (string, string, error) {
+	state, err := sso.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := sso.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	st := model.OIDCState{
+		State:        state,
+		CodeVerifier: sso.NewVerifier(),
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(ttl),
+	}
+	if err = s.CreateOIDCState(ctx, st); err != nil {
+		return "", "", err
+	}
+	url, err := p.AuthCodeURL(ctx, st.State, st.Nonce, st.CodeVerifier)
+	return url, state, err
+}
+
+// setStateCookie ставит или, при maxAge < 0, удаляет cookie со state. SameSite=Lax
+// пропускает cookie при переходе с провайдера на callback, но не в запросах с чужих страниц
+func setStateCookie(w http.ResponseWriter, c config.OIDCCfg, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(c.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// stateMatches сверяет state из ответа провайдера с cookie браузера
+func stateMatches(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(stateCookie)
+	return err == nil && subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) == 1
+}
+
+// Callback завершает вход: проверяет state, обменивает code на id_token, синхронизирует
+// членства по группам и выдает токен сессии для REST API
+func Callback(log *slog.Logger, s Server, p Provider, c config.OIDCCfg) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.sso-handlers.Callback"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		q := r.URL.Query()
+		if e := q.Get("error"); e != "" {
+			log.Error("provider returned error", slog.String("error", e), slog.String("description", q.Get("error_description")))
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "login failed: " + e,
+			})
+			return
+		}
+		if q.Get("state") == "" || q.Get("code") == "" {
+			log.Error("state or code is empty")
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "state and code are required",
+			})
+			return
+		}
+
+		if !stateMatches(r, q.Get("state")) {
+			log.Error("state does not match cookie")
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "login was started in another browser, start again",
+			})
+			return
+		}
+		setStateCookie(w, c, "", -1)
+
+		st, err := s.ConsumeOIDCState(r.Context(), q.Get("state"))
+		if err != nil {
+			log.Error("failed to consume state", slog.String("error", err.Error()))
+			msg := "failed to complete login"
+			if errors.Is(err, storage.ErrStateNotFound) {
+				render.Status(r, http.StatusBadRequest)
+				msg = "login session expired, start again"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		identity, err := p.Exchange(r.Context(), q.Get("code"), st.CodeVerifier, st.Nonce)
+		if err != nil {
+			log.Error("failed to exchange code", slog.String("error", err.Error()))
+			msg := "failed to verify login"
+			if errors.Is(err, sso.ErrNoEmail) {
+				msg = "identity provider did not return an email"
+			}
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		accountID, err := s.LoginOIDC(r.Context(), identity)
+		if err != nil {
+			log.Error("failed to login", slog.String("error", err.Error()))
+			msg := "failed to complete login"
+			if errors.Is(err, storage.ErrEmailTaken) {
+				render.Status(r, http.StatusConflict)
+				msg = "email is registered to another account and cannot be linked: it is not verified"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+
+		token, hash, err := auth.NewSessionToken()
+		session := model.Session{Token: token, ExpiresAt: time.Now().Add(c.SessionTTL)}
+		if err == nil {
+			err = s.CreateSession(r.Context(), accountID, hash, session.ExpiresAt)
+		}
+		if err != nil {
+			log.Error("failed to create session", slog.String("error", err.Error()))
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "failed to complete login",
+			})
+			return
+		}
+
+		log.Info("oidc login", slog.Int("account_id", accountID), slog.String("subject", identity.Subject), slog.Any("groups", identity.Groups))
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   session,
+		})
+	}
+}
+
+// Logout отзывает сессию, с которой пришел запрос
+func Logout(log *slog.Logger, s Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.sso-handlers.Logout"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		token, ok := auth.BearerToken(r)
+		if !ok || !auth.IsSessionToken(token) {
+			log.Error("request has no session token")
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "session token required",
+			})
+			return
+		}
+
+		if err := s.RevokeSession(r.Context(), auth.HashKey(token)); err != nil {
+			log.Error("failed to revoke session", slog.String("error", err.Error()))
+			msg := "failed to logout"
+			if errors.Is(err, storage.ErrSessionNotFound) {
+				msg = "session not found"
+			}
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  msg,
+			})
+			return
+		}
+		respOk(w, r)
+	}
+}
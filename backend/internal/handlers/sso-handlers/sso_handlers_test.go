@@ -0,0 +1,109 @@
+package sso_handlers
+
+import (
+	"REST_project/config"
+	model "REST_project/internal/models"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeServer хранит начатые входы в памяти и считает, сколько раз state погашали
+type fakeServer struct {
+	Server
+	states   map[string]model.OIDCState
+	consumed int
+}
+
+func (f *fakeServer) CreateOIDCState(_ context.Context, st model.OIDCState) error {
+	f.states[st.State] = st
+	return nil
+}
+
+func (f *fakeServer) ConsumeOIDCState(_ context.Context, state string) (model.OIDCState, error) {
+	f.consumed++
+	return f.states[state], nil
+}
+
+func (f *fakeServer) LoginOIDC(context.Context, model.OIDCIdentity) (int, error) {
+	return 1, nil
+}
+
+func (f *fakeServer) CreateSession(context.Context, int, string, time.Time) error {
+	return nil
+}
+
+type fakeProvider struct{}
+
+func (fakeProvider) AuthCodeURL(_ context.Context, state, _, _ string) (string, error) {
+	return "https://idp.example.com/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (fakeProvider) Exchange(context.Context, string, string, string) (model.OIDCIdentity, error) {
+	return model.OIDCIdentity{Subject: "sub", Email: "ann@example.com", EmailVerified: true}, nil
+}
+
+func TestCallbackState(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c := config.OIDCCfg{RedirectURL: "https://app.example.com/auth/oidc/callback", StateTTL: time.Minute, SessionTTL: time.Hour}
+
+	tests := []struct {
+		name       string
+		cookie     func(state string) *http.Cookie
+		wantStatus int
+		// state гасится, только если вход пришел из того же браузера
+		wantConsumed int
+	}{
+		{name: "same browser", cookie: func(state string) *http.Cookie {
+			return &http.Cookie{Name: stateCookie, Value: state}
+		}, wantStatus: http.StatusOK, wantConsumed: 1},
+		{name: "no cookie", cookie: func(string) *http.Cookie { return nil }, wantStatus: http.StatusBadRequest},
+		{name: "other state", cookie: func(string) *http.Cookie {
+			return &http.Cookie{Name: stateCookie, Value: "attacker"}
+		}, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeServer{states: make(map[string]model.OIDCState)}
+
+			w := httptest.NewRecorder()
+			Login(log, s, fakeProvider{}, c)(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+			if w.Code != http.StatusFound {
+				t.Fatalf("login status = %d, want %d", w.Code, http.StatusFound)
+			}
+			location, err := url.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := location.Query().Get("state")
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != stateCookie || cookies[0].Value != state {
+				t.Fatalf("login cookies = %v, want %s=%s", cookies, stateCookie, state)
+			}
+			if !cookies[0].HttpOnly || !cookies[0].Secure || cookies[0].SameSite != http.SameSiteLaxMode {
+				t.Errorf("state cookie %v must be HttpOnly, Secure and SameSite=Lax", cookies[0])
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?code=abc&state="+url.QueryEscape(state), nil)
+			if cookie := tt.cookie(state); cookie != nil {
+				r.AddCookie(cookie)
+			}
+			w = httptest.NewRecorder()
+			Callback(log, s, fakeProvider{}, c)(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("callback status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if s.consumed != tt.wantConsumed {
+				t.Errorf("state consumed %d times, want %d", s.consumed, tt.wantConsumed)
+			}
+		})
+	}
+}
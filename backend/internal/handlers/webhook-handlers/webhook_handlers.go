@@ -0,0 +1,413 @@
+package webhook_handlers
+
+import (
+	"REST_project/internal/handlers/auth"
+	model "REST_project/internal/models"
+	"REST_project/internal/policy"
+	"REST_project/internal/storage"
+	"REST_project/internal/webhook"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// Подписки предприятия на вебхуки. Управлять ими может владелец или администратор
+
+// defaultDeliveries и maxDeliveries - размер журнала доставок по умолчанию и наибольший
+const (
+	defaultDeliveries = 50
+	maxDeliveries     = 200
+)
+
+type Server interface {
+	CreateWebhook(ctx context.Context, w model.Webhook) (model.Webhook, error)
+	GetWebhooks(ctx context.Context, enterpriseID int) ([]model.Webhook, error)
+	UpdateWebhook(ctx context.Context, w model.Webhook) (model.Webhook, error)
+	DeleteWebhook(ctx context.Context, enterpriseID, webhookID int) error
+	GetWebhookDeliveries(ctx context.Context, enterpriseID, webhookID int, status string, limit int) ([]model.WebhookDelivery, error)
+	RetryWebhookDelivery(ctx context.Context, enterpriseID, webhookID int, deliveryID int64) error
+}
+
+type Policy interface {
+	Authorize(ctx context.Context, enterpriseID int, perm policy.Permission) error
+}
+
+// RequestWebhook - тело создания и изменения подписки. Пустой EventTypes - все типы событий,
+// Active по умолчанию true
+type RequestWebhook struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+// CreateWebhook создает подписку. Секрет для проверки подписи отдается только в этом ответе
+func CreateWebhook(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.webhook-handlers.CreateWebhook"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ManageIntegrations)) {
+			return
+		}
+
+		var req RequestWebhook
+		if !decode(w, r, log, &req) {
+			return
+		}
+		hook, ok := validate(w, r, log, req)
+		if !ok {
+			return
+		}
+		hook.EnterpriseID = enterpriseID
+
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			log.Error("failed to generate secret", slog.String("error", err.Error()))
+			failed(w, r, "failed to create webhook")
+			return
+		}
+		hook.Secret = secret
+
+		log.Info("creating webhook", slog.Int("enterprise_id", enterpriseID), slog.String("url", hook.URL))
+
+		created, err := s.CreateWebhook(r.Context(), hook)
+		if errors.Is(err, storage.ErrEnterpriseNotFound) {
+			notFound(w, r, log, "enterprise not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to create webhook", slog.String("error", err.Error()))
+			failed(w, r, "failed to create webhook")
+			return
+		}
+
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   created,
+		})
+	}
+}
+
+// GetWebhooks возвращает подписки предприятия без секретов
+func GetWebhooks(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.webhook-handlers.GetWebhooks"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ManageIntegrations)) {
+			return
+		}
+
+		hooks, err := s.GetWebhooks(r.Context(), enterpriseID)
+		if err != nil {
+			log.Error("failed to get webhooks", slog.String("error", err.Error()))
+			failed(w, r, "failed to get webhooks")
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   hooks,
+		})
+	}
+}
+
+// UpdateWebhook заменяет адрес, типы событий, описание и активность подписки
+func UpdateWebhook(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.webhook-handlers.UpdateWebhook"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		webhookID, ok := urlID(w, r, log, "webhookID", "webhook")
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ManageIntegrations)) {
+			return
+		}
+
+		var req RequestWebhook
+		if !decode(w, r, log, &req) {
+			return
+		}
+		hook, ok := validate(w, r, log, req)
+		if !ok {
+			return
+		}
+		hook.ID, hook.EnterpriseID = webhookID, enterpriseID
+
+		log.Info("updating webhook", slog.Int("webhook_id", webhookID), slog.String("url", hook.URL))
+
+		updated, err := s.UpdateWebhook(r.Context(), hook)
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			notFound(w, r, log, "webhook not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to update webhook", slog.String("error", err.Error()))
+			failed(w, r, "failed to update webhook")
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   updated,
+		})
+	}
+}
+
+// DeleteWebhook удаляет подписку и ее журнал доставок
+func DeleteWebhook(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.webhook-handlers.DeleteWebhook"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		webhookID, ok := urlID(w, r, log, "webhookID", "webhook")
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ManageIntegrations)) {
+			return
+		}
+
+		log.Info("deleting webhook", slog.Int("webhook_id", webhookID))
+
+		err := s.DeleteWebhook(r.Context(), enterpriseID, webhookID)
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			notFound(w, r, log, "webhook not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to delete webhook", slog.String("error", err.Error()))
+			failed(w, r, "failed to delete webhook")
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+		})
+	}
+}
+
+// GetDeliveries возвращает журнал доставок подписки: ?status=pending|delivered|dead&limit=N
+func GetDeliveries(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.webhook-handlers.GetDeliveries"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		webhookID, ok := urlID(w, r, log, "webhookID", "webhook")
+		if !ok {
+			return
+		}
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ManageIntegrations)) {
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", model.DeliveryPending, model.DeliveryDelivered, model.DeliveryDead:
+		default:
+			badRequest(w, r, log, "invalid status")
+			return
+		}
+		limit := defaultDeliveries
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				badRequest(w, r, log, "invalid limit")
+				return
+			}
+			limit = min(n, maxDeliveries)
+		}
+
+		deliveries, err := s.GetWebhookDeliveries(r.Context(), enterpriseID, webhookID, status, limit)
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			notFound(w, r, log, "webhook not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to get deliveries", slog.String("error", err.Error()))
+			failed(w, r, "failed to get deliveries")
+			return
+		}
+
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+			Data:   deliveries,
+		})
+	}
+}
+
+// RetryDelivery ставит доставку в очередь заново, например мертвую после починки приемника
+func RetryDelivery(log *slog.Logger, s Server, p Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "internal.handlers.webhook-handlers.RetryDelivery"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		enterpriseID, ok := urlID(w, r, log, "id", "enterprise")
+		if !ok {
+			return
+		}
+		webhookID, ok := urlID(w, r, log, "webhookID", "webhook")
+		if !ok {
+			return
+		}
+		deliveryID, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+		if err != nil || deliveryID <= 0 {
+			badRequest(w, r, log, "invalid delivery id")
+			return
+		}
+		if !auth.Allowed(w, r, log, p.Authorize(r.Context(), enterpriseID, policy.ManageIntegrations)) {
+			return
+		}
+
+		log.Info("retrying delivery", slog.Int("webhook_id", webhookID), slog.Int64("delivery_id", deliveryID))
+
+		err = s.RetryWebhookDelivery(r.Context(), enterpriseID, webhookID, deliveryID)
+		if errors.Is(err, storage.ErrDeliveryNotFound) {
+			notFound(w, r, log, "delivery not found")
+			return
+		}
+		if err != nil {
+			log.Error("failed to retry delivery", slog.String("error", err.Error()))
+			failed(w, r, "failed to retry delivery")
+			return
+		}
+
+		render.Status(r, http.StatusAccepted)
+		render.JSON(w, r, model.Response{
+			Status: "OK",
+		})
+	}
+}
+
+// validate проверяет адрес и типы событий. Адрес должен быть абсолютным http(s) URL,
+// внутренние адреса отсекает рассылка при подключении
+func validate(w http.ResponseWriter, r *http.Request, log *slog.Logger, req RequestWebhook) (model.Webhook, bool) {
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		badRequest(w, r, log, "url must be an absolute http or https address")
+		return model.Webhook{}, false
+	}
+
+	types := []string{}
+	for _, t := range req.EventTypes {
+		if !slices.Contains(model.WebhookEventTypes, t) {
+			badRequest(w, r, log, "unknown event type "+strconv.Quote(t))
+			return model.Webhook{}, false
+		}
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+	return model.Webhook{
+		URL:         u.String(),
+		EventTypes:  types,
+		Description: strings.TrimSpace(req.Description),
+		Active:      active,
+	}, true
+}
+
+func urlID(w http.ResponseWriter, r *http.Request, log *slog.Logger, param, entity string) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, param))
+	if err != nil || id <= 0 {
+		badRequest(w, r, log, "invalid "+entity+" id")
+		return 0, false
+	}
+	return id, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, log *slog.Logger, v any) bool {
+	err := render.DecodeJSON(r.Body, v)
+	if errors.Is(err, io.EOF) {
+		badRequest(w, r, log, "empty request")
+		return false
+	}
+	if err != nil {
+		log.Error("failed to decode request body", slog.String("error", err.Error()))
+		badRequest(w, r, log, "invalid request format")
+		return false
+	}
+	return true
+}
+
+func badRequest(w http.ResponseWriter, r *http.Request, log *slog.Logger, msg string) {
+	log.Info(msg)
+	render.Status(r, http.StatusBadRequest)
+	render.JSON(w, r, model.Response{
+		Status: "Error",
+		Error:  msg,
+	})
+}
+
+func notFound(w http.ResponseWriter, r *http.Request, log *slog.Logger, msg string) {
+	log.Info(msg)
+	render.Status(r, http.StatusNotFound)
+	render.JSON(w, r, model.Response{
+		Status: "Error",
+		Error:  msg,
+	})
+}
+
+func failed(w http.ResponseWriter, r *http.Request, msg string) {
+	render.Status(r, http.StatusInternalServerError)
+	render.JSON(w, r, model.Response{
+		Status: "Error",
+		Error:  msg,
+	})
+}
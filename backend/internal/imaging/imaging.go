@@ -0,0 +1,189 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"slices"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels ограничивает размер изображения, которое мы готовы декодировать,
+// чтобы маленький файл с огромными размерами не съел всю память
+const MaxPixels = 50_000_000
+
+const (
+	originalQuality  = 90
+	thumbnailQuality = 80
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported image format")
+	ErrTooLarge    = errors.New("image dimensions are too large")
+)
+
+type Variant struct {
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+type Result struct {
+	// Data - исходное изображение без метаданных
+	Data     []byte
+	Width    int
+	Height   int
+	Variants []Variant
+}
+
+// IsImage сообщает, умеет ли Process обрабатывать данный тип
+func IsImage(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Process удаляет из изображения EXIF и прочие метаданные и строит уменьшенные
+// копии указанной ширины. Копии шире оригинала не создаются
+func Process(data []byte, contentType string, widths []int) (*Result, error) {
+	const op = "imaging.Process"
+
+	if !IsImage(contentType) {
+		return nil, fmt.Errorf("%s: %w", op, ErrUnsupported)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("%s: %w", op, ErrTooLarge)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var clean []byte
+	switch contentType {
+	case "image/jpeg":
+		// вместе с EXIF пропадет и тег ориентации, поэтому повернутые
+		// снимки с телефона поворачиваем сами и пережимаем
+		if o := jpegOrientation(data); o > 1 {
+			img = orient(img, o)
+			clean, err = encode(img, contentType, originalQuality)
+		} else {
+			clean, err = stripJPEG(data)
+		}
+	case "image/png":
+		clean, err = stripPNG(data)
+	case "image/webp":
+		clean, err = stripWebP(data)
+	case "image/gif":
+		// GIF не содержит EXIF
+		clean = data
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	b := img.Bounds()
+	res := &Result{Data: clean, Width: b.Dx(), Height: b.Dy()}
+
+	thumbType := "image/png"
+	if contentType == "image/jpeg" {
+		thumbType = "image/jpeg"
+	}
+
+	widths = slices.Clone(widths)
+	slices.Sort(widths)
+	for _, w := range slices.Compact(widths) {
+		if w <= 0 || w >= b.Dx() {
+			continue
+		}
+		h := max(1, b.Dy()*w/b.Dx())
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+
+		data, err := encode(dst, thumbType, thumbnailQuality)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		res.Variants = append(res.Variants, Variant{
+			Width:       w,
+			Height:      h,
+			ContentType: thumbType,
+			Data:        data,
+		})
+	}
+
+	return res, nil
+}
+
+func encode(img image.Image, contentType string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// orient приводит изображение к нормальной ориентации по значению EXIF-тега Orientation (1-8)
+func orient(src image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			si := rgba.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], rgba.Pix[si:si+4])
+		}
+	}
+	return dst
+}
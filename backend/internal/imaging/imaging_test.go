@@ -0,0 +1,154 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"slices"
+	"testing"
+)
+
+// exifSegment возвращает сегмент APP1 с EXIF, в котором только тег Orientation
+func exifSegment(order binary.AppendByteOrder, orientation int) []byte {
+	tiff := []byte("MM")
+	if order == binary.LittleEndian {
+		tiff = []byte("II")
+	}
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = order.AppendUint16(tiff, 1)
+	tiff = order.AppendUint16(tiff, 0x0112) // Orientation
+	tiff = order.AppendUint16(tiff, 3)      // SHORT
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0)
+
+	payload := append(slices.Clone(exifHeader), tiff...)
+	seg := []byte{0xFF, markerAPP1}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(2+len(payload)))
+	return append(seg, payload...)
+}
+
+// withSegment вставляет сегмент в JPEG сразу после SOI
+func withSegment(data, seg []byte) []byte {
+	return slices.Concat(data[:2], seg, data[2:])
+}
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	plain := testJPEG(t, 4, 4)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{name: "no exif", data: plain, want: 1},
+		{name: "little endian", data: withSegment(plain, exifSegment(binary.LittleEndian, 6)), want: 6},
+		{name: "big endian", data: withSegment(plain, exifSegment(binary.BigEndian, 8)), want: 8},
+		{name: "out of range", data: withSegment(plain, exifSegment(binary.LittleEndian, 9)), want: 1},
+		{name: "not exif app1", data: withSegment(plain, []byte{0xFF, markerAPP1, 0, 6, 'h', 't', 't', 'p'}), want: 1},
+		{name: "malformed", data: []byte("not a jpeg"), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Fatalf("jpegOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// исходное изображение 3x2:
+	//  a b c
+	//  d e f
+	const a, b, c, d, e, f = 10, 20, 30, 40, 50, 60
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	for i, y := range []uint8{a, b, c, d, e, f} {
+		src.SetGray(i%3, i/3, color.Gray{Y: y})
+	}
+
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{orientation: 0, want: [][]uint8{{a, b, c}, {d, e, f}}},
+		{orientation: 1, want: [][]uint8{{a, b, c}, {d, e, f}}},
+		{orientation: 2, want: [][]uint8{{c, b, a}, {f, e, d}}},
+		{orientation: 3, want: [][]uint8{{f, e, d}, {c, b, a}}},
+		{orientation: 4, want: [][]uint8{{d, e, f}, {a, b, c}}},
+		{orientation: 5, want: [][]uint8{{a, d}, {b, e}, {c, f}}},
+		{orientation: 6, want: [][]uint8{{d, a}, {e, b}, {f, c}}},
+		{orientation: 7, want: [][]uint8{{f, c}, {e, b}, {d, a}}},
+		{orientation: 8, want: [][]uint8{{c, f}, {b, e}, {a, d}}},
+	}
+
+	for _, tt := range tests {
+		img := orient(src, tt.orientation)
+		var got [][]uint8
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			var row []uint8
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				row = append(row, color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			}
+			got = append(got, row)
+		}
+		if !slices.EqualFunc(got, tt.want, slices.Equal) {
+			t.Errorf("orient(%d) = %v, want %v", tt.orientation, got, tt.want)
+		}
+	}
+}
+
+func TestProcessOrientation(t *testing.T) {
+	plain := testJPEG(t, 30, 20)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantWidth  int
+		wantHeight int
+	}{
+		{name: "no exif", data: plain, wantWidth: 30, wantHeight: 20},
+		{name: "normal", data: withSegment(plain, exifSegment(binary.LittleEndian, 1)), wantWidth: 30, wantHeight: 20},
+		{name: "upside down", data: withSegment(plain, exifSegment(binary.LittleEndian, 3)), wantWidth: 30, wantHeight: 20},
+		{name: "rotated", data: withSegment(plain, exifSegment(binary.BigEndian, 6)), wantWidth: 20, wantHeight: 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Process(tt.data, "image/jpeg", []int{10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Width != tt.wantWidth || res.Height != tt.wantHeight {
+				t.Fatalf("size = %dx%d, want %dx%d", res.Width, res.Height, tt.wantWidth, tt.wantHeight)
+			}
+			if bytes.Contains(res.Data, exifHeader) {
+				t.Error("EXIF kept in the cleaned image")
+			}
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(res.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.wantWidth || cfg.Height != tt.wantHeight {
+				t.Errorf("cleaned image is %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantWidth, tt.wantHeight)
+			}
+			if len(res.Variants) != 1 || res.Variants[0].Width != 10 || res.Variants[0].Height != 10*tt.wantHeight/tt.wantWidth {
+				t.Errorf("variants = %+v, want one 10 wide in the same orientation", res.Variants)
+			}
+		})
+	}
+}
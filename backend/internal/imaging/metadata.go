@@ -0,0 +1,191 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("malformed image")
+
+// Маркеры JPEG
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerEOI  = 0xD9
+	markerAPP1 = 0xE1 // EXIF и XMP
+	markerAPPD = 0xED // Photoshop / IPTC
+	markerCOM  = 0xFE
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// jpegSegments вызывает fn для каждого сегмента до начала сжатых данных (SOS).
+// Возвращает смещение маркера SOS
+func jpegSegments(data []byte, fn func(marker byte, segment []byte)) (int, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return 0, errMalformed
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 0, errMalformed
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// байт-заполнитель
+			i++
+			continue
+		}
+		if marker == markerSOS || marker == markerEOI {
+			return i, nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0, errMalformed
+		}
+		fn(marker, data[i:i+2+length])
+		i += 2 + length
+	}
+	return 0, errMalformed
+}
+
+// stripJPEG без перекодирования удаляет сегменты с EXIF, XMP, IPTC и комментарии
+func stripJPEG(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	sos, err := jpegSegments(data, func(marker byte, segment []byte) {
+		switch marker {
+		case markerAPP1, markerAPPD, markerCOM:
+			return
+		}
+		out.Write(segment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Write(data[sos:])
+	return out.Bytes(), nil
+}
+
+// jpegOrientation возвращает значение EXIF-тега Orientation или 1, если его нет
+func jpegOrientation(data []byte) int {
+	orientation := 1
+	jpegSegments(data, func(marker byte, segment []byte) {
+		if marker != markerAPP1 || orientation != 1 {
+			return
+		}
+		payload := segment[4:]
+		if !bytes.HasPrefix(payload, exifHeader) {
+			return
+		}
+		if o, ok := tiffOrientation(payload[len(exifHeader):]); ok {
+			orientation = o
+		}
+	})
+	return orientation
+}
+
+func tiffOrientation(tiff []byte) (int, bool) {
+	const tagOrientation = 0x0112
+
+	if len(tiff) < 8 {
+		return 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0, false
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		e := ifd + 2 + n*12
+		if e+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[e:]) == tagOrientation {
+			o := int(order.Uint16(tiff[e+8:]))
+			return o, o >= 1 && o <= 8
+		}
+	}
+	return 0, false
+}
+
+// stripPNG удаляет чанки с EXIF, текстовыми метаданными и временем изменения
+func stripPNG(data []byte) ([]byte, error) {
+	const sigLen = 8
+	if len(data) < sigLen || string(data[1:4]) != "PNG" {
+		return nil, errMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:sigLen])
+
+	for i := sigLen; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+// stripWebP удаляет чанки EXIF и XMP из контейнера RIFF и сбрасывает
+// соответствующие флаги в заголовке VP8X
+func stripWebP(data []byte) ([]byte, error) {
+	const (
+		headerLen = 12
+		flagEXIF  = 0x08
+		flagXMP   = 0x04
+	)
+	if len(data) < headerLen || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:headerLen])
+
+	for i := headerLen; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := bytes.Clone(data[i:end])
+			if len(chunk) > 8 {
+				chunk[8] &^= flagEXIF | flagXMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	res := out.Bytes()
+	binary.LittleEndian.PutUint32(res[4:], uint32(len(res)-8))
+	return res, nil
+}
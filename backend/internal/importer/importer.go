@@ -0,0 +1,222 @@
+package importer
+
+import (
+	model "REST_project/internal/models"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// Форматы файла импорта
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+const (
+	maxNameLen  = 255
+	maxEmailLen = 255
+	// maxLineSize - предел длины строки JSON Lines
+	maxLineSize = 64 * 1024
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown import format")
+	ErrMissingName   = errors.New("csv header must contain a name column")
+	ErrNameRequired  = errors.New("name is required")
+	ErrNameTooLong   = errors.New("name is too long")
+	ErrInvalidEmail  = errors.New("invalid email")
+	ErrDuplicate     = errors.New("duplicate of an earlier row")
+	ErrAlreadyExists = errors.New("participant is already registered")
+	ErrBanned        = errors.New("participant is banned from this event")
+	ErrMalformedRow  = errors.New("malformed row")
+)
+
+// RowError - ошибка одной строки файла. После нее чтение продолжается со следующей строки
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Reader читает участников из файла по одной строке, не загружая файл целиком.
+// Read возвращает номер строки в файле и участника. Ошибка *RowError относится к строке,
+// io.EOF означает конец файла, остальные ошибки прерывают чтение
+type Reader interface {
+	Read() (int, model.Participant, error)
+}
+
+// FormatFromContentType определяет формат по Content-Type или возвращает пустую строку
+func FormatFromContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return FormatCSV
+	case "application/jsonl", "application/x-ndjson", "application/x-jsonlines", "application/jsonlines":
+		return FormatJSONL
+	}
+	return ""
+}
+
+// NewReader возвращает читатель формата format. Для CSV сразу читается строка заголовка:
+// в ней обязателен столбец name, столбец email необязателен, остальные игнорируются
+func NewReader(r io.Reader, format string) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatJSONL:
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 4096), maxLineSize)
+		return &jsonlReader{sc: sc}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+type csvReader struct {
+	r     *csv.Reader
+	name  int
+	email int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, ErrMissingName
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &csvReader{r: cr, name: -1, email: -1}
+	for i, col := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(col, "\ufeff"))) {
+		case "name":
+			c.name = i
+		case "email":
+			c.email = i
+		}
+	}
+	if c.name < 0 {
+		return nil, ErrMissingName
+	}
+	return c, nil
+}
+
+func (c *csvReader) Read() (int, model.Participant, error) {
+	record, err := c.r.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, model.Participant{}, &RowError{Line: parseErr.StartLine, Err: ErrMalformedRow}
+	}
+	if err != nil {
+		return 0, model.Participant{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	var p model.Participant
+	if c.name < len(record) {
+		p.Name = record[c.name]
+	}
+	if c.email >= 0 && c.email < len(record) {
+		p.Email = record[c.email]
+	}
+	return line, p, nil
+}
+
+type jsonlReader struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+func (j *jsonlReader) Read() (int, model.Participant, error) {
+	for j.sc.Scan() {
+		j.line++
+		b := j.sc.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		var row struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		}
+		if err := json.Unmarshal(b, &row); err != nil {
+			return j.line, model.Participant{}, &RowError{Line: j.line, Err: ErrMalformedRow}
+		}
+		return j.line, model.Participant{Name: row.Name, Email: row.Email}, nil
+	}
+	if err := j.sc.Err(); err != nil {
+		return 0, model.Participant{}, err
+	}
+	return 0, model.Participant{}, io.EOF
+}
+
+// Validator проверяет строки импорта и отсеивает дубликаты: повторы внутри файла
+// и уже зарегистрированных участников. Участник с email сравнивается по email, без него - по имени
+type Validator struct {
+	index model.ParticipantIndex
+	seen  map[string]bool
+}
+
+func NewValidator(index model.ParticipantIndex) *Validator {
+	return &Validator{index: index, seen: make(map[string]bool)}
+}
+
+// Check приводит участника к виду для записи и возвращает ошибку, если строку импортировать нельзя
+func (v *Validator) Check(p *model.Participant) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Email = strings.TrimSpace(p.Email)
+	if p.Name == "" {
+		return ErrNameRequired
+	}
+	if utf8.RuneCountInString(p.Name) > maxNameLen {
+		return ErrNameTooLong
+	}
+	if p.Email != "" {
+		addr, err := mail.ParseAddress(p.Email)
+		if err != nil || addr.Address != p.Email || len(p.Email) > maxEmailLen {
+			return ErrInvalidEmail
+		}
+	}
+
+	name, email := strings.ToLower(p.Name), strings.ToLower(p.Email)
+	if v.index.BannedNames[name] || (email != "" && v.index.BannedEmails[email]) {
+		return ErrBanned
+	}
+
+	key := "name:" + name
+	exists := v.index.Names[name]
+	if email != "" {
+		key = "email:" + email
+		exists = v.index.Emails[email]
+	}
+	if exists {
+		return ErrAlreadyExists
+	}
+	if v.seen[key] {
+		return ErrDuplicate
+	}
+	v.seen[key] = true
+	return nil
+}
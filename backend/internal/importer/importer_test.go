@@ -0,0 +1,39 @@
+package importer
+
+import (
+	model "REST_project/internal/models"
+	"errors"
+	"testing"
+)
+
+func TestValidatorBans(t *testing.T) {
+	// забанен участник "Bob" с email bob@example.com
+	index := model.ParticipantIndex{
+		Emails:       map[string]bool{},
+		Names:        map[string]bool{},
+		BannedNames:  map[string]bool{"bob": true},
+		BannedEmails: map[string]bool{"bob@example.com": true},
+	}
+
+	tests := []struct {
+		name    string
+		p       model.Participant
+		wantErr error
+	}{
+		{name: "same name without email", p: model.Participant{Name: "Bob"}, wantErr: ErrBanned},
+		{name: "same name in other case", p: model.Participant{Name: " BOB "}, wantErr: ErrBanned},
+		{name: "same name with other email", p: model.Participant{Name: "Bob", Email: "bob2@example.com"}, wantErr: ErrBanned},
+		{name: "other name with same email", p: model.Participant{Name: "Robert", Email: "Bob@Example.com"}, wantErr: ErrBanned},
+		{name: "other name and email", p: model.Participant{Name: "Alice", Email: "alice@example.com"}},
+		{name: "other name without email", p: model.Participant{Name: "Alice"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewValidator(index).Check(&tt.p)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check(%+v) = %v, want %v", tt.p, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package live
+
+import (
+	"REST_project/config"
+	model "REST_project/internal/models"
+	"REST_project/internal/storage"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type Store interface {
+	Listen(ctx context.Context) (*storage.Listener, error)
+	GetTxDomainEvents(ctx context.Context, txid string, types []string) ([]model.DomainEvent, error)
+	GetDomainEventsSince(ctx context.Context, since time.Time, types []string, limit int) ([]model.DomainEvent, error)
+}
+
+// Types - доменные события, которые видят живые клиенты
+var Types = []string{model.PostCreated, model.CommentCreated, model.CommentModerated}
+
+// catchUpSlack - насколько раньше обрыва начинается досылка: события транзакций, которые
+// начались до обрыва, а закоммичены после, записаны со временем до обрыва
+const catchUpSlack = 10 * time.Second
+
+// Message - обновление, которое получает клиент события
+type Message struct {
+	// ID - номер доменного события, клиент может отбросить по нему повтор
+	ID   int64
+	Type string
+	Data json.RawMessage
+}
+
+// Subscription - подписка клиента на обновления одного события. C закрывается,
+// когда клиент не успевает читать сообщения или сервер останавливается
+type Subscription struct {
+	C       <-chan Message
+	c       chan Message
+	eventID int
+}
+
+// Hub рассылает обновления клиентам этого сервера. Изменения на любом сервере приходят
+// через LISTEN/NOTIFY, поэтому клиент получает их, к какому бы серверу ни подключился
+type Hub struct {
+	log   *slog.Logger
+	store Store
+	c     config.LiveCfg
+
+	mu   sync.Mutex
+	subs map[int]map[*Subscription]struct{}
+	// closed - hub остановлен, новые подписки сразу закрываются
+	closed bool
+}
+
+func New(log *slog.Logger, store Store, c config.LiveCfg) *Hub {
+	if c.Buffer < 1 {
+		c.Buffer = 1
+	}
+	if c.ReconnectMin <= 0 {
+		c.ReconnectMin = time.Second
+	}
+	if c.ReconnectMax < c.ReconnectMin {
+		c.ReconnectMax = c.ReconnectMin
+	}
+	return &Hub{
+		log:   log.With(slog.String("component", "live")),
+		store: store,
+		c:     c,
+		subs:  make(map[int]map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe подписывает клиента на обновления события eventID
+func (h *Hub) Subscribe(eventID int) *Subscription {
+	c := make(chan Message, h.c.Buffer)
+	sub := &Subscription{C: c, c: c, eventID: eventID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c)
+		return sub
+	}
+	if h.subs[eventID] == nil {
+		h.subs[eventID] = make(map[*Subscription]struct{})
+	}
+	h.subs[eventID][sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe снимает подписку. Повторный вызов ничего не делает
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// remove вызывается под h.mu
+func (h *Hub) remove(sub *Subscription) {
+	subs, ok := h.subs[sub.eventID]
+	if !ok {
+		return
+	}
+	if _, ok = subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.c)
+	if len(subs) == 0 {
+		delete(h.subs, sub.eventID)
+	}
+}
+
+// Run слушает уведомления, пока не отменен ctx. После обрыва соединения переподключается
+// и досылает события, записанные за время обрыва. При остановке закрывает все подписки
+func (h *Hub) Run(ctx context.Context) {
+	defer h.closeAll()
+
+	delay := h.c.ReconnectMin
+	var lost time.Time
+	for ctx.Err() == nil {
+		l, err := h.store.Listen(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				h.log.Error("failed to listen", slog.String("error", err.Error()), slog.Duration("retry_in", delay))
+			}
+			if lost.IsZero() {
+				lost = time.Now()
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, h.c.ReconnectMax)
+			continue
+		}
+		delay = h.c.ReconnectMin
+
+		// LISTEN уже действует, поэтому то, что записано после этого места, придет уведомлением
+		if !lost.IsZero() {
+			h.catchUp(ctx, lost.Add(-catchUpSlack))
+			h.log.Info("listening again", slog.Duration("lost_for", time.Since(lost)))
+		}
+
+		err = h.listen(ctx, l)
+		l.Close(context.WithoutCancel(ctx))
+		if ctx.Err() == nil {
+			h.log.Error("lost listen connection", slog.String("error", err.Error()))
+		}
+		lost = time.Now()
+	}
+}
+
+func (h *Hub) listen(ctx context.Context, l *storage.Listener) error {
+	for {
+		txid, err := l.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		events, err := h.store.GetTxDomainEvents(ctx, txid, Types)
+		if err != nil {
+			if ctx.Err() == nil {
+				h.log.Error("failed to get domain events", slog.String("txid", txid), slog.String("error", err.Error()))
+			}
+			continue
+		}
+		h.publish(events)
+	}
+}
+
+// catchUp досылает события, записанные с since. Часть из них клиенты могли уже получить
+func (h *Hub) catchUp(ctx context.Context, since time.Time) {
+	events, err := h.store.GetDomainEventsSince(ctx, since, Types, h.c.CatchUpLimit)
+	if err != nil {
+		if ctx.Err() == nil {
+			h.log.Error("failed to catch up domain events", slog.String("error", err.Error()))
+		}
+		return
+	}
+	if len(events) == h.c.CatchUpLimit {
+		h.log.Warn("catch up limit reached, some updates are lost", slog.Int("limit", h.c.CatchUpLimit))
+	}
+	h.publish(events)
+}
+
+// publish отправляет события подписчикам их мероприятий. Клиента, у которого заполнен буфер,
+// hub отключает, а не ждет: один медленный клиент не должен задерживать остальных
+func (h *Hub) publish(events []model.DomainEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range events {
+		subs := h.subs[e.EventID]
+		if len(subs) == 0 {
+			continue
+		}
+		msg, ok := message(e)
+		if !ok {
+			continue
+		}
+		for sub := range subs {
+			select {
+			case sub.c <- msg:
+			default:
+				h.log.Warn("slow live client dropped", slog.Int("event_id", e.EventID))
+				h.remove(sub)
+			}
+		}
+	}
+}
+
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+// message превращает доменное событие в сообщение для участников. Комментарий виден, когда
+// он одобрен, и без причины модерации. Об отклонении клиент узнает только номер комментария,
+// чтобы убрать его, если уже показал
+func message(e model.DomainEvent) (Message, bool) {
+	msg := Message{ID: e.ID, Type: e.Type, Data: e.Payload}
+	switch e.Type {
+	case model.CommentCreated, model.CommentModerated:
+		var c model.Comment
+		if err := json.Unmarshal(e.Payload, &c); err != nil {
+			return Message{}, false
+		}
+		switch {
+		case c.Status == model.CommentApproved:
+			c.ModerationReason = ""
+		case c.Status == model.CommentRejected && e.Type == model.CommentModerated:
+			c = model.Comment{ID: c.ID, PostID: c.PostID, Status: c.Status}
+		default:
+			return Message{}, false
+		}
+		data, err := json.Marshal(c)
+		if err != nil {
+			return Message{}, false
+		}
+		msg.Data = data
+	}
+	return msg, true
+}
@@ -0,0 +1,201 @@
+package live
+
+import (
+	"REST_project/config"
+	model "REST_project/internal/models"
+	"REST_project/internal/storage"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	since    []model.DomainEvent
+	gotSince time.Time
+	gotLimit int
+}
+
+func (f *fakeStore) Listen(context.Context) (*storage.Listener, error) { return nil, context.Canceled }
+
+func (f *fakeStore) GetTxDomainEvents(context.Context, string, []string) ([]model.DomainEvent, error) {
+	return nil, nil
+}
+
+func (f *fakeStore) GetDomainEventsSince(_ context.Context, since time.Time, _ []string, limit int) ([]model.DomainEvent, error) {
+	f.gotSince, f.gotLimit = since, limit
+	return f.since, nil
+}
+
+func newTestHub(store Store, buffer int) *Hub {
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), store, config.LiveCfg{Buffer: buffer, CatchUpLimit: 100})
+}
+
+func post(id int64, eventID int) model.DomainEvent {
+	return model.DomainEvent{ID: id, Type: model.PostCreated, EventID: eventID, Payload: json.RawMessage(`{"id":1}`)}
+}
+
+func comment(id int64, eventType string, c model.Comment) model.DomainEvent {
+	payload, _ := json.Marshal(c)
+	return model.DomainEvent{ID: id, Type: eventType, EventID: 1, Payload: payload}
+}
+
+// received забирает сообщения, уже лежащие в канале, и сообщает, закрыт ли он
+func received(sub *Subscription) ([]int64, bool) {
+	var ids []int64
+	for {
+		select {
+		case msg, ok := <-sub.C:
+			if !ok {
+				return ids, true
+			}
+			ids = append(ids, msg.ID)
+		default:
+			return ids, false
+		}
+	}
+}
+
+func TestHubPublish(t *testing.T) {
+	h := newTestHub(&fakeStore{}, 10)
+	a, b := h.Subscribe(1), h.Subscribe(1)
+	other := h.Subscribe(2)
+
+	h.publish([]model.DomainEvent{
+		post(1, 1),
+		post(2, 2),
+		comment(3, model.CommentCreated, model.Comment{ID: 1, Status: model.CommentApproved}),
+		comment(4, model.CommentCreated, model.Comment{ID: 2, Status: model.CommentPending}),
+		comment(5, model.CommentModerated, model.Comment{ID: 2, Status: model.CommentRejected}),
+		comment(6, model.CommentCreated, model.Comment{ID: 3, Status: model.CommentRejected}),
+	})
+
+	tests := []struct {
+		name string
+		sub  *Subscription
+		want []int64
+	}{
+		{name: "first client", sub: a, want: []int64{1, 3, 5}},
+		{name: "second client", sub: b, want: []int64{1, 3, 5}},
+		{name: "other event", sub: other, want: []int64{2}},
+	}
+	for _, tt := range tests {
+		got, closed := received(tt.sub)
+		if closed || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v (closed %v), want %v", tt.name, got, closed, tt.want)
+		}
+	}
+
+	h.Unsubscribe(b)
+	h.Unsubscribe(b)
+	h.publish([]model.DomainEvent{post(7, 1)})
+	if got, _ := received(a); !slices.Equal(got, []int64{7}) {
+		t.Errorf("after unsubscribe of the other client got %v, want [7]", got)
+	}
+	if _, closed := received(b); !closed {
+		t.Error("unsubscribed channel is not closed")
+	}
+}
+
+func TestHubMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		e    model.DomainEvent
+		want *model.Comment
+	}{
+		{
+			name: "approved comment without reason",
+			e:    comment(1, model.CommentCreated, model.Comment{ID: 1, PostID: 2, Content: "hi", Status: model.CommentApproved, ModerationReason: "checked"}),
+			want: &model.Comment{ID: 1, PostID: 2, Content: "hi", Status: model.CommentApproved},
+		},
+		{
+			name: "rejected comment reduced to its id",
+			e:    comment(2, model.CommentModerated, model.Comment{ID: 1, PostID: 2, ParticipantID: 3, Content: "spam", Status: model.CommentRejected, ModerationReason: "links"}),
+			want: &model.Comment{ID: 1, PostID: 2, Status: model.CommentRejected},
+		},
+		{
+			name: "pending comment hidden",
+			e:    comment(3, model.CommentModerated, model.Comment{ID: 1, Status: model.CommentPending}),
+		},
+		{
+			name: "malformed payload",
+			e:    model.DomainEvent{ID: 4, Type: model.CommentCreated, Payload: json.RawMessage(`[`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, ok := message(tt.e)
+			if ok != (tt.want != nil) {
+				t.Fatalf("message ok = %v, want %v", ok, tt.want != nil)
+			}
+			if !ok {
+				return
+			}
+			var got model.Comment
+			if err := json.Unmarshal(msg.Data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != *tt.want || msg.ID != tt.e.ID || msg.Type != tt.e.Type {
+				t.Fatalf("message = %d %s %+v, want %d %s %+v", msg.ID, msg.Type, got, tt.e.ID, tt.e.Type, *tt.want)
+			}
+		})
+	}
+}
+
+func TestHubSlowClient(t *testing.T) {
+	h := newTestHub(&fakeStore{}, 1)
+	slow, fast := h.Subscribe(1), h.Subscribe(1)
+
+	h.publish([]model.DomainEvent{post(1, 1)})
+	if got, _ := received(fast); !slices.Equal(got, []int64{1}) {
+		t.Fatalf("fast client got %v, want [1]", got)
+	}
+	h.publish([]model.DomainEvent{post(2, 1)})
+
+	got, closed := received(slow)
+	if !closed || !slices.Equal(got, []int64{1}) {
+		t.Errorf("slow client got %v (closed %v), want [1] and closed", got, closed)
+	}
+	if got, closed := received(fast); closed || !slices.Equal(got, []int64{2}) {
+		t.Errorf("fast client got %v (closed %v), want [2]", got, closed)
+	}
+	if _, ok := h.subs[1][slow]; ok {
+		t.Error("slow client is still subscribed")
+	}
+	h.Unsubscribe(slow)
+}
+
+func TestHubCatchUp(t *testing.T) {
+	store := &fakeStore{since: []model.DomainEvent{post(1, 1), post(2, 2)}}
+	h := newTestHub(store, 10)
+	sub := h.Subscribe(1)
+
+	since := time.Now().Add(-time.Minute)
+	h.catchUp(context.Background(), since)
+	if !store.gotSince.Equal(since) || store.gotLimit != 100 {
+		t.Errorf("catch up asked since %v limit %d, want %v limit 100", store.gotSince, store.gotLimit, since)
+	}
+	if got, _ := received(sub); !slices.Equal(got, []int64{1}) {
+		t.Errorf("got %v, want [1]", got)
+	}
+}
+
+func TestHubStop(t *testing.T) {
+	h := newTestHub(&fakeStore{}, 10)
+	sub := h.Subscribe(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.Run(ctx)
+
+	if _, closed := received(sub); !closed {
+		t.Error("subscription is open after stop")
+	}
+	if _, closed := received(h.Subscribe(1)); !closed {
+		t.Error("subscription after stop is open")
+	}
+}
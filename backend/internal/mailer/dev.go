@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Log пишет письма в лог вместо отправки, для разработки
+type Log struct {
+	log *slog.Logger
+}
+
+func NewLog(log *slog.Logger) *Log {
+	return &Log{log: log.With(slog.String("component", "mailer"))}
+}
+
+func (m *Log) Send(_ context.Context, msg Message) error {
+	m.log.Info("mail",
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("text", msg.Text),
+	)
+	return nil
+}
+
+// File сохраняет письма в каталог файлами .eml, их можно открыть почтовым клиентом
+type File struct {
+	dir  string
+	from string
+}
+
+func NewFile(dir, from string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("mailer: %w", err)
+	}
+	return &File{dir: dir, from: from}, nil
+}
+
+func (m *File) Send(_ context.Context, msg Message) error {
+	const op = "mailer.File.Send"
+
+	data, err := build(m.from, msg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	name := fmt.Sprintf("%s.eml", time.Now().Format("20060102T150405.000000000"))
+	if err = os.WriteFile(filepath.Join(m.dir, name), data, 0o640); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package mailer
+
+import (
+	"REST_project/config"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Message - письмо. HTML необязателен, Text отправляется всегда.
+// Headers - дополнительные заголовки, например List-Unsubscribe
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New создает отправщика по настройкам: smtp, file или log
+func New(c config.MailCfg, log *slog.Logger) (Mailer, error) {
+	switch c.Backend {
+	case "smtp":
+		return NewSMTP(c), nil
+	case "file":
+		return NewFile(c.Dir, c.From)
+	case "log", "":
+		return NewLog(log), nil
+	default:
+		return nil, fmt.Errorf("mailer: unknown backend %q", c.Backend)
+	}
+}
+
+// build собирает письмо в формате RFC 5322, при наличии HTML - multipart/alternative
+func build(from string, msg Message) ([]byte, error) {
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	toAddr, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient address: %w", err)
+	}
+
+	var b bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&b, "%s: %s\r\n", k, v) }
+	header("From", fromAddr.String())
+	header("To", toAddr.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	for _, k := range slices.Sorted(maps.Keys(msg.Headers)) {
+		if strings.ContainsAny(k+msg.Headers[k], "\r\n") {
+			return nil, fmt.Errorf("invalid header %q", k)
+		}
+		header(k, msg.Headers[k])
+	}
+
+	if msg.HTML == "" {
+		header("Content-Type", `text/plain; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		b.WriteString("\r\n")
+		if err := writeQP(&b, msg.Text); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	boundary := fmt.Sprintf("=_%d", time.Now().UnixNano())
+	header("Content-Type", fmt.Sprintf(`multipart/alternative; boundary="%s"`, boundary))
+	b.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	} {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s; charset=\"utf-8\"\r\n", part.contentType)
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQP(&b, part.body); err != nil {
+			return nil, err
+		}
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+func writeQP(b *bytes.Buffer, text string) error {
+	w := quotedprintable.NewWriter(b)
+	if _, err := w.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return w.Close()
+}
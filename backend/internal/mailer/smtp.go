@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"REST_project/config"
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTP отправляет письма через SMTP-сервер. smtp.SendMail сам включает STARTTLS,
+// если сервер его поддерживает, а без TLS не передает пароль
+type SMTP struct {
+	cfg config.MailCfg
+}
+
+func NewSMTP(c config.MailCfg) *SMTP {
+	return &SMTP{cfg: c}
+}
+
+func (m *SMTP) Send(ctx context.Context, msg Message) error {
+	const op = "mailer.SMTP.Send"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	data, err := build(m.cfg.From, msg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	from, _ := mail.ParseAddress(m.cfg.From)
+	to, _ := mail.ParseAddress(msg.To)
+
+	var auth smtp.Auth
+	if m.cfg.SMTPUser != "" {
+		auth = smtp.PlainAuth("", m.cfg.SMTPUser, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+	}
+
+	addr := net.JoinHostPort(m.cfg.SMTPHost, m.cfg.SMTPPort)
+	if err = smtp.SendMail(addr, auth, from.Address, []string{to.Address}, data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
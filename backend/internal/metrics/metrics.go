@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DBSource - хранилище, чей пул соединений и кэш выражений попадают в метрики
+type DBSource interface {
+	Pool() *pgxpool.Pool
+	PreparedStatements() int
+}
+
+// New собирает реестр метрик процесса, рантайма Go и пула соединений с базой
+func New(db DBSource, dbName string) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "go_sql_prepared_statements",
+			Help:        "The number of statements in the prepared statement cache.",
+			ConstLabels: prometheus.Labels{"db_name": dbName},
+		}, func() float64 { return float64(db.PreparedStatements()) }),
+	)
+	reg.MustRegister(poolCollectors(db, dbName)...)
+	return reg
+}
+
+// poolCollectors описывает пул pgx. Статистика database/sql не собирается: она видит
+// только свои соединения, а пакеты запросов и COPY берут соединения из пула напрямую
+func poolCollectors(db DBSource, dbName string) []prometheus.Collector {
+	labels := prometheus.Labels{"db_name": dbName}
+	gauge := func(name, help string, value func(st *pgxpool.Stat) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help, ConstLabels: labels},
+			func() float64 { return value(db.Pool().Stat()) })
+	}
+	counter := func(name, help string, value func(st *pgxpool.Stat) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help, ConstLabels: labels},
+			func() float64 { return value(db.Pool().Stat()) })
+	}
+	return []prometheus.Collector{
+		gauge("pgxpool_max_conns", "Maximum size of the pool.",
+			func(st *pgxpool.Stat) float64 { return float64(st.MaxConns()) }),
+		gauge("pgxpool_total_conns", "Total number of resources currently in the pool.",
+			func(st *pgxpool.Stat) float64 { return float64(st.TotalConns()) }),
+		gauge("pgxpool_acquired_conns", "Number of currently acquired connections in the pool.",
+			func(st *pgxpool.Stat) float64 { return float64(st.AcquiredConns()) }),
+		gauge("pgxpool_idle_conns", "Number of currently idle connections in the pool.",
+			func(st *pgxpool.Stat) float64 { return float64(st.IdleConns()) }),
+		counter("pgxpool_acquire_count_total", "Cumulative count of successful acquires from the pool.",
+			func(st *pgxpool.Stat) float64 { return float64(st.AcquireCount()) }),
+		counter("pgxpool_acquire_duration_seconds_total", "Total time spent waiting for a connection from the pool.",
+			func(st *pgxpool.Stat) float64 { return st.AcquireDuration().Seconds() }),
+		counter("pgxpool_empty_acquire_count_total", "Cumulative count of acquires that waited for a resource because the pool was empty.",
+			func(st *pgxpool.Stat) float64 { return float64(st.EmptyAcquireCount()) }),
+		counter("pgxpool_canceled_acquire_count_total", "Cumulative count of acquires canceled by a context.",
+			func(st *pgxpool.Stat) float64 { return float64(st.CanceledAcquireCount()) }),
+	}
+}
+
+// Handler отдает метрики в формате Prometheus
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
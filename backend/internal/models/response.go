@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 type Enterprise struct {
 	ID   int    `json:"id"`
@@ -12,30 +16,380 @@ type Event struct {
 	EnterpriseID int       `json:"enterprise_id"`
 	Name         string    `json:"name"`
 	Description  string    `json:"description,omitempty"`
+	Capacity     int       `json:"capacity,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
+	EventSchedule
+	// Sequence растет с каждым изменением расписания, по нему календари замечают перенос
+	Sequence  int       `json:"sequence"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EventSchedule - время и место проведения события. Timezone - часовой пояс IANA,
+// в котором событие показывается в календаре
+type EventSchedule struct {
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	Timezone string     `json:"timezone,omitempty"`
+	Location string     `json:"location,omitempty"`
+	JoinURL  string     `json:"join_url,omitempty"`
 }
 
 type Participant struct {
 	ID      int    `json:"id"`
 	EventID int    `json:"event_id"`
 	Name    string `json:"name"`
+	// Email заполняется только для самого участника, в общих списках не показывается
+	Email string `json:"email,omitempty"`
 }
 
+const (
+	PostTypeText = "text"
+	PostTypePoll = "poll"
+)
+
 type Post struct {
+	ID          int          `json:"id"`
+	EventID     int          `json:"event_id"`
+	Type        string       `json:"type"`
+	Content     string       `json:"content"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Poll        *Poll        `json:"poll,omitempty"`
+}
+
+type Poll struct {
+	MultiChoice bool         `json:"multi_choice"`
+	Anonymous   bool         `json:"anonymous"`
+	ClosesAt    *time.Time   `json:"closes_at,omitempty"`
+	Closed      bool         `json:"closed"`
+	TotalVoters int          `json:"total_voters"`
+	Options     []PollOption `json:"options"`
+}
+
+type PollOption struct {
+	ID      int    `json:"id"`
+	Content string `json:"content"`
+	Votes   int    `json:"votes"`
+	// Voters заполняется только для неанонимных опросов
+	Voters []int `json:"voters,omitempty"`
+}
+
+type Attachment struct {
+	ID          int                 `json:"id"`
+	PostID      int                 `json:"post_id"`
+	FileName    string              `json:"file_name"`
+	ContentType string              `json:"content_type"`
+	Size        int64               `json:"size"`
+	Width       int                 `json:"width,omitempty"`
+	Height      int                 `json:"height,omitempty"`
+	URL         string              `json:"url"`
+	StorageKey  string              `json:"-"`
+	CreatedAt   time.Time           `json:"created_at"`
+	Variants    []AttachmentVariant `json:"variants,omitempty"`
+}
+
+// AttachmentVariant - уменьшенная копия изображения
+type AttachmentVariant struct {
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+	StorageKey  string `json:"-"`
+}
+
+// AttachmentURL возвращает путь, по которому вложение отдается клиенту
+func AttachmentURL(id int) string {
+	return fmt.Sprintf("/api/attachments/%d", id)
+}
+
+// AttachmentVariantURL возвращает путь к уменьшенной копии вложения
+func AttachmentVariantURL(id, width int) string {
+	return fmt.Sprintf("/api/attachments/%d/variants/%d", id, width)
+}
+
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentRejected = "rejected"
+)
+
+type Comment struct {
+	ID               int       `json:"id"`
+	PostID           int       `json:"post_id"`
+	ParticipantID    int       `json:"participant_id"`
+	Content          string    `json:"content"`
+	Status           string    `json:"status,omitempty"`
+	ModerationReason string    `json:"moderation_reason,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type ModerationRule struct {
+	ID           int       `json:"id"`
+	EnterpriseID int       `json:"enterprise_id"`
+	Pattern      string    `json:"pattern"`
+	IsRegex      bool      `json:"is_regex"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+const (
+	QuestionOpen     = "open"
+	QuestionAnswered = "answered"
+	QuestionHidden   = "hidden"
+)
+
+type Question struct {
+	ID      int `json:"id"`
+	EventID int `json:"event_id"`
+	// ParticipantID и ParticipantName не отдаются участникам для анонимных вопросов
+	ParticipantID   int        `json:"participant_id,omitempty"`
+	ParticipantName string     `json:"participant_name,omitempty"`
+	Content         string     `json:"content"`
+	Anonymous       bool       `json:"anonymous"`
+	Status          string     `json:"status"`
+	Votes           int        `json:"votes"`
+	CreatedAt       time.Time  `json:"created_at"`
+	AnsweredAt      *time.Time `json:"answered_at,omitempty"`
+}
+
+const (
+	SearchTypePost    = "post"
+	SearchTypeComment = "comment"
+)
+
+type SearchParams struct {
+	Query string
+	// Type ограничивает поиск постами или комментариями, пустая строка - искать везде
+	Type   string
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
+
+type SearchResult struct {
+	Type      string    `json:"type"`
 	ID        int       `json:"id"`
-	EventID   int       `json:"event_id"`
-	Content   string    `json:"content"`
+	PostID    int       `json:"post_id"`
+	Snippet   string    `json:"snippet"`
+	Rank      float64   `json:"rank"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
-type Comment struct {
+const (
+	ReportOpen      = "open"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+
+	SanctionMute = "mute"
+	SanctionBan  = "ban"
+)
+
+type CommentReport struct {
+	ID         int        `json:"id"`
+	CommentID  int        `json:"comment_id"`
+	ReporterID int        `json:"reporter_id"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	// Comment - текст комментария, на который пожаловались
+	Comment string `json:"comment"`
+}
+
+type Sanction struct {
+	ID              int        `json:"id"`
+	EventID         int        `json:"event_id"`
+	ParticipantID   int        `json:"participant_id"`
+	ParticipantName string     `json:"participant_name"`
+	Kind            string     `json:"kind"`
+	Reason          string     `json:"reason,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ModerationLogEntry - запись журнала действий модерации
+type ModerationLogEntry struct {
+	ID            int64     `json:"id"`
+	EventID       int       `json:"event_id"`
+	Action        string    `json:"action"`
+	ParticipantID int       `json:"participant_id,omitempty"`
+	CommentID     int       `json:"comment_id,omitempty"`
+	ReportID      int       `json:"report_id,omitempty"`
+	SanctionID    int       `json:"sanction_id,omitempty"`
+	Details       string    `json:"details,omitempty"`
+	Actor         string    `json:"actor"`
+	RequestID     string    `json:"request_id,omitempty"`
+	IP            string    `json:"ip,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ActionMeta описывает, кто и откуда выполнил действие, для журналов
+type ActionMeta struct {
+	Actor     string
+	RequestID string
+	IP        string
+}
+
+// AuditEntry - запись журнала аудита: кто, когда и как изменил сущность.
+// Before и After - снимки строки до и после изменения
+type AuditEntry struct {
+	ID           int64           `json:"id"`
+	EnterpriseID int             `json:"enterprise_id,omitempty"`
+	EventID      int             `json:"event_id,omitempty"`
+	Actor        string          `json:"actor"`
+	Action       string          `json:"action"`
+	Entity       string          `json:"entity"`
+	EntityID     int             `json:"entity_id,omitempty"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	RequestID    string          `json:"request_id,omitempty"`
+	IP           string          `json:"ip,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// AuditFilter - условия выборки журнала аудита. Пустые поля не фильтруют
+type AuditFilter struct {
+	Entity   string
+	EntityID int
+	Action   string
+	Actor    string
+	Limit    int
+	Offset   int
+}
+
+// ParticipantIndex - все, что нужно для проверки строк импорта без запроса к базе на каждую:
+// уже зарегистрированные участники, действующие баны и вместимость события.
+// Ключи - строки в нижнем регистре, Names - имена участников без email
+type ParticipantIndex struct {
+	Emails       map[string]bool
+	Names        map[string]bool
+	BannedNames  map[string]bool
+	BannedEmails map[string]bool
+	// Capacity - предел числа участников, 0 - без ограничения
+	Capacity   int
+	Registered int
+}
+
+// ImportRowError - ошибка в строке файла импорта. Row - номер строки в файле
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ImportReport - итог импорта участников. При dry-run ничего не записывается и Imported равен 0
+type ImportReport struct {
+	DryRun          bool             `json:"dry_run"`
+	Rows            int              `json:"rows"`
+	Valid           int              `json:"valid"`
+	Imported        int              `json:"imported"`
+	Failed          int              `json:"failed"`
+	Errors          []ImportRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
+}
+
+// ExportJob - фоновая выгрузка события в ZIP. Progress - процент готовности, Stage - текущий этап
+type ExportJob struct {
+	ID         int        `json:"id"`
+	EventID    int        `json:"event_id"`
+	Status     string     `json:"status"`
+	Progress   int        `json:"progress"`
+	Stage      string     `json:"stage,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Size       int64      `json:"size,omitempty"`
+	URL        string     `json:"url,omitempty"`
+	StorageKey string     `json:"-"`
+	Actor      string     `json:"actor"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Статусы выгрузки
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// ExportJobURL возвращает путь, по которому отдается готовый архив выгрузки
+func ExportJobURL(eventID, jobID int) string {
+	return fmt.Sprintf("/events/%d/exports/%d/download", eventID, jobID)
+}
+
+// Account - сотрудник, который управляет предприятиями через API-ключи
+type Account struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	RoleOwner     = "owner"
+	RoleAdmin     = "admin"
+	RoleOrganizer = "organizer"
+	RoleModerator = "moderator"
+	RoleViewer    = "viewer"
+)
+
+// Member - роль аккаунта в предприятии
+type Member struct {
+	EnterpriseID int       `json:"enterprise_id"`
+	AccountID    int       `json:"account_id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	Source       string    `json:"source"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Источники членства в предприятии
+const (
+	MemberSourceManual = "manual"
+	MemberSourceOIDC   = "oidc"
+)
+
+// GroupMapping - группа провайдера OIDC, участникам которой при входе выдается роль в предприятии
+type GroupMapping struct {
 	ID           int       `json:"id"`
-	PostID       int       `json:"post_id"`
-	ParticipantID int       `json:"participant_id"`
-	Content      string    `json:"content"`
+	EnterpriseID int       `json:"enterprise_id"`
+	Group        string    `json:"group"`
+	Role         string    `json:"role"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// OIDCState - незавершенный вход через OIDC
+type OIDCState struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
+
+// OIDCIdentity - проверенные утверждения id_token
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+type Session struct {
+	Token     string    `json:"session_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
 type Response struct {
 	Status string      `json:"status"`
 	Data   interface{} `json:"data,omitempty"`
@@ -68,4 +422,124 @@ type CreateCommentRequest struct {
 	PostID       int    `json:"post_id"`
 	ParticipantID int    `json:"participant_id"`
 	Content      string `json:"content"`
+}
+
+// Webhook - подписка предприятия на события. Пустой EventTypes - все типы.
+// Secret отдается только при создании подписки
+type Webhook struct {
+	ID           int       `json:"id"`
+	EnterpriseID int       `json:"enterprise_id"`
+	URL          string    `json:"url"`
+	EventTypes   []string  `json:"event_types"`
+	Description  string    `json:"description,omitempty"`
+	Active       bool      `json:"active"`
+	Secret       string    `json:"secret,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// WebhookEventTypes - типы доменных событий, на которые можно подписать вебхук
+var WebhookEventTypes = []string{ParticipantRegistered, PostCreated}
+
+// Статусы доставки
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery - доставка одного события одной подписке. URL и Secret нужны только рассылке
+type WebhookDelivery struct {
+	ID            int64            `json:"id"`
+	WebhookID     int              `json:"webhook_id"`
+	EventType     string           `json:"event_type"`
+	Payload       json.RawMessage  `json:"payload"`
+	Status        string           `json:"status"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at,omitempty"`
+	LastStatus    int              `json:"last_status,omitempty"`
+	LastError     string           `json:"last_error,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	DeliveredAt   *time.Time       `json:"delivered_at,omitempty"`
+	Log           []WebhookAttempt `json:"log,omitempty"`
+	URL           string           `json:"-"`
+	Secret        string           `json:"-"`
+}
+
+// WebhookAttempt - попытка доставки. StatusCode 0 - ответа не было
+type WebhookAttempt struct {
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int       `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Типы доменных событий
+const (
+	ParticipantRegistered = "participant.registered"
+	PostCreated           = "post.created"
+	CommentCreated        = "comment.created"
+	CommentModerated      = "comment.moderated"
+	QuestionCreated       = "question.created"
+)
+
+// DomainEvent - запись outbox о состоявшемся изменении. Payload - снимок строки сущности EntityID
+// после изменения, EventID - событие-мероприятие, к которому относится сущность
+type DomainEvent struct {
+	ID           int64           `json:"id"`
+	Type         string          `json:"type"`
+	EnterpriseID int             `json:"enterprise_id"`
+	EventID      int             `json:"event_id,omitempty"`
+	EntityID     int             `json:"entity_id"`
+	Payload      json.RawMessage `json:"payload"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// Режимы писем о новых постах
+const (
+	NotifyImmediate = "immediate"
+	NotifyHourly    = "hourly"
+	NotifyDaily     = "daily"
+	NotifyOff       = "off"
+)
+
+type NotificationPreferences struct {
+	Mode string `json:"mode"`
+}
+
+// Digest - письмо участнику о новых постах его события. More - сколько постов не поместилось
+// в письмо, LastPostID - последний новый пост, после отправки письма курсор участника встает на него
+type Digest struct {
+	ParticipantID int    `json:"participant_id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EventID       int    `json:"event_id"`
+	EventName     string `json:"event_name"`
+	Mode          string `json:"mode"`
+	Posts         []Post `json:"posts"`
+	More          int    `json:"more"`
+	LastPostID    int    `json:"last_post_id"`
+}
+
+// PushSubscription - подписка браузера участника на Web Push. P256DH и Auth - ключи шифрования
+// из PushSubscription.getKey() в base64url, Auth клиенту обратно не отдается
+type PushSubscription struct {
+	ID            int        `json:"id"`
+	ParticipantID int        `json:"participant_id"`
+	Endpoint      string     `json:"endpoint"`
+	P256DH        string     `json:"p256dh"`
+	Auth          string     `json:"-"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// PushDelivery - отправка одного уведомления одной подписке. Attempts - сколько попыток уже было
+type PushDelivery struct {
+	ID             int64
+	SubscriptionID int
+	Endpoint       string
+	P256DH         string
+	Auth           string
+	Payload        json.RawMessage
+	Attempts       int
+	CreatedAt      time.Time
 }
\ No newline at end of file
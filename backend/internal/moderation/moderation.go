@@ -0,0 +1,172 @@
+package moderation
+
+import (
+	"REST_project/config"
+	model "REST_project/internal/models"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// maxRepeatedChars - длина серии одинаковых символов, после которой комментарий считается спамом
+	maxRepeatedChars = 10
+	// capsMinLetters и capsRatio - комментарий из capsMinLetters букв и более,
+	// в котором заглавных больше capsRatio, считается криком
+	capsMinLetters = 20
+	capsRatio      = 0.7
+)
+
+var linkRe = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+type Store interface {
+	// CommentContext возвращает предприятие и режим премодерации события, к которому относится пост
+	CommentContext(ctx context.Context, postID int) (enterpriseID int, premoderation bool, err error)
+	GetModerationRules(ctx context.Context, enterpriseID int) ([]model.ModerationRule, error)
+	// RecentComments возвращает комментарии участника, оставленные после since
+	RecentComments(ctx context.Context, participantID int, since time.Time) ([]model.Comment, error)
+}
+
+// Verdict - решение модерации: статус, с которым сохраняется комментарий, и причина
+type Verdict struct {
+	Status string
+	Reason string
+}
+
+type Moderator struct {
+	store Store
+	cfg   config.ModerationCfg
+}
+
+func New(store Store, cfg config.ModerationCfg) *Moderator {
+	return &Moderator{store: store, cfg: cfg}
+}
+
+// Check проверяет комментарий до сохранения. Совпадение с блок-листом предприятия
+// отклоняет комментарий, подозрение на спам и премодерация отправляют его в очередь
+func (m *Moderator) Check(ctx context.Context, postID, participantID int, content string) (Verdict, error) {
+	const op = "moderation.Check"
+
+	enterpriseID, premoderation, err := m.store.CommentContext(ctx, postID)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if enterpriseID > 0 {
+		rules, err := m.store.GetModerationRules(ctx, enterpriseID)
+		if err != nil {
+			return Verdict{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if rule, ok := MatchRules(rules, content); ok {
+			return Verdict{
+				Status: model.CommentRejected,
+				Reason: fmt.Sprintf("matched blocklist rule #%d", rule.ID),
+			}, nil
+		}
+	}
+
+	if reason := m.spamReason(content); reason != "" {
+		return Verdict{Status: model.CommentPending, Reason: reason}, nil
+	}
+
+	now := time.Now()
+	recent, err := m.store.RecentComments(ctx, participantID, now.Add(-max(m.cfg.FloodWindow, m.cfg.DuplicateWindow)))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if reason := m.floodReason(content, recent, now); reason != "" {
+		return Verdict{Status: model.CommentPending, Reason: reason}, nil
+	}
+
+	if premoderation {
+		return Verdict{Status: model.CommentPending, Reason: "premoderation"}, nil
+	}
+
+	return Verdict{Status: model.CommentApproved}, nil
+}
+
+// MatchRules возвращает первое правило, под которое попадает текст.
+// Слова и фразы сравниваются целиком без учета регистра, регулярные выражения - как есть
+func MatchRules(rules []model.ModerationRule, content string) (model.ModerationRule, bool) {
+	text := " " + strings.Join(words(content), " ") + " "
+	for _, rule := range rules {
+		if rule.IsRegex {
+			re, err := CompileRule(rule.Pattern)
+			if err == nil && re.MatchString(content) {
+				return rule, true
+			}
+			continue
+		}
+		phrase := strings.Join(words(rule.Pattern), " ")
+		if phrase != "" && strings.Contains(text, " "+phrase+" ") {
+			return rule, true
+		}
+	}
+	return model.ModerationRule{}, false
+}
+
+// CompileRule компилирует регулярное выражение правила без учета регистра
+func CompileRule(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + pattern)
+}
+
+func (m *Moderator) spamReason(content string) string {
+	if m.cfg.MaxLinks >= 0 && len(linkRe.FindAllStringIndex(content, -1)) > m.cfg.MaxLinks {
+		return "too many links"
+	}
+
+	var run, letters, upper int
+	var prev rune
+	for i, r := range content {
+		if i > 0 && r == prev && !unicode.IsSpace(r) {
+			run++
+			if run >= maxRepeatedChars {
+				return "repeated characters"
+			}
+		} else {
+			run = 1
+		}
+		prev = r
+
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters >= capsMinLetters && float64(upper)/float64(letters) > capsRatio {
+		return "excessive capitals"
+	}
+	return ""
+}
+
+// floodReason проверяет, не пишет ли участник слишком часто и не повторяет ли
+// свои недавние комментарии
+func (m *Moderator) floodReason(content string, recent []model.Comment, now time.Time) string {
+	normalized := strings.Join(words(content), " ")
+	var inFloodWindow int
+	for _, c := range recent {
+		age := now.Sub(c.CreatedAt)
+		if age <= m.cfg.FloodWindow {
+			inFloodWindow++
+		}
+		if age <= m.cfg.DuplicateWindow && normalized != "" && strings.Join(words(c.Content), " ") == normalized {
+			return "duplicate comment"
+		}
+	}
+	if m.cfg.FloodLimit > 0 && inFloodWindow >= m.cfg.FloodLimit {
+		return "too many comments"
+	}
+	return ""
+}
+
+// words разбивает текст на слова в нижнем регистре
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
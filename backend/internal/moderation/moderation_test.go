@@ -0,0 +1,167 @@
+package moderation
+
+import (
+	"REST_project/config"
+	model "REST_project/internal/models"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	enterpriseID  int
+	premoderation bool
+	rules         []model.ModerationRule
+	recent        []model.Comment
+}
+
+func (f *fakeStore) CommentContext(context.Context, int) (int, bool, error) {
+	return f.enterpriseID, f.premoderation, nil
+}
+
+func (f *fakeStore) GetModerationRules(context.Context, int) ([]model.ModerationRule, error) {
+	return f.rules, nil
+}
+
+func (f *fakeStore) RecentComments(context.Context, int, time.Time) ([]model.Comment, error) {
+	return f.recent, nil
+}
+
+func TestCheck(t *testing.T) {
+	cfg := config.ModerationCfg{
+		MaxLinks:        2,
+		FloodLimit:      3,
+		FloodWindow:     time.Minute,
+		DuplicateWindow: 10 * time.Minute,
+	}
+	rules := []model.ModerationRule{
+		{ID: 1, Pattern: "casino"},
+		{ID: 2, Pattern: "buy  Now!"},
+		{ID: 3, Pattern: `\d{4}-\d{4}`, IsRegex: true},
+	}
+	ago := func(d time.Duration) model.Comment {
+		return model.Comment{Content: "earlier comment", CreatedAt: time.Now().Add(-d)}
+	}
+
+	tests := []struct {
+		name          string
+		content       string
+		premoderation bool
+		recent        []model.Comment
+		want          Verdict
+	}{
+		{
+			name:    "clean comment",
+			content: "Great talk, thanks!",
+			want:    Verdict{Status: model.CommentApproved},
+		},
+		{
+			name:    "blocklisted word in other case",
+			content: "Visit the CASINO tonight",
+			want:    Verdict{Status: model.CommentRejected, Reason: "matched blocklist rule #1"},
+		},
+		{
+			name:    "blocklisted word inside other word",
+			content: "casinos are not matched",
+			want:    Verdict{Status: model.CommentApproved},
+		},
+		{
+			name:    "blocklisted phrase with other punctuation",
+			content: "Buy, now: cheap",
+			want:    Verdict{Status: model.CommentRejected, Reason: "matched blocklist rule #2"},
+		},
+		{
+			name:    "blocklist regex",
+			content: "call 1234-5678",
+			want:    Verdict{Status: model.CommentRejected, Reason: "matched blocklist rule #3"},
+		},
+		{
+			name:    "links up to the limit",
+			content: "see https://a.example and www.b.example",
+			want:    Verdict{Status: model.CommentApproved},
+		},
+		{
+			name:    "too many links",
+			content: "https://a.example http://b.example www.c.example",
+			want:    Verdict{Status: model.CommentPending, Reason: "too many links"},
+		},
+		{
+			name:    "repeated characters",
+			content: "wow" + strings.Repeat("!", maxRepeatedChars),
+			want:    Verdict{Status: model.CommentPending, Reason: "repeated characters"},
+		},
+		{
+			name:    "repeated spaces",
+			content: "wow" + strings.Repeat(" ", maxRepeatedChars) + "ok",
+			want:    Verdict{Status: model.CommentApproved},
+		},
+		{
+			name:    "excessive capitals",
+			content: "THIS IS THE BEST TALK EVER",
+			want:    Verdict{Status: model.CommentPending, Reason: "excessive capitals"},
+		},
+		{
+			name:    "short capitals",
+			content: "GREAT TALK",
+			want:    Verdict{Status: model.CommentApproved},
+		},
+		{
+			name:    "duplicate comment",
+			content: "Earlier  comment!",
+			recent:  []model.Comment{ago(5 * time.Minute)},
+			want:    Verdict{Status: model.CommentPending, Reason: "duplicate comment"},
+		},
+		{
+			name:    "duplicate outside the window",
+			content: "earlier comment",
+			recent:  []model.Comment{ago(time.Hour)},
+			want:    Verdict{Status: model.CommentApproved},
+		},
+		{
+			name:    "flood",
+			content: "one more",
+			recent: []model.Comment{
+				{Content: "first", CreatedAt: time.Now().Add(-10 * time.Second)},
+				{Content: "second", CreatedAt: time.Now().Add(-20 * time.Second)},
+				{Content: "third", CreatedAt: time.Now().Add(-30 * time.Second)},
+			},
+			want: Verdict{Status: model.CommentPending, Reason: "too many comments"},
+		},
+		{
+			name:    "comments outside the flood window",
+			content: "one more",
+			recent: []model.Comment{
+				{Content: "first", CreatedAt: time.Now().Add(-10 * time.Second)},
+				{Content: "second", CreatedAt: time.Now().Add(-2 * time.Minute)},
+				{Content: "third", CreatedAt: time.Now().Add(-3 * time.Minute)},
+			},
+			want: Verdict{Status: model.CommentApproved},
+		},
+		{
+			name:          "premoderation",
+			content:       "Great talk, thanks!",
+			premoderation: true,
+			want:          Verdict{Status: model.CommentPending, Reason: "premoderation"},
+		},
+		{
+			name:          "blocklist wins over premoderation",
+			content:       "casino",
+			premoderation: true,
+			want:          Verdict{Status: model.CommentRejected, Reason: "matched blocklist rule #1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{enterpriseID: 1, premoderation: tt.premoderation, rules: rules, recent: tt.recent}
+			got, err := New(store, cfg).Check(context.Background(), 1, 1, tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("Check(%q) = %+v, want %+v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
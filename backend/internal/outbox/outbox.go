@@ -0,0 +1,208 @@
+package outbox
+
+import (
+	"REST_project/config"
+	"REST_project/internal/delivery"
+	model "REST_project/internal/models"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Store interface {
+	RegisterSubscriber(ctx context.Context, subscriber string) error
+	ClaimDomainEvents(ctx context.Context, subscriber string, limit int, lease time.Duration) ([]model.DomainEvent, error)
+	AckDomainEvent(ctx context.Context, subscriber string, eventID int64, lease time.Duration) error
+	ReleaseSubscriber(ctx context.Context, subscriber string) error
+	DeadLetterDomainEvent(ctx context.Context, subscriber string, e model.DomainEvent, attempts int, reason string) error
+	PurgeDomainEvents(ctx context.Context, before time.Time) (int, error)
+}
+
+// Handler обрабатывает доменное событие. Событие может прийти повторно, например после
+// ошибки или остановки сервера, поэтому обработка должна быть идемпотентной
+type Handler func(ctx context.Context, e model.DomainEvent) error
+
+// purgeInterval - как часто шина удаляет события, которые прошли все подписчики
+const purgeInterval = time.Hour
+
+type subscriber struct {
+	name    string
+	types   []string
+	handler Handler
+	// failures - число неудачных попыток обработать событие, на котором остановился подписчик
+	failures map[int64]int
+	// retryAt - до этого времени подписчик не забирает события после неудачи
+	retryAt time.Time
+}
+
+// Bus доставляет доменные события из outbox подписчикам внутри процесса. У каждого
+// подписчика свой курсор в базе: он получает события по порядку и хотя бы один раз,
+// а после перезапуска продолжает с того места, где остановился
+type Bus struct {
+	log  *slog.Logger
+	s    Store
+	c    config.OutboxCfg
+	subs []*subscriber
+}
+
+func New(log *slog.Logger, store Store, c config.OutboxCfg) *Bus {
+	if c.BatchSize < 1 {
+		c.BatchSize = 1
+	}
+	if c.MaxAttempts < 1 {
+		c.MaxAttempts = 1
+	}
+	return &Bus{log: log, s: store, c: c}
+}
+
+// Subscribe добавляет подписчика name на события types, без types - на все события.
+// Имя - ключ курсора в базе, его нельзя менять без потери позиции. Вызывается до Run
+func (b *Bus) Subscribe(name string, h Handler, types ...string) {
+	b.subs = append(b.subs, &subscriber{name: name, types: types, handler: h, failures: make(map[int64]int)})
+}
+
+// Run регистрирует курсоры подписчиков и рассылает события, пока не отменен ctx
+func (b *Bus) Run(ctx context.Context) error {
+	const op = "outbox.Run"
+	for _, sub := range b.subs {
+		if err := b.s.RegisterSubscriber(ctx, sub.name); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, sub := range b.subs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.consume(ctx, sub)
+		}()
+	}
+	if b.c.Retention > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.purge(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (b *Bus) consume(ctx context.Context, sub *subscriber) {
+	ticker := time.NewTicker(b.c.PollInterval)
+	defer ticker.Stop()
+	for {
+		// полная пачка значит, что за ней есть еще события: следующая забирается сразу
+		for b.poll(ctx, sub) && ctx.Err() == nil {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll забирает пачку событий подписчика и обрабатывает их по порядку. На первой ошибке
+// подписчик останавливается до следующего опроса, чтобы не нарушить порядок событий.
+// Возвращает true, если пачка полная и обработана целиком
+func (b *Bus) poll(ctx context.Context, sub *subscriber) bool {
+	log := b.log.With(slog.String("subscriber", sub.name))
+	if time.Now().Before(sub.retryAt) {
+		return false
+	}
+
+	events, err := b.s.ClaimDomainEvents(ctx, sub.name, b.c.BatchSize, b.c.Lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Error("failed to claim domain events", slog.String("error", err.Error()))
+		}
+		return false
+	}
+	if len(events) == 0 {
+		return false
+	}
+	// курсор освобождается и при остановке сервера, чтобы другой сервер не ждал конца lease
+	defer func() {
+		if err := b.s.ReleaseSubscriber(context.WithoutCancel(ctx), sub.name); err != nil {
+			log.Error("failed to release subscriber", slog.String("error", err.Error()))
+		}
+	}()
+
+	for _, e := range events {
+		if ctx.Err() != nil {
+			return false
+		}
+		if !b.handle(ctx, log, sub, e) {
+			return false
+		}
+		if err := b.s.AckDomainEvent(ctx, sub.name, e.ID, b.c.Lease); err != nil {
+			if ctx.Err() == nil {
+				log.Error("failed to ack domain event", slog.Int64("domain_event_id", e.ID), slog.String("error", err.Error()))
+			}
+			return false
+		}
+	}
+	return len(events) == b.c.BatchSize
+}
+
+// handle вызывает обработчик, если подписчику нужен тип события. Возвращает true, если курсор
+// можно сдвигать: событие обработано, не нужно подписчику или исчерпало попытки
+func (b *Bus) handle(ctx context.Context, log *slog.Logger, sub *subscriber, e model.DomainEvent) bool {
+	if len(sub.types) > 0 && !slices.Contains(sub.types, e.Type) {
+		return true
+	}
+	log = log.With(slog.Int64("domain_event_id", e.ID), slog.String("type", e.Type))
+
+	hctx, cancel := context.WithTimeout(ctx, b.c.HandlerTimeout)
+	defer cancel()
+	err := sub.handler(hctx, e)
+	if err == nil {
+		delete(sub.failures, e.ID)
+		return true
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	sub.failures[e.ID]++
+	n := sub.failures[e.ID]
+	if n < b.c.MaxAttempts {
+		sub.retryAt = time.Now().Add(delivery.Backoff(b.c.BackoffBase, b.c.BackoffMax, n))
+		log.Warn("failed to handle domain event", slog.Int("attempt", n), slog.Time("retry_at", sub.retryAt), slog.String("error", err.Error()))
+		return false
+	}
+	// событие, которое не обрабатывается, не должно навсегда остановить подписчика, но и теряться
+	// не должно: курсор сдвигается, только когда событие сохранено для разбора
+	if err := b.s.DeadLetterDomainEvent(ctx, sub.name, e, n, err.Error()); err != nil {
+		sub.retryAt = time.Now().Add(delivery.Backoff(b.c.BackoffBase, b.c.BackoffMax, n))
+		log.Error("failed to dead-letter domain event", slog.String("error", err.Error()))
+		return false
+	}
+	delete(sub.failures, e.ID)
+	log.Error("domain event dead-lettered after max attempts", slog.String("error", err.Error()))
+	return true
+}
+
+func (b *Bus) purge(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		n, err := b.s.PurgeDomainEvents(ctx, time.Now().Add(-b.c.Retention))
+		if err != nil && ctx.Err() == nil {
+			b.log.Error("failed to purge domain events", slog.String("error", err.Error()))
+		}
+		if n > 0 {
+			b.log.Info("old domain events purged", slog.Int("count", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
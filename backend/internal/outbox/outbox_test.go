@@ -0,0 +1,201 @@
+package outbox
+
+import (
+	"REST_project/config"
+	model "REST_project/internal/models"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeStore - outbox одного подписчика в памяти: курсор - индекс первого неподтвержденного события
+type fakeStore struct {
+	events  []model.DomainEvent
+	cursor  int
+	claims  int
+	dead    []int64
+	deadErr error
+}
+
+func (f *fakeStore) RegisterSubscriber(context.Context, string) error { return nil }
+
+func (f *fakeStore) ClaimDomainEvents(_ context.Context, _ string, limit int, _ time.Duration) ([]model.DomainEvent, error) {
+	f.claims++
+	end := min(f.cursor+limit, len(f.events))
+	return f.events[f.cursor:end], nil
+}
+
+func (f *fakeStore) AckDomainEvent(_ context.Context, _ string, eventID int64, _ time.Duration) error {
+	for i, e := range f.events {
+		if e.ID == eventID {
+			f.cursor = i + 1
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) ReleaseSubscriber(context.Context, string) error { return nil }
+
+func (f *fakeStore) PurgeDomainEvents(context.Context, time.Time) (int, error) { return 0, nil }
+
+func (f *fakeStore) DeadLetterDomainEvent(_ context.Context, _ string, e model.DomainEvent, _ int, _ string) error {
+	if f.deadErr != nil {
+		return f.deadErr
+	}
+	f.dead = append(f.dead, e.ID)
+	return nil
+}
+
+func testEvents() []model.DomainEvent {
+	return []model.DomainEvent{
+		{ID: 1, Type: model.PostCreated},
+		{ID: 2, Type: model.ParticipantRegistered},
+		{ID: 3, Type: model.PostCreated},
+	}
+}
+
+func TestBusPoll(t *testing.T) {
+	errHandler := errors.New("handler failed")
+
+	tests := []struct {
+		name        string
+		types       []string
+		maxAttempts int
+		// fail - события, на которых обработчик возвращает ошибку
+		fail    map[int64]bool
+		deadErr error
+		polls   int
+		// wantHandled - события, переданные обработчику, по порядку
+		wantHandled []int64
+		wantCursor  int
+		wantDead    []int64
+		wantClaims  int
+	}{
+		{
+			name:        "all handled",
+			polls:       1,
+			wantHandled: []int64{1, 2, 3},
+			wantCursor:  3,
+			wantClaims:  1,
+		},
+		{
+			name:        "other types skipped",
+			types:       []string{model.PostCreated},
+			polls:       1,
+			wantHandled: []int64{1, 3},
+			wantCursor:  3,
+			wantClaims:  1,
+		},
+		{
+			name:        "failure stops subscriber and backs off",
+			maxAttempts: 3,
+			fail:        map[int64]bool{2: true},
+			polls:       2,
+			wantHandled: []int64{1, 2},
+			wantCursor:  1,
+			wantClaims:  1,
+		},
+		{
+			name:        "dead letter after max attempts",
+			maxAttempts: 1,
+			fail:        map[int64]bool{2: true},
+			polls:       1,
+			wantHandled: []int64{1, 2, 3},
+			wantCursor:  3,
+			wantDead:    []int64{2},
+			wantClaims:  1,
+		},
+		{
+			name:        "event kept when dead letter fails",
+			maxAttempts: 1,
+			fail:        map[int64]bool{2: true},
+			deadErr:     errors.New("db is down"),
+			polls:       1,
+			wantHandled: []int64{1, 2},
+			wantCursor:  1,
+			wantClaims:  1,
+		},
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{events: testEvents(), deadErr: tt.deadErr}
+			b := New(log, store, config.OutboxCfg{
+				BatchSize:      10,
+				HandlerTimeout: time.Second,
+				MaxAttempts:    tt.maxAttempts,
+				BackoffBase:    time.Hour,
+				BackoffMax:     time.Hour,
+			})
+
+			var handled []int64
+			b.Subscribe("test", func(_ context.Context, e model.DomainEvent) error {
+				handled = append(handled, e.ID)
+				if tt.fail[e.ID] {
+					return errHandler
+				}
+				return nil
+			}, tt.types...)
+
+			for range tt.polls {
+				b.poll(context.Background(), b.subs[0])
+			}
+
+			if !slices.Equal(handled, tt.wantHandled) {
+				t.Errorf("handled = %v, want %v", handled, tt.wantHandled)
+			}
+			if store.cursor != tt.wantCursor {
+				t.Errorf("cursor = %d, want %d", store.cursor, tt.wantCursor)
+			}
+			if !slices.Equal(store.dead, tt.wantDead) {
+				t.Errorf("dead letters = %v, want %v", store.dead, tt.wantDead)
+			}
+			if store.claims != tt.wantClaims {
+				t.Errorf("claims = %d, want %d", store.claims, tt.wantClaims)
+			}
+		})
+	}
+}
+
+// После паузы подписчик повторяет событие и, если обработчик справился, идет дальше
+func TestBusRetryAfterBackoff(t *testing.T) {
+	store := &fakeStore{events: testEvents()}
+	b := New(slog.New(slog.NewTextHandler(io.Discard, nil)), store, config.OutboxCfg{
+		BatchSize:      10,
+		HandlerTimeout: time.Second,
+		MaxAttempts:    3,
+		BackoffBase:    time.Hour,
+		BackoffMax:     time.Hour,
+	})
+
+	attempts := 0
+	b.Subscribe("test", func(_ context.Context, e model.DomainEvent) error {
+		if e.ID == 2 {
+			attempts++
+			if attempts == 1 {
+				return errors.New("handler failed")
+			}
+		}
+		return nil
+	})
+	sub := b.subs[0]
+
+	b.poll(context.Background(), sub)
+	if !sub.retryAt.After(time.Now()) {
+		t.Fatalf("retryAt = %v, want in the future", sub.retryAt)
+	}
+
+	sub.retryAt = time.Time{}
+	b.poll(context.Background(), sub)
+	if store.cursor != 3 || attempts != 2 {
+		t.Fatalf("cursor = %d after %d attempts, want 3 after 2", store.cursor, attempts)
+	}
+	if len(sub.failures) != 0 {
+		t.Errorf("failures = %v, want none after success", sub.failures)
+	}
+}
@@ -0,0 +1,200 @@
+package policy
+
+import (
+	model "REST_project/internal/models"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Permission - действие, которое роль может выполнять в предприятии и его событиях
+type Permission string
+
+const (
+	// ViewEnterprise - просмотр сотрудников и настроек предприятия
+	ViewEnterprise Permission = "enterprise:view"
+	// ManageMembers - приглашение сотрудников и изменение их ролей
+	ManageMembers Permission = "members:manage"
+	// ManageRules - блок-лист модерации предприятия
+	ManageRules Permission = "rules:manage"
+	// ManageEvents - создание событий, постов и вложений, настройка премодерации
+	ManageEvents Permission = "events:manage"
+	// ModerateEvents - очередь модерации, жалобы, санкции, модерация вопросов
+	ModerateEvents Permission = "events:moderate"
+	// ViewAudit - журнал аудита предприятия
+	ViewAudit Permission = "audit:view"
+	// ManageIntegrations - вебхуки и их журнал доставок
+	ManageIntegrations Permission = "integrations:manage"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+var rolePermissions = map[string][]Permission{
+	model.RoleOwner:     {ViewEnterprise, ManageMembers, ManageRules, ManageEvents, ModerateEvents, ViewAudit, ManageIntegrations},
+	model.RoleAdmin:     {ViewEnterprise, ManageMembers, ManageRules, ManageEvents, ModerateEvents, ViewAudit, ManageIntegrations},
+	model.RoleOrganizer: {ViewEnterprise, ManageEvents, ModerateEvents, ViewAudit},
+	model.RoleModerator: {ViewEnterprise, ModerateEvents},
+	model.RoleViewer:    {ViewEnterprise},
+}
+
+// roleRank упорядочивает роли для проверки, кто кого может назначать
+var roleRank = map[string]int{
+	model.RoleViewer:    1,
+	model.RoleModerator: 2,
+	model.RoleOrganizer: 3,
+	model.RoleAdmin:     4,
+	model.RoleOwner:     5,
+}
+
+type Store interface {
+	// MemberRole возвращает роль аккаунта в предприятии или пустую строку
+	MemberRole(ctx context.Context, enterpriseID, accountID int) (string, error)
+	EventEnterprise(ctx context.Context, eventID int) (int, error)
+	PostEvent(ctx context.Context, postID int) (int, error)
+}
+
+type Policy struct {
+	store Store
+}
+
+func New(store Store) *Policy {
+	return &Policy{store: store}
+}
+
+// ValidRole сообщает, существует ли такая роль
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can сообщает, дает ли роль разрешение
+func Can(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAssign сообщает, может ли сотрудник с ролью actor назначать и снимать роль role.
+// Владелец управляет всеми, остальные - только ролями ниже своей
+func CanAssign(actor, role string) bool {
+	if !Can(actor, ManageMembers) {
+		return false
+	}
+	return actor == model.RoleOwner || roleRank[actor] > roleRank[role]
+}
+
+// Authorize проверяет, что аккаунт из контекста имеет разрешение в предприятии
+func (p *Policy) Authorize(ctx context.Context, enterpriseID int, perm Permission) error {
+	const op = "policy.Authorize"
+
+	role, err := p.role(ctx, enterpriseID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !Can(role, perm) {
+		return fmt.Errorf("%s: %s: %w", op, perm, ErrForbidden)
+	}
+	return nil
+}
+
+// AuthorizeEvent проверяет разрешение в предприятии, которому принадлежит событие
+func (p *Policy) AuthorizeEvent(ctx context.Context, eventID int, perm Permission) error {
+	const op = "policy.AuthorizeEvent"
+
+	if _, ok := AccountFrom(ctx); !ok {
+		return fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+	enterpriseID, err := p.store.EventEnterprise(ctx, eventID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return p.Authorize(ctx, enterpriseID, perm)
+}
+
+// AuthorizePost проверяет разрешение в предприятии, которому принадлежит событие поста
+func (p *Policy) AuthorizePost(ctx context.Context, postID int, perm Permission) error {
+	const op = "policy.AuthorizePost"
+
+	if _, ok := AccountFrom(ctx); !ok {
+		return fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+	eventID, err := p.store.PostEvent(ctx, postID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return p.AuthorizeEvent(ctx, eventID, perm)
+}
+
+// AuthorizeRoles проверяет, что аккаунт из контекста может управлять каждой из ролей
+func (p *Policy) AuthorizeRoles(ctx context.Context, enterpriseID int, roles ...string) error {
+	const op = "policy.AuthorizeRoles"
+
+	actor, err := p.role(ctx, enterpriseID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, role := range roles {
+		if !CanAssign(actor, role) {
+			return fmt.Errorf("%s: %s cannot manage %s: %w", op, actor, role, ErrForbidden)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) role(ctx context.Context, enterpriseID int) (string, error) {
+	account, ok := AccountFrom(ctx)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	if enterpriseID <= 0 {
+		return "", nil
+	}
+	return p.store.MemberRole(ctx, enterpriseID, account.ID)
+}
+
+type ctxKey struct{}
+
+type participantCtxKey struct{}
+
+// WithAccount сохраняет в контексте аутентифицированный аккаунт
+func WithAccount(ctx context.Context, account model.Account) context.Context {
+	return context.WithValue(ctx, ctxKey{}, account)
+}
+
+// AccountFrom возвращает аккаунт, от имени которого выполняется запрос
+func AccountFrom(ctx context.Context) (model.Account, bool) {
+	account, ok := ctx.Value(ctxKey{}).(model.Account)
+	return account, ok
+}
+
+// WithParticipant сохраняет в контексте участника, вошедшего по ссылке из письма
+func WithParticipant(ctx context.Context, participant model.Participant) context.Context {
+	return context.WithValue(ctx, participantCtxKey{}, participant)
+}
+
+// ParticipantFrom возвращает участника, от имени которого выполняется запрос
+func ParticipantFrom(ctx context.Context) (model.Participant, bool) {
+	participant, ok := ctx.Value(participantCtxKey{}).(model.Participant)
+	return participant, ok
+}
+
+// ActingParticipant возвращает участника сессии, от имени которого выполняется действие.
+// participantID из тела запроса необязателен, но если указан, должен совпадать с участником сессии
+func ActingParticipant(ctx context.Context, participantID int) (model.Participant, error) {
+	const op = "policy.ActingParticipant"
+
+	participant, ok := ParticipantFrom(ctx)
+	if !ok {
+		return model.Participant{}, fmt.Errorf("%s: %w", op, ErrUnauthenticated)
+	}
+	if participantID != 0 && participantID != participant.ID {
+		return model.Participant{}, fmt.Errorf("%s: participant %d acts as %d: %w", op, participant.ID, participantID, ErrForbidden)
+	}
+	return participant, nil
+}
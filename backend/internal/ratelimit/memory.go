@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full - когда корзина снова наполнится и ее можно забыть
+	full time.Time
+}
+
+// Memory хранит корзины в памяти сервера. У каждого сервера свои счетчики,
+// поэтому за несколькими серверами клиент получает лимит на каждом
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket)}
+}
+
+// TakeRateToken - как Storage.TakeRateToken, но в памяти
+func (m *Memory) TakeRateToken(_ context.Context, key string, rate float64, burst int) (float64, bool, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+	b.tokens--
+	b.full = now.Add(seconds((float64(burst) - b.tokens) / rate))
+	return b.tokens, true, nil
+}
+
+// PurgeRateBuckets удаляет корзины, которые уже наполнились
+func (m *Memory) PurgeRateBuckets(context.Context) (int, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for key, b := range m.buckets {
+		if !b.full.After(now) {
+			delete(m.buckets, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
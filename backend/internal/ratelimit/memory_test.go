@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMemoryTakeRateToken(t *testing.T) {
+	// 2 токена в секунду, в корзине не больше 3
+	const rate, burst = 2.0, 3
+
+	tests := []struct {
+		name string
+		// elapsed - сколько прошло с предыдущего запроса
+		elapsed    time.Duration
+		wantOK     bool
+		wantTokens float64
+	}{
+		{name: "new bucket is full", wantOK: true, wantTokens: 2},
+		{name: "burst", wantOK: true, wantTokens: 1},
+		{name: "last token of burst", wantOK: true, wantTokens: 0},
+		{name: "empty bucket", wantOK: false, wantTokens: 0},
+		{name: "partial refill is not enough", elapsed: 250 * time.Millisecond, wantOK: false, wantTokens: 0.5},
+		{name: "refill to one token", elapsed: 250 * time.Millisecond, wantOK: true, wantTokens: 0},
+		{name: "refill is capped by burst", elapsed: time.Hour, wantOK: true, wantTokens: 2},
+	}
+
+	m := NewMemory()
+	ctx := context.Background()
+	for _, tt := range tests {
+		if b := m.buckets["key"]; b != nil {
+			b.updated = b.updated.Add(-tt.elapsed)
+		}
+		tokens, ok, err := m.TakeRateToken(ctx, "key", rate, burst)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		// время между запросами в тесте тоже идет, поэтому токены сравниваются приблизительно
+		if ok != tt.wantOK || math.Abs(tokens-tt.wantTokens) > 0.01 {
+			t.Fatalf("%s: got %.3f tokens, ok %v, want %.3f, %v", tt.name, tokens, ok, tt.wantTokens, tt.wantOK)
+		}
+	}
+}
+
+func TestMemoryKeysAreIndependent(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	if _, ok, _ := m.TakeRateToken(ctx, "a", 1, 1); !ok {
+		t.Fatal("first request of a rejected")
+	}
+	if _, ok, _ := m.TakeRateToken(ctx, "a", 1, 1); ok {
+		t.Fatal("second request of a allowed over burst")
+	}
+	if _, ok, _ := m.TakeRateToken(ctx, "b", 1, 1); !ok {
+		t.Fatal("request of b rejected because of a")
+	}
+}
+
+func TestMemoryPurgeRateBuckets(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	m.TakeRateToken(ctx, "full", 1, 2)
+	m.TakeRateToken(ctx, "drained", 1, 2)
+	m.buckets["full"].full = time.Now().Add(-time.Second)
+
+	n, err := m.PurgeRateBuckets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("purged %d buckets, want 1", n)
+	}
+	if _, ok := m.buckets["full"]; ok {
+		t.Error("full bucket kept")
+	}
+	if _, ok := m.buckets["drained"]; !ok {
+		t.Error("draining bucket purged")
+	}
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"REST_project/config"
+	"REST_project/internal/audit"
+	model "REST_project/internal/models"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// Store хранит корзины токенов. Memory - в памяти сервера, storage.Storage - в Postgres,
+// общие для всех серверов
+type Store interface {
+	TakeRateToken(ctx context.Context, key string, rate float64, burst int) (float64, bool, error)
+	PurgeRateBuckets(ctx context.Context) (int, error)
+}
+
+// Limiter ограничивает частоту запросов корзиной токенов. Корзина своя у каждого клиента
+// в каждой группе маршрутов: у участника, у аккаунта (сессия или API-ключ), у анонима - у адреса
+type Limiter struct {
+	log   *slog.Logger
+	store Store
+	c     config.RateLimitCfg
+}
+
+func New(log *slog.Logger, store Store, c config.RateLimitCfg) *Limiter {
+	return &Limiter{
+		log:   log.With(slog.String("component", "middleware/ratelimit")),
+		store: store,
+		c:     c,
+	}
+}
+
+// Limit возвращает middleware с лимитом rc для группы name. Запрос сверх лимита получает 429
+// с Retry-After, каждый ответ - заголовки RateLimit-*. Если хранилище недоступно, запрос
+// пропускается: ограничитель не должен останавливать сервис
+func (l *Limiter) Limit(name string, rc config.RateCfg) func(next http.Handler) http.Handler {
+	if !l.c.Enabled || rc.Requests <= 0 || rc.Period <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	burst := rc.Burst
+	if burst <= 0 {
+		burst = rc.Requests
+	}
+	rate := float64(rc.Requests) / rc.Period.Seconds()
+	policy := fmt.Sprintf("%d;w=%d;burst=%d", rc.Requests, int(math.Ceil(rc.Period.Seconds())), burst)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := name + ":" + client(r.Context())
+			tokens, ok, err := l.store.TakeRateToken(r.Context(), key, rate, burst)
+			if err != nil {
+				l.log.Error("failed to check rate limit",
+					slog.String("error", err.Error()),
+					slog.String("request_id", middleware.GetReqID(r.Context())),
+				)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Policy", policy)
+			h.Set("RateLimit-Limit", strconv.Itoa(burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(int(max(tokens, 0))))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceil((float64(burst)-tokens)/rate)))
+			if ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			l.log.Info("rate limit exceeded",
+				slog.String("key", key),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+			)
+			h.Set("Retry-After", strconv.Itoa(ceil((1-tokens)/rate)))
+			render.Status(r, http.StatusTooManyRequests)
+			render.JSON(w, r, model.Response{
+				Status: "Error",
+				Error:  "too many requests",
+			})
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Run удаляет наполнившиеся корзины, пока не отменен ctx
+func (l *Limiter) Run(ctx context.Context) {
+	if !l.c.Enabled || l.c.PurgeInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(l.c.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := l.store.PurgeRateBuckets(ctx)
+		if err != nil && ctx.Err() == nil {
+			l.log.Error("failed to purge rate limit buckets", slog.String("error", err.Error()))
+		}
+		if n > 0 {
+			l.log.Debug("full rate limit buckets purged", slog.Int("count", n))
+		}
+	}
+}
+
+// client - ключ клиента: автор запроса из auth, для анонима - его адрес.
+// Запрос, который дошел сюда, уже прошел auth, поэтому сведения о нем в контексте есть
+func client(ctx context.Context) string {
+	meta := audit.MetaFrom(ctx)
+	if meta.Actor == audit.ActorAnonymous || meta.Actor == audit.ActorSystem {
+		return "ip:" + meta.IP
+	}
+	return meta.Actor
+}
+
+// ceil округляет секунды вверх: клиент, который подождет столько, точно получит токен
+func ceil(s float64) int {
+	return max(int(math.Ceil(s)), 0)
+}
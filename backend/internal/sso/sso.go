@@ -0,0 +1,172 @@
+package sso
+
+import (
+	"REST_project/config"
+	model "REST_project/internal/models"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// discoveryTimeout ограничивает запрос к /.well-known/openid-configuration
+const discoveryTimeout = 10 * time.Second
+
+var (
+	ErrNoIDToken     = errors.New("token response has no id_token")
+	ErrNonceMismatch = errors.New("id_token nonce does not match")
+	ErrNoEmail       = errors.New("id_token has no email claim")
+)
+
+// Client выполняет вход по authorization code с PKCE. Discovery выполняется
+// при первом обращении и повторяется, пока провайдер недоступен
+type Client struct {
+	cfg config.OIDCCfg
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func New(cfg config.OIDCCfg) *Client {
+	return &Client{cfg: cfg}
+}
+
+// AuthCodeURL возвращает адрес провайдера, на который нужно перенаправить пользователя
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	const op = "sso.AuthCodeURL"
+
+	oauth, _, err := c.discover(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange обменивает code на токены, проверяет подпись и nonce id_token и возвращает его утверждения
+func (c *Client) Exchange(ctx context.Context, code, verifier, nonce string) (model.OIDCIdentity, error) {
+	const op = "sso.Exchange"
+
+	oauth, idVerifier, err := c.discover(ctx)
+	if err != nil {
+		return model.OIDCIdentity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return model.OIDCIdentity{}, fmt.Errorf("%s: %w", op, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return model.OIDCIdentity{}, fmt.Errorf("%s: %w", op, ErrNoIDToken)
+	}
+
+	idToken, err := idVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return model.OIDCIdentity{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if idToken.Nonce != nonce {
+		return model.OIDCIdentity{}, fmt.Errorf("%s: %w", op, ErrNonceMismatch)
+	}
+
+	var claims map[string]any
+	if err = idToken.Claims(&claims); err != nil {
+		return model.OIDCIdentity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	identity := model.OIDCIdentity{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         stringClaim(claims, "email"),
+		EmailVerified: boolClaim(claims, "email_verified"),
+		Name:          stringClaim(claims, "name"),
+		Groups:        listClaim(claims, c.cfg.GroupsClaim),
+	}
+	if identity.Email == "" {
+		return model.OIDCIdentity{}, fmt.Errorf("%s: %w", op, ErrNoEmail)
+	}
+	return identity, nil
+}
+
+func (c *Client) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.oauth != nil {
+		return c.oauth, c.verifier, nil
+	}
+
+	// discovery принимает и адрес издателя, и полный адрес документа
+	issuer := strings.TrimSuffix(strings.TrimSuffix(c.cfg.DiscoveryURL, "/.well-known/openid-configuration"), "/")
+
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	c.oauth = &oauth2.Config{
+		ClientID:     c.cfg.ClientID,
+		ClientSecret: c.cfg.ClientSecret,
+		RedirectURL:  c.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       c.cfg.Scopes,
+	}
+	c.verifier = provider.Verifier(&oidc.Config{ClientID: c.cfg.ClientID})
+	return c.oauth, c.verifier, nil
+}
+
+// NewVerifier возвращает PKCE code_verifier
+func NewVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// RandomString возвращает случайную строку для state и nonce
+func RandomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	v, _ := claims[name].(string)
+	return v
+}
+
+// boolClaim учитывает провайдеров, которые присылают email_verified строкой
+func boolClaim(claims map[string]any, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// listClaim читает утверждение с группами: массив строк или одна строка
+func listClaim(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package sso
+
+import (
+	"REST_project/config"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+// mockIdP - провайдер OIDC для тестов: discovery, JWKS и token endpoint, который
+// проверяет PKCE и отдает id_token с утверждениями claims
+type mockIdP struct {
+	t         *testing.T
+	srv       *httptest.Server
+	key       *rsa.PrivateKey
+	signer    *rsa.PrivateKey
+	challenge string
+	claims    map[string]any
+	noIDToken bool
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIdP{t: t, key: key, signer: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                m.srv.URL,
+			"authorization_endpoint":                m.srv.URL + "/authorize",
+			"token_endpoint":                        m.srv.URL + "/token",
+			"jwks_uri":                              m.srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("token request: %v", err)
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		resp := map[string]any{"access_token": "access", "token_type": "Bearer", "expires_in": 3600}
+		if !m.noIDToken {
+			resp["id_token"] = m.idToken()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+// idToken подписывает утверждения RS256, iss, aud, iat и exp дополняются сами
+func (m *mockIdP) idToken() string {
+	claims := map[string]any{
+		"iss": m.srv.URL,
+		"aud": "client",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// login проходит вход до обмена code: запоминает code_challenge из адреса провайдера
+func (m *mockIdP) login(t *testing.T, c *Client, nonce string) string {
+	t.Helper()
+	verifier := NewVerifier()
+	authURL, err := c.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" || u.Query().Get("nonce") != nonce {
+		t.Fatalf("auth url %s: want S256 challenge and nonce", authURL)
+	}
+	m.challenge = u.Query().Get("code_challenge")
+	return verifier
+}
+
+func testClient(m *mockIdP, groupsClaim string) *Client {
+	return New(config.OIDCCfg{
+		DiscoveryURL: m.srv.URL + "/.well-known/openid-configuration",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/callback",
+		Scopes:       []string{"openid", "email"},
+		GroupsClaim:  groupsClaim,
+	})
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockIdP(t)
+	m.claims = map[string]any{
+		"sub":            "user-1",
+		"nonce":          "nonce-1",
+		"email":          "ivan@example.com",
+		"email_verified": "true",
+		"name":           "Ivan",
+		"groups":         []string{"staff", "admins"},
+	}
+	c := testClient(m, "groups")
+
+	verifier := m.login(t, c, "nonce-1")
+	identity, err := c.Exchange(context.Background(), "code", verifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Issuer != m.srv.URL || identity.Subject != "user-1" || identity.Email != "ivan@example.com" || identity.Name != "Ivan" {
+		t.Errorf("identity = %+v", identity)
+	}
+	if !identity.EmailVerified {
+		t.Error("email_verified \"true\" was not accepted")
+	}
+	if !slices.Equal(identity.Groups, []string{"staff", "admins"}) {
+		t.Errorf("groups = %v, want [staff admins]", identity.Groups)
+	}
+}
+
+func TestExchangeSingleGroupClaim(t *testing.T) {
+	m := newMockIdP(t)
+	m.claims = map[string]any{
+		"sub":            "user-1",
+		"nonce":          "n",
+		"email":          "ivan@example.com",
+		"email_verified": false,
+		"roles":          "organizers",
+	}
+	c := testClient(m, "roles")
+
+	verifier := m.login(t, c, "n")
+	identity, err := c.Exchange(context.Background(), "code", verifier, "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(identity.Groups, []string{"organizers"}) {
+		t.Errorf("groups = %v, want [organizers]", identity.Groups)
+	}
+	if identity.EmailVerified {
+		t.Error("email_verified false was accepted")
+	}
+}
+
+func TestExchangeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		nonce   string
+		prepare func(m *mockIdP)
+		want    error
+	}{
+		{
+			name:   "nonce mismatch",
+			claims: map[string]any{"sub": "u", "nonce": "other", "email": "ivan@example.com"},
+			nonce:  "n",
+			want:   ErrNonceMismatch,
+		},
+		{
+			name:   "no email",
+			claims: map[string]any{"sub": "u", "nonce": "n"},
+			nonce:  "n",
+			want:   ErrNoEmail,
+		},
+		{
+			name:    "no id_token",
+			nonce:   "n",
+			prepare: func(m *mockIdP) { m.noIDToken = true },
+			want:    ErrNoIDToken,
+		},
+		{
+			name:   "foreign signature",
+			claims: map[string]any{"sub": "u", "nonce": "n", "email": "ivan@example.com"},
+			nonce:  "n",
+			prepare: func(m *mockIdP) {
+				m.signer, _ = rsa.GenerateKey(rand.Reader, 2048)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIdP(t)
+			m.claims = tt.claims
+			if tt.prepare != nil {
+				tt.prepare(m)
+			}
+			c := testClient(m, "groups")
+
+			verifier := m.login(t, c, tt.nonce)
+			_, err := c.Exchange(context.Background(), "code", verifier, tt.nonce)
+			if err == nil {
+				t.Fatal("Exchange() succeeded, want error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Exchange() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	m := newMockIdP(t)
+	m.claims = map[string]any{"sub": "u", "nonce": "n", "email": "ivan@example.com"}
+	c := testClient(m, "groups")
+
+	m.login(t, c, "n")
+	if _, err := c.Exchange(context.Background(), "code", NewVerifier(), "n"); err == nil {
+		t.Fatal("Exchange() with another PKCE verifier succeeded")
+	}
+}
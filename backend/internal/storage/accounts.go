@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// CreateAccount создает аккаунт вместе с его первым API-ключом
+func (s *Storage) CreateAccount(ctx context.Context, name, email, keyHash string) (int, error) {
+	const op = "storage.postgres.CreateAccount"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, "INSERT INTO accounts (name, email) VALUES ($1, $2) RETURNING id;", name, email).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("%s: %w", op, ErrEmailTaken)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var keyID int
+	err = tx.QueryRowContext(ctx, "INSERT INTO api_keys (account_id, key_hash) VALUES ($1, $2) RETURNING id;", id, keyHash).Scan(&keyID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = auditCreated(ctx, tx, "accounts", auditRecord{Entity: entityAccount, EntityID: id}); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err = auditCreated(ctx, tx, "api_keys", auditRecord{Entity: entityAPIKey, EntityID: keyID}); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// AccountByKey находит владельца действующего API-ключа и отмечает время использования ключа
+func (s *Storage) AccountByKey(ctx context.Context, keyHash string) (models.Account, error) {
+	const op = "storage.AccountByKey"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var a models.Account
+	err := s.conn().QueryRowContext(ctx, `
+		UPDATE api_keys k SET last_used_at = now()
+		FROM accounts a
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND a.id = k.account_id
+		RETURNING a.id, a.name, a.email, a.created_at`, keyHash,
+	).Scan(&a.ID, &a.Name, &a.Email, &a.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Account{}, fmt.Errorf("%s: %w", op, ErrAccountNotFound)
+	}
+	if err != nil {
+		return models.Account{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return a, nil
+}
+
+func (s *Storage) CreateAPIKey(ctx context.Context, accountID int, keyHash string) (int, error) {
+	const op = "storage.postgres.CreateAPIKey"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO api_keys (account_id, key_hash) VALUES ($1, $2) RETURNING id;",
+		accountID, keyHash,
+	).Scan(&id)
+	if isForeignKeyViolation(err) {
+		return 0, fmt.Errorf("%s: %w", op, ErrAccountNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = auditCreated(ctx, tx, "api_keys", auditRecord{Entity: entityAPIKey, EntityID: id}); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// GetAPIKeys возвращает действующие ключи аккаунта без самих ключей
+func (s *Storage) GetAPIKeys(ctx context.Context, accountID int) ([]models.APIKey, error) {
+	const op = "storage.GetAPIKeys"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx,
+		"SELECT id, created_at, last_used_at FROM api_keys WHERE account_id = $1 AND revoked_at IS NULL ORDER BY id",
+		accountID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var k models.APIKey
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.CreatedAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if lastUsedAt.Valid {
+			k.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, k)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, accountID, keyID int) error {
+	const op = "storage.postgres.RevokeAPIKey"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(ctx, tx, "api_keys", "t.id = $1 AND t.account_id = $2 AND t.revoked_at IS NULL FOR UPDATE", keyID, accountID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, ErrKeyNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE api_keys SET revoked_at = now() WHERE id = $1;", keyID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = auditUpdated(ctx, tx, "api_keys", auditRecord{Action: auditDelete, Entity: entityAPIKey, EntityID: keyID, Before: before}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const attachmentColumns = "id, post_id, file_name, content_type, size, COALESCE(width, 0), COALESCE(height, 0), storage_key, created_at"
+
+// CreateAttachment сохраняет вложение вместе с его уменьшенными копиями
+func (s *Storage) CreateAttachment(ctx context.Context, a models.Attachment) (int, error) {
+	const op = "storage.postgres.CreateAttachment"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id, eventID int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO attachments (post_id, file_name, content_type, size, width, height, storage_key)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($6, 0), $7)
+		RETURNING id, (SELECT COALESCE(event_id, 0) FROM posts WHERE id = $1);`,
+		a.PostID, a.FileName, a.ContentType, a.Size, a.Width, a.Height, a.StorageKey,
+	).Scan(&id, &eventID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, v := range a.Variants {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO attachment_variants (attachment_id, width, height, content_type, size, storage_key) VALUES ($1, $2, $3, $4, $5, $6);",
+			id, v.Width, v.Height, v.ContentType, v.Size, v.StorageKey,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = auditCreated(ctx, tx, "attachments", auditRecord{EventID: eventID, Entity: entityAttachment, EntityID: id})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// GetAttachment возвращает вложение вместе с ключом в хранилище
+func (s *Storage) GetAttachment(ctx context.Context, id int) (models.Attachment, error) {
+	const op = "storage.GetAttachment"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var a models.Attachment
+	err := s.conn().QueryRowContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id = $1", id).
+		Scan(&a.ID, &a.PostID, &a.FileName, &a.ContentType, &a.Size, &a.Width, &a.Height, &a.StorageKey, &a.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Attachment{}, fmt.Errorf("%s: %w", op, ErrAttachmentNotFound)
+	}
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("%s: %w", op, err)
+	}
+	a.URL = models.AttachmentURL(a.ID)
+
+	variants, err := s.variantsByAttachment(ctx, "WHERE attachment_id = $1", id)
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("%s: %w", op, err)
+	}
+	a.Variants = variants[a.ID]
+	return a, nil
+}
+
+// GetAttachmentVariant возвращает уменьшенную копию вложения заданной ширины
+func (s *Storage) GetAttachmentVariant(ctx context.Context, attachmentID, width int) (models.AttachmentVariant, error) {
+	const op = "storage.GetAttachmentVariant"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var v models.AttachmentVariant
+	err := s.conn().QueryRowContext(ctx,
+		"SELECT width, height, content_type, size, storage_key FROM attachment_variants WHERE attachment_id = $1 AND width = $2",
+		attachmentID, width,
+	).Scan(&v.Width, &v.Height, &v.ContentType, &v.Size, &v.StorageKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.AttachmentVariant{}, fmt.Errorf("%s: %w", op, ErrAttachmentNotFound)
+	}
+	if err != nil {
+		return models.AttachmentVariant{}, fmt.Errorf("%s: %w", op, err)
+	}
+	v.URL = models.AttachmentVariantURL(attachmentID, v.Width)
+	return v, nil
+}
+
+// GetPostAttachments возвращает вложения одного поста
+func (s *Storage) GetPostAttachments(ctx context.Context, postID int) ([]models.Attachment, error) {
+	const op = "storage.GetPostAttachments"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE post_id = $1 ORDER BY id", postID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	variants, err := s.variantsByAttachment(ctx, "WHERE attachment_id IN (SELECT id FROM attachments WHERE post_id = $1)", postID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for i := range attachments {
+		attachments[i].Variants = variants[attachments[i].ID]
+	}
+	return attachments, nil
+}
+
+// variantsByAttachment возвращает уменьшенные копии, подходящие под условие where,
+// сгруппированные по id вложения
+func (s *Storage) variantsByAttachment(ctx context.Context, where string, args ...any) (map[int][]models.AttachmentVariant, error) {
+	variants := make(map[int][]models.AttachmentVariant)
+	q := variantsQuery(variants, where, args...)
+	rows, err := s.conn().QueryContext(ctx, q.query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return variants, q.scan(rows)
+}
+
+// attachmentsQuery - запрос вложений для пакета, строки записываются в into
+func attachmentsQuery(into *[]models.Attachment, where string, args ...any) batchQuery {
+	return batchQuery{
+		query: "SELECT " + attachmentColumns + " FROM attachments " + where + " ORDER BY id",
+		args:  args,
+		scan: func(rows rowScanner) error {
+			attachments, err := scanAttachments(rows)
+			*into = attachments
+			return err
+		},
+	}
+}
+
+// variantsQuery - запрос уменьшенных копий для пакета, копии раскладываются в into по id вложения
+func variantsQuery(into map[int][]models.AttachmentVariant, where string, args ...any) batchQuery {
+	return batchQuery{
+		query: "SELECT attachment_id, width, height, content_type, size, storage_key FROM attachment_variants " + where + " ORDER BY width",
+		args:  args,
+		scan: func(rows rowScanner) error {
+			for rows.Next() {
+				var id int
+				var v models.AttachmentVariant
+				if err := rows.Scan(&id, &v.Width, &v.Height, &v.ContentType, &v.Size, &v.StorageKey); err != nil {
+					return err
+				}
+				v.URL = models.AttachmentVariantURL(id, v.Width)
+				into[id] = append(into[id], v)
+			}
+			return rows.Err()
+		},
+	}
+}
+
+func scanAttachments(rows rowScanner) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	for rows.Next() {
+		var a models.Attachment
+		if err := rows.Scan(&a.ID, &a.PostID, &a.FileName, &a.ContentType, &a.Size, &a.Width, &a.Height, &a.StorageKey, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.URL = models.AttachmentURL(a.ID)
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
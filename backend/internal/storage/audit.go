@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"REST_project/internal/audit"
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Сущности журнала аудита
+const (
+	entityEnterprise   = "enterprise"
+	entityEvent        = "event"
+	entityParticipant  = "participant"
+	entityPost         = "post"
+	entityComment      = "comment"
+	entityAttachment   = "attachment"
+	entityPoll         = "poll"
+	entityBallot       = "ballot"
+	entityQuestion     = "question"
+	entityQuestionVote = "question_vote"
+	entityRule         = "moderation_rule"
+	entityReport       = "report"
+	entitySanction     = "sanction"
+	entityAccount      = "account"
+	entityAPIKey       = "api_key"
+	entityMember       = "member"
+	entityGroupMapping = "group_mapping"
+	entityExportJob    = "export_job"
+	entityWebhook      = "webhook"
+	entityDelivery     = "webhook_delivery"
+	entityPreference   = "notification_preference"
+	entityPush         = "push_subscription"
+)
+
+// Действия журнала аудита
+const (
+	auditCreate = "create"
+	auditUpdate = "update"
+	auditDelete = "delete"
+	auditLogin  = "login"
+)
+
+// snapshotExpr превращает строку таблицы с алиасом t в JSON без служебных и секретных столбцов
+const snapshotExpr = "to_jsonb(t) - 'search_vector' - 'key_hash' - 'token_hash' - 'secret' - 'auth'"
+
+// auditRecord - изменение, которое записывается в audit_log в транзакции самой операции.
+// Если EnterpriseID не задан, предприятие определяется по EventID
+type auditRecord struct {
+	EnterpriseID int
+	EventID      int
+	Action       string
+	Entity       string
+	EntityID     int
+	Before       []byte
+	After        []byte
+}
+
+// writeAudit добавляет запись в журнал аудита. Автор, request id и адрес берутся из контекста.
+// Служебные таблицы (состояния OIDC, одноразовые токены, сессии) в журнал не попадают
+func writeAudit(ctx context.Context, tx *txn, rec auditRecord) error {
+	meta := audit.MetaFrom(ctx)
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_log (enterprise_id, event_id, actor, action, entity, entity_id, before, after, request_id, ip)
+		VALUES (COALESCE(NULLIF($1, 0), (SELECT enterprise_id FROM events WHERE id = NULLIF($2, 0))),
+			NULLIF($2, 0), $3, $4, $5, NULLIF($6, 0), $7::jsonb, $8::jsonb, NULLIF($9, ''), NULLIF($10, ''));`,
+		rec.EnterpriseID, rec.EventID, meta.Actor, rec.Action, rec.Entity, rec.EntityID,
+		jsonArg(rec.Before), jsonArg(rec.After), meta.RequestID, meta.IP,
+	)
+	return err
+}
+
+// auditCreated записывает создание строки table с id = rec.EntityID вместе с ее снимком
+func auditCreated(ctx context.Context, tx *txn, table string, rec auditRecord) error {
+	after, err := snapshot(ctx, tx, table, "t.id = $1", rec.EntityID)
+	if err != nil {
+		return err
+	}
+	rec.Action, rec.After = auditCreate, after
+	return writeAudit(ctx, tx, rec)
+}
+
+// auditUpdated записывает изменение строки table с id = rec.EntityID. rec.Before снимается
+// до изменения вызывающим кодом, снимок после берется здесь. По умолчанию действие - update
+func auditUpdated(ctx context.Context, tx *txn, table string, rec auditRecord) error {
+	after, err := snapshot(ctx, tx, table, "t.id = $1", rec.EntityID)
+	if err != nil {
+		return err
+	}
+	if rec.Action == "" {
+		rec.Action = auditUpdate
+	}
+	rec.After = after
+	return writeAudit(ctx, tx, rec)
+}
+
+// snapshot возвращает строку table в виде JSON или nil, если строки нет.
+// table и where подставляются в запрос как есть и должны быть константами
+func snapshot(ctx context.Context, tx *txn, table, where string, args ...any) ([]byte, error) {
+	var b []byte
+	err := tx.QueryRowContext(ctx, "SELECT "+snapshotExpr+" FROM "+table+" t WHERE "+where, args...).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// snapshots возвращает снимки строк table, разложенные по целочисленному столбцу key
+func snapshots(ctx context.Context, tx *txn, table, key, where string, args ...any) (map[int][]byte, error) {
+	return snapshotRows(tx.QueryContext(ctx, "SELECT t."+key+", "+snapshotExpr+" FROM "+table+" t WHERE "+where, args...))
+}
+
+// snapshotRows собирает результат запроса вида (ключ, снимок) в map
+func snapshotRows(rows *sql.Rows, err error) (map[int][]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := make(map[int][]byte)
+	for rows.Next() {
+		var key int
+		var b []byte
+		if err := rows.Scan(&key, &b); err != nil {
+			return nil, err
+		}
+		m[key] = b
+	}
+	return m, rows.Err()
+}
+
+func jsonArg(b []byte) any {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
+
+// GetAuditLog возвращает журнал аудита предприятия от новых записей к старым
+func (s *Storage) GetAuditLog(ctx context.Context, enterpriseID int, f models.AuditFilter) ([]models.AuditEntry, error) {
+	const op = "storage.GetAuditLog"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, `
+		SELECT id, COALESCE(enterprise_id, 0), COALESCE(event_id, 0), actor, action, entity, COALESCE(entity_id, 0),
+			before, after, COALESCE(request_id, ''), COALESCE(ip, ''), created_at
+		FROM audit_log
+		WHERE enterprise_id = $1
+			AND ($2 = '' OR entity = $2)
+			AND ($3 = 0 OR entity_id = $3)
+			AND ($4 = '' OR action = $4)
+			AND ($5 = '' OR actor = $5)
+		ORDER BY id DESC
+		LIMIT $6 OFFSET $7`,
+		enterpriseID, f.Entity, f.EntityID, f.Action, f.Actor, f.Limit, f.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.EnterpriseID, &e.EventID, &e.Actor, &e.Action, &e.Entity, &e.EntityID,
+			&before, &after, &e.RequestID, &e.IP, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		e.Before, e.After = before, after
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// rowScanner - общее у *sql.Rows и pgx.Rows, чтобы разбор строк не зависел от того, как выполнен запрос
+type rowScanner interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+}
+
+// batchQuery - запрос пакета и разбор его результата
+type batchQuery struct {
+	query string
+	args  []any
+	scan  func(rows rowScanner) error
+}
+
+// batch отправляет запросы одним пакетом pgx: база получает их за один обмен по сети
+// и выполняет по очереди, результаты разбираются в том же порядке.
+// Внутри WithTx пакет выполняется в ее транзакции
+func (s *Storage) batch(ctx context.Context, queries ...batchQuery) error {
+	return s.withPgx(ctx, func(conn *pgx.Conn) error {
+		b := &pgx.Batch{}
+		for _, q := range queries {
+			b.Queue(q.query, q.args...)
+		}
+
+		results := conn.SendBatch(ctx, b)
+		for _, q := range queries {
+			rows, err := results.Query()
+			if err == nil {
+				err = q.scan(rows)
+				rows.Close()
+			}
+			if err != nil {
+				results.Close()
+				return err
+			}
+		}
+		return results.Close()
+	})
+}
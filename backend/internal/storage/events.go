@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const eventColumns = `id, COALESCE(enterprise_id, 0), name, COALESCE(description, ''), COALESCE(capacity, 0), created_at,
+	starts_at, ends_at, timezone, COALESCE(location, ''), COALESCE(join_url, ''), sequence, updated_at`
+
+// GetEvent возвращает событие
+func (s *Storage) GetEvent(ctx context.Context, eventID int) (models.Event, error) {
+	const op = "storage.GetEvent"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	e, err := scanEvent(s.conn().QueryRowContext(ctx, "SELECT "+eventColumns+" FROM events WHERE id = $1", eventID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Event{}, fmt.Errorf("%s: %w", op, ErrEventNotFound)
+	}
+	if err != nil {
+		return models.Event{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return e, nil
+}
+
+// GetEnterprise возвращает предприятие
+func (s *Storage) GetEnterprise(ctx context.Context, enterpriseID int) (models.Enterprise, error) {
+	const op = "storage.GetEnterprise"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var e models.Enterprise
+	err := s.conn().QueryRowContext(ctx, "SELECT id, name FROM enterprises WHERE id = $1", enterpriseID).Scan(&e.ID, &e.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Enterprise{}, fmt.Errorf("%s: %w", op, ErrEnterpriseNotFound)
+	}
+	if err != nil {
+		return models.Enterprise{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return e, nil
+}
+
+// GetEnterpriseEvents возвращает события предприятия, у которых задано время начала, в порядке начала
+func (s *Storage) GetEnterpriseEvents(ctx context.Context, enterpriseID int) ([]models.Event, error) {
+	const op = "storage.GetEnterpriseEvents"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx,
+		"SELECT "+eventColumns+" FROM events WHERE enterprise_id = $1 AND starts_at IS NOT NULL ORDER BY starts_at, id", enterpriseID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return events, nil
+}
+
+// SetEventSchedule меняет время и место события и увеличивает sequence, чтобы
+// подписанные календари обновили событие
+func (s *Storage) SetEventSchedule(ctx context.Context, eventID int, schedule models.EventSchedule) error {
+	const op = "storage.postgres.SetEventSchedule"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(ctx, tx, "events", "t.id = $1 FOR UPDATE", eventID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, ErrEventNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE events
+		SET starts_at = $2, ends_at = $3, timezone = $4, location = NULLIF($5, ''), join_url = NULLIF($6, ''),
+			sequence = sequence + 1, updated_at = now()
+		WHERE id = $1`,
+		eventID, schedule.StartsAt, schedule.EndsAt, schedule.Timezone, schedule.Location, schedule.JoinURL)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditUpdated(ctx, tx, "events", auditRecord{EventID: eventID, Entity: entityEvent, EntityID: eventID, Before: before})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func scanEvent(row interface{ Scan(dest ...any) error }) (models.Event, error) {
+	var e models.Event
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(&e.ID, &e.EnterpriseID, &e.Name, &e.Description, &e.Capacity, &e.CreatedAt,
+		&startsAt, &endsAt, &e.Timezone, &e.Location, &e.JoinURL, &e.Sequence, &e.UpdatedAt)
+	if err != nil {
+		return models.Event{}, err
+	}
+	if startsAt.Valid {
+		e.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		e.EndsAt = &endsAt.Time
+	}
+	return e, nil
+}
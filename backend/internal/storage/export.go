@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"REST_project/internal/audit"
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+)
+
+const exportJobColumns = `id, event_id, status, progress, COALESCE(stage, ''), COALESCE(error, ''),
+	COALESCE(storage_key, ''), COALESCE(size, 0), actor, created_at, started_at, finished_at`
+
+// CreateExportJob ставит выгрузку события в очередь. Автор берется из контекста
+func (s *Storage) CreateExportJob(ctx context.Context, eventID int) (models.ExportJob, error) {
+	const op = "storage.postgres.CreateExportJob"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return models.ExportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	job, err := scanExportJob(tx.QueryRowContext(ctx,
+		"INSERT INTO export_jobs (event_id, actor) VALUES ($1, $2) RETURNING "+exportJobColumns,
+		eventID, audit.MetaFrom(ctx).Actor,
+	))
+	if isForeignKeyViolation(err) {
+		return models.ExportJob{}, fmt.Errorf("%s: %w", op, ErrEventNotFound)
+	}
+	if err != nil {
+		return models.ExportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditCreated(ctx, tx, "export_jobs", auditRecord{EventID: eventID, Entity: entityExportJob, EntityID: job.ID})
+	if err != nil {
+		return models.ExportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.ExportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return job, nil
+}
+
+// GetExportJob возвращает выгрузку события
+func (s *Storage) GetExportJob(ctx context.Context, eventID, jobID int) (models.ExportJob, error) {
+	const op = "storage.GetExportJob"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	job, err := scanExportJob(s.conn().QueryRowContext(ctx,
+		"SELECT "+exportJobColumns+" FROM export_jobs WHERE event_id = $1 AND id = $2", eventID, jobID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ExportJob{}, fmt.Errorf("%s: %w", op, ErrExportNotFound)
+	}
+	if err != nil {
+		return models.ExportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return job, nil
+}
+
+// GetExportJobs возвращает выгрузки события от новых к старым
+func (s *Storage) GetExportJobs(ctx context.Context, eventID int) ([]models.ExportJob, error) {
+	const op = "storage.GetExportJobs"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx,
+		"SELECT "+exportJobColumns+" FROM export_jobs WHERE event_id = $1 ORDER BY id DESC", eventID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	jobs := []models.ExportJob{}
+	for rows.Next() {
+		job, err := scanExportJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return jobs, nil
+}
+
+// StartExportJob отмечает начало выгрузки
+func (s *Storage) StartExportJob(ctx context.Context, jobID int) error {
+	const op = "storage.postgres.StartExportJob"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx,
+		"UPDATE export_jobs SET status = 'running', started_at = now() WHERE id = $1", jobID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// SetExportProgress сохраняет процент готовности и этап выгрузки
+func (s *Storage) SetExportProgress(ctx context.Context, jobID, progress int, stage string) error {
+	const op = "storage.postgres.SetExportProgress"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx,
+		"UPDATE export_jobs SET progress = $2, stage = $3 WHERE id = $1", jobID, progress, stage)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// FinishExportJob завершает выгрузку: с архивом под key или, если errMsg не пуст, с ошибкой
+func (s *Storage) FinishExportJob(ctx context.Context, jobID int, key string, size int64, errMsg string) error {
+	const op = "storage.postgres.FinishExportJob"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx, `
+		UPDATE export_jobs
+		SET status = CASE WHEN $4 = '' THEN 'done' ELSE 'failed' END,
+			progress = CASE WHEN $4 = '' THEN 100 ELSE progress END,
+			storage_key = NULLIF($2, ''), size = NULLIF($3::bigint, 0), error = NULLIF($4, ''), finished_at = now()
+		WHERE id = $1`, jobID, key, size, errMsg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// FailInterruptedExportJobs завершает с ошибкой выгрузки, которые не доработали до остановки сервера
+func (s *Storage) FailInterruptedExportJobs(ctx context.Context) (int, error) {
+	const op = "storage.postgres.FailInterruptedExportJobs"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn().ExecContext(ctx, `
+		UPDATE export_jobs SET status = 'failed', error = 'interrupted by server restart', finished_at = now()
+		WHERE status IN ('pending', 'running')`)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return int(n), nil
+}
+
+func scanExportJob(row interface{ Scan(dest ...any) error }) (models.ExportJob, error) {
+	var job models.ExportJob
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.EventID, &job.Status, &job.Progress, &job.Stage, &job.Error,
+		&job.StorageKey, &job.Size, &job.Actor, &job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return models.ExportJob{}, err
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	if job.Status == models.ExportDone {
+		job.URL = models.ExportJobURL(job.EventID, job.ID)
+	}
+	return job, nil
+}
+
+// Методы Export* отдают строки по одной, пока выгрузка их пишет, и не ограничены таймаутом запроса:
+// чтение длится столько, сколько запись архива. Выгрузка вызывает их в одной транзакции
+// REPEATABLE READ, чтобы все файлы архива описывали одно состояние события
+
+// ExportParticipants отдает участников события вместе с email
+func (s *Storage) ExportParticipants(ctx context.Context, eventID int) iter.Seq2[models.Participant, error] {
+	return queryEach(ctx, s.conn(), "storage.ExportParticipants", func(rows rowScanner) (models.Participant, error) {
+		var p models.Participant
+		err := rows.Scan(&p.ID, &p.EventID, &p.Name, &p.Email)
+		return p, err
+	}, "SELECT id, event_id, name, COALESCE(email, '') FROM participants WHERE event_id = $1 ORDER BY id", eventID)
+}
+
+// ExportPosts отдает посты события
+func (s *Storage) ExportPosts(ctx context.Context, eventID int) iter.Seq2[models.Post, error] {
+	return queryEach(ctx, s.conn(), "storage.ExportPosts", func(rows rowScanner) (models.Post, error) {
+		var p models.Post
+		err := rows.Scan(&p.ID, &p.EventID, &p.Type, &p.Content, &p.CreatedAt)
+		return p, err
+	}, "SELECT id, event_id, type, content, created_at FROM posts WHERE event_id = $1 ORDER BY id", eventID)
+}
+
+// ExportComments отдает комментарии к постам события во всех статусах модерации
+func (s *Storage) ExportComments(ctx context.Context, eventID int) iter.Seq2[models.Comment, error] {
+	return queryEach(ctx, s.conn(), "storage.ExportComments", func(rows rowScanner) (models.Comment, error) {
+		var c models.Comment
+		err := rows.Scan(&c.ID, &c.PostID, &c.ParticipantID, &c.Content, &c.Status, &c.ModerationReason, &c.CreatedAt)
+		return c, err
+	}, `
+		SELECT c.id, c.post_id, COALESCE(c.participant_id, 0), c.content, c.status, COALESCE(c.moderation_reason, ''), c.created_at
+		FROM comments c JOIN posts p ON p.id = c.post_id
+		WHERE p.event_id = $1
+		ORDER BY c.id`, eventID)
+}
+
+// ExportAttachments отдает вложения постов события
+func (s *Storage) ExportAttachments(ctx context.Context, eventID int) iter.Seq2[models.Attachment, error] {
+	return queryEach(ctx, s.conn(), "storage.ExportAttachments", func(rows rowScanner) (models.Attachment, error) {
+		var a models.Attachment
+		err := rows.Scan(&a.ID, &a.PostID, &a.FileName, &a.ContentType, &a.Size, &a.Width, &a.Height, &a.StorageKey, &a.CreatedAt)
+		a.URL = models.AttachmentURL(a.ID)
+		return a, err
+	}, "SELECT "+attachmentColumns+" FROM attachments WHERE post_id IN (SELECT id FROM posts WHERE event_id = $1) ORDER BY id", eventID)
+}
+
+// CountAttachments возвращает число вложений события
+func (s *Storage) CountAttachments(ctx context.Context, eventID int) (int, error) {
+	const op = "storage.CountAttachments"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var n int
+	err := s.conn().QueryRowContext(ctx,
+		"SELECT count(*) FROM attachments WHERE post_id IN (SELECT id FROM posts WHERE event_id = $1)", eventID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
+
+// queryEach выполняет запрос и отдает строки по одной. Запрос выполняется при обходе,
+// ошибка отдается последним элементом
+func queryEach[T any](ctx context.Context, q querier, op string, scan func(rows rowScanner) (T, error), query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			yield(zero, fmt.Errorf("%s: %w", op, err))
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			v, err := scan(rows)
+			if err != nil {
+				yield(zero, fmt.Errorf("%s: %w", op, err))
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+		if err = rows.Err(); err != nil {
+			yield(zero, fmt.Errorf("%s: %w", op, err))
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Listener - отдельное соединение, которое слушает уведомления о доменных событиях.
+// Соединение забирается из пула насовсем: LISTEN действует, пока оно открыто
+type Listener struct {
+	conn *pgx.Conn
+}
+
+// Listen открывает Listener. Его нужно закрыть через Close
+func (s *Storage) Listen(ctx context.Context) (*Listener, error) {
+	const op = "storage.Listen"
+	c, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	conn := c.Hijack()
+	if _, err = conn.Exec(ctx, "LISTEN "+domainEventsChannel); err != nil {
+		conn.Close(context.WithoutCancel(ctx))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &Listener{conn: conn}, nil
+}
+
+// Wait ждет следующего уведомления и возвращает номер транзакции, которая записала события.
+// Ошибка значит, что соединение потеряно или ctx отменен: Listener нужно закрыть и открыть заново
+func (l *Listener) Wait(ctx context.Context) (string, error) {
+	const op = "storage.Listener.Wait"
+	n, err := l.conn.WaitForNotification(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	var payload struct {
+		TxID string `json:"txid"`
+	}
+	if err = json.Unmarshal([]byte(n.Payload), &payload); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return payload.TxID, nil
+}
+
+// Close закрывает соединение, LISTEN снимается вместе с ним
+func (l *Listener) Close(ctx context.Context) error {
+	return l.conn.Close(ctx)
+}
@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// MemberRole возвращает роль аккаунта в предприятии или пустую строку, если аккаунт в нем не состоит
+func (s *Storage) MemberRole(ctx context.Context, enterpriseID, accountID int) (string, error) {
+	const op = "storage.MemberRole"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var role string
+	err := s.conn().QueryRowContext(ctx,
+		"SELECT role FROM enterprise_members WHERE enterprise_id = $1 AND account_id = $2",
+		enterpriseID, accountID,
+	).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return role, nil
+}
+
+// EventEnterprise возвращает предприятие события, 0 - событие без предприятия
+func (s *Storage) EventEnterprise(ctx context.Context, eventID int) (int, error) {
+	const op = "storage.EventEnterprise"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var enterpriseID int
+	err := s.conn().QueryRowContext(ctx, "SELECT COALESCE(enterprise_id, 0) FROM events WHERE id = $1", eventID).Scan(&enterpriseID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, ErrEventNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return enterpriseID, nil
+}
+
+// PostEvent возвращает событие, к которому относится пост
+func (s *Storage) PostEvent(ctx context.Context, postID int) (int, error) {
+	const op = "storage.PostEvent"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var eventID int
+	err := s.conn().QueryRowContext(ctx, "SELECT COALESCE(event_id, 0) FROM posts WHERE id = $1", postID).Scan(&eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, ErrPostNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return eventID, nil
+}
+
+// GetMembers возвращает сотрудников предприятия с их ролями
+func (s *Storage) GetMembers(ctx context.Context, enterpriseID int) ([]models.Member, error) {
+	const op = "storage.GetMembers"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.members(ctx, op, "m.enterprise_id = $1", enterpriseID)
+}
+
+// GetMemberships возвращает предприятия, в которых состоит аккаунт
+func (s *Storage) GetMemberships(ctx context.Context, accountID int) ([]models.Member, error) {
+	const op = "storage.GetMemberships"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.members(ctx, op, "m.account_id = $1", accountID)
+}
+
+func (s *Storage) members(ctx context.Context, op, where string, args ...any) ([]models.Member, error) {
+	rows, err := s.conn().QueryContext(ctx, `
+		SELECT m.enterprise_id, m.account_id, a.name, a.email, m.role, m.source, m.created_at
+		FROM enterprise_members m JOIN accounts a ON a.id = m.account_id
+		WHERE `+where+`
+		ORDER BY m.enterprise_id, m.created_at`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	members := []models.Member{}
+	for rows.Next() {
+		var m models.Member
+		if err := rows.Scan(&m.EnterpriseID, &m.AccountID, &m.Name, &m.Email, &m.Role, &m.Source, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		members = append(members, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+// AddMember добавляет в предприятие зарегистрированный аккаунт с указанным email
+func (s *Storage) AddMember(ctx context.Context, enterpriseID int, email, role string) (int, error) {
+	const op = "storage.postgres.AddMember"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var accountID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO enterprise_members (enterprise_id, account_id, role)
+		SELECT $1, id, $3 FROM accounts WHERE lower(email) = lower($2)
+		RETURNING account_id;`,
+		enterpriseID, email, role,
+	).Scan(&accountID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, ErrAccountNotFound)
+	}
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("%s: %w", op, ErrAlreadyMember)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = auditMember(ctx, tx, auditCreate, enterpriseID, accountID, nil); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return accountID, nil
+}
+
+// SetMemberRole меняет роль сотрудника. Измененное вручную членство больше не
+// синхронизируется с группами OIDC. Последнего владельца понизить нельзя
+func (s *Storage) SetMemberRole(ctx context.Context, enterpriseID, accountID int, role string) error {
+	const op = "storage.postgres.SetMemberRole"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if role != models.RoleOwner {
+		if err = ensureNotLastOwner(ctx, tx, enterpriseID, accountID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	before, err := memberSnapshot(ctx, tx, enterpriseID, accountID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, ErrMemberNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE enterprise_members SET role = $3, source = 'manual' WHERE enterprise_id = $1 AND account_id = $2;",
+		enterpriseID, accountID, role,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = auditMember(ctx, tx, auditUpdate, enterpriseID, accountID, before); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RemoveMember исключает сотрудника из предприятия. Последнего владельца исключить нельзя
+func (s *Storage) RemoveMember(ctx context.Context, enterpriseID, accountID int) error {
+	const op = "storage.postgres.RemoveMember"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err = ensureNotLastOwner(ctx, tx, enterpriseID, accountID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	before, err := memberSnapshot(ctx, tx, enterpriseID, accountID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, ErrMemberNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM enterprise_members WHERE enterprise_id = $1 AND account_id = $2;",
+		enterpriseID, accountID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = auditMember(ctx, tx, auditDelete, enterpriseID, accountID, before); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// memberSnapshot блокирует членство до конца транзакции и возвращает его снимок для журнала аудита
+func memberSnapshot(ctx context.Context, tx *txn, enterpriseID, accountID int) ([]byte, error) {
+	return snapshot(ctx, tx, "enterprise_members", "t.enterprise_id = $1 AND t.account_id = $2 FOR UPDATE", enterpriseID, accountID)
+}
+
+// auditMember записывает изменение членства. Снимок после изменения берется из текущей строки
+func auditMember(ctx context.Context, tx *txn, action string, enterpriseID, accountID int, before []byte) error {
+	after, err := snapshot(ctx, tx, "enterprise_members", "t.enterprise_id = $1 AND t.account_id = $2", enterpriseID, accountID)
+	if err != nil {
+		return err
+	}
+	return writeAudit(ctx, tx, auditRecord{
+		EnterpriseID: enterpriseID,
+		Action:       action,
+		Entity:       entityMember,
+		EntityID:     accountID,
+		Before:       before,
+		After:        after,
+	})
+}
+
+// ensureNotLastOwner блокирует владельцев предприятия до конца транзакции и
+// возвращает ErrLastOwner, если accountID - единственный из них
+func ensureNotLastOwner(ctx context.Context, tx *txn, enterpriseID, accountID int) error {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT account_id FROM enterprise_members WHERE enterprise_id = $1 AND role = $2 FOR UPDATE",
+		enterpriseID, models.RoleOwner,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var owners []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		owners = append(owners, id)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(owners) == 1 && owners[0] == accountID {
+		return ErrLastOwner
+	}
+	return nil
+}
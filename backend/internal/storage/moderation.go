@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CommentContext возвращает предприятие и режим премодерации события, к которому относится пост
+func (s *Storage) CommentContext(ctx context.Context, postID int) (int, bool, error) {
+	const op = "storage.CommentContext"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var enterpriseID int
+	var premoderation bool
+	err := s.conn().QueryRowContext(ctx, `
+		SELECT COALESCE(e.enterprise_id, 0), e.premoderation
+		FROM posts p JOIN events e ON e.id = p.event_id
+		WHERE p.id = $1`, postID,
+	).Scan(&enterpriseID, &premoderation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, fmt.Errorf("%s: %w", op, ErrPostNotFound)
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+	return enterpriseID, premoderation, nil
+}
+
+// RecentComments возвращает комментарии участника, оставленные после since, от новых к старым
+func (s *Storage) RecentComments(ctx context.Context, participantID int, since time.Time) ([]models.Comment, error) {
+	const op = "storage.RecentComments"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, `
+		SELECT id, post_id, participant_id, content, status, created_at
+		FROM comments
+		WHERE participant_id = $1 AND created_at > $2
+		ORDER BY created_at DESC`, participantID, since)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		var c models.Comment
+		if err := rows.Scan(&c.ID, &c.PostID, &c.ParticipantID, &c.Content, &c.Status, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		comments = append(comments, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return comments, nil
+}
+
+// GetPendingComments возвращает очередь комментариев события, ожидающих модерации
+func (s *Storage) GetPendingComments(ctx context.Context, eventID int) ([]models.Comment, error) {
+	const op = "storage.GetPendingComments"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, `
+		SELECT c.id, c.post_id, c.participant_id, c.content, c.status, COALESCE(c.moderation_reason, ''), c.created_at
+		FROM comments c JOIN posts p ON p.id = c.post_id
+		WHERE p.event_id = $1 AND c.status = 'pending'
+		ORDER BY c.created_at`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	comments := []models.Comment{}
+	for rows.Next() {
+		var c models.Comment
+		if err := rows.Scan(&c.ID, &c.PostID, &c.ParticipantID, &c.Content, &c.Status, &c.ModerationReason, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		comments = append(comments, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return comments, nil
+}
+
+// ModerateComment одобряет или отклоняет комментарий события. При отклонении сохраняется причина
+func (s *Storage) ModerateComment(ctx context.Context, eventID, commentID int, status, reason string) error {
+	const op = "storage.postgres.ModerateComment"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(ctx, tx, "comments",
+		"t.id = $1 AND EXISTS (SELECT 1 FROM posts p WHERE p.id = t.post_id AND p.event_id = $2) FOR UPDATE",
+		commentID, eventID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, ErrCommentNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE comments
+		SET status = $2, moderation_reason = NULLIF($3, ''), moderated_at = now()
+		WHERE id = $1;`,
+		commentID, status, reason,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditUpdated(ctx, tx, "comments", auditRecord{EventID: eventID, Entity: entityComment, EntityID: commentID, Before: before})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = emit(ctx, tx, models.CommentModerated, eventID, "comments", commentID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// SetPremoderation включает или выключает премодерацию комментариев события
+func (s *Storage) SetPremoderation(ctx context.Context, eventID int, enabled bool) error {
+	const op = "storage.postgres.SetPremoderation"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(ctx, tx, "events", "t.id = $1 FOR UPDATE", eventID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, ErrEventNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE events SET premoderation = $2 WHERE id = $1;", eventID, enabled)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditUpdated(ctx, tx, "events", auditRecord{EventID: eventID, Entity: entityEvent, EntityID: eventID, Before: before})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) CreateModerationRule(ctx context.Context, enterpriseID int, pattern string, isRegex bool) (int, error) {
+	const op = "storage.postgres.CreateModerationRule"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO moderation_rules (enterprise_id, pattern, is_regex) VALUES ($1, $2, $3) RETURNING id;",
+		enterpriseID, pattern, isRegex,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditCreated(ctx, tx, "moderation_rules", auditRecord{EnterpriseID: enterpriseID, Entity: entityRule, EntityID: id})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// GetModerationRules возвращает блок-лист предприятия
+func (s *Storage) GetModerationRules(ctx context.Context, enterpriseID int) ([]models.ModerationRule, error) {
+	const op = "storage.GetModerationRules"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx,
+		"SELECT id, enterprise_id, pattern, is_regex, created_at FROM moderation_rules WHERE enterprise_id = $1 ORDER BY id",
+		enterpriseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	rules := []models.ModerationRule{}
+	for rows.Next() {
+		var r models.ModerationRule
+		if err := rows.Scan(&r.ID, &r.EnterpriseID, &r.Pattern, &r.IsRegex, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		rules = append(rules, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return rules, nil
+}
+
+func (s *Storage) DeleteModerationRule(ctx context.Context, enterpriseID, ruleID int) error {
+	const op = "storage.postgres.DeleteModerationRule"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(ctx, tx, "moderation_rules", "t.id = $1 AND t.enterprise_id = $2 FOR UPDATE", ruleID, enterpriseID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, ErrRuleNotFound)
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM moderation_rules WHERE id = $1;", ruleID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = writeAudit(ctx, tx, auditRecord{
+		EnterpriseID: enterpriseID,
+		Action:       auditDelete,
+		Entity:       entityRule,
+		EntityID:     ruleID,
+		Before:       before,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// InitNotificationPreferences создает настройки писем новому участнику. Это подписчик outbox:
+// участник получает письма только о постах, опубликованных после регистрации
+func (s *Storage) InitNotificationPreferences(ctx context.Context, e models.DomainEvent) error {
+	const op = "storage.postgres.InitNotificationPreferences"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx, `
+		INSERT INTO notification_preferences (participant_id, last_post_id)
+		SELECT p.id, COALESCE((
+			SELECT max(po.id) FROM posts po WHERE po.event_id = p.event_id AND po.created_at <= $2
+		), 0)
+		FROM participants p WHERE p.id = $1
+		ON CONFLICT (participant_id) DO NOTHING`,
+		e.EntityID, e.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// GetNotificationMode возвращает режим писем участника. Пока настройки не созданы, действует
+// режим по умолчанию - ежедневная сводка
+func (s *Storage) GetNotificationMode(ctx context.Context, participantID int) (string, error) {
+	const op = "storage.GetNotificationMode"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var mode string
+	err := s.conn().QueryRowContext(ctx,
+		"SELECT mode FROM notification_preferences WHERE participant_id = $1", participantID,
+	).Scan(&mode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.NotifyDaily, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return mode, nil
+}
+
+// SetNotificationMode меняет режим писем участника. Кто включает письма после отписки,
+// получает только посты, опубликованные после этого
+func (s *Storage) SetNotificationMode(ctx context.Context, participantID int, mode string) error {
+	const op = "storage.postgres.SetNotificationMode"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	eventID, err := participantEvent(ctx, tx, participantID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	before, err := snapshot(ctx, tx, "notification_preferences", "t.participant_id = $1 FOR UPDATE", participantID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var after []byte
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO notification_preferences AS t (participant_id, mode, last_post_id)
+		SELECT p.id, $2, COALESCE((SELECT max(po.id) FROM posts po WHERE po.event_id = p.event_id), 0)
+		FROM participants p WHERE p.id = $1
+		ON CONFLICT (participant_id) DO UPDATE SET
+			mode = EXCLUDED.mode,
+			last_post_id = CASE WHEN t.mode = 'off' THEN EXCLUDED.last_post_id ELSE t.last_post_id END,
+			updated_at = now()
+		RETURNING `+snapshotExpr,
+		participantID, mode,
+	).Scan(&after)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	action := auditUpdate
+	if before == nil {
+		action = auditCreate
+	}
+	err = writeAudit(ctx, tx, auditRecord{
+		EventID:  eventID,
+		Action:   action,
+		Entity:   entityPreference,
+		EntityID: participantID,
+		Before:   before,
+		After:    after,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// participantEvent возвращает событие участника или ErrParticipantNotFound
+func participantEvent(ctx context.Context, tx *txn, participantID int) (int, error) {
+	var eventID int
+	err := tx.QueryRowContext(ctx, "SELECT event_id FROM participants WHERE id = $1", participantID).Scan(&eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrParticipantNotFound
+	}
+	return eventID, err
+}
+
+// ClaimDigests забирает до limit участников, которым пора писать, и закрепляет их за вызывающим
+// на lease. Пора, если в событии есть новые посты, а с прошлого письма прошел час для hourly
+// или сутки для daily. Письмо, которое не удалось отправить, повторяется после lease.
+// В каждое письмо попадает до maxPosts первых новых постов
+func (s *Storage) ClaimDigests(ctx context.Context, limit int, lease time.Duration, maxPosts int) ([]models.Digest, error) {
+	const op = "storage.postgres.ClaimDigests"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		WITH due AS (
+			SELECT np.participant_id FROM notification_preferences np
+			JOIN participants p ON p.id = np.participant_id
+			WHERE np.mode <> 'off' AND p.email IS NOT NULL
+				AND (np.claimed_until IS NULL OR np.claimed_until < now())
+				AND (np.mode = 'immediate'
+					OR (np.mode = 'hourly' AND np.last_sent_at <= now() - interval '1 hour')
+					OR (np.mode = 'daily' AND np.last_sent_at <= now() - interval '1 day'))
+				AND EXISTS (SELECT 1 FROM posts po WHERE po.event_id = p.event_id AND po.id > np.last_post_id)
+			ORDER BY np.last_sent_at
+			LIMIT $1
+			FOR UPDATE OF np SKIP LOCKED
+		)
+		UPDATE notification_preferences np
+		SET claimed_until = now() + make_interval(secs => $2)
+		FROM due, participants p, events e
+		WHERE np.participant_id = due.participant_id AND p.id = np.participant_id AND e.id = p.event_id
+		RETURNING np.participant_id, p.name, p.email, e.id, e.name, np.mode, np.last_post_id`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var digests []models.Digest
+	for rows.Next() {
+		var d models.Digest
+		if err := rows.Scan(&d.ParticipantID, &d.Name, &d.Email, &d.EventID, &d.EventName, &d.Mode, &d.LastPostID); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		digests = append(digests, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(digests) == 0 {
+		return nil, nil
+	}
+
+	// курсоры участников одного события различаются, поэтому посты выбираются для каждого отдельно
+	ids := make([]int, len(digests))
+	events := make([]int, len(digests))
+	cursors := make([]int, len(digests))
+	byParticipant := make(map[int]*models.Digest, len(digests))
+	for i := range digests {
+		ids[i], events[i], cursors[i] = digests[i].ParticipantID, digests[i].EventID, digests[i].LastPostID
+		byParticipant[digests[i].ParticipantID] = &digests[i]
+	}
+	rows, err = tx.QueryContext(ctx, `
+		SELECT d.participant_id, po.id, po.event_id, po.type, po.content, po.created_at, po.total, po.last
+		FROM unnest($1::int[], $2::int[], $3::int[]) AS d(participant_id, event_id, last_post_id)
+		CROSS JOIN LATERAL (
+			SELECT id, event_id, type, content, created_at, count(*) OVER () AS total, max(id) OVER () AS last
+			FROM posts WHERE event_id = d.event_id AND id > d.last_post_id
+			ORDER BY id LIMIT $4
+		) po
+		ORDER BY d.participant_id, po.id`,
+		ids, events, cursors, maxPosts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var participantID, total, last int
+		var p models.Post
+		if err := rows.Scan(&participantID, &p.ID, &p.EventID, &p.Type, &p.Content, &p.CreatedAt, &total, &last); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		d := byParticipant[participantID]
+		d.Posts = append(d.Posts, p)
+		d.More = total - len(d.Posts)
+		d.LastPostID = last
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return digests, nil
+}
+
+// MarkDigestSent отмечает, что письмо участнику отправлено с постами до lastPostID включительно
+func (s *Storage) MarkDigestSent(ctx context.Context, participantID, lastPostID int) error {
+	const op = "storage.postgres.MarkDigestSent"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx, `
+		UPDATE notification_preferences
+		SET last_post_id = GREATEST(last_post_id, $2), last_sent_at = now(), claimed_until = NULL
+		WHERE participant_id = $1`,
+		participantID, lastPostID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const domainEventColumns = "d.id, d.type, COALESCE(d.enterprise_id, 0), COALESCE(d.event_id, 0), d.entity_id, d.payload, d.created_at"
+
+// domainEventsChannel - канал NOTIFY, которым транзакция сообщает всем серверам о своих доменных событиях
+const domainEventsChannel = "domain_events"
+
+// emit записывает доменное событие eventType о строке table с id = entityID мероприятия eventID.
+// Вызывается в транзакции самого изменения: подписчики узнают о нем, только если оно закоммичено.
+// Если мероприятия нет, возвращает ErrEventNotFound, а не теряет событие молча
+func emit(ctx context.Context, tx *txn, eventType string, eventID int, table string, entityID int) error {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO domain_events (type, enterprise_id, event_id, entity_id, payload)
+		SELECT $1, e.enterprise_id, e.id, $3, (SELECT `+snapshotExpr+` FROM `+table+` t WHERE t.id = $3)
+		FROM events e WHERE e.id = $2`,
+		eventType, eventID, entityID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrEventNotFound
+	}
+	return notifyDomainEvents(ctx, tx)
+}
+
+// notifyDomainEvents сообщает в domainEventsChannel номер текущей транзакции. Postgres доставит
+// уведомление только после коммита, а получатели прочитают события транзакции по номеру:
+// так сообщение не упирается в предел 8000 байт на NOTIFY, сколько бы событий ни записала транзакция.
+// Одинаковые уведомления одной транзакции Postgres склеивает в одно
+func notifyDomainEvents(ctx context.Context, tx *txn) error {
+	_, err := tx.ExecContext(ctx,
+		"SELECT pg_notify($1, json_build_object('txid', pg_current_xact_id()::text)::text)",
+		domainEventsChannel)
+	return err
+}
+
+// GetTxDomainEvents возвращает доменные события типов types, записанные транзакцией txid
+func (s *Storage) GetTxDomainEvents(ctx context.Context, txid string, types []string) ([]models.DomainEvent, error) {
+	const op = "storage.GetTxDomainEvents"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	events, err := s.domainEvents(ctx, "d.txid = $1::xid8 AND d.type = ANY($2) ORDER BY d.id", txid, types)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return events, nil
+}
+
+// GetDomainEventsSince возвращает до limit доменных событий типов types, записанных не раньше since
+func (s *Storage) GetDomainEventsSince(ctx context.Context, since time.Time, types []string, limit int) ([]models.DomainEvent, error) {
+	const op = "storage.GetDomainEventsSince"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	events, err := s.domainEvents(ctx, "d.created_at >= $1 AND d.type = ANY($2) ORDER BY d.id LIMIT $3", since, types, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return events, nil
+}
+
+func (s *Storage) domainEvents(ctx context.Context, where string, args ...any) ([]models.DomainEvent, error) {
+	rows, err := s.conn().QueryContext(ctx, "SELECT "+domainEventColumns+" FROM domain_events d WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.DomainEvent
+	for rows.Next() {
+		e, err := scanDomainEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// RegisterSubscriber создает курсор подписчика, если его еще нет. Новый подписчик
+// получает события, записанные после регистрации
+func (s *Storage) RegisterSubscriber(ctx context.Context, subscriber string) error {
+	const op = "storage.postgres.RegisterSubscriber"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx, `
+		INSERT INTO event_cursors (subscriber, last_txid, last_id)
+		SELECT $1, COALESCE(last.txid, '0'), COALESCE(last.id, 0)
+		FROM (SELECT 1) one LEFT JOIN (
+			SELECT txid, id FROM domain_events ORDER BY txid DESC, id DESC LIMIT 1
+		) last ON true
+		ON CONFLICT (subscriber) DO NOTHING`,
+		subscriber)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ClaimDomainEvents забирает до limit событий после курсора подписчика и закрепляет подписчика
+// за вызывающим на lease. Если подписчика уже обрабатывает другой сервер или новых событий нет,
+// возвращает пустой список
+func (s *Storage) ClaimDomainEvents(ctx context.Context, subscriber string, limit int, lease time.Duration) ([]models.DomainEvent, error) {
+	const op = "storage.postgres.ClaimDomainEvents"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var free bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT locked_until IS NULL OR locked_until < now() FROM event_cursors
+		WHERE subscriber = $1 FOR UPDATE SKIP LOCKED`,
+		subscriber,
+	).Scan(&free)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !free) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// транзакции старше xmin снимка завершены, более новые еще могут дописать события с меньшим id
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+domainEventColumns+` FROM domain_events d, event_cursors c
+		WHERE c.subscriber = $1 AND (d.txid, d.id) > (c.last_txid, c.last_id)
+			AND d.txid < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY d.txid, d.id
+		LIMIT $2`,
+		subscriber, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var events []models.DomainEvent
+	for rows.Next() {
+		e, err := scanDomainEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE event_cursors SET locked_until = now() + make_interval(secs => $2) WHERE subscriber = $1",
+		subscriber, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return events, nil
+}
+
+// AckDomainEvent сдвигает курсор подписчика на событие eventID и продлевает lease
+func (s *Storage) AckDomainEvent(ctx context.Context, subscriber string, eventID int64, lease time.Duration) error {
+	const op = "storage.postgres.AckDomainEvent"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx, `
+		UPDATE event_cursors c
+		SET last_txid = d.txid, last_id = d.id, locked_until = now() + make_interval(secs => $3), updated_at = now()
+		FROM domain_events d
+		WHERE c.subscriber = $1 AND d.id = $2`,
+		subscriber, eventID, lease.Seconds())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// DeadLetterDomainEvent сохраняет событие, которое подписчик не обработал за attempts попыток.
+// Повторная запись того же события ничего не меняет: подписчик мог упасть до ack
+func (s *Storage) DeadLetterDomainEvent(ctx context.Context, subscriber string, e models.DomainEvent, attempts int, reason string) error {
+	const op = "storage.postgres.DeadLetterDomainEvent"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx, `
+		INSERT INTO domain_event_dead_letters (subscriber, domain_event_id, type, enterprise_id, event_id, entity_id, payload, attempts, error)
+		VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, 0), $6, $7::jsonb, $8, $9)
+		ON CONFLICT (subscriber, domain_event_id) DO NOTHING`,
+		subscriber, e.ID, e.Type, e.EnterpriseID, e.EventID, e.EntityID, string(e.Payload), attempts, reason)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ReleaseSubscriber снимает lease, и подписчика может забрать любой сервер
+func (s *Storage) ReleaseSubscriber(ctx context.Context, subscriber string) error {
+	const op = "storage.postgres.ReleaseSubscriber"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx, "UPDATE event_cursors SET locked_until = NULL WHERE subscriber = $1", subscriber)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// PurgeDomainEvents удаляет события старше before, которые уже прошли все подписчики
+func (s *Storage) PurgeDomainEvents(ctx context.Context, before time.Time) (int, error) {
+	const op = "storage.postgres.PurgeDomainEvents"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn().ExecContext(ctx, `
+		DELETE FROM domain_events d
+		WHERE d.created_at < $1
+			AND NOT EXISTS (SELECT 1 FROM event_cursors c WHERE (c.last_txid, c.last_id) < (d.txid, d.id))`,
+		before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return int(n), nil
+}
+
+func scanDomainEvent(row interface{ Scan(dest ...any) error }) (models.DomainEvent, error) {
+	var e models.DomainEvent
+	var payload []byte
+	if err := row.Scan(&e.ID, &e.Type, &e.EnterpriseID, &e.EventID, &e.EntityID, &payload, &e.CreatedAt); err != nil {
+		return models.DomainEvent{}, err
+	}
+	e.Payload = payload
+	return e, nil
+}
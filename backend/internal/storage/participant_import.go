@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"REST_project/internal/audit"
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ParticipantIndex возвращает уже зарегистрированных участников события, действующие баны
+// и вместимость - по ним импорт проверяет строки до записи
+func (s *Storage) ParticipantIndex(ctx context.Context, eventID int) (models.ParticipantIndex, error) {
+	const op = "storage.ParticipantIndex"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	index := models.ParticipantIndex{
+		Emails:       make(map[string]bool),
+		Names:        make(map[string]bool),
+		BannedNames:  make(map[string]bool),
+		BannedEmails: make(map[string]bool),
+	}
+	found := false
+	err := s.batch(ctx,
+		batchQuery{
+			query: "SELECT COALESCE(capacity, 0), (SELECT count(*) FROM participants WHERE event_id = $1) FROM events WHERE id = $1",
+			args:  []any{eventID},
+			scan: func(rows rowScanner) error {
+				for rows.Next() {
+					found = true
+					if err := rows.Scan(&index.Capacity, &index.Registered); err != nil {
+						return err
+					}
+				}
+				return rows.Err()
+			},
+		},
+		batchQuery{
+			query: "SELECT name, COALESCE(email, '') FROM participants WHERE event_id = $1",
+			args:  []any{eventID},
+			scan: func(rows rowScanner) error {
+				for rows.Next() {
+					var name, email string
+					if err := rows.Scan(&name, &email); err != nil {
+						return err
+					}
+					if email != "" {
+						index.Emails[strings.ToLower(email)] = true
+					} else {
+						index.Names[strings.ToLower(name)] = true
+					}
+				}
+				return rows.Err()
+			},
+		},
+		batchQuery{
+			query: `
+				SELECT ps.participant_name, COALESCE(p.email, '')
+				FROM participant_sanctions ps LEFT JOIN participants p ON p.id = ps.participant_id
+				WHERE ps.event_id = $1 AND ps.kind = 'ban' AND ` + activeSanctionCond,
+			args: []any{eventID},
+			scan: func(rows rowScanner) error {
+				for rows.Next() {
+					var name, email string
+					if err := rows.Scan(&name, &email); err != nil {
+						return err
+					}
+					// как banMatchCond: бан действует и по имени, и по email
+					index.BannedNames[strings.ToLower(name)] = true
+					if email != "" {
+						index.BannedEmails[strings.ToLower(email)] = true
+					}
+				}
+				return rows.Err()
+			},
+		},
+	)
+	if err != nil {
+		return models.ParticipantIndex{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !found {
+		return models.ParticipantIndex{}, fmt.Errorf("%s: %w", op, ErrEventNotFound)
+	}
+	return index, nil
+}
+
+// ImportParticipants массово регистрирует участников события через COPY. Участники читаются
+// из participants по одному, поэтому весь список в памяти не нужен; ошибка источника отменяет импорт.
+// Строки копируются во временную таблицу, а оттуда одним запросом переносятся в participants
+// вместе с записями аудита. Забаненные в событии пропускаются. Возвращает число зарегистрированных
+func (s *Storage) ImportParticipants(ctx context.Context, eventID int, participants iter.Seq2[models.Participant, error]) (int, error) {
+	const op = "storage.postgres.ImportParticipants"
+	// без таймаута запроса: COPY длится, пока читается источник, а его ограничивает контекст вызывающего
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var capacity sql.NullInt64
+	err = tx.QueryRowContext(ctx, "SELECT capacity FROM events WHERE id = $1 FOR UPDATE", eventID).Scan(&capacity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, ErrEventNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var imported int
+	err = tx.pgx(func(conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "CREATE TEMP TABLE participants_import (n INTEGER, name TEXT, email TEXT) ON COMMIT DROP")
+		if err != nil {
+			return err
+		}
+		defer conn.Exec(context.WithoutCancel(ctx), "DROP TABLE IF EXISTS participants_import")
+
+		next, stop := iter.Pull2(participants)
+		defer stop()
+		n := 0
+		_, err = conn.CopyFrom(ctx,
+			pgx.Identifier{"participants_import"},
+			[]string{"n", "name", "email"},
+			pgx.CopyFromFunc(func() ([]any, error) {
+				p, err, ok := next()
+				if !ok {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				n++
+				return []any{n, p.Name, p.Email}, nil
+			}),
+		)
+		if err != nil {
+			return err
+		}
+
+		meta := audit.MetaFrom(ctx)
+		tag, err := conn.Exec(ctx, `
+			WITH imported AS (
+				INSERT INTO participants AS t (event_id, name, email)
+				SELECT $1, i.name, NULLIF(i.email, '')
+				FROM participants_import i
+				WHERE NOT EXISTS (
+					SELECT 1 FROM participant_sanctions ps LEFT JOIN participants p ON p.id = ps.participant_id
+					WHERE ps.event_id = $1 AND ps.kind = 'ban' AND `+activeSanctionCond+`
+						AND `+banMatchCond("i.name", "i.email")+`
+				)
+				ORDER BY i.n
+				RETURNING t.*
+			),
+			-- доменные события пишутся в той же транзакции, что и участники
+			emitted AS (
+				INSERT INTO domain_events (type, enterprise_id, event_id, entity_id, payload)
+				SELECT $7, e.enterprise_id, e.id, t.id, `+snapshotExpr+`
+				FROM imported t JOIN events e ON e.id = t.event_id
+			)
+			INSERT INTO audit_log (enterprise_id, event_id, actor, action, entity, entity_id, after, request_id, ip)
+			SELECT (SELECT enterprise_id FROM events WHERE id = $1), $1, $2, $3, $4, t.id, `+snapshotExpr+`, NULLIF($5, ''), NULLIF($6, '')
+			FROM imported t`,
+			eventID, meta.Actor, auditCreate, entityParticipant, meta.RequestID, meta.IP, models.ParticipantRegistered,
+		)
+		imported = int(tag.RowsAffected())
+		return err
+	})
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("%s: %w", op, ErrEmailTaken)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if capacity.Valid {
+		var registered int64
+		err = tx.QueryRowContext(ctx, "SELECT count(*) FROM participants WHERE event_id = $1", eventID).Scan(&registered)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if registered > capacity.Int64 {
+			return 0, fmt.Errorf("%s: %w", op, ErrEventFull)
+		}
+	}
+	if imported > 0 {
+		if err = notifyDomainEvents(ctx, tx); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return imported, nil
+}
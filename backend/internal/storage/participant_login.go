@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ParticipantByEmail находит участника события по email
+func (s *Storage) ParticipantByEmail(ctx context.Context, eventID int, email string) (models.Participant, error) {
+	const op = "storage.ParticipantByEmail"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var p models.Participant
+	err := s.conn().QueryRowContext(ctx,
+		"SELECT id, event_id, name, email FROM participants WHERE event_id = $1 AND lower(email) = lower($2)",
+		eventID, email,
+	).Scan(&p.ID, &p.EventID, &p.Name, &p.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, ErrParticipantNotFound)
+	}
+	if err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return p, nil
+}
+
+// CreateLoginToken сохраняет хеш одноразового токена для входа по ссылке
+func (s *Storage) CreateLoginToken(ctx context.Context, participantID int, tokenHash string, expiresAt time.Time) error {
+	const op = "storage.postgres.CreateLoginToken"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx,
+		"INSERT INTO participant_login_tokens (participant_id, token_hash, expires_at) VALUES ($1, $2, $3);",
+		participantID, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// LoginParticipant погашает токен из письма и в той же транзакции открывает сессию участника
+func (s *Storage) LoginParticipant(ctx context.Context, tokenHash, sessionHash string, expiresAt time.Time) (models.Participant, error) {
+	const op = "storage.postgres.LoginParticipant"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var p models.Participant
+	err = tx.QueryRowContext(ctx, `
+		WITH used AS (
+			UPDATE participant_login_tokens SET used_at = now()
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+			RETURNING participant_id
+		)
+		SELECT p.id, p.event_id, p.name, COALESCE(p.email, '')
+		FROM used JOIN participants p ON p.id = used.participant_id`, tokenHash,
+	).Scan(&p.ID, &p.EventID, &p.Name, &p.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, ErrTokenInvalid)
+	}
+	if err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO participant_sessions (participant_id, token_hash, expires_at) VALUES ($1, $2, $3);",
+		p.ID, sessionHash, expiresAt,
+	)
+	if err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return p, nil
+}
+
+// ParticipantBySession находит участника по действующей сессии
+func (s *Storage) ParticipantBySession(ctx context.Context, tokenHash string) (models.Participant, error) {
+	const op = "storage.ParticipantBySession"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var p models.Participant
+	err := s.conn().QueryRowContext(ctx, `
+		SELECT p.id, p.event_id, p.name, COALESCE(p.email, '')
+		FROM participant_sessions ss JOIN participants p ON p.id = ss.participant_id
+		WHERE ss.token_hash = $1 AND ss.revoked_at IS NULL AND ss.expires_at > now()`, tokenHash,
+	).Scan(&p.ID, &p.EventID, &p.Name, &p.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, ErrParticipantNotFound)
+	}
+	if err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return p, nil
+}
+
+func (s *Storage) RevokeParticipantSession(ctx context.Context, tokenHash string) error {
+	const op = "storage.postgres.RevokeParticipantSession"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn().ExecContext(ctx,
+		"UPDATE participant_sessions SET revoked_at = now() WHERE token_hash = $1 AND revoked_at IS NULL;",
+		tokenHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrSessionNotFound)
+	}
+	return nil
+}
+
+// RegisterParticipant регистрирует участника и сразу открывает ему сессию: без email
+// это единственный способ войти. Вместимость проверяется в той же транзакции, иначе
+// параллельные регистрации могут ее превысить
+func (s *Storage) RegisterParticipant(ctx context.Context, eventID int, name, email, sessionHash string, expiresAt time.Time) (models.Participant, error) {
+	const op = "storage.postgres.RegisterParticipant"
+
+	p := models.Participant{EventID: eventID, Name: name, Email: email}
+	err := s.WithTx(ctx, func(tx Repo) error {
+		if err := tx.CheckCapacity(ctx, eventID); err != nil {
+			return err
+		}
+		id, err := tx.ParticipantRegister(ctx, eventID, name, email)
+		if err != nil {
+			return err
+		}
+		p.ID = id
+		return tx.createParticipantSession(ctx, id, sessionHash, expiresAt)
+	})
+	if err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return p, nil
+}
+
+// OpenParticipantSession открывает сессию участнику события по решению организатора:
+// так входят участники без email, зарегистрированные до появления сессий.
+// В журнал аудита попадает вход участника, сама сессия - нет
+func (s *Storage) OpenParticipantSession(ctx context.Context, eventID, participantID int, sessionHash string, expiresAt time.Time) (models.Participant, error) {
+	const op = "storage.postgres.OpenParticipantSession"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var p models.Participant
+	err = tx.QueryRowContext(ctx,
+		"SELECT id, event_id, name, COALESCE(email, '') FROM participants WHERE id = $1 AND event_id = $2",
+		participantID, eventID,
+	).Scan(&p.ID, &p.EventID, &p.Name, &p.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, ErrParticipantNotFound)
+	}
+	if err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO participant_sessions (participant_id, token_hash, expires_at) VALUES ($1, $2, $3);",
+		p.ID, sessionHash, expiresAt,
+	)
+	if err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = writeAudit(ctx, tx, auditRecord{EventID: eventID, Action: auditLogin, Entity: entityParticipant, EntityID: p.ID})
+	if err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Participant{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return p, nil
+}
+
+func (s *Storage) createParticipantSession(ctx context.Context, participantID int, sessionHash string, expiresAt time.Time) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx,
+		"INSERT INTO participant_sessions (participant_id, token_hash, expires_at) VALUES ($1, $2, $3);",
+		participantID, sessionHash, expiresAt,
+	)
+	return err
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// CreatePoll создает пост-опрос вместе с вариантами ответа. notify - как в CreatePost
+func (s *Storage) CreatePoll(ctx context.Context, content string, eventID int, poll models.Poll, notify bool) (int, error) {
+	const op = "storage.postgres.CreatePoll"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO posts (content, event_id, type, notify) VALUES ($1, $2, $3, $4) RETURNING id;",
+		content, eventID, models.PostTypePoll, notify,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO polls (post_id, multi_choice, anonymous, closes_at) VALUES ($1, $2, $3, $4);",
+		id, poll.MultiChoice, poll.Anonymous, poll.ClosesAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i, o := range poll.Options {
+		_, err = tx.ExecContext(ctx, "INSERT INTO poll_options (poll_id, content, position) VALUES ($1, $2, $3);", id, o.Content, i)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = auditCreated(ctx, tx, "posts", auditRecord{EventID: eventID, Entity: entityPoll, EntityID: id})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err = emit(ctx, tx, models.PostCreated, eventID, "posts", id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// Vote записывает бюллетень участника. Повторное голосование отсекается
+// ограничением уникальности (poll_id, participant_id)
+func (s *Storage) Vote(ctx context.Context, postID, participantID int, optionIDs []int) error {
+	const op = "storage.postgres.Vote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var multiChoice, closed bool
+	var eventID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT p.multi_choice, p.closes_at IS NOT NULL AND p.closes_at <= now(), po.event_id
+		FROM polls p JOIN posts po ON po.id = p.post_id
+		WHERE p.post_id = $1`, postID,
+	).Scan(&multiChoice, &closed, &eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, ErrPollNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if closed {
+		return fmt.Errorf("%s: %w", op, ErrPollClosed)
+	}
+
+	var participantEvent int
+	err = tx.QueryRowContext(ctx, "SELECT event_id FROM participants WHERE id = $1", participantID).Scan(&participantEvent)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && participantEvent != eventID) {
+		return fmt.Errorf("%s: %w", op, ErrParticipantNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	optionIDs = slices.Compact(slices.Sorted(slices.Values(optionIDs)))
+	if len(optionIDs) == 0 || (!multiChoice && len(optionIDs) > 1) {
+		return fmt.Errorf("%s: %w", op, ErrInvalidVote)
+	}
+
+	var ballotID int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO poll_ballots (poll_id, participant_id) VALUES ($1, $2) RETURNING id;",
+		postID, participantID,
+	).Scan(&ballotID)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%s: %w", op, ErrAlreadyVoted)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, optionID := range optionIDs {
+		_, err = tx.ExecContext(ctx, "INSERT INTO poll_choices (ballot_id, option_id, poll_id) VALUES ($1, $2, $3);", ballotID, optionID, postID)
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidVote)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = auditCreated(ctx, tx, "poll_ballots", auditRecord{EventID: eventID, Entity: entityBallot, EntityID: ballotID})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// GetPoll возвращает опрос с текущими результатами
+func (s *Storage) GetPoll(ctx context.Context, postID int) (*models.Poll, error) {
+	const op = "storage.GetPoll"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	polls, err := s.polls(ctx, "WHERE p.post_id = $1", postID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	poll, ok := polls[postID]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, ErrPollNotFound)
+	}
+	return poll, nil
+}
+
+// polls возвращает опросы, подходящие под условие where (по алиасу p таблицы polls),
+// вместе с результатами, сгруппированные по id поста
+func (s *Storage) polls(ctx context.Context, where string, args ...any) (map[int]*models.Poll, error) {
+	l := newPollLoader()
+	if err := s.batch(ctx, l.queries(where, args...)...); err != nil {
+		return nil, err
+	}
+	return l.polls, nil
+}
+
+// pollLoader собирает опросы с результатами из трех запросов, которые уходят одним пакетом,
+// в том числе вместе с другими запросами ленты
+type pollLoader struct {
+	polls       map[int]*models.Poll
+	optionIndex map[int]*models.PollOption
+}
+
+func newPollLoader() *pollLoader {
+	return &pollLoader{
+		polls:       make(map[int]*models.Poll),
+		optionIndex: make(map[int]*models.PollOption),
+	}
+}
+
+// queries возвращает запросы опросов, вариантов и голосов. Выполнять их нужно в этом порядке
+func (l *pollLoader) queries(where string, args ...any) []batchQuery {
+	cond := "WHERE"
+	if where != "" {
+		cond = where + " AND"
+	}
+	return []batchQuery{
+		{
+			query: `
+		SELECT p.post_id, p.multi_choice, p.anonymous, p.closes_at,
+			(SELECT COUNT(*) FROM poll_ballots b WHERE b.poll_id = p.post_id)
+		FROM polls p ` + where,
+			args: args,
+			scan: l.scanPolls,
+		},
+		{
+			query: `
+		SELECT o.poll_id, o.id, o.content, COUNT(c.ballot_id)
+		FROM poll_options o
+		JOIN polls p ON p.post_id = o.poll_id
+		LEFT JOIN poll_choices c ON c.option_id = o.id ` + where + `
+		GROUP BY o.id
+		ORDER BY o.poll_id, o.position`,
+			args: args,
+			scan: l.scanOptions,
+		},
+		{
+			query: `
+		SELECT c.option_id, b.participant_id
+		FROM poll_choices c
+		JOIN poll_ballots b ON b.id = c.ballot_id
+		JOIN polls p ON p.post_id = c.poll_id ` + cond + ` NOT p.anonymous
+		ORDER BY b.id`,
+			args: args,
+			scan: l.scanVoters,
+		},
+	}
+}
+
+func (l *pollLoader) scanPolls(rows rowScanner) error {
+	now := time.Now()
+	for rows.Next() {
+		var id int
+		var closesAt sql.NullTime
+		p := &models.Poll{Options: []models.PollOption{}}
+		if err := rows.Scan(&id, &p.MultiChoice, &p.Anonymous, &closesAt, &p.TotalVoters); err != nil {
+			return err
+		}
+		if closesAt.Valid {
+			p.ClosesAt = &closesAt.Time
+			p.Closed = !now.Before(closesAt.Time)
+		}
+		l.polls[id] = p
+	}
+	return rows.Err()
+}
+
+func (l *pollLoader) scanOptions(rows rowScanner) error {
+	for rows.Next() {
+		var pollID int
+		var o models.PollOption
+		if err := rows.Scan(&pollID, &o.ID, &o.Content, &o.Votes); err != nil {
+			return err
+		}
+		if p, ok := l.polls[pollID]; ok {
+			p.Options = append(p.Options, o)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, p := range l.polls {
+		for i := range p.Options {
+			l.optionIndex[p.Options[i].ID] = &p.Options[i]
+		}
+	}
+	return nil
+}
+
+func (l *pollLoader) scanVoters(rows rowScanner) error {
+	for rows.Next() {
+		var optionID, participantID int
+		if err := rows.Scan(&optionID, &participantID); err != nil {
+			return err
+		}
+		if o, ok := l.optionIndex[optionID]; ok {
+			o.Voters = append(o.Voters, participantID)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const pushSubscriptionColumns = "id, participant_id, endpoint, p256dh, auth, expires_at, created_at"
+
+// pushBodyLen - сколько символов поста попадает в уведомление. Зашифрованное сообщение
+// не должно превышать 4096 байт, остальное участник прочитает на сайте
+const pushBodyLen = 500
+
+// SavePushSubscription сохраняет подписку браузера участника. Браузер, который подписывается
+// заново, например после входа другого участника, перезаписывает свою прежнюю подписку
+func (s *Storage) SavePushSubscription(ctx context.Context, sub models.PushSubscription) (models.PushSubscription, error) {
+	const op = "storage.postgres.SavePushSubscription"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return models.PushSubscription{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	eventID, err := participantEvent(ctx, tx, sub.ParticipantID)
+	if err != nil {
+		return models.PushSubscription{}, fmt.Errorf("%s: %w", op, err)
+	}
+	before, err := snapshot(ctx, tx, "push_subscriptions", "t.endpoint = $1 FOR UPDATE", sub.Endpoint)
+	if err != nil {
+		return models.PushSubscription{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	saved, err := scanPushSubscription(tx.QueryRowContext(ctx, `
+		INSERT INTO push_subscriptions (participant_id, endpoint, p256dh, auth, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (endpoint) DO UPDATE SET
+			participant_id = EXCLUDED.participant_id,
+			p256dh = EXCLUDED.p256dh,
+			auth = EXCLUDED.auth,
+			expires_at = EXCLUDED.expires_at
+		RETURNING `+pushSubscriptionColumns,
+		sub.ParticipantID, sub.Endpoint, sub.P256DH, sub.Auth, sub.ExpiresAt,
+	))
+	if isForeignKeyViolation(err) {
+		return models.PushSubscription{}, fmt.Errorf("%s: %w", op, ErrParticipantNotFound)
+	}
+	if err != nil {
+		return models.PushSubscription{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rec := auditRecord{EventID: eventID, Entity: entityPush, EntityID: saved.ID, Before: before}
+	if before == nil {
+		err = auditCreated(ctx, tx, "push_subscriptions", rec)
+	} else {
+		err = auditUpdated(ctx, tx, "push_subscriptions", rec)
+	}
+	if err != nil {
+		return models.PushSubscription{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.PushSubscription{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return saved, nil
+}
+
+// GetPushSubscriptions возвращает подписки участника
+func (s *Storage) GetPushSubscriptions(ctx context.Context, participantID int) ([]models.PushSubscription, error) {
+	const op = "storage.GetPushSubscriptions"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx,
+		"SELECT "+pushSubscriptionColumns+" FROM push_subscriptions WHERE participant_id = $1 ORDER BY id",
+		participantID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	subs := []models.PushSubscription{}
+	for rows.Next() {
+		sub, err := scanPushSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		subs = append(subs, sub)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return subs, nil
+}
+
+// DeletePushSubscription удаляет подписку участника вместе с неотправленными уведомлениями
+func (s *Storage) DeletePushSubscription(ctx context.Context, participantID, subscriptionID int) error {
+	const op = "storage.postgres.DeletePushSubscription"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err := s.deletePushSubscription(ctx,
+		"DELETE FROM push_subscriptions t WHERE id = $1 AND participant_id = $2", subscriptionID, participantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, ErrEndpointNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ExpirePushSubscription удаляет подписку, от которой отказался push-сервис
+func (s *Storage) ExpirePushSubscription(ctx context.Context, subscriptionID int) error {
+	const op = "storage.postgres.ExpirePushSubscription"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err := s.deletePushSubscription(ctx, "DELETE FROM push_subscriptions t WHERE id = $1", subscriptionID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// deletePushSubscription выполняет query с RETURNING снимка удаленной подписки и записывает
+// удаление в аудит. Если подписки нет, возвращает sql.ErrNoRows
+func (s *Storage) deletePushSubscription(ctx context.Context, query string, args ...any) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id, eventID int
+	var before []byte
+	err = tx.QueryRowContext(ctx, `
+		WITH d AS (`+query+` RETURNING t.id, t.participant_id, `+snapshotExpr+` AS snapshot)
+		SELECT d.id, p.event_id, d.snapshot FROM d JOIN participants p ON p.id = d.participant_id`,
+		args...,
+	).Scan(&id, &eventID, &before)
+	if err != nil {
+		return err
+	}
+
+	err = writeAudit(ctx, tx, auditRecord{
+		EventID:  eventID,
+		Action:   auditDelete,
+		Entity:   entityPush,
+		EntityID: id,
+		Before:   before,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// EnqueuePushes ставит уведомления о посте с флагом notify всем подпискам участников его события.
+// Это подписчик outbox: при повторной обработке события уведомления не дублируются
+func (s *Storage) EnqueuePushes(ctx context.Context, e models.DomainEvent) error {
+	const op = "storage.postgres.EnqueuePushes"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx, `
+		INSERT INTO push_deliveries (subscription_id, domain_event_id, payload)
+		SELECT ps.id, $1, jsonb_build_object(
+			'type', $2::text,
+			'event_id', ev.id,
+			'event_name', ev.name,
+			'post_id', ($4::jsonb->>'id')::integer,
+			'body', left($4::jsonb->>'content', $5))
+		FROM push_subscriptions ps
+		JOIN participants p ON p.id = ps.participant_id
+		JOIN events ev ON ev.id = p.event_id
+		WHERE p.event_id = $3 AND COALESCE(($4::jsonb->>'notify')::boolean, false)
+			AND (ps.expires_at IS NULL OR ps.expires_at > now())
+		ON CONFLICT (subscription_id, domain_event_id) DO NOTHING`,
+		e.ID, e.Type, e.EventID, []byte(e.Payload), pushBodyLen,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ClaimPushDeliveries забирает до limit уведомлений, которым пора уходить, и откладывает их на lease,
+// чтобы их не забрал следующий проход или другой сервер
+func (s *Storage) ClaimPushDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.PushDelivery, error) {
+	const op = "storage.postgres.ClaimPushDeliveries"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, `
+		WITH due AS (
+			SELECT id FROM push_deliveries
+			WHERE next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE push_deliveries d SET next_attempt_at = now() + make_interval(secs => $2)
+		FROM due, push_subscriptions ps
+		WHERE d.id = due.id AND ps.id = d.subscription_id
+		RETURNING d.id, d.subscription_id, ps.endpoint, ps.p256dh, ps.auth, d.payload, d.attempts, d.created_at`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.PushDelivery
+	for rows.Next() {
+		var d models.PushDelivery
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.Endpoint, &d.P256DH, &d.Auth, &payload, &d.Attempts, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return deliveries, nil
+}
+
+// FinishPushDelivery записывает итог попытки: без retryAt уведомление удаляется,
+// иначе повторяется в retryAt
+func (s *Storage) FinishPushDelivery(ctx context.Context, deliveryID int64, retryAt time.Time) error {
+	const op = "storage.postgres.FinishPushDelivery"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var err error
+	if retryAt.IsZero() {
+		_, err = s.conn().ExecContext(ctx, "DELETE FROM push_deliveries WHERE id = $1", deliveryID)
+	} else {
+		_, err = s.conn().ExecContext(ctx,
+			"UPDATE push_deliveries SET attempts = attempts + 1, next_attempt_at = $2 WHERE id = $1",
+			deliveryID, retryAt)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// PurgePush удаляет уведомления, созданные раньше before, и подписки с истекшим сроком
+func (s *Storage) PurgePush(ctx context.Context, before time.Time) (int, error) {
+	const op = "storage.postgres.PurgePush"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var n int
+	err := s.conn().QueryRowContext(ctx, `
+		WITH deliveries AS (
+			DELETE FROM push_deliveries WHERE created_at < $1 RETURNING 1
+		), subscriptions AS (
+			DELETE FROM push_subscriptions WHERE expires_at < now() RETURNING 1
+		)
+		SELECT (SELECT count(*) FROM deliveries) + (SELECT count(*) FROM subscriptions)`,
+		before,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
+
+func scanPushSubscription(row interface{ Scan(dest ...any) error }) (models.PushSubscription, error) {
+	var sub models.PushSubscription
+	var expiresAt sql.NullTime
+	err := row.Scan(&sub.ID, &sub.ParticipantID, &sub.Endpoint, &sub.P256DH, &sub.Auth, &expiresAt, &sub.CreatedAt)
+	if err != nil {
+		return models.PushSubscription{}, err
+	}
+	if expiresAt.Valid {
+		sub.ExpiresAt = &expiresAt.Time
+	}
+	return sub, nil
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// CreateQuestion создает вопрос от участника, зарегистрированного на событие
+func (s *Storage) CreateQuestion(ctx context.Context, eventID, participantID int, content string, anonymous bool) (int, error) {
+	const op = "storage.postgres.CreateQuestion"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO questions (event_id, participant_id, content, anonymous)
+		SELECT $1, $2, $3, $4
+		WHERE EXISTS (SELECT 1 FROM participants WHERE id = $2 AND event_id = $1)
+		RETURNING id;`,
+		eventID, participantID, content, anonymous,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, ErrParticipantNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditCreated(ctx, tx, "questions", auditRecord{EventID: eventID, Entity: entityQuestion, EntityID: id})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err = emit(ctx, tx, models.QuestionCreated, eventID, "questions", id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// UpvoteQuestion добавляет голос участника за вопрос. Повторный голос
+// отсекается первичным ключом (question_id, participant_id)
+func (s *Storage) UpvoteQuestion(ctx context.Context, eventID, questionID, participantID int) error {
+	const op = "storage.postgres.UpvoteQuestion"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := s.checkQuestionVoter(ctx, eventID, questionID, participantID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO question_votes (question_id, participant_id) VALUES ($1, $2);", questionID, participantID)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%s: %w", op, ErrAlreadyVoted)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = auditQuestionVote(ctx, tx, auditCreate, eventID, questionID, participantID, nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RemoveQuestionVote отзывает голос участника за вопрос
+func (s *Storage) RemoveQuestionVote(ctx context.Context, eventID, questionID, participantID int) error {
+	const op = "storage.postgres.RemoveQuestionVote"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := s.checkQuestionVoter(ctx, eventID, questionID, participantID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var before []byte
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM question_votes t WHERE question_id = $1 AND participant_id = $2
+		RETURNING `+snapshotExpr, questionID, participantID,
+	).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = auditQuestionVote(ctx, tx, auditDelete, eventID, questionID, participantID, before); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// auditQuestionVote записывает изменение голоса за вопрос
+func auditQuestionVote(ctx context.Context, tx *txn, action string, eventID, questionID, participantID int, before []byte) error {
+	after, err := snapshot(ctx, tx, "question_votes", "t.question_id = $1 AND t.participant_id = $2", questionID, participantID)
+	if err != nil {
+		return err
+	}
+	return writeAudit(ctx, tx, auditRecord{
+		EventID:  eventID,
+		Action:   action,
+		Entity:   entityQuestionVote,
+		EntityID: questionID,
+		Before:   before,
+		After:    after,
+	})
+}
+
+// checkQuestionVoter проверяет, что вопрос открыт и относится к событию,
+// а участник зарегистрирован на это же событие
+func (s *Storage) checkQuestionVoter(ctx context.Context, eventID, questionID, participantID int) error {
+	var status string
+	err := s.conn().QueryRowContext(ctx, "SELECT status FROM questions WHERE id = $1 AND event_id = $2", questionID, eventID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && status == models.QuestionHidden) {
+		return ErrQuestionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	err = s.conn().QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM participants WHERE id = $1 AND event_id = $2)", participantID, eventID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrParticipantNotFound
+	}
+	return nil
+}
+
+// SetQuestionStatus меняет статус вопроса (модератор отмечает вопрос отвеченным или скрывает его)
+func (s *Storage) SetQuestionStatus(ctx context.Context, eventID, questionID int, status string) error {
+	const op = "storage.postgres.SetQuestionStatus"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(ctx, tx, "questions", "t.id = $1 AND t.event_id = $2 FOR UPDATE", questionID, eventID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, ErrQuestionNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE questions
+		SET status = $2,
+			answered_at = CASE WHEN $2 = 'answered' THEN COALESCE(answered_at, now()) END
+		WHERE id = $1;`,
+		questionID, status,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditUpdated(ctx, tx, "questions", auditRecord{EventID: eventID, Entity: entityQuestion, EntityID: questionID, Before: before})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// GetQuestions возвращает вопросы события. sort: "votes" или "recent".
+// Если includeHidden = false, скрытые модератором вопросы не возвращаются.
+// status фильтрует вопросы по статусу, пустая строка - без фильтра
+func (s *Storage) GetQuestions(ctx context.Context, eventID int, sort, status string, includeHidden bool) ([]models.Question, error) {
+	const op = "storage.GetQuestions"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	order := "votes DESC, q.created_at ASC"
+	if sort == "recent" {
+		order = "q.created_at DESC"
+	}
+
+	rows, err := s.conn().QueryContext(ctx, `
+		SELECT q.id, q.event_id, q.participant_id, p.name, q.content, q.anonymous, q.status,
+			(SELECT COUNT(*) FROM question_votes v WHERE v.question_id = q.id) AS votes,
+			q.created_at, q.answered_at
+		FROM questions q
+		JOIN participants p ON p.id = q.participant_id
+		WHERE q.event_id = $1
+			AND ($2 OR q.status <> 'hidden')
+			AND ($3 = '' OR q.status = $3)
+		ORDER BY `+order,
+		eventID, includeHidden, status,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	questions := []models.Question{}
+	for rows.Next() {
+		var q models.Question
+		var answeredAt sql.NullTime
+		if err := rows.Scan(&q.ID, &q.EventID, &q.ParticipantID, &q.ParticipantName, &q.Content, &q.Anonymous,
+			&q.Status, &q.Votes, &q.CreatedAt, &answeredAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if answeredAt.Valid {
+			q.AnsweredAt = &answeredAt.Time
+		}
+		questions = append(questions, q)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return questions, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// availableTokens - токены корзины rl на момент запроса: накопленные с прошлого раза, но не больше
+// burst ($3). Параллельный запрос мог записать updated_at позже now(), поэтому время не уходит в минус
+const availableTokens = "LEAST($3::float8, rl.tokens + GREATEST(EXTRACT(EPOCH FROM now() - rl.updated_at), 0) * $2::float8)"
+
+// TakeRateToken берет токен из корзины key, которая наполняется со скоростью rate токенов
+// в секунду до burst. Возвращает, сколько токенов осталось и получен ли токен.
+// Корзина общая для всех серверов: строка блокируется на время обновления
+func (s *Storage) TakeRateToken(ctx context.Context, key string, rate float64, burst int) (float64, bool, error) {
+	const op = "storage.postgres.TakeRateToken"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var tokens float64
+	err := s.conn().QueryRowContext(ctx, `
+		INSERT INTO rate_limits AS rl (key, tokens, updated_at, full_at)
+		VALUES ($1, $3::float8 - 1, now(), now() + make_interval(secs => 1 / $2::float8))
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = `+availableTokens+` - 1,
+			updated_at = GREATEST(rl.updated_at, now()),
+			full_at = GREATEST(rl.updated_at, now()) + make_interval(secs => ($3::float8 - `+availableTokens+` + 1) / $2::float8)
+		WHERE `+availableTokens+` >= 1
+		RETURNING tokens`,
+		key, rate, float64(burst),
+	).Scan(&tokens)
+	if err == nil {
+		return tokens, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// токенов нет: корзина не меняется, остаток нужен для Retry-After
+	err = s.conn().QueryRowContext(ctx,
+		"SELECT "+availableTokens+" FROM rate_limits rl WHERE key = $1",
+		key, rate, float64(burst),
+	).Scan(&tokens)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+	return tokens, false, nil
+}
+
+// PurgeRateBuckets удаляет корзины, которые уже наполнились: без строки корзина считается полной
+func (s *Storage) PurgeRateBuckets(ctx context.Context) (int, error) {
+	const op = "storage.postgres.PurgeRateBuckets"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn().ExecContext(ctx, "DELETE FROM rate_limits WHERE full_at <= now()")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return int(n), nil
+}
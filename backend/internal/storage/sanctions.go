@@ -0,0 +1,420 @@
+package storage
+
+import (
+	"REST_project/internal/audit"
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// activeSanctionCond - условие действующей санкции по алиасу ps таблицы participant_sanctions
+const activeSanctionCond = "ps.revoked_at IS NULL AND (ps.expires_at IS NULL OR ps.expires_at > now())"
+
+// Действия в журнале модерации
+const (
+	actionReport         = "report"
+	actionReportResolved = "report_resolved"
+	actionSanction       = "sanction"
+	actionSanctionRevoke = "sanction_revoked"
+)
+
+// CreateReport сохраняет жалобу участника на комментарий события
+func (s *Storage) CreateReport(ctx context.Context, eventID, commentID, reporterID int, reason string) (int, error) {
+	const op = "storage.postgres.CreateReport"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var commentExists, reporterExists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			EXISTS (SELECT 1 FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.id = $1 AND p.event_id = $3),
+			EXISTS (SELECT 1 FROM participants WHERE id = $2 AND event_id = $3)`,
+		commentID, reporterID, eventID,
+	).Scan(&commentExists, &reporterExists)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if !commentExists {
+		return 0, fmt.Errorf("%s: %w", op, ErrCommentNotFound)
+	}
+	if !reporterExists {
+		return 0, fmt.Errorf("%s: %w", op, ErrParticipantNotFound)
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO comment_reports (comment_id, reporter_id, reason) VALUES ($1, $2, $3) RETURNING id;",
+		commentID, reporterID, reason,
+	).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("%s: %w", op, ErrAlreadyReported)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = logModeration(ctx, tx, models.ModerationLogEntry{
+		EventID:       eventID,
+		Action:        actionReport,
+		ParticipantID: reporterID,
+		CommentID:     commentID,
+		ReportID:      id,
+		Details:       reason,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	err = auditCreated(ctx, tx, "comment_reports", auditRecord{EventID: eventID, Entity: entityReport, EntityID: id})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// GetReports возвращает жалобы на комментарии события. status - фильтр, пустая строка - все
+func (s *Storage) GetReports(ctx context.Context, eventID int, status string) ([]models.CommentReport, error) {
+	const op = "storage.GetReports"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, `
+		SELECT r.id, r.comment_id, r.reporter_id, r.reason, r.status, r.created_at, r.resolved_at, c.content
+		FROM comment_reports r
+		JOIN comments c ON c.id = r.comment_id
+		JOIN posts p ON p.id = c.post_id
+		WHERE p.event_id = $1 AND ($2 = '' OR r.status = $2)
+		ORDER BY r.created_at`, eventID, status)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	reports := []models.CommentReport{}
+	for rows.Next() {
+		var r models.CommentReport
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(&r.ID, &r.CommentID, &r.ReporterID, &r.Reason, &r.Status, &r.CreatedAt, &resolvedAt, &r.Comment); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if resolvedAt.Valid {
+			r.ResolvedAt = &resolvedAt.Time
+		}
+		reports = append(reports, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return reports, nil
+}
+
+// ResolveReport закрывает жалобу: resolved - меры приняты, dismissed - жалоба отклонена
+func (s *Storage) ResolveReport(ctx context.Context, eventID, reportID int, status string) error {
+	const op = "storage.postgres.ResolveReport"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(ctx, tx, "comment_reports", `t.id = $1 AND EXISTS (
+		SELECT 1 FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.id = t.comment_id AND p.event_id = $2) FOR UPDATE`,
+		reportID, eventID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var commentID int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE comment_reports r
+		SET status = $3, resolved_at = now()
+		FROM comments c, posts p
+		WHERE r.id = $1 AND c.id = r.comment_id AND p.id = c.post_id AND p.event_id = $2
+		RETURNING r.comment_id;`,
+		reportID, eventID, status,
+	).Scan(&commentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, ErrReportNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = logModeration(ctx, tx, models.ModerationLogEntry{
+		EventID:   eventID,
+		Action:    actionReportResolved,
+		CommentID: commentID,
+		ReportID:  reportID,
+		Details:   status,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	err = auditUpdated(ctx, tx, "comment_reports", auditRecord{EventID: eventID, Entity: entityReport, EntityID: reportID, Before: before})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// CreateSanction ограничивает участника события: mute запрещает комментировать,
+// ban дополнительно запрещает повторную регистрацию под тем же именем или email
+func (s *Storage) CreateSanction(ctx context.Context, sanction models.Sanction) (int, error) {
+	const op = "storage.postgres.CreateSanction"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// бан ждет регистраций, которые уже проверили баны, и наоборот (см. isBanned)
+	if sanction.Kind == models.SanctionBan {
+		if _, err = tx.ExecContext(ctx, "SELECT 1 FROM events WHERE id = $1 FOR NO KEY UPDATE", sanction.EventID); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO participant_sanctions (event_id, participant_id, participant_name, kind, reason, expires_at)
+		SELECT $1, p.id, p.name, $3, NULLIF($4, ''), $5
+		FROM participants p
+		WHERE p.id = $2 AND p.event_id = $1
+		RETURNING id;`,
+		sanction.EventID, sanction.ParticipantID, sanction.Kind, sanction.Reason, sanction.ExpiresAt,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, ErrParticipantNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	details := sanction.Kind
+	if sanction.ExpiresAt != nil {
+		details += " until " + sanction.ExpiresAt.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	if sanction.Reason != "" {
+		details += ": " + sanction.Reason
+	}
+	err = logModeration(ctx, tx, models.ModerationLogEntry{
+		EventID:       sanction.EventID,
+		Action:        actionSanction,
+		ParticipantID: sanction.ParticipantID,
+		SanctionID:    id,
+		Details:       details,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	err = auditCreated(ctx, tx, "participant_sanctions", auditRecord{EventID: sanction.EventID, Entity: entitySanction, EntityID: id})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// GetSanctions возвращает санкции события. activeOnly оставляет только действующие
+func (s *Storage) GetSanctions(ctx context.Context, eventID int, activeOnly bool) ([]models.Sanction, error) {
+	const op = "storage.GetSanctions"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, `
+		SELECT ps.id, ps.event_id, ps.participant_id, ps.participant_name, ps.kind, COALESCE(ps.reason, ''),
+			ps.expires_at, ps.created_at, ps.revoked_at
+		FROM participant_sanctions ps
+		WHERE ps.event_id = $1 AND (NOT $2 OR (`+activeSanctionCond+`))
+		ORDER BY ps.created_at DESC`, eventID, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	sanctions := []models.Sanction{}
+	for rows.Next() {
+		var sn models.Sanction
+		var expiresAt, revokedAt sql.NullTime
+		if err := rows.Scan(&sn.ID, &sn.EventID, &sn.ParticipantID, &sn.ParticipantName, &sn.Kind, &sn.Reason,
+			&expiresAt, &sn.CreatedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if expiresAt.Valid {
+			sn.ExpiresAt = &expiresAt.Time
+		}
+		if revokedAt.Valid {
+			sn.RevokedAt = &revokedAt.Time
+		}
+		sanctions = append(sanctions, sn)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sanctions, nil
+}
+
+// RevokeSanction досрочно снимает санкцию
+func (s *Storage) RevokeSanction(ctx context.Context, eventID, sanctionID int) error {
+	const op = "storage.postgres.RevokeSanction"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(ctx, tx, "participant_sanctions", "t.id = $1 AND t.event_id = $2 FOR UPDATE", sanctionID, eventID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var participantID int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE participant_sanctions SET revoked_at = now()
+		WHERE id = $1 AND event_id = $2 AND revoked_at IS NULL
+		RETURNING participant_id;`,
+		sanctionID, eventID,
+	).Scan(&participantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, ErrSanctionNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = logModeration(ctx, tx, models.ModerationLogEntry{
+		EventID:       eventID,
+		Action:        actionSanctionRevoke,
+		ParticipantID: participantID,
+		SanctionID:    sanctionID,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	err = auditUpdated(ctx, tx, "participant_sanctions", auditRecord{EventID: eventID, Entity: entitySanction, EntityID: sanctionID, Before: before})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// GetModerationLog возвращает журнал модерации события от новых записей к старым
+func (s *Storage) GetModerationLog(ctx context.Context, eventID, limit, offset int) ([]models.ModerationLogEntry, error) {
+	const op = "storage.GetModerationLog"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, `
+		SELECT id, event_id, action, COALESCE(participant_id, 0), COALESCE(comment_id, 0), COALESCE(report_id, 0),
+			COALESCE(sanction_id, 0), COALESCE(details, ''), actor, COALESCE(request_id, ''), COALESCE(ip, ''), created_at
+		FROM moderation_log
+		WHERE event_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3`, eventID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	entries := []models.ModerationLogEntry{}
+	for rows.Next() {
+		var e models.ModerationLogEntry
+		if err := rows.Scan(&e.ID, &e.EventID, &e.Action, &e.ParticipantID, &e.CommentID, &e.ReportID,
+			&e.SanctionID, &e.Details, &e.Actor, &e.RequestID, &e.IP, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
+
+// sanctionForPost возвращает вид действующей санкции участника в событии поста
+// (ban важнее mute) или пустую строку
+func (s *Storage) sanctionForPost(ctx context.Context, postID, participantID int) (string, error) {
+	var kind string
+	err := s.conn().QueryRowContext(ctx, `
+		SELECT ps.kind
+		FROM participant_sanctions ps JOIN posts p ON p.event_id = ps.event_id
+		WHERE p.id = $1 AND ps.participant_id = $2 AND `+activeSanctionCond+`
+		ORDER BY ps.kind = 'ban' DESC
+		LIMIT 1`, postID, participantID,
+	).Scan(&kind)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return kind, err
+}
+
+// banMatchCond - условие, что бан ps забаненного участника p распространяется на регистрацию
+// с именем name и email email (выражения SQL): совпадает имя или непустой email. Одного email
+// мало - без email или с новым адресом забаненный зарегистрировался бы снова.
+// p присоединяется через LEFT JOIN: имя хранится в санкции и после удаления участника
+func banMatchCond(name, email string) string {
+	return "(lower(ps.participant_name) = lower(" + name + ") OR (" + email + " <> '' AND lower(p.email) = lower(" + email + ")))"
+}
+
+// isBanned сообщает, распространяется ли действующий бан события на регистрацию с таким именем и email.
+// Вызывается в транзакции регистрации после блокировки события, которую берет и CreateSanction,
+// иначе бан, выданный между проверкой и вставкой, не заметить
+func isBanned(ctx context.Context, tx *txn, eventID int, name, email string) (bool, error) {
+	var banned bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM participant_sanctions ps LEFT JOIN participants p ON p.id = ps.participant_id
+			WHERE ps.event_id = $1 AND ps.kind = 'ban' AND `+activeSanctionCond+`
+				AND `+banMatchCond("$2::text", "$3::text")+`
+		)`, eventID, name, email,
+	).Scan(&banned)
+	return banned, err
+}
+
+// logModeration добавляет запись в журнал модерации. Автор действия берется из контекста
+func logModeration(ctx context.Context, tx *txn, e models.ModerationLogEntry) error {
+	meta := audit.MetaFrom(ctx)
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO moderation_log (event_id, action, participant_id, comment_id, report_id, sanction_id, details, actor, request_id, ip)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), NULLIF($5, 0), NULLIF($6, 0), NULLIF($7, ''), $8, NULLIF($9, ''), NULLIF($10, ''));`,
+		e.EventID, e.Action, e.ParticipantID, e.CommentID, e.ReportID, e.SanctionID, e.Details, meta.Actor, meta.RequestID, meta.IP,
+	)
+	return err
+}
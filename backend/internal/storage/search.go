@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Границы подсветки в ts_headline. Используем управляющие символы, чтобы
+// сначала экранировать текст, а уже потом превратить их в <mark>
+const (
+	markStart = "\x02"
+	markStop  = "\x03"
+)
+
+var headlineOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=30, MinWords=10, FragmentDelimiter=\" … \"", markStart, markStop)
+
+// Search ищет по постам и комментариям события с ранжированием и подсвеченными фрагментами
+func (s *Storage) Search(ctx context.Context, eventID int, p models.SearchParams) ([]models.SearchResult, error) {
+	const op = "storage.Search"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	// ts_headline дорогой, поэтому считаем его только для страницы результатов
+	rows, err := s.conn().QueryContext(ctx, `
+		WITH q AS (SELECT websearch_to_tsquery('russian', $2) AS query),
+		matches AS (
+			SELECT 'post' AS type, p.id, p.id AS post_id, p.content, p.created_at,
+				ts_rank(p.search_vector, q.query) AS rank
+			FROM posts p, q
+			WHERE p.event_id = $1 AND p.search_vector @@ q.query
+				AND $3 IN ('', 'post')
+				AND ($4::timestamptz IS NULL OR p.created_at >= $4)
+				AND ($5::timestamptz IS NULL OR p.created_at < $5)
+			UNION ALL
+			SELECT 'comment', c.id, c.post_id, c.content, c.created_at,
+				ts_rank(c.search_vector, q.query)
+			FROM comments c JOIN posts p ON p.id = c.post_id, q
+			WHERE p.event_id = $1 AND c.status = 'approved' AND c.search_vector @@ q.query
+				AND $3 IN ('', 'comment')
+				AND ($4::timestamptz IS NULL OR c.created_at >= $4)
+				AND ($5::timestamptz IS NULL OR c.created_at < $5)
+			ORDER BY rank DESC, created_at DESC
+			LIMIT $6 OFFSET $7
+		)
+		SELECT m.type, m.id, m.post_id, ts_headline('russian', m.content, q.query, $8), m.rank, m.created_at
+		FROM matches m, q
+		ORDER BY m.rank DESC, m.created_at DESC`,
+		eventID, p.Query, p.Type, p.From, p.To, p.Limit, p.Offset, headlineOptions,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var r models.SearchResult
+		if err := rows.Scan(&r.Type, &r.ID, &r.PostID, &r.Snippet, &r.Rank, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.Snippet = highlight(r.Snippet)
+		results = append(results, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return results, nil
+}
+
+// highlight экранирует фрагмент и заменяет границы подсветки на <mark>
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, markStart, "<mark>")
+	return strings.ReplaceAll(snippet, markStop, "</mark>")
+}
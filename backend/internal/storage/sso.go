@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"REST_project/internal/audit"
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CreateOIDCState сохраняет начатый вход и заодно удаляет просроченные
+func (s *Storage) CreateOIDCState(ctx context.Context, st models.OIDCState) error {
+	const op = "storage.postgres.CreateOIDCState"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.conn().ExecContext(ctx, "DELETE FROM oidc_states WHERE expires_at < now();"); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err := s.conn().ExecContext(ctx,
+		"INSERT INTO oidc_states (state, code_verifier, nonce, expires_at) VALUES ($1, $2, $3, $4);",
+		st.State, st.CodeVerifier, st.Nonce, st.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ConsumeOIDCState возвращает и удаляет незавершенный вход, так что state нельзя использовать повторно
+func (s *Storage) ConsumeOIDCState(ctx context.Context, state string) (models.OIDCState, error) {
+	const op = "storage.postgres.ConsumeOIDCState"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var st models.OIDCState
+	err := s.conn().QueryRowContext(ctx, `
+		DELETE FROM oidc_states WHERE state = $1 AND expires_at > now()
+		RETURNING state, code_verifier, nonce, expires_at`, state,
+	).Scan(&st.State, &st.CodeVerifier, &st.Nonce, &st.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.OIDCState{}, fmt.Errorf("%s: %w", op, ErrStateNotFound)
+	}
+	if err != nil {
+		return models.OIDCState{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return st, nil
+}
+
+// LoginOIDC находит или создает аккаунт для проверенной личности провайдера и
+// синхронизирует членства в предприятиях с группами из id_token. Аккаунт с тем же
+// email привязывается, только если email подтвердили и провайдер, и сам аккаунт:
+// email из /register/account никто не проверял, и привязка к нему отдала бы чужой
+// аккаунт тому, кто зарегистрировал его первым
+func (s *Storage) LoginOIDC(ctx context.Context, id models.OIDCIdentity) (int, error) {
+	const op = "storage.postgres.LoginOIDC"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var accountID int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE oidc_identities SET last_login_at = now()
+		WHERE issuer = $1 AND subject = $2
+		RETURNING account_id`, id.Issuer, id.Subject,
+	).Scan(&accountID)
+	if errors.Is(err, sql.ErrNoRows) {
+		accountID, err = linkOIDCIdentity(ctx, tx, id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// изменения при входе подписываются самим аккаунтом
+	ctx = audit.WithActor(ctx, audit.AccountActor(accountID))
+	if err = syncOIDCMemberships(ctx, tx, accountID, id.Groups); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return accountID, nil
+}
+
+func linkOIDCIdentity(ctx context.Context, tx *txn, id models.OIDCIdentity) (int, error) {
+	var accountID int
+	var verified bool
+	err := tx.QueryRowContext(ctx,
+		"SELECT id, email_verified FROM accounts WHERE lower(email) = lower($1)", id.Email,
+	).Scan(&accountID, &verified)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		name := id.Name
+		if name == "" {
+			name = id.Email
+		}
+		err = tx.QueryRowContext(ctx,
+			"INSERT INTO accounts (name, email, email_verified) VALUES ($1, $2, $3) RETURNING id;",
+			name, id.Email, id.EmailVerified,
+		).Scan(&accountID)
+		if err != nil {
+			return 0, err
+		}
+		err = auditCreated(audit.WithActor(ctx, audit.AccountActor(accountID)), tx, "accounts",
+			auditRecord{Entity: entityAccount, EntityID: accountID})
+		if err != nil {
+			return 0, err
+		}
+	case err != nil:
+		return 0, err
+	case !id.EmailVerified || !verified:
+		return 0, ErrEmailTaken
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO oidc_identities (issuer, subject, account_id, last_login_at) VALUES ($1, $2, $3, now());",
+		id.Issuer, id.Subject, accountID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return accountID, nil
+}
+
+// syncOIDCMemberships выдает аккаунту старшую из ролей, сопоставленных его группам,
+// и снимает членства из OIDC, для которых групп больше нет. Ручные членства не меняются,
+// последний владелец предприятия не понижается и не удаляется
+func syncOIDCMemberships(ctx context.Context, tx *txn, accountID int, groups []string) error {
+	before, err := snapshots(ctx, tx, "enterprise_members", "enterprise_id", "t.account_id = $1 FOR UPDATE", accountID)
+	if err != nil {
+		return err
+	}
+
+	upserted, err := snapshotRows(tx.QueryContext(ctx, `
+		WITH desired AS (
+			SELECT DISTINCT ON (enterprise_id) enterprise_id, role
+			FROM oidc_group_mappings
+			WHERE group_name = ANY($2)
+			ORDER BY enterprise_id, array_position(ARRAY['owner', 'admin', 'organizer', 'moderator', 'viewer'], role::text)
+		)
+		INSERT INTO enterprise_members AS t (enterprise_id, account_id, role, source)
+		SELECT enterprise_id, $1, role, 'oidc' FROM desired
+		ON CONFLICT (enterprise_id, account_id) DO UPDATE SET role = EXCLUDED.role
+		WHERE t.source = 'oidc' AND t.role <> EXCLUDED.role
+			AND (t.role <> 'owner'
+				OR (SELECT count(*) FROM enterprise_members o WHERE o.enterprise_id = t.enterprise_id AND o.role = 'owner') > 1)
+		RETURNING t.enterprise_id, `+snapshotExpr+`;`,
+		accountID, groups,
+	))
+	if err != nil {
+		return err
+	}
+
+	deleted, err := snapshotRows(tx.QueryContext(ctx, `
+		DELETE FROM enterprise_members t
+		WHERE t.account_id = $1 AND t.source = 'oidc'
+			AND t.enterprise_id NOT IN (SELECT enterprise_id FROM oidc_group_mappings WHERE group_name = ANY($2))
+			AND (t.role <> 'owner'
+				OR (SELECT count(*) FROM enterprise_members o WHERE o.enterprise_id = t.enterprise_id AND o.role = 'owner') > 1)
+		RETURNING t.enterprise_id, `+snapshotExpr+`;`,
+		accountID, groups,
+	))
+	if err != nil {
+		return err
+	}
+
+	for enterpriseID, after := range upserted {
+		action := auditUpdate
+		if before[enterpriseID] == nil {
+			action = auditCreate
+		}
+		err = writeAudit(ctx, tx, auditRecord{
+			EnterpriseID: enterpriseID,
+			Action:       action,
+			Entity:       entityMember,
+			EntityID:     accountID,
+			Before:       before[enterpriseID],
+			After:        after,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for enterpriseID := range deleted {
+		err = writeAudit(ctx, tx, auditRecord{
+			EnterpriseID: enterpriseID,
+			Action:       auditDelete,
+			Entity:       entityMember,
+			EntityID:     accountID,
+			Before:       before[enterpriseID],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) CreateSession(ctx context.Context, accountID int, tokenHash string, expiresAt time.Time) error {
+	const op = "storage.postgres.CreateSession"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx,
+		"INSERT INTO sessions (account_id, token_hash, expires_at) VALUES ($1, $2, $3);",
+		accountID, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// AccountBySession находит владельца действующей сессии
+func (s *Storage) AccountBySession(ctx context.Context, tokenHash string) (models.Account, error) {
+	const op = "storage.AccountBySession"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var a models.Account
+	err := s.conn().QueryRowContext(ctx, `
+		SELECT a.id, a.name, a.email, a.created_at
+		FROM sessions ss JOIN accounts a ON a.id = ss.account_id
+		WHERE ss.token_hash = $1 AND ss.revoked_at IS NULL AND ss.expires_at > now()`, tokenHash,
+	).Scan(&a.ID, &a.Name, &a.Email, &a.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Account{}, fmt.Errorf("%s: %w", op, ErrAccountNotFound)
+	}
+	if err != nil {
+		return models.Account{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return a, nil
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, tokenHash string) error {
+	const op = "storage.postgres.RevokeSession"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn().ExecContext(ctx, "UPDATE sessions SET revoked_at = now() WHERE token_hash = $1 AND revoked_at IS NULL;", tokenHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrSessionNotFound)
+	}
+	return nil
+}
+
+// GetGroupMappings возвращает сопоставления групп провайдера ролям предприятия
+func (s *Storage) GetGroupMappings(ctx context.Context, enterpriseID int) ([]models.GroupMapping, error) {
+	const op = "storage.GetGroupMappings"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx,
+		"SELECT id, enterprise_id, group_name, role, created_at FROM oidc_group_mappings WHERE enterprise_id = $1 ORDER BY id",
+		enterpriseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	mappings := []models.GroupMapping{}
+	for rows.Next() {
+		var m models.GroupMapping
+		if err := rows.Scan(&m.ID, &m.EnterpriseID, &m.Group, &m.Role, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		mappings = append(mappings, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return mappings, nil
+}
+
+func (s *Storage) CreateGroupMapping(ctx context.Context, enterpriseID int, group, role string) (int, error) {
+	const op = "storage.postgres.CreateGroupMapping"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO oidc_group_mappings (enterprise_id, group_name, role) VALUES ($1, $2, $3) RETURNING id;",
+		enterpriseID, group, role,
+	).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("%s: %w", op, ErrMappingExists)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditCreated(ctx, tx, "oidc_group_mappings", auditRecord{EnterpriseID: enterpriseID, Entity: entityGroupMapping, EntityID: id})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// GetGroupMapping нужен, чтобы проверить право управлять ролью перед удалением
+func (s *Storage) GetGroupMapping(ctx context.Context, enterpriseID, mappingID int) (models.GroupMapping, error) {
+	const op = "storage.GetGroupMapping"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var m models.GroupMapping
+	err := s.conn().QueryRowContext(ctx,
+		"SELECT id, enterprise_id, group_name, role, created_at FROM oidc_group_mappings WHERE id = $1 AND enterprise_id = $2",
+		mappingID, enterpriseID,
+	).Scan(&m.ID, &m.EnterpriseID, &m.Group, &m.Role, &m.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.GroupMapping{}, fmt.Errorf("%s: %w", op, ErrMappingNotFound)
+	}
+	if err != nil {
+		return models.GroupMapping{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return m, nil
+}
+
+func (s *Storage) DeleteGroupMapping(ctx context.Context, enterpriseID, mappingID int) error {
+	const op = "storage.postgres.DeleteGroupMapping"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var before []byte
+	err = tx.QueryRowContext(ctx,
+		"DELETE FROM oidc_group_mappings t WHERE id = $1 AND enterprise_id = $2 RETURNING "+snapshotExpr+";",
+		mappingID, enterpriseID,
+	).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, ErrMappingNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = writeAudit(ctx, tx, auditRecord{
+		EnterpriseID: enterpriseID,
+		Action:       auditDelete,
+		Entity:       entityGroupMapping,
+		EntityID:     mappingID,
+		Before:       before,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
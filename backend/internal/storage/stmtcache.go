@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// stmtCounter считает выражения в кэшах подготовленных выражений соединений пула. Сам кэш pgx
+// наружу не отдает, поэтому счетчик повторяет его по трассировке: выражение попадает в кэш
+// при подготовке через Prepare или в пакете, а сверх capacity кэш вытесняет старые,
+// так что размер не растет. Выражения, сброшенные после смены схемы, не вычитаются
+type stmtCounter struct {
+	capacity int
+	mu       sync.Mutex
+	conns    map[*pgx.Conn]map[string]struct{}
+}
+
+func newStmtCounter(capacity int) *stmtCounter {
+	return &stmtCounter{capacity: capacity, conns: make(map[*pgx.Conn]map[string]struct{})}
+}
+
+func (t *stmtCounter) add(conn *pgx.Conn, sql string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stmts := t.conns[conn]
+	if stmts == nil {
+		stmts = make(map[string]struct{})
+		t.conns[conn] = stmts
+	}
+	if len(stmts) < t.capacity {
+		stmts[sql] = struct{}{}
+	}
+}
+
+// forget вызывается перед закрытием соединения пулом
+func (t *stmtCounter) forget(conn *pgx.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, conn)
+}
+
+func (t *stmtCounter) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, stmts := range t.conns {
+		n += len(stmts)
+	}
+	return n
+}
+
+func (t *stmtCounter) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (t *stmtCounter) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// TracePrepareStart учитывает только выражения кэша, у них имя с префиксом stmtcache_
+func (t *stmtCounter) TracePrepareStart(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareStartData) context.Context {
+	if strings.HasPrefix(data.Name, "stmtcache_") {
+		t.add(conn, data.SQL)
+	}
+	return ctx
+}
+
+func (t *stmtCounter) TracePrepareEnd(context.Context, *pgx.Conn, pgx.TracePrepareEndData) {}
+
+func (t *stmtCounter) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	return ctx
+}
+
+// TraceBatchQuery учитывает запросы пакета: pgx готовит их через тот же кэш
+func (t *stmtCounter) TraceBatchQuery(_ context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if data.Err == nil {
+		t.add(conn, data.SQL)
+	}
+}
+
+func (t *stmtCounter) TraceBatchEnd(context.Context, *pgx.Conn, pgx.TraceBatchEndData) {}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestStmtCounter(t *testing.T) {
+	var tracer pgx.QueryTracer = newStmtCounter(2)
+	if _, ok := tracer.(pgx.PrepareTracer); !ok {
+		t.Fatal("stmtCounter does not trace Prepare")
+	}
+	if _, ok := tracer.(pgx.BatchTracer); !ok {
+		t.Fatal("stmtCounter does not trace batches")
+	}
+
+	ctx := context.Background()
+	a, b := &pgx.Conn{}, &pgx.Conn{}
+
+	tests := []struct {
+		name  string
+		step  func(c *stmtCounter)
+		count int
+	}{
+		{name: "cached statement", count: 1, step: func(c *stmtCounter) {
+			c.TracePrepareStart(ctx, a, pgx.TracePrepareStartData{Name: "stmtcache_1", SQL: "SELECT 1"})
+		}},
+		{name: "same statement again", count: 1, step: func(c *stmtCounter) {
+			c.TracePrepareStart(ctx, a, pgx.TracePrepareStartData{Name: "stmtcache_1", SQL: "SELECT 1"})
+		}},
+		{name: "named statement is not cached", count: 1, step: func(c *stmtCounter) {
+			c.TracePrepareStart(ctx, a, pgx.TracePrepareStartData{Name: "mine", SQL: "SELECT 2"})
+		}},
+		{name: "batch query", count: 2, step: func(c *stmtCounter) {
+			c.TraceBatchQuery(ctx, a, pgx.TraceBatchQueryData{SQL: "SELECT 3"})
+		}},
+		{name: "capacity reached", count: 2, step: func(c *stmtCounter) {
+			c.TraceBatchQuery(ctx, a, pgx.TraceBatchQueryData{SQL: "SELECT 4"})
+		}},
+		{name: "other connection", count: 3, step: func(c *stmtCounter) {
+			c.TracePrepareStart(ctx, b, pgx.TracePrepareStartData{Name: "stmtcache_1", SQL: "SELECT 1"})
+		}},
+		{name: "closed connection", count: 1, step: func(c *stmtCounter) {
+			c.forget(a)
+		}},
+	}
+
+	c := tracer.(*stmtCounter)
+	for _, tt := range tests {
+		tt.step(c)
+		if got := c.count(); got != tt.count {
+			t.Fatalf("%s: count = %d, want %d", tt.name, got, tt.count)
+		}
+	}
+}
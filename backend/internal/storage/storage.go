@@ -2,47 +2,173 @@ package storage
 
 import (
 	cfg "REST_project/config"
-	"database/sql"
 	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
+	pgxmigrate "github.com/golang-migrate/migrate/v4/database/pgx/v5"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"time"
 )
 
 const (
-	migrationPath = "file://migrations" 
+	migrationPath = "file://migrations"
+)
+
+var (
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrParticipantNotFound = errors.New("participant not found")
+	ErrPollNotFound        = errors.New("poll not found")
+	ErrPollClosed          = errors.New("poll is closed")
+	ErrAlreadyVoted        = errors.New("participant has already voted")
+	ErrInvalidVote         = errors.New("invalid vote")
+	ErrQuestionNotFound    = errors.New("question not found")
+	ErrPostNotFound        = errors.New("post not found")
+	ErrEventNotFound       = errors.New("event not found")
+	ErrCommentNotFound     = errors.New("comment not found")
+	ErrRuleNotFound        = errors.New("moderation rule not found")
+	ErrReportNotFound      = errors.New("report not found")
+	ErrAlreadyReported     = errors.New("comment has already been reported by participant")
+	ErrSanctionNotFound    = errors.New("sanction not found")
+	ErrParticipantMuted    = errors.New("participant is muted")
+	ErrParticipantBanned   = errors.New("participant is banned")
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrEmailTaken          = errors.New("email is already registered")
+	ErrKeyNotFound         = errors.New("api key not found")
+	ErrMemberNotFound      = errors.New("member not found")
+	ErrAlreadyMember       = errors.New("account is already a member")
+	ErrLastOwner           = errors.New("enterprise must keep at least one owner")
+	ErrStateNotFound       = errors.New("login state not found or expired")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrMappingNotFound     = errors.New("group mapping not found")
+	ErrMappingExists       = errors.New("group is already mapped")
+	ErrTokenInvalid        = errors.New("login token is invalid, expired or already used")
+	ErrEventFull           = errors.New("event is full")
+	ErrExportNotFound      = errors.New("export not found")
+	ErrEnterpriseNotFound  = errors.New("enterprise not found")
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrDeliveryNotFound    = errors.New("webhook delivery not found")
+	ErrEndpointNotFound    = errors.New("push subscription not found")
 )
 
+// pgCode возвращает код ошибки PostgreSQL или пустую строку, если ошибка пришла не от базы
+func pgCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// isUniqueViolation сообщает, что запрос нарушил ограничение уникальности
+func isUniqueViolation(err error) bool {
+	return pgCode(err) == "23505"
+}
+
+// isForeignKeyViolation сообщает, что запрос сослался на несуществующую запись
+func isForeignKeyViolation(err error) bool {
+	return pgCode(err) == "23503"
+}
+
+// Storage работает с базой через пул pgx. Обычные запросы идут через database/sql поверх
+// того же пула, пакеты запросов и COPY - напрямую через pgx
 type Storage struct {
-	DB *sql.DB
+	DB    *sql.DB
+	pool  *pgxpool.Pool
+	stmts *stmtCounter
+	// tx и sc не nil у хранилища, которое WithTx передает в свою функцию: транзакция и ее соединение
+	tx           *sql.Tx
+	sc           *sql.Conn
+	isolation    sql.IsolationLevel
+	txRetries    int
+	queryTimeout time.Duration
 }
 
 func New(c cfg.DatabaseCfg) (*Storage, error) {
 	const op = "storage.connection"
+	isolation, err := parseIsolation(c.Isolation)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
 	connstr := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable", c.User, c.Password, c.DBName, c.Host, c.Port)
-	db, err := sql.Open("postgres", connstr)
+	poolConf, err := pgxpool.ParseConfig(connstr)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %w", op, err)
+	}
+	if c.MaxOpenConns > 0 {
+		poolConf.MaxConns = int32(c.MaxOpenConns)
+	}
+	poolConf.MinIdleConns = int32(c.MinIdleConns)
+	// устаревший maxIdleConns держал соединения открытыми, ближе всего к нему нижняя граница пула
+	if c.MaxIdleConns > 0 {
+		poolConf.MinConns = min(int32(c.MaxIdleConns), poolConf.MaxConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		poolConf.MaxConnLifetime = c.ConnMaxLifetime
+	}
+	if c.ConnMaxIdleTime > 0 {
+		poolConf.MaxConnIdleTime = c.ConnMaxIdleTime
+	}
+	// pgx готовит запросы при первом выполнении и держит их в кэше каждого соединения
+	stmts := newStmtCounter(c.StmtCacheSize)
+	if c.StmtCacheSize > 0 {
+		poolConf.ConnConfig.StatementCacheCapacity = c.StmtCacheSize
+		poolConf.ConnConfig.Tracer = stmts
+		poolConf.BeforeClose = stmts.forget
+	} else {
+		poolConf.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConf)
 	if err != nil {
 		return nil, fmt.Errorf("%s : %w", op, err)
 	}
-	if err = db.Ping(); err != nil {
+	if err = pool.Ping(context.Background()); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("%s : %w", op, err)
 	}
+	// соединения database/sql берутся из пула pgx, поэтому его настройки действуют и здесь
+	db := stdlib.OpenDBFromPool(pool)
 	s := &Storage{
-		db,
+		DB:           db,
+		pool:         pool,
+		stmts:        stmts,
+		isolation:    isolation,
+		txRetries:    c.TxRetries,
+		queryTimeout: c.QueryTimeout,
 	}
 	return s, err
 }
 
+// Close закрывает пул соединений
+func (s *Storage) Close() error {
+	defer s.pool.Close()
+	return s.DB.Close()
+}
+
+// Pool возвращает пул pgx, например для метрик: через него идут и database/sql, и пакеты с COPY
+func (s *Storage) Pool() *pgxpool.Pool {
+	return s.pool
+}
+
+// PreparedStatements возвращает число выражений в кэшах подготовленных выражений всех соединений
+func (s *Storage) PreparedStatements() int {
+	return s.stmts.count()
+}
+
 func RunMigrations(db *sql.DB) error {
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	driver, err := pgxmigrate.WithInstance(db, &pgxmigrate.Config{})
 	if err != nil {
 		return fmt.Errorf("Error of migrate: %w", err)
 	}
 	m, err := migrate.NewWithDatabaseInstance(
 		migrationPath,
-		"postgres",
+		"pgx5",
 		driver,
 	)
 	if err != nil {
@@ -56,93 +182,257 @@ func RunMigrations(db *sql.DB) error {
 	return nil
 }
 
-func (s *Storage) EnterpriseRegister(name string) (int, error) {
+// EnterpriseRegister создает предприятие и делает аккаунт ownerID его владельцем
+func (s *Storage) EnterpriseRegister(ctx context.Context, name string, ownerID int) (int, error) {
 	const op = "storage.postgres.EnterpriseRegister"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	stmt, err := s.DB.Prepare("INSERT INTO enterprises (name) VALUES ($1) RETURNING id;")
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
 	var id int
-	err = stmt.QueryRow(name).Scan(&id)
+	err = tx.QueryRowContext(ctx, "INSERT INTO enterprises (name) VALUES ($1) RETURNING id;", name).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO enterprise_members (enterprise_id, account_id, role) VALUES ($1, $2, $3);",
+		id, ownerID, models.RoleOwner,
+	)
+	if isForeignKeyViolation(err) {
+		return 0, fmt.Errorf("%s: %w", op, ErrAccountNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditCreated(ctx, tx, "enterprises", auditRecord{EnterpriseID: id, Entity: entityEnterprise, EntityID: id})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err = auditMember(ctx, tx, auditCreate, id, ownerID, nil); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 	return id, nil
 }
 
-func (s *Storage) EventRegister(name, description string, enterprise_id int) (int, error) {
+// EventRegister создает событие. capacity - предел числа участников, 0 - без ограничения
+func (s *Storage) EventRegister(ctx context.Context, name, description string, enterprise_id, capacity int, schedule models.EventSchedule) (int, error) {
 	const op = "storage.postgres.EventRegister"
-	stmt, err := s.DB.Prepare("INSERT INTO events (name, enterprise_id, description) VALUES ($1, $2, $3) RETURNING id;")
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
 	var id int
-	err = stmt.QueryRow(name, enterprise_id, description).Scan(&id)
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO events (name, enterprise_id, description, capacity, starts_at, ends_at, timezone, location, join_url)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7, NULLIF($8, ''), NULLIF($9, '')) RETURNING id;`,
+		name, enterprise_id, description, capacity,
+		schedule.StartsAt, schedule.EndsAt, schedule.Timezone, schedule.Location, schedule.JoinURL).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditCreated(ctx, tx, "events", auditRecord{EnterpriseID: enterprise_id, EventID: id, Entity: entityEvent, EntityID: id})
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 	return id, nil
 }
 
-func (s *Storage) ParticipantRegister(event_id int, name string) (int, error) {
+// CheckCapacity блокирует событие до конца транзакции и возвращает ErrEventFull,
+// если участников уже столько, сколько позволяет его вместимость.
+// Имеет смысл только внутри WithTx вместе с последующей регистрацией
+func (s *Storage) CheckCapacity(ctx context.Context, eventID int) error {
+	const op = "storage.CheckCapacity"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var capacity sql.NullInt64
+	err := s.conn().QueryRowContext(ctx, "SELECT capacity FROM events WHERE id = $1 FOR UPDATE", eventID).Scan(&capacity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, ErrEventNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !capacity.Valid {
+		return nil
+	}
+
+	var registered int64
+	err = s.conn().QueryRowContext(ctx, "SELECT count(*) FROM participants WHERE event_id = $1", eventID).Scan(&registered)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if registered >= capacity.Int64 {
+		return fmt.Errorf("%s: %w", op, ErrEventFull)
+	}
+	return nil
+}
+
+// ParticipantRegister регистрирует участника события. email необязателен и нужен для входа по ссылке
+func (s *Storage) ParticipantRegister(ctx context.Context, event_id int, name, email string) (int, error) {
 	const op = "storage.postgres.EventRegister"
-	stmt, err := s.DB.Prepare("INSERT INTO participants (name, event_id) VALUES ($1, $2) RETURNING id;")
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
+
+	// FOR SHARE не мешает параллельным регистрациям, но ждет выдачи бана (см. isBanned)
+	var found bool
+	err = tx.QueryRowContext(ctx, "SELECT true FROM events WHERE id = $1 FOR SHARE", event_id).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, ErrEventNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	banned, err := isBanned(ctx, tx, event_id, name, email)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if banned {
+		return 0, fmt.Errorf("%s: %w", op, ErrParticipantBanned)
+	}
 
 	var id int
-	err = stmt.QueryRow(name, event_id).Scan(&id)
+	err = tx.QueryRowContext(ctx, "INSERT INTO participants (name, event_id, email) VALUES ($1, $2, NULLIF($3, '')) RETURNING id;",
+		name, event_id, email).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("%s: %w", op, ErrEmailTaken)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditCreated(ctx, tx, "participants", auditRecord{EventID: event_id, Entity: entityParticipant, EntityID: id})
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	if err = emit(ctx, tx, models.ParticipantRegistered, event_id, "participants", id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 	return id, nil
 }
 
-func (s *Storage) CreatePost(content string, event_id int) (int, error) {
+// CreatePost публикует пост. С notify участники события получат о нем push-уведомление
+func (s *Storage) CreatePost(ctx context.Context, content string, event_id int, notify bool) (int, error) {
 	const op = "storage.postgres.EventRegister"
-	stmt, err := s.DB.Prepare("INSERT INTO posts (content, event_id) VALUES ($1, $2) RETURNING id;")
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
 	var id int
-	err = stmt.QueryRow(content, event_id).Scan(&id)
+	err = tx.QueryRowContext(ctx, "INSERT INTO posts (content, event_id, notify) VALUES ($1, $2, $3) RETURNING id;", content, event_id, notify).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditCreated(ctx, tx, "posts", auditRecord{EventID: event_id, Entity: entityPost, EntityID: id})
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	if err = emit(ctx, tx, models.PostCreated, event_id, "posts", id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 	return id, nil
 }
 
-func (s *Storage) CreateComment(postID, participantID int, content string) (int, error) {
+// CreateComment сохраняет комментарий со статусом, который определила модерация.
+// Автор должен быть участником события поста, иначе санкции события его бы не касались
+func (s *Storage) CreateComment(ctx context.Context, postID, participantID int, content, status, reason string) (int, error) {
 	const op = "storage.postgres.CreateComment"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	stmt, err := s.DB.Prepare("INSERT INTO comments (post_id, participant_id, content) VALUES ($1, $2, $3) RETURNING id;")
+	kind, err := s.sanctionForPost(ctx, postID, participantID)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
+	switch kind {
+	case models.SanctionBan:
+		return 0, fmt.Errorf("%s: %w", op, ErrParticipantBanned)
+	case models.SanctionMute:
+		return 0, fmt.Errorf("%s: %w", op, ErrParticipantMuted)
+	}
 
-	var id int
-	err = stmt.QueryRow(postID, participantID, content).Scan(&id)
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback()
+
+	var id, eventID int
+	err = tx.QueryRowContext(ctx, `INSERT INTO comments (post_id, participant_id, content, status, moderation_reason, moderated_at)
+		SELECT $1::int, $2::int, $3::text, $4::text, NULLIF($5::text, ''), CASE WHEN $4::text = 'rejected' THEN now() END
+		WHERE EXISTS (SELECT 1 FROM posts p JOIN participants pa ON pa.event_id = p.event_id WHERE p.id = $1 AND pa.id = $2)
+		RETURNING id, (SELECT COALESCE(event_id, 0) FROM posts WHERE id = $1);`,
+		postID, participantID, content, status, reason,
+	).Scan(&id, &eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, ErrParticipantNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditCreated(ctx, tx, "comments", auditRecord{EventID: eventID, Entity: entityComment, EntityID: id})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err = emit(ctx, tx, models.CommentCreated, eventID, "comments", id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 	return id, nil
 }
 
-func (s *Storage) GetComments() ([]models.Comment, error) {
+func (s *Storage) GetComments(ctx context.Context) ([]models.Comment, error) {
 	const op = "storage.GetComments"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.DB.Query("SELECT id, post_id, participant_id, content, created_at FROM comments")
+	rows, err := s.conn().QueryContext(ctx, "SELECT id, post_id, participant_id, content, created_at FROM comments WHERE status = 'approved'")
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -165,10 +455,12 @@ func (s *Storage) GetComments() ([]models.Comment, error) {
 }
 
 // GetEnterprises возвращает все предприятия из базы данных
-func (s *Storage) GetEnterprises() ([]models.Enterprise, error) {
+func (s *Storage) GetEnterprises(ctx context.Context) ([]models.Enterprise, error) {
 	const op = "storage.GetEnterprises"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.DB.Query("SELECT id, name FROM enterprises")
+	rows, err := s.conn().QueryContext(ctx, "SELECT id, name FROM enterprises")
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -191,10 +483,12 @@ func (s *Storage) GetEnterprises() ([]models.Enterprise, error) {
 }
 
 // GetEvents возвращает все события из базы данных
-func (s *Storage) GetEvents() ([]models.Event, error) {
+func (s *Storage) GetEvents(ctx context.Context) ([]models.Event, error) {
 	const op = "storage.GetEvents"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.DB.Query("SELECT id, enterprise_id, name, description, created_at FROM events")
+	rows, err := s.conn().QueryContext(ctx, "SELECT "+eventColumns+" FROM events")
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -202,8 +496,8 @@ func (s *Storage) GetEvents() ([]models.Event, error) {
 
 	var events []models.Event
 	for rows.Next() {
-		var e models.Event
-		if err := rows.Scan(&e.ID, &e.EnterpriseID, &e.Name, &e.Description, &e.CreatedAt); err != nil {
+		e, err := scanEvent(rows)
+		if err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 		events = append(events, e)
@@ -217,10 +511,12 @@ func (s *Storage) GetEvents() ([]models.Event, error) {
 }
 
 // GetParticipants возвращает всех участников из базы данных
-func (s *Storage) GetParticipants() ([]models.Participant, error) {
+func (s *Storage) GetParticipants(ctx context.Context) ([]models.Participant, error) {
 	const op = "storage.GetParticipants"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.DB.Query("SELECT id, event_id, name FROM participants")
+	rows, err := s.conn().QueryContext(ctx, "SELECT id, event_id, name FROM participants")
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -242,28 +538,88 @@ func (s *Storage) GetParticipants() ([]models.Participant, error) {
 	return participants, nil
 }
 
-// GetPosts возвращает все посты из базы данных
-func (s *Storage) GetPosts() ([]models.Post, error) {
+// GetPosts возвращает все посты из базы данных. Посты, вложения, их копии и опросы
+// загружаются одним пакетом запросов
+func (s *Storage) GetPosts(ctx context.Context) ([]models.Post, error) {
 	const op = "storage.GetPosts"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	rows, err := s.DB.Query("SELECT id, event_id, content, created_at FROM posts")
-	if err != nil {
+	var posts []models.Post
+	var attachments []models.Attachment
+	variants := make(map[int][]models.AttachmentVariant)
+	polls := newPollLoader()
+
+	queries := []batchQuery{
+		{
+			query: "SELECT id, event_id, type, content, created_at FROM posts",
+			scan: func(rows rowScanner) error {
+				for rows.Next() {
+					var p models.Post
+					if err := rows.Scan(&p.ID, &p.EventID, &p.Type, &p.Content, &p.CreatedAt); err != nil {
+						return err
+					}
+					posts = append(posts, p)
+				}
+				return rows.Err()
+			},
+		},
+		attachmentsQuery(&attachments, ""),
+		variantsQuery(variants, ""),
+	}
+	if err := s.batch(ctx, append(queries, polls.queries("")...)...); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	defer rows.Close()
 
-	var posts []models.Post
-	for rows.Next() {
-		var p models.Post
-		if err := rows.Scan(&p.ID, &p.EventID, &p.Content, &p.CreatedAt); err != nil {
-			return nil, fmt.Errorf("%s: %w", op, err)
-		}
-		posts = append(posts, p)
+	byPost := make(map[int][]models.Attachment)
+	for _, a := range attachments {
+		a.Variants = variants[a.ID]
+		byPost[a.PostID] = append(byPost[a.PostID], a)
+	}
+	for i := range posts {
+		posts[i].Attachments = byPost[posts[i].ID]
+		posts[i].Poll = polls.polls[posts[i].ID]
 	}
 
-	if err = rows.Err(); err != nil {
+	return posts, nil
+}
+
+// GetEventPosts возвращает последние limit постов события, новые первыми, вместе с вложениями
+func (s *Storage) GetEventPosts(ctx context.Context, eventID, limit int) ([]models.Post, error) {
+	const op = "storage.GetEventPosts"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	const recent = "SELECT id FROM posts WHERE event_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2"
+	posts := []models.Post{}
+	var attachments []models.Attachment
+	err := s.batch(ctx,
+		batchQuery{
+			query: "SELECT id, event_id, type, content, created_at FROM posts WHERE id IN (" + recent + ") ORDER BY created_at DESC, id DESC",
+			args:  []any{eventID, limit},
+			scan: func(rows rowScanner) error {
+				for rows.Next() {
+					var p models.Post
+					if err := rows.Scan(&p.ID, &p.EventID, &p.Type, &p.Content, &p.CreatedAt); err != nil {
+						return err
+					}
+					posts = append(posts, p)
+				}
+				return rows.Err()
+			},
+		},
+		attachmentsQuery(&attachments, "WHERE post_id IN ("+recent+")", eventID, limit),
+	)
+	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	byPost := make(map[int][]models.Attachment)
+	for _, a := range attachments {
+		byPost[a.PostID] = append(byPost[a.PostID], a)
+	}
+	for i := range posts {
+		posts[i].Attachments = byPost[posts[i].ID]
+	}
 	return posts, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Repo - хранилище, привязанное к транзакции WithTx: все его методы выполняются в ней
+type Repo = *Storage
+
+// querier - общее у *sql.DB и *sql.Tx, через него методы работают вне транзакции и внутри нее
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// txn - транзакция одного метода. Внутри WithTx метод получает внешнюю транзакцию,
+// и его Commit и Rollback ничего не делают: итог решает WithTx.
+// sc - соединение транзакции, через него pgx выполняет COPY в той же транзакции
+type txn struct {
+	*sql.Tx
+	sc     *sql.Conn
+	nested bool
+}
+
+func (t *txn) Commit() error {
+	if t.nested {
+		return nil
+	}
+	defer t.sc.Close()
+	return t.Tx.Commit()
+}
+
+func (t *txn) Rollback() error {
+	if t.nested {
+		return nil
+	}
+	defer t.sc.Close()
+	return t.Tx.Rollback()
+}
+
+// pgx выполняет fn на соединении транзакции. Пока fn работает, запросы через database/sql ждут ее
+func (t *txn) pgx(fn func(conn *pgx.Conn) error) error {
+	return rawPgx(t.sc, fn)
+}
+
+// conn возвращает транзакцию WithTx или пул соединений вне ее
+func (s *Storage) conn() querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.DB
+}
+
+// withTimeout ограничивает время работы метода хранилища сроком из конфигурации,
+// чтобы зависший запрос не держал соединение дольше, чем ждет клиент
+func (s *Storage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// withPgx выполняет fn на соединении pgx: соединении транзакции WithTx или свободном соединении пула.
+// Через него идут пакеты запросов и COPY, которых нет в database/sql
+func (s *Storage) withPgx(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	if s.sc != nil {
+		return rawPgx(s.sc, fn)
+	}
+	return s.pool.AcquireFunc(ctx, func(c *pgxpool.Conn) error {
+		return fn(c.Conn())
+	})
+}
+
+func rawPgx(sc *sql.Conn, fn func(conn *pgx.Conn) error) error {
+	return sc.Raw(func(driverConn any) error {
+		return fn(driverConn.(*stdlib.Conn).Conn())
+	})
+}
+
+// beginConn берет соединение из пула и открывает на нем транзакцию
+func (s *Storage) beginConn(ctx context.Context, opts *sql.TxOptions) (*sql.Conn, *sql.Tx, error) {
+	sc, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := sc.BeginTx(ctx, opts)
+	if err != nil {
+		sc.Close()
+		return nil, nil, err
+	}
+	return sc, tx, nil
+}
+
+// begin открывает транзакцию метода или присоединяется к транзакции WithTx
+func (s *Storage) begin(ctx context.Context) (*txn, error) {
+	if s.tx != nil {
+		return &txn{Tx: s.tx, sc: s.sc, nested: true}, nil
+	}
+	sc, tx, err := s.beginConn(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &txn{Tx: tx, sc: sc}, nil
+}
+
+// WithTx выполняет fn в одной транзакции с уровнем изоляции из конфигурации.
+// Изменения фиксируются, только если fn вернула nil. При ошибке сериализации или
+// взаимной блокировке fn выполняется заново, поэтому вне базы она ничего менять не должна.
+// Вложенный вызов присоединяется к внешней транзакции
+func (s *Storage) WithTx(ctx context.Context, fn func(tx Repo) error) error {
+	return s.WithTxIsolation(ctx, s.isolation, fn)
+}
+
+// WithTxIsolation - WithTx с явным уровнем изоляции
+func (s *Storage) WithTxIsolation(ctx context.Context, level sql.IsolationLevel, fn func(tx Repo) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := s.runTx(ctx, level, fn)
+		if err == nil || !isRetryable(err) || attempt >= s.txRetries {
+			return err
+		}
+
+		// случайная пауза разводит конкурирующие транзакции
+		delay := time.Duration(attempt+1)*10*time.Millisecond + rand.N(10*time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (s *Storage) runTx(ctx context.Context, level sql.IsolationLevel, fn func(tx Repo) error) error {
+	const op = "storage.postgres.WithTx"
+
+	sc, tx, err := s.beginConn(ctx, &sql.TxOptions{Isolation: level})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer sc.Close()
+	defer tx.Rollback()
+
+	repo := *s
+	repo.tx, repo.sc = tx, sc
+	if err = fn(&repo); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// isRetryable сообщает, что транзакцию откатила база и ее можно повторить:
+// 40001 - ошибка сериализации, 40P01 - взаимная блокировка
+func isRetryable(err error) bool {
+	code := pgCode(err)
+	return code == "40001" || code == "40P01"
+}
+
+// parseIsolation переводит уровень изоляции из конфигурации в sql.IsolationLevel
+func parseIsolation(level string) (sql.IsolationLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "", "default":
+		return sql.LevelDefault, nil
+	case "read committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	}
+	return 0, fmt.Errorf("unknown isolation level %q", level)
+}
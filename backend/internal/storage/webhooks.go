@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"REST_project/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// event_types отдается как JSON: database/sql не умеет сканировать массивы Postgres
+const webhookColumns = "id, enterprise_id, url, to_jsonb(event_types), COALESCE(description, ''), active, created_at"
+
+const deliveryColumns = `d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts,
+	CASE WHEN d.status = 'pending' THEN d.next_attempt_at END, COALESCE(d.last_status, 0), COALESCE(d.last_error, ''),
+	d.created_at, d.delivered_at`
+
+// EnqueueWebhooks ставит доставки доменного события всем активным подпискам его предприятия.
+// Это подписчик outbox: при повторной обработке события доставки не дублируются
+func (s *Storage) EnqueueWebhooks(ctx context.Context, e models.DomainEvent) error {
+	const op = "storage.postgres.EnqueueWebhooks"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn().ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, domain_event_id, event_type, payload)
+		SELECT w.id, $1, $2, jsonb_build_object(
+			'type', $2::text,
+			'enterprise_id', $3::integer,
+			'event_id', NULLIF($4, 0),
+			'occurred_at', $5::timestamptz,
+			'data', $6::jsonb)
+		FROM webhooks w
+		WHERE w.enterprise_id = $3 AND w.active AND (cardinality(w.event_types) = 0 OR $2 = ANY(w.event_types))
+		ON CONFLICT (webhook_id, domain_event_id) DO NOTHING`,
+		e.ID, e.Type, e.EnterpriseID, e.EventID, e.CreatedAt, []byte(e.Payload),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// CreateWebhook создает подписку предприятия
+func (s *Storage) CreateWebhook(ctx context.Context, w models.Webhook) (models.Webhook, error) {
+	const op = "storage.postgres.CreateWebhook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	created, err := scanWebhook(tx.QueryRowContext(ctx, `
+		INSERT INTO webhooks (enterprise_id, url, secret, event_types, description, active)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6) RETURNING `+webhookColumns,
+		w.EnterpriseID, w.URL, w.Secret, w.EventTypes, w.Description, w.Active,
+	))
+	if isForeignKeyViolation(err) {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, ErrEnterpriseNotFound)
+	}
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditCreated(ctx, tx, "webhooks", auditRecord{EnterpriseID: w.EnterpriseID, Entity: entityWebhook, EntityID: created.ID})
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+	created.Secret = w.Secret
+	return created, nil
+}
+
+// GetWebhooks возвращает подписки предприятия без секретов
+func (s *Storage) GetWebhooks(ctx context.Context, enterpriseID int) ([]models.Webhook, error) {
+	const op = "storage.GetWebhooks"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE enterprise_id = $1 ORDER BY id", enterpriseID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook меняет адрес, фильтр типов, описание и активность подписки. Секрет не меняется
+func (s *Storage) UpdateWebhook(ctx context.Context, w models.Webhook) (models.Webhook, error) {
+	const op = "storage.postgres.UpdateWebhook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(ctx, tx, "webhooks", "t.id = $1 AND t.enterprise_id = $2 FOR UPDATE", w.ID, w.EnterpriseID)
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, ErrWebhookNotFound)
+	}
+
+	updated, err := scanWebhook(tx.QueryRowContext(ctx, `
+		UPDATE webhooks SET url = $2, event_types = $3, description = NULLIF($4, ''), active = $5
+		WHERE id = $1 RETURNING `+webhookColumns,
+		w.ID, w.URL, w.EventTypes, w.Description, w.Active,
+	))
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditUpdated(ctx, tx, "webhooks", auditRecord{EnterpriseID: w.EnterpriseID, Entity: entityWebhook, EntityID: w.ID, Before: before})
+	if err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Webhook{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return updated, nil
+}
+
+// DeleteWebhook удаляет подписку вместе с ее доставками
+func (s *Storage) DeleteWebhook(ctx context.Context, enterpriseID, webhookID int) error {
+	const op = "storage.postgres.DeleteWebhook"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var before []byte
+	err = tx.QueryRowContext(ctx,
+		"DELETE FROM webhooks t WHERE id = $1 AND enterprise_id = $2 RETURNING "+snapshotExpr+";",
+		webhookID, enterpriseID,
+	).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, ErrWebhookNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = writeAudit(ctx, tx, auditRecord{
+		EnterpriseID: enterpriseID,
+		Action:       auditDelete,
+		Entity:       entityWebhook,
+		EntityID:     webhookID,
+		Before:       before,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries возвращает журнал доставок подписки от новых к старым вместе с попытками.
+// status фильтрует по статусу доставки, пустая строка - все доставки
+func (s *Storage) GetWebhookDeliveries(ctx context.Context, enterpriseID, webhookID int, status string, limit int) ([]models.WebhookDelivery, error) {
+	const op = "storage.GetWebhookDeliveries"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := s.conn().QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = $1 AND enterprise_id = $2)", webhookID, enterpriseID,
+	).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", op, ErrWebhookNotFound)
+	}
+
+	const recent = `SELECT id FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2) ORDER BY id DESC LIMIT $3`
+	deliveries := []models.WebhookDelivery{}
+	attempts := make(map[int64][]models.WebhookAttempt)
+	err = s.batch(ctx,
+		batchQuery{
+			query: "SELECT " + deliveryColumns + " FROM webhook_deliveries d WHERE d.id IN (" + recent + ") ORDER BY d.id DESC",
+			args:  []any{webhookID, status, limit},
+			scan: func(rows rowScanner) error {
+				for rows.Next() {
+					d, err := scanDelivery(rows)
+					if err != nil {
+						return err
+					}
+					deliveries = append(deliveries, d)
+				}
+				return rows.Err()
+			},
+		},
+		batchQuery{
+			query: "SELECT delivery_id, COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, created_at FROM webhook_attempts WHERE delivery_id IN (" + recent + ") ORDER BY id",
+			args:  []any{webhookID, status, limit},
+			scan: func(rows rowScanner) error {
+				for rows.Next() {
+					var id int64
+					var a models.WebhookAttempt
+					if err := rows.Scan(&id, &a.StatusCode, &a.Error, &a.DurationMS, &a.CreatedAt); err != nil {
+						return err
+					}
+					attempts[id] = append(attempts[id], a)
+				}
+				return rows.Err()
+			},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for i := range deliveries {
+		deliveries[i].Log = attempts[deliveries[i].ID]
+	}
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery возвращает мертвую или доставленную доставку в очередь с новым запасом попыток
+func (s *Storage) RetryWebhookDelivery(ctx context.Context, enterpriseID, webhookID int, deliveryID int64) error {
+	const op = "storage.postgres.RetryWebhookDelivery"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(ctx, tx, "webhook_deliveries", `t.id = $1 AND t.webhook_id = $2
+		AND EXISTS (SELECT 1 FROM webhooks w WHERE w.id = t.webhook_id AND w.enterprise_id = $3) FOR UPDATE`,
+		deliveryID, webhookID, enterpriseID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if before == nil {
+		return fmt.Errorf("%s: %w", op, ErrDeliveryNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = now(), delivered_at = NULL WHERE id = $1",
+		deliveryID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = auditUpdated(ctx, tx, "webhook_deliveries",
+		auditRecord{EnterpriseID: enterpriseID, Entity: entityDelivery, EntityID: int(deliveryID), Before: before})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries забирает до limit доставок, срок которых подошел, и откладывает их на lease.
+// Если рассылка не запишет итог за это время (например, упадет), доставку заберет следующий проход.
+// SKIP LOCKED не дает двум копиям сервера забрать одну доставку
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	const op = "storage.postgres.ClaimWebhookDeliveries"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn().QueryContext(ctx, `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d SET next_attempt_at = now() + make_interval(secs => $2)
+		FROM due, webhooks w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING `+deliveryColumns+`, w.url, w.secret`,
+		limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		d, err := scanDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		d.URL, d.Secret = url, secret
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return deliveries, nil
+}
+
+// FinishWebhookAttempt записывает попытку доставки и новый статус: delivered, dead или pending
+// с повтором в retryAt
+func (s *Storage) FinishWebhookAttempt(ctx context.Context, deliveryID int64, a models.WebhookAttempt, status string, retryAt time.Time) error {
+	const op = "storage.postgres.FinishWebhookAttempt"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO webhook_attempts (delivery_id, status_code, error, duration_ms) VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4)",
+		deliveryID, a.StatusCode, a.Error, a.DurationMS)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var next *time.Time
+	if !retryAt.IsZero() {
+		next = &retryAt
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, last_status = NULLIF($3, 0), last_error = NULLIF($4, ''),
+			next_attempt_at = COALESCE($5, next_attempt_at),
+			delivered_at = CASE WHEN $2 = 'delivered' THEN now() END
+		WHERE id = $1`,
+		deliveryID, status, a.StatusCode, a.Error, next)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// PurgeWebhookDeliveries удаляет доставленные и мертвые доставки, созданные раньше before
+func (s *Storage) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int, error) {
+	const op = "storage.postgres.PurgeWebhookDeliveries"
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn().ExecContext(ctx,
+		"DELETE FROM webhook_deliveries WHERE status IN ('delivered', 'dead') AND created_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return int(n), nil
+}
+
+func scanWebhook(row interface{ Scan(dest ...any) error }) (models.Webhook, error) {
+	var w models.Webhook
+	var types []byte
+	err := row.Scan(&w.ID, &w.EnterpriseID, &w.URL, &types, &w.Description, &w.Active, &w.CreatedAt)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	if err = json.Unmarshal(types, &w.EventTypes); err != nil {
+		return models.Webhook{}, err
+	}
+	return w, nil
+}
+
+// scanDelivery сканирует столбцы deliveryColumns, за которыми идут столбцы extra
+func scanDelivery(row interface{ Scan(dest ...any) error }, extra ...any) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload []byte
+	var next, delivered sql.NullTime
+	dest := []any{&d.ID, &d.WebhookID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&next, &d.LastStatus, &d.LastError, &d.CreatedAt, &delivered}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	d.Payload = payload
+	if next.Valid {
+		d.NextAttemptAt = &next.Time
+	}
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return d, nil
+}
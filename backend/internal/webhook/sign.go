@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// secretPrefix отличает секрет вебхука от других ключей, формат как в Standard Webhooks
+const secretPrefix = "whsec_"
+
+// NewSecret создает секрет подписки: whsec_ и 32 случайных байта в base64
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretPrefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// Sign возвращает значение заголовка webhook-signature: v1,<base64 HMAC-SHA256>
+// от строки "id.timestamp.body". Получатель проверяет подпись тем же секретом
+func Sign(secret, id string, ts time.Time, body []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, secretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook secret: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + strconv.FormatInt(ts.Unix(), 10) + "."))
+	mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
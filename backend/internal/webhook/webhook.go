@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"REST_project/config"
+	"REST_project/internal/delivery"
+	model "REST_project/internal/models"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Store interface {
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	FinishWebhookAttempt(ctx context.Context, deliveryID int64, a model.WebhookAttempt, status string, retryAt time.Time) error
+	PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int, error)
+}
+
+// purgeInterval - как часто рассылка удаляет старые доставки
+const purgeInterval = time.Hour
+
+// maxError - предел длины ошибки попытки в журнале доставок
+const maxError = 500
+
+// Dispatcher отправляет доставки из очереди webhook_deliveries. Доставки создает подписчик
+// шины доменных событий, рассылка только забирает готовые строки и записывает итог попыток
+type Dispatcher struct {
+	log    *slog.Logger
+	store  Store
+	client *http.Client
+	c      config.WebhookCfg
+	queue  *delivery.Queue[model.WebhookDelivery]
+}
+
+func New(log *slog.Logger, store Store, c config.WebhookCfg) *Dispatcher {
+	if c.MaxAttempts < 1 {
+		c.MaxAttempts = 1
+	}
+
+	log = log.With(slog.String("component", "webhook"))
+	d := &Dispatcher{
+		log:    log,
+		store:  store,
+		client: delivery.NewClient(c.Timeout, c.Workers, c.AllowPrivate),
+		c:      c,
+	}
+	qc := delivery.Config{Workers: c.Workers, BatchSize: c.BatchSize, PollInterval: c.PollInterval}
+	if c.Retention > 0 {
+		qc.PurgeInterval = purgeInterval
+	}
+	// lease - на сколько откладывается забранная доставка, чтобы ее не взял следующий проход
+	lease := 2*c.Timeout + time.Minute
+	d.queue = delivery.NewQueue(log, qc,
+		func(ctx context.Context, limit int) ([]model.WebhookDelivery, error) {
+			return store.ClaimWebhookDeliveries(ctx, limit, lease)
+		},
+		d.deliver, d.purge,
+	)
+	return d
+}
+
+// Run рассылает доставки, пока не отменен ctx. Начатые отправки дописываются и после отмены,
+// Run возвращается, когда они закончатся
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.queue.Run(ctx)
+}
+
+// deliver делает одну попытку доставки и записывает ее итог
+func (d *Dispatcher) deliver(ctx context.Context, del model.WebhookDelivery) {
+	log := d.log.With(slog.Int64("delivery_id", del.ID), slog.Int("webhook_id", del.WebhookID))
+
+	attempt := d.send(ctx, del)
+	attempt.CreatedAt = time.Now()
+
+	status := model.DeliveryDelivered
+	var retryAt time.Time
+	switch {
+	case attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+	case del.Attempts+1 >= d.c.MaxAttempts:
+		status = model.DeliveryDead
+		log.Warn("webhook delivery is dead", slog.Int("attempts", del.Attempts+1), slog.String("error", attempt.Error))
+	default:
+		status = model.DeliveryPending
+		retryAt = time.Now().Add(delivery.Backoff(d.c.BackoffBase, d.c.BackoffMax, del.Attempts+1))
+	}
+
+	if err := d.store.FinishWebhookAttempt(ctx, del.ID, attempt, status, retryAt); err != nil {
+		log.Error("failed to save webhook attempt", slog.String("error", err.Error()))
+	}
+}
+
+// send отправляет доставку с заголовками Standard Webhooks. webhook-id не меняется между
+// повторами, по нему получатель отбрасывает дубли
+func (d *Dispatcher) send(ctx context.Context, del model.WebhookDelivery) model.WebhookAttempt {
+	var attempt model.WebhookAttempt
+	msgID := "msg_" + strconv.FormatInt(del.ID, 10)
+	now := time.Now()
+
+	signature, err := Sign(del.Secret, msgID, now, del.Payload)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "REST_project-webhooks")
+	req.Header.Set("webhook-id", msgID)
+	req.Header.Set("webhook-timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("webhook-signature", signature)
+
+	resp, err := d.client.Do(req)
+	attempt.DurationMS = int(time.Since(now).Milliseconds())
+	if err != nil {
+		attempt.Error = truncate(err.Error())
+		return attempt
+	}
+	defer delivery.Drain(resp)
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return attempt
+}
+
+func (d *Dispatcher) purge(ctx context.Context) {
+	n, err := d.store.PurgeWebhookDeliveries(ctx, time.Now().Add(-d.c.Retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			d.log.Error("failed to purge webhook deliveries", slog.String("error", err.Error()))
+		}
+		return
+	}
+	if n > 0 {
+		d.log.Info("old webhook deliveries purged", slog.Int("count", n))
+	}
+}
+
+func truncate(s string) string {
+	if len(s) > maxError {
+		// обрезка могла разорвать символ, а Postgres не примет такую строку
+		return strings.ToValidUTF8(s[:maxError], "")
+	}
+	return s
+}
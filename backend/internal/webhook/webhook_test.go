@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"REST_project/config"
+	"REST_project/internal/delivery"
+	model "REST_project/internal/models"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeStore - очередь доставок в памяти: повтор возвращает доставку в очередь, как ClaimWebhookDeliveries
+type fakeStore struct {
+	mu       sync.Mutex
+	queue    []model.WebhookDelivery
+	claimed  map[int64]model.WebhookDelivery
+	attempts []model.WebhookAttempt
+	statuses []string
+	retries  []time.Time
+}
+
+func (f *fakeStore) ClaimWebhookDeliveries(_ context.Context, limit int, _ time.Duration) ([]model.WebhookDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := min(limit, len(f.queue))
+	claimed := f.queue[:n:n]
+	f.queue = f.queue[n:]
+	if f.claimed == nil {
+		f.claimed = make(map[int64]model.WebhookDelivery)
+	}
+	for _, d := range claimed {
+		f.claimed[d.ID] = d
+	}
+	return claimed, nil
+}
+
+func (f *fakeStore) FinishWebhookAttempt(_ context.Context, deliveryID int64, a model.WebhookAttempt, status string, retryAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts = append(f.attempts, a)
+	f.statuses = append(f.statuses, status)
+	f.retries = append(f.retries, retryAt)
+	if status == model.DeliveryPending {
+		d := f.claimed[deliveryID]
+		d.Attempts++
+		f.queue = append(f.queue, d)
+	}
+	return nil
+}
+
+func (f *fakeStore) PurgeWebhookDeliveries(context.Context, time.Time) (int, error) {
+	return 0, nil
+}
+
+const testSecret = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+
+func testConfig() config.WebhookCfg {
+	return config.WebhookCfg{
+		Workers:      1,
+		BatchSize:    10,
+		Timeout:      5 * time.Second,
+		MaxAttempts:  3,
+		BackoffBase:  time.Second,
+		BackoffMax:   time.Minute,
+		AllowPrivate: true,
+	}
+}
+
+func discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// Пример из спецификации Standard Webhooks
+func TestSignKnownAnswer(t *testing.T) {
+	got, err := Sign(testSecret, "msg_p5jXN8AQM9LWM0D4loKWxJek", time.Unix(1614265330, 0), []byte(`{"test": 2432232314}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="
+	if got != want {
+		t.Fatalf("Sign() = %q, want %q", got, want)
+	}
+}
+
+func TestSignInvalidSecret(t *testing.T) {
+	if _, err := Sign("whsec_not base64!", "msg_1", time.Now(), nil); err == nil {
+		t.Fatal("Sign() with invalid secret: want error")
+	}
+}
+
+func TestDispatcherRetriesUntilDelivered(t *testing.T) {
+	var calls atomic.Int32
+	var mu sync.Mutex
+	var ids []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, err := strconv.ParseInt(r.Header.Get("webhook-timestamp"), 10, 64)
+		if err != nil {
+			t.Errorf("invalid webhook-timestamp %q", r.Header.Get("webhook-timestamp"))
+		}
+		want, _ := Sign(testSecret, r.Header.Get("webhook-id"), time.Unix(ts, 0), body)
+		if got := r.Header.Get("webhook-signature"); got != want {
+			t.Errorf("webhook-signature = %q, want %q", got, want)
+		}
+		mu.Lock()
+		ids = append(ids, r.Header.Get("webhook-id"))
+		mu.Unlock()
+
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	store := &fakeStore{queue: []model.WebhookDelivery{{
+		ID:      7,
+		Payload: []byte(`{"type":"post.created"}`),
+		URL:     srv.URL,
+		Secret:  testSecret,
+	}}}
+	d := New(discard(), store, testConfig())
+
+	d.queue.Dispatch(context.Background())
+	d.queue.Dispatch(context.Background())
+
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("receiver got %d requests, want 2", got)
+	}
+	if len(store.attempts) != 2 {
+		t.Fatalf("%d attempts recorded, want 2", len(store.attempts))
+	}
+	if store.attempts[0].StatusCode != http.StatusInternalServerError || store.statuses[0] != model.DeliveryPending {
+		t.Errorf("first attempt = %d %s, want 500 pending", store.attempts[0].StatusCode, store.statuses[0])
+	}
+	if store.retries[0].Before(time.Now()) {
+		t.Errorf("retry scheduled at %v, want in the future", store.retries[0])
+	}
+	if store.attempts[0].Error == "" {
+		t.Error("failed attempt has no error")
+	}
+	if store.attempts[1].StatusCode != http.StatusOK || store.statuses[1] != model.DeliveryDelivered {
+		t.Errorf("second attempt = %d %s, want 200 delivered", store.attempts[1].StatusCode, store.statuses[1])
+	}
+	if ids[0] != "msg_7" || ids[1] != ids[0] {
+		t.Errorf("webhook-id = %v, want msg_7 on every attempt", ids)
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := testConfig()
+	c.MaxAttempts = 2
+	store := &fakeStore{queue: []model.WebhookDelivery{{ID: 1, URL: srv.URL, Secret: testSecret}}}
+	d := New(discard(), store, c)
+
+	d.queue.Dispatch(context.Background())
+	d.queue.Dispatch(context.Background())
+	d.queue.Dispatch(context.Background())
+
+	want := []string{model.DeliveryPending, model.DeliveryDead}
+	if strings.Join(store.statuses, ",") != strings.Join(want, ",") {
+		t.Fatalf("statuses = %v, want %v", store.statuses, want)
+	}
+	if !store.retries[1].IsZero() {
+		t.Errorf("dead delivery scheduled for retry at %v", store.retries[1])
+	}
+}
+
+func TestDispatcherGuard(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+
+	c := testConfig()
+	c.AllowPrivate = false
+	store := &fakeStore{queue: []model.WebhookDelivery{{ID: 1, URL: srv.URL, Secret: testSecret}}}
+	New(discard(), store, c).queue.Dispatch(context.Background())
+
+	if calls.Load() != 0 {
+		t.Fatal("request to loopback address was sent")
+	}
+	if len(store.attempts) != 1 || !strings.Contains(store.attempts[0].Error, delivery.ErrForbiddenAddress.Error()) {
+		t.Fatalf("attempts = %+v, want one blocked by guard", store.attempts)
+	}
+}
@@ -0,0 +1,134 @@
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// recordSize - размер записи aes128gcm. Сообщение укладывается в одну запись,
+// push-сервисы принимают не больше 4096 байт
+const recordSize = 4096
+
+// headerLen - заголовок aes128gcm: salt, размер записи, длина ключа и сам ключ
+const headerLen = 16 + 4 + 1 + 65
+
+// MaxPayload - наибольшее сообщение, которое помещается в одну запись с тегом GCM и разделителем
+const MaxPayload = recordSize - headerLen - 16 - 1
+
+var errPayloadTooLarge = errors.New("push payload is too large")
+
+// Encrypt шифрует сообщение для браузера по RFC 8291 кодировкой aes128gcm (RFC 8188).
+// p256dh и auth - ключи подписки браузера в base64url
+func Encrypt(p256dh, auth string, payload []byte) ([]byte, error) {
+	// на каждое сообщение - новая пара ключей и salt, ключ шифрования не повторяется
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return encrypt(p256dh, auth, payload, asPrivate, salt)
+}
+
+// encrypt шифрует сообщение ключом сервера asPrivate с заданным salt
+func encrypt(p256dh, auth string, payload []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(payload) > MaxPayload {
+		return nil, errPayloadTooLarge
+	}
+	uaPublic, authSecret, err := decodeKeys(p256dh, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	prkKey, err := hkdf.Extract(sha256.New, ecdhSecret, authSecret)
+	if err != nil {
+		return nil, err
+	}
+	ikm, err := hkdf.Expand(sha256.New, prkKey, "WebPush: info\x00"+string(uaPublic.Bytes())+string(asPublic), 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, 0, headerLen+len(payload)+1+gcm.Overhead())
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+	// 0x02 - разделитель последней записи, дополнение не используется
+	plaintext := append(append(make([]byte, 0, len(payload)+1), payload...), 0x02)
+	return gcm.Seal(body, nonce, plaintext, nil), nil
+}
+
+// CheckSubscription проверяет подписку браузера: адрес push-сервиса и ключи шифрования.
+// Без allowInsecure адрес должен быть https
+func CheckSubscription(endpoint, p256dh, auth string, allowInsecure bool) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return errors.New("endpoint must be an absolute url")
+	}
+	if u.Scheme != "https" && !(allowInsecure && u.Scheme == "http") {
+		return errors.New("endpoint must use https")
+	}
+	if _, _, err = decodeKeys(p256dh, auth); err != nil {
+		return err
+	}
+	return nil
+}
+
+func decodeKeys(p256dh, auth string) (*ecdh.PublicKey, []byte, error) {
+	raw, err := decodeBase64(p256dh)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	public, err := ecdh.P256().NewPublicKey(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	secret, err := decodeBase64(auth)
+	if err != nil || len(secret) != 16 {
+		return nil, nil, errors.New("invalid auth secret: must be 16 bytes")
+	}
+	return public, secret, nil
+}
+
+// decodeBase64 принимает base64url с дополнением и без: браузеры отдают ключи по-разному
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
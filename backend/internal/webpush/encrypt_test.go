@@ -0,0 +1,58 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"testing"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Пример из RFC 8291, приложение A
+func TestEncryptRFC8291(t *testing.T) {
+	const (
+		plaintext = "V2hlbiBJIGdyb3cgdXAsIEkgd2FudCB0byBiZSBhIHdhdGVybWVsb24"
+		asPrivate = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+		asPublic  = "BP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A8"
+		uaPublic  = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+		salt      = "DGv6ra1nlYgDCS1FRnbzlw"
+		auth      = "BTBZMqHH6r4Tts7J_aSIgg"
+		want      = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	)
+
+	key, err := ecdh.P256().NewPrivateKey(mustDecode(t, asPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()); got != asPublic {
+		t.Fatalf("as_public = %s, want %s", got, asPublic)
+	}
+
+	body, err := encrypt(uaPublic, auth, mustDecode(t, plaintext), key, mustDecode(t, salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(body); got != want {
+		t.Fatalf("encrypt() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEncryptRejectsLargePayload(t *testing.T) {
+	const (
+		uaPublic = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+		auth     = "BTBZMqHH6r4Tts7J_aSIgg"
+	)
+	if _, err := Encrypt(uaPublic, auth, make([]byte, MaxPayload)); err != nil {
+		t.Fatalf("Encrypt() of %d bytes: %v", MaxPayload, err)
+	}
+	if _, err := Encrypt(uaPublic, auth, make([]byte, MaxPayload+1)); err == nil {
+		t.Fatalf("Encrypt() of %d bytes: want error", MaxPayload+1)
+	}
+}
@@ -0,0 +1,97 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+// vapidTTL - срок действия подписи VAPID, push-сервисы принимают не больше суток
+const vapidTTL = 12 * time.Hour
+
+// Keys - ключи сервера приложения (VAPID, RFC 8292). Браузер подписывается с открытым ключом
+// и принимает уведомления только с подписью закрытого
+type Keys struct {
+	private *ecdsa.PrivateKey
+	// public - открытый ключ в несжатом виде, 65 байт
+	public []byte
+}
+
+// NewKeys разбирает закрытый ключ P-256 в base64url, в том виде, в каком его выдают
+// генераторы ключей web-push. Без ключа создается случайный: подписки браузеров,
+// сделанные с ним, перестанут работать после перезапуска
+func NewKeys(log *slog.Logger, privateKey string) (*Keys, error) {
+	var key *ecdh.PrivateKey
+	var err error
+	if privateKey == "" {
+		log.Warn("vapid private key is not set, push subscriptions will break on restart")
+		key, err = ecdh.P256().GenerateKey(rand.Reader)
+	} else {
+		var d []byte
+		d, err = base64.RawURLEncoding.DecodeString(privateKey)
+		if err == nil {
+			key, err = ecdh.P256().NewPrivateKey(d)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid vapid private key: %w", err)
+	}
+
+	public := key.PublicKey().Bytes()
+	return &Keys{
+		private: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(public[1:33]),
+				Y:     new(big.Int).SetBytes(public[33:]),
+			},
+			D: new(big.Int).SetBytes(key.Bytes()),
+		},
+		public: public,
+	}, nil
+}
+
+// PublicKey возвращает открытый ключ в base64url: его браузер передает в applicationServerKey
+func (k *Keys) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.public)
+}
+
+// authorization возвращает заголовок Authorization для push-сервиса адреса endpoint:
+// vapid t=<JWT ES256>, k=<открытый ключ>
+func (k *Keys) authorization(endpoint, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub,omitempty"`
+	}{u.Scheme + "://" + u.Host, now.Add(vapidTTL).Unix(), subject})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// ES256 - r и s по 32 байта подряд, а не ASN.1
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return "vapid t=" + unsigned + "." + base64.RawURLEncoding.EncodeToString(sig) + ", k=" + k.PublicKey(), nil
+}
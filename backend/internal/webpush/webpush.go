@@ -0,0 +1,157 @@
+package webpush
+
+import (
+	"REST_project/config"
+	"REST_project/internal/delivery"
+	model "REST_project/internal/models"
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Store interface {
+	ClaimPushDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.PushDelivery, error)
+	FinishPushDelivery(ctx context.Context, deliveryID int64, retryAt time.Time) error
+	ExpirePushSubscription(ctx context.Context, subscriptionID int) error
+	PurgePush(ctx context.Context, before time.Time) (int, error)
+}
+
+// purgeInterval - как часто рассылка удаляет устаревшие уведомления и подписки
+const purgeInterval = time.Hour
+
+// Sender отправляет уведомления из очереди push_deliveries push-сервисам браузеров.
+// Уведомления ставит подписчик шины доменных событий, Sender только шифрует их и отправляет
+type Sender struct {
+	log    *slog.Logger
+	store  Store
+	keys   *Keys
+	client *http.Client
+	c      config.PushCfg
+	queue  *delivery.Queue[model.PushDelivery]
+}
+
+func New(log *slog.Logger, store Store, keys *Keys, c config.PushCfg) *Sender {
+	if c.MaxAttempts < 1 {
+		c.MaxAttempts = 1
+	}
+
+	log = log.With(slog.String("component", "webpush"))
+	s := &Sender{
+		log:   log,
+		store: store,
+		keys:  keys,
+		// адрес push-сервиса присылает клиент, он не должен вести во внутреннюю сеть
+		client: delivery.NewClient(c.Timeout, c.Workers, c.AllowPrivate),
+		c:      c,
+	}
+	// lease - на сколько откладывается забранное уведомление, чтобы его не взял следующий проход
+	lease := 2*c.Timeout + time.Minute
+	s.queue = delivery.NewQueue(log,
+		delivery.Config{Workers: c.Workers, BatchSize: c.BatchSize, PollInterval: c.PollInterval, PurgeInterval: purgeInterval},
+		func(ctx context.Context, limit int) ([]model.PushDelivery, error) {
+			return store.ClaimPushDeliveries(ctx, limit, lease)
+		},
+		s.deliver, s.purge,
+	)
+	return s
+}
+
+// Run рассылает уведомления, пока не отменен ctx. Начатые отправки дописываются и после отмены,
+// Run возвращается, когда они закончатся
+func (s *Sender) Run(ctx context.Context) {
+	s.queue.Run(ctx)
+}
+
+// deliver делает одну попытку отправки. Подписку, которой больше нет (404 и 410), удаляет вместе
+// с ее уведомлениями. Сетевые ошибки, 429 и 5xx повторяются, пока уведомление не старше TTL,
+// остальные отказы push-сервиса повтором не исправить
+func (s *Sender) deliver(ctx context.Context, d model.PushDelivery) {
+	log := s.log.With(slog.Int64("delivery_id", d.ID), slog.Int("subscription_id", d.SubscriptionID))
+
+	req, err := s.request(ctx, d)
+	if err != nil {
+		// уведомление, которое не удалось зашифровать или подписать, не исправится повтором
+		log.Error("failed to build push request", slog.String("error", err.Error()))
+		if err := s.store.FinishPushDelivery(ctx, d.ID, time.Time{}); err != nil {
+			log.Error("failed to finish push delivery", slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	status, err := s.send(req)
+	switch {
+	case err == nil && status >= 200 && status < 300:
+	case status == http.StatusNotFound || status == http.StatusGone:
+		log.Info("push subscription expired", slog.Int("status", status))
+		if err := s.store.ExpirePushSubscription(ctx, d.SubscriptionID); err != nil {
+			log.Error("failed to delete expired push subscription", slog.String("error", err.Error()))
+		}
+		return
+	case (status == 0 || status == http.StatusTooManyRequests || status >= 500) && d.Attempts+1 < s.c.MaxAttempts:
+		retryAt := time.Now().Add(delivery.Backoff(s.c.BackoffBase, s.c.BackoffMax, d.Attempts+1))
+		if retryAt.Before(d.CreatedAt.Add(s.c.TTL)) {
+			log.Warn("push delivery failed, will retry", slog.Int("status", status), slog.Any("error", err))
+			if err := s.store.FinishPushDelivery(ctx, d.ID, retryAt); err != nil {
+				log.Error("failed to reschedule push delivery", slog.String("error", err.Error()))
+			}
+			return
+		}
+		fallthrough
+	default:
+		log.Warn("push delivery dropped", slog.Int("status", status), slog.Any("error", err), slog.Int("attempts", d.Attempts+1))
+	}
+
+	if err := s.store.FinishPushDelivery(ctx, d.ID, time.Time{}); err != nil {
+		log.Error("failed to finish push delivery", slog.String("error", err.Error()))
+	}
+}
+
+// request шифрует уведомление и подписывает запрос к push-сервису
+func (s *Sender) request(ctx context.Context, d model.PushDelivery) (*http.Request, error) {
+	body, err := Encrypt(d.P256DH, d.Auth, d.Payload)
+	if err != nil {
+		return nil, err
+	}
+	authorization, err := s.keys.authorization(d.Endpoint, s.c.Subject, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// push-сервис хранит уведомление для выключенного устройства, пока оно еще актуально
+	ttl := max(s.c.TTL-time.Since(d.CreatedAt), 0)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", authorization)
+	return req, nil
+}
+
+// send отправляет запрос и возвращает код ответа, 0 - ответа не было
+func (s *Sender) send(req *http.Request) (int, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	delivery.Drain(resp)
+	return resp.StatusCode, nil
+}
+
+func (s *Sender) purge(ctx context.Context) {
+	n, err := s.store.PurgePush(ctx, time.Now().Add(-s.c.TTL))
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.Error("failed to purge push deliveries", slog.String("error", err.Error()))
+		}
+		return
+	}
+	if n > 0 {
+		s.log.Info("stale push deliveries purged", slog.Int("count", n))
+	}
+}
@@ -0,0 +1,134 @@
+package webpush
+
+import (
+	"REST_project/config"
+	model "REST_project/internal/models"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	mu       sync.Mutex
+	queue    []model.PushDelivery
+	finished map[int64]time.Time
+	expired  []int
+}
+
+func (f *fakeStore) ClaimPushDeliveries(_ context.Context, limit int, _ time.Duration) ([]model.PushDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := min(limit, len(f.queue))
+	claimed := f.queue[:n:n]
+	f.queue = f.queue[n:]
+	return claimed, nil
+}
+
+func (f *fakeStore) FinishPushDelivery(_ context.Context, deliveryID int64, retryAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.finished == nil {
+		f.finished = make(map[int64]time.Time)
+	}
+	f.finished[deliveryID] = retryAt
+	return nil
+}
+
+func (f *fakeStore) ExpirePushSubscription(_ context.Context, subscriptionID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expired = append(f.expired, subscriptionID)
+	return nil
+}
+
+func (f *fakeStore) PurgePush(context.Context, time.Time) (int, error) {
+	return 0, nil
+}
+
+func testSender(t *testing.T, store Store) *Sender {
+	t.Helper()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	keys, err := NewKeys(log, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(log, store, keys, config.PushCfg{
+		Subject:      "mailto:test@example.com",
+		Workers:      2,
+		BatchSize:    10,
+		Timeout:      5 * time.Second,
+		MaxAttempts:  3,
+		BackoffBase:  time.Second,
+		BackoffMax:   time.Minute,
+		TTL:          time.Hour,
+		AllowPrivate: true,
+	})
+}
+
+func testDelivery(id int64, subscriptionID int, endpoint string) model.PushDelivery {
+	return model.PushDelivery{
+		ID:             id,
+		SubscriptionID: subscriptionID,
+		Endpoint:       endpoint,
+		P256DH:         "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4",
+		Auth:           "BTBZMqHH6r4Tts7J_aSIgg",
+		Payload:        []byte(`{"title":"New announcement"}`),
+		CreatedAt:      time.Now(),
+	}
+}
+
+func TestSenderExpiresGoneSubscription(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "aes128gcm" {
+			t.Errorf("Content-Encoding = %q, want aes128gcm", r.Header.Get("Content-Encoding"))
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "vapid t=") {
+			t.Errorf("Authorization = %q, want vapid", r.Header.Get("Authorization"))
+		}
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	store := &fakeStore{queue: []model.PushDelivery{
+		testDelivery(1, 10, srv.URL+"/gone"),
+		testDelivery(2, 20, srv.URL+"/ok"),
+	}}
+	testSender(t, store).queue.Dispatch(context.Background())
+
+	if len(store.expired) != 1 || store.expired[0] != 10 {
+		t.Fatalf("expired subscriptions = %v, want [10]", store.expired)
+	}
+	if _, ok := store.finished[1]; ok {
+		t.Error("delivery to expired subscription was finished instead of removed with it")
+	}
+	if retryAt, ok := store.finished[2]; !ok || !retryAt.IsZero() {
+		t.Errorf("delivery 2 finished = %v %v, want done without retry", retryAt, ok)
+	}
+}
+
+func TestSenderRetriesServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	store := &fakeStore{queue: []model.PushDelivery{testDelivery(1, 10, srv.URL)}}
+	testSender(t, store).queue.Dispatch(context.Background())
+
+	if retryAt := store.finished[1]; !retryAt.After(time.Now()) {
+		t.Fatalf("retry scheduled at %v, want in the future", retryAt)
+	}
+	if len(store.expired) != 0 {
+		t.Fatalf("expired subscriptions = %v, want none", store.expired)
+	}
+}
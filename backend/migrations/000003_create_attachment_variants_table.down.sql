@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS attachment_variants;
+ALTER TABLE attachments DROP COLUMN IF EXISTS height;
+ALTER TABLE attachments DROP COLUMN IF EXISTS width;
@@ -0,0 +1,13 @@
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS width INTEGER;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS height INTEGER;
+
+CREATE TABLE IF NOT EXISTS attachment_variants (
+    id SERIAL PRIMARY KEY,
+    attachment_id INTEGER NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(512) NOT NULL UNIQUE,
+    UNIQUE (attachment_id, width)
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS poll_choices;
+DROP TABLE IF EXISTS poll_ballots;
+DROP TABLE IF EXISTS poll_options;
+DROP TABLE IF EXISTS polls;
+ALTER TABLE posts DROP COLUMN IF EXISTS type;
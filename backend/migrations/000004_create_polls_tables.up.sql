@@ -0,0 +1,37 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS type VARCHAR(16) NOT NULL DEFAULT 'text';
+
+CREATE TABLE IF NOT EXISTS polls (
+    post_id INTEGER PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+    multi_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id SERIAL PRIMARY KEY,
+    poll_id INTEGER NOT NULL REFERENCES polls(post_id) ON DELETE CASCADE,
+    content VARCHAR(255) NOT NULL,
+    position INTEGER NOT NULL,
+    UNIQUE (poll_id, position),
+    UNIQUE (id, poll_id)
+);
+
+-- один бюллетень на участника в каждом опросе
+CREATE TABLE IF NOT EXISTS poll_ballots (
+    id SERIAL PRIMARY KEY,
+    poll_id INTEGER NOT NULL REFERENCES polls(post_id) ON DELETE CASCADE,
+    participant_id INTEGER NOT NULL REFERENCES participants(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (poll_id, participant_id),
+    UNIQUE (id, poll_id)
+);
+
+-- составные внешние ключи не дают выбрать вариант из чужого опроса
+CREATE TABLE IF NOT EXISTS poll_choices (
+    ballot_id INTEGER NOT NULL,
+    option_id INTEGER NOT NULL,
+    poll_id INTEGER NOT NULL,
+    PRIMARY KEY (ballot_id, option_id),
+    FOREIGN KEY (ballot_id, poll_id) REFERENCES poll_ballots(id, poll_id) ON DELETE CASCADE,
+    FOREIGN KEY (option_id, poll_id) REFERENCES poll_options(id, poll_id) ON DELETE CASCADE
+);
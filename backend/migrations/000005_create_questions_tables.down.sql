@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS question_votes;
+DROP TABLE IF EXISTS questions;
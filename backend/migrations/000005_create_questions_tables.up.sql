@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS questions (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    participant_id INTEGER NOT NULL REFERENCES participants(id),
+    content TEXT NOT NULL,
+    anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'answered', 'hidden')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    answered_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS questions_event_id_idx ON questions(event_id);
+
+-- один голос участника за вопрос
+CREATE TABLE IF NOT EXISTS question_votes (
+    question_id INTEGER NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    participant_id INTEGER NOT NULL REFERENCES participants(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (question_id, participant_id)
+);
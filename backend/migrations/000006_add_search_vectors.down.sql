@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS comments_post_id_idx;
+DROP INDEX IF EXISTS posts_event_id_idx;
+DROP INDEX IF EXISTS comments_search_vector_idx;
+DROP INDEX IF EXISTS posts_search_vector_idx;
+ALTER TABLE comments DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE posts DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,11 @@
+-- конфигурация russian стеммит русские слова, а латиницу обрабатывает английским стеммером
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('russian', content)) STORED;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('russian', content)) STORED;
+
+CREATE INDEX IF NOT EXISTS posts_search_vector_idx ON posts USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS comments_search_vector_idx ON comments USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS posts_event_id_idx ON posts(event_id);
+CREATE INDEX IF NOT EXISTS comments_post_id_idx ON comments(post_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS comments_participant_created_idx;
+DROP INDEX IF EXISTS comments_pending_idx;
+ALTER TABLE comments DROP COLUMN IF EXISTS moderated_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS moderation_reason;
+ALTER TABLE comments DROP COLUMN IF EXISTS status;
+ALTER TABLE events DROP COLUMN IF EXISTS premoderation;
+DROP TABLE IF EXISTS moderation_rules;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS moderation_rules (
+    id SERIAL PRIMARY KEY,
+    enterprise_id INTEGER NOT NULL REFERENCES enterprises(id) ON DELETE CASCADE,
+    pattern VARCHAR(255) NOT NULL,
+    is_regex BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS moderation_rules_enterprise_id_idx ON moderation_rules(enterprise_id);
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS premoderation BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'approved'
+    CHECK (status IN ('pending', 'approved', 'rejected'));
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS moderation_reason TEXT;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS moderated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS comments_pending_idx ON comments(post_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS comments_participant_created_idx ON comments(participant_id, created_at);
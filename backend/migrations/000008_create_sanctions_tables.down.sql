@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS moderation_log;
+DROP TABLE IF EXISTS participant_sanctions;
+DROP TABLE IF EXISTS comment_reports;
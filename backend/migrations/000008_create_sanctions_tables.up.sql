@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS comment_reports (
+    id SERIAL PRIMARY KEY,
+    comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    reporter_id INTEGER NOT NULL REFERENCES participants(id),
+    reason TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (comment_id, reporter_id)
+);
+
+-- participant_name нужен для бана: повторная регистрация создает нового участника с тем же именем
+CREATE TABLE IF NOT EXISTS participant_sanctions (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    participant_id INTEGER NOT NULL REFERENCES participants(id),
+    participant_name VARCHAR(255) NOT NULL,
+    kind VARCHAR(8) NOT NULL CHECK (kind IN ('mute', 'ban')),
+    reason TEXT,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS participant_sanctions_participant_idx ON participant_sanctions(event_id, participant_id);
+CREATE INDEX IF NOT EXISTS participant_sanctions_name_idx ON participant_sanctions(event_id, lower(participant_name)) WHERE kind = 'ban';
+
+-- журнал действий модерации, только добавление
+CREATE TABLE IF NOT EXISTS moderation_log (
+    id BIGSERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    action VARCHAR(32) NOT NULL,
+    participant_id INTEGER,
+    comment_id INTEGER,
+    report_id INTEGER,
+    sanction_id INTEGER,
+    details TEXT,
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(255),
+    ip VARCHAR(64),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS moderation_log_event_id_idx ON moderation_log(event_id, id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS oidc_group_mappings;
+DROP TABLE IF EXISTS oidc_states;
+DROP TABLE IF EXISTS oidc_identities;
+ALTER TABLE enterprise_members DROP COLUMN IF EXISTS source;
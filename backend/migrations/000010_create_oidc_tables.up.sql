@@ -0,0 +1,41 @@
+-- откуда взялось членство: вручную через API или из групп провайдера OIDC.
+-- Синхронизация при входе трогает только членства из OIDC
+ALTER TABLE enterprise_members ADD COLUMN IF NOT EXISTS source VARCHAR(8) NOT NULL DEFAULT 'manual'
+    CHECK (source IN ('manual', 'oidc'));
+
+CREATE TABLE IF NOT EXISTS oidc_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (issuer, subject)
+);
+
+-- незавершенные входы: state из redirect, PKCE verifier и nonce для проверки id_token
+CREATE TABLE IF NOT EXISTS oidc_states (
+    state VARCHAR(64) PRIMARY KEY,
+    code_verifier VARCHAR(128) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS oidc_group_mappings (
+    id SERIAL PRIMARY KEY,
+    enterprise_id INTEGER NOT NULL REFERENCES enterprises(id) ON DELETE CASCADE,
+    group_name VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'organizer', 'moderator', 'viewer')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (enterprise_id, group_name)
+);
+
+CREATE INDEX IF NOT EXISTS oidc_group_mappings_group_name_idx ON oidc_group_mappings(group_name);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id SERIAL PRIMARY KEY,
+    account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
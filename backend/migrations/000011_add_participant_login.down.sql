@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS participant_sessions;
+DROP TABLE IF EXISTS participant_login_tokens;
+DROP INDEX IF EXISTS participants_event_email_idx;
+ALTER TABLE participants DROP COLUMN IF EXISTS email;
@@ -0,0 +1,22 @@
+ALTER TABLE participants ADD COLUMN IF NOT EXISTS email VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS participants_event_email_idx ON participants(event_id, lower(email)) WHERE email IS NOT NULL;
+
+-- одноразовые токены из писем со ссылкой для входа, храним только sha256
+CREATE TABLE IF NOT EXISTS participant_login_tokens (
+    id SERIAL PRIMARY KEY,
+    participant_id INTEGER NOT NULL REFERENCES participants(id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS participant_sessions (
+    id SERIAL PRIMARY KEY,
+    participant_id INTEGER NOT NULL REFERENCES participants(id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
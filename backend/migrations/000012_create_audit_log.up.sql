@@ -0,0 +1,28 @@
+-- журнал аудита всех изменяющих операций, только добавление.
+-- Внешних ключей нет намеренно: записи должны пережить удаление сущностей, о которых они рассказывают
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    enterprise_id INTEGER,
+    event_id INTEGER,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    entity VARCHAR(32) NOT NULL,
+    entity_id INTEGER,
+    before JSONB,
+    after JSONB,
+    request_id VARCHAR(255),
+    ip VARCHAR(64),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_enterprise_id_idx ON audit_log(enterprise_id, id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
@@ -0,0 +1,2 @@
+-- NULL - без ограничения числа участников
+ALTER TABLE events ADD COLUMN IF NOT EXISTS capacity INTEGER CHECK (capacity > 0);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS events_enterprise_starts_idx;
+
+ALTER TABLE events
+    DROP CONSTRAINT IF EXISTS events_schedule_check,
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS sequence,
+    DROP COLUMN IF EXISTS join_url,
+    DROP COLUMN IF EXISTS location,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS ends_at,
+    DROP COLUMN IF EXISTS starts_at;
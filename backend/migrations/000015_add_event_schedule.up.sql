@@ -0,0 +1,13 @@
+-- время проведения события, часовой пояс, место и ссылка для подключения.
+-- sequence растет с каждым изменением расписания, по нему календари узнают о переносе
+ALTER TABLE events
+    ADD COLUMN IF NOT EXISTS starts_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS ends_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC',
+    ADD COLUMN IF NOT EXISTS location TEXT,
+    ADD COLUMN IF NOT EXISTS join_url TEXT,
+    ADD COLUMN IF NOT EXISTS sequence INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    ADD CONSTRAINT events_schedule_check CHECK (ends_at IS NULL OR (starts_at IS NOT NULL AND ends_at >= starts_at));
+
+CREATE INDEX IF NOT EXISTS events_enterprise_starts_idx ON events (enterprise_id, starts_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS webhook_deliveries_domain_event_idx;
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS domain_event_id;
+DROP TABLE IF EXISTS event_cursors;
+DROP TABLE IF EXISTS domain_events;
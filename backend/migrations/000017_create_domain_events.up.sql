@@ -0,0 +1,28 @@
+-- outbox доменных событий: строка пишется в транзакции изменения, которое ее вызвало.
+-- txid - транзакция записи. Подписчики читают события по (txid, id) и только из завершенных
+-- транзакций, поэтому событие поздно закоммиченной транзакции не окажется позади курсора
+CREATE TABLE IF NOT EXISTS domain_events (
+    id BIGSERIAL PRIMARY KEY,
+    txid xid8 NOT NULL DEFAULT pg_current_xact_id(),
+    type TEXT NOT NULL,
+    enterprise_id INTEGER NOT NULL,
+    event_id INTEGER,
+    entity_id INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS domain_events_position_idx ON domain_events (txid, id);
+
+-- позиция каждого подписчика в outbox. locked_until - срок, на который подписчика забрал один из серверов
+CREATE TABLE IF NOT EXISTS event_cursors (
+    subscriber TEXT PRIMARY KEY,
+    last_txid xid8 NOT NULL DEFAULT '0',
+    last_id BIGINT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+-- доставки вебхуков теперь создает подписчик outbox, повторная обработка события не должна их дублировать
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS domain_event_id BIGINT;
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_deliveries_domain_event_idx ON webhook_deliveries (webhook_id, domain_event_id);
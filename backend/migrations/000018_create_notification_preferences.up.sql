@@ -0,0 +1,19 @@
+-- настройки писем участнику о новых постах события. last_post_id - последний пост, который
+-- уже попал в письмо или был опубликован до регистрации участника. От last_sent_at отсчитывается
+-- следующая сводка, claimed_until - срок, на который письмо забрал один из серверов
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    participant_id INTEGER PRIMARY KEY REFERENCES participants(id) ON DELETE CASCADE,
+    mode TEXT NOT NULL DEFAULT 'daily' CHECK (mode IN ('immediate', 'hourly', 'daily', 'off')),
+    last_post_id INTEGER NOT NULL DEFAULT 0,
+    last_sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    claimed_until TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS notification_preferences_due_idx ON notification_preferences (last_sent_at) WHERE mode <> 'off';
+
+-- уже зарегистрированные участники получают письма только о новых постах
+INSERT INTO notification_preferences (participant_id, last_post_id)
+SELECT p.id, COALESCE((SELECT max(po.id) FROM posts po WHERE po.event_id = p.event_id), 0)
+FROM participants p
+ON CONFLICT (participant_id) DO NOTHING;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS push_deliveries;
+DROP TABLE IF EXISTS push_subscriptions;
+ALTER TABLE posts DROP COLUMN IF EXISTS notify;
@@ -0,0 +1,30 @@
+-- notify - пост нужно разослать участникам push-уведомлением
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS notify BOOLEAN NOT NULL DEFAULT false;
+
+-- подписки браузеров участников на Web Push. Адрес выдает push-сервис браузера,
+-- p256dh и auth - ключи, которыми шифруется сообщение для этого браузера
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    id SERIAL PRIMARY KEY,
+    participant_id INTEGER NOT NULL REFERENCES participants(id) ON DELETE CASCADE,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh TEXT NOT NULL,
+    auth TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS push_subscriptions_participant_idx ON push_subscriptions (participant_id);
+
+-- очередь отправки. Отправленные строки удаляются, журнал попыток не ведется
+CREATE TABLE IF NOT EXISTS push_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES push_subscriptions(id) ON DELETE CASCADE,
+    domain_event_id BIGINT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS push_deliveries_event_idx ON push_deliveries (subscription_id, domain_event_id);
+CREATE INDEX IF NOT EXISTS push_deliveries_due_idx ON push_deliveries (next_attempt_at);
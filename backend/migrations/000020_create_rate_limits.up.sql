@@ -0,0 +1,11 @@
+-- корзины токенов ограничителя запросов, общие для всех серверов. Таблица без журнала:
+-- после сбоя базы счетчики просто начнутся заново. full_at - когда корзина снова наполнится,
+-- после этого строку можно удалить
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    full_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_full_at_idx ON rate_limits (full_at);
@@ -0,0 +1,6 @@
+-- email из /register/account вводится без подтверждения, вход через OIDC привязывается
+-- только к аккаунтам с подтвержденным email. Аккаунты, уже вошедшие через провайдера,
+-- получили email от него
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE accounts SET email_verified = TRUE WHERE id IN (SELECT account_id FROM oidc_identities);
@@ -0,0 +1,2 @@
+DELETE FROM domain_events WHERE enterprise_id IS NULL;
+ALTER TABLE domain_events ALTER COLUMN enterprise_id SET NOT NULL;
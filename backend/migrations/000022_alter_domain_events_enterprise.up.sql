@@ -0,0 +1,3 @@
+-- у события может не быть предприятия (events.enterprise_id допускает NULL),
+-- и его доменные события тоже пишутся без предприятия
+ALTER TABLE domain_events ALTER COLUMN enterprise_id DROP NOT NULL;
@@ -0,0 +1,16 @@
+-- события, которые подписчик не обработал за все попытки. Событие копируется целиком:
+-- domain_events со временем чистится, а разобрать и повторить его нужно и позже
+CREATE TABLE IF NOT EXISTS domain_event_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    subscriber TEXT NOT NULL,
+    domain_event_id BIGINT NOT NULL,
+    type TEXT NOT NULL,
+    enterprise_id INTEGER,
+    event_id INTEGER,
+    entity_id INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL,
+    error TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    UNIQUE (subscriber, domain_event_id)
+);